@@ -15,50 +15,2515 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/order/{order_uid}": {
+        "/admin/audit": {
             "get": {
-                "description": "Получить заказ по его уникальному идентификатору",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Кто (префикс API-ключа, bootstrap или anonymous для публичных эндпоинтов) читал или менял какой заказ: метод, маршрут, статус ответа, IP, X-Request-ID, время; от новых к старым",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "admin"
                 ],
-                "summary": "Get order by UID",
+                "summary": "Audit log of order access",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key prefix, bootstrap or anonymous",
+                        "name": "subject",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Order UID",
                         "name": "order_uid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditRecord"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/cache/stats": {
+            "get": {
+                "description": "Сколько раз чтение заказа ушло в PostgreSQL и заказ был заново записан в Redis (по шаблонам ключей и окнам времени)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Cache repopulation stats",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CacheStats"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/config/reload": {
+            "post": {
+                "description": "Перечитывает конфигурацию (флаги, переменные окружения, config.yaml) и применяет без перезапуска изменённые параметры кеша; остальные изменения перечисляются в restart_required. То же делает сигнал SIGHUP",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reload config",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ConfigReload"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/consumer/seek": {
+            "post": {
+                "description": "Переносит offsets группы консьюмеров на момент времени или на заданные offsets по партициям. Другие реплики консьюмера должны быть остановлены",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Replay messages from a timestamp or offsets",
+                "parameters": [
+                    {
+                        "description": "timestamp (RFC3339) or offsets per partition",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.seekRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/failed-messages": {
+            "get": {
+                "description": "Сообщения, которые не удалось обработать (таблица failed_messages), сначала последние",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List quarantined messages",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.FailedMessage"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/failed-messages/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get quarantined message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Failed message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailedMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет сообщение из карантина без повторной обработки",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Discard quarantined message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Failed message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/failed-messages/{id}/redrive": {
+            "post": {
+                "description": "Отправляет сообщение заново в топик, из которого оно было прочитано (с тем же ключом), и удаляет его из карантина; если обработка снова не удастся, сообщение вернётся в карантин новой записью",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Redrive quarantined message",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Failed message ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/models.Order"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/health/full": {
+            "get": {
+                "description": "Статус, время в текущем статусе и последняя ошибка каждого компонента (HTTP, consumer, PostgreSQL, Redis, outbox relay), общий статус и оценка 0-100. 503, если хотя бы один компонент недоступен",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Composite health of all subsystems",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List API keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.APIKey"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Секрет возвращается только в этом ответе, в базе хранится его хеш",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create API key",
+                "parameters": [
+                    {
+                        "description": "Key name",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.createKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}": {
+            "delete": {
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Revoke API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/rotate": {
+            "post": {
+                "description": "Отзывает ключ и возвращает новый с тем же именем",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Rotate API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIKey"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/orders": {
+            "post": {
+                "description": "Сохраняет заказ в обход Kafka (тело - сообщение заказа, в конверте {schema_version, produced_at, payload} или без него). Заказ проверяется теми же правилами, что и в консьюмере, включая JSON Schema сообщения и ограничения размера сообщения и числа товаров (413); при ошибке в details перечислены все недопустимые поля (field, tag, value, message)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create order",
+                "parameters": [
+                    {
+                        "description": "Order message",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/orders/{order_uid}": {
+            "get": {
+                "description": "Заказ из PostgreSQL в обход кеша; с include_deleted=true возвращаются и мягко удалённые заказы (с полем deleted_at)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get order including soft-deleted",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include soft-deleted orders",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Помечает заказ удалённым (deleted_at): данные сохраняются для аудита, но заказ больше не отдаётся чтением и страницей статуса",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Soft-delete order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/orders/{order_uid}/events": {
+            "get": {
+                "description": "Все события заказа из неизменяемого журнала order_event_log: полученные сообщения (включая дубликаты и замены) с исходным payload, версией его схемы (schema_version) и позицией в Kafka, удаления и восстановления",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Event log of order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.OrderLogEvent"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/orders/{order_uid}/restore": {
+            "post": {
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Restore soft-deleted order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhook-deliveries/{id}/retry": {
+            "post": {
+                "description": "Возвращает доставку, исчерпавшую попытки, в очередь с новым набором попыток",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Retry dead webhook delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List webhook subscriptions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookSubscription"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "События заказов (order_saved, order_updated; пустой event_types - все) отправляются POST-запросом на url с подписью X-Webhook-Signature (HMAC-SHA256 секретом подписки). Секрет возвращается только в этом ответе",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create webhook subscription",
+                "parameters": [
+                    {
+                        "description": "URL and event types",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.createWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}": {
+            "delete": {
+                "description": "Удаляет подписку вместе с её доставками",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Delete webhook subscription",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Доставки событий подписке от новых к старым: статус (pending, delivered, dead), число попыток, код и текст последней ошибки, время следующей попытки",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Deliveries of webhook subscription",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, delivered or dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/consumer/backlog": {
+            "get": {
+                "description": "Число сообщений топика, ещё не подтверждённых группой консьюмеров (по всем партициям), скорость подтверждения за последние замеры и оценка времени разбора очереди (null, пока группа ничего не подтверждает). Одинаково на всех репликах, обновляется раз в 15 секунд; 503, если замер не удался",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Backlog of the consumer group for autoscaling",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ConsumerBacklog"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/customers/{customer_id}/orders": {
+            "get": {
+                "description": "Заказы клиента от новых к старым с курсорной пагинацией: next_cursor из ответа передаётся в cursor следующего запроса. Последние redis.customer_orders_limit заказов хранятся в Redis и обновляются при сохранении заказов, более старые читаются из PostgreSQL",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Orders of a customer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Customer ID",
+                        "name": "customer_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/customers/{customer_id}/orders/stream": {
+            "get": {
+                "description": "Server-Sent Events: новые заказы клиента по мере их поступления из Kafka",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Stream new orders of a customer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Customer ID",
+                        "name": "customer_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz/consumer": {
+            "get": {
+                "description": "Время последнего полученного и подтверждённого сообщения, с какого момента обрабатывается текущее и с какого момента идут ошибки без успехов. 503, если сообщение обрабатывается или ошибки идут дольше health.consumer_stuck_after; ожидание сообщений пустого топика ошибкой не считается",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness of the consumer loop",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ConsumerProgress"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ConsumerProgress"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/search": {
+            "get": {
+                "description": "Товары бренда (brand, без учёта регистра) и/или артикула (nm_id) вместе с order_uid их заказов, от новых заказов к старым, - например, все заказы с брендом X. Нужен хотя бы один из параметров",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Item search by brand and product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Brand, e.g. Vivienne Sabo",
+                        "name": "brand",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product nm_id",
+                        "name": "nm_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ItemHit"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}": {
+            "get": {
+                "description": "Получить заказ по его уникальному идентификатору; заголовок X-Order-Source - откуда прочитан заказ: local, redis или db",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Get order by UID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderResponse"
+                        },
+                        "headers": {
+                            "X-Order-Source": {
+                                "type": "string",
+                                "description": "local, redis or db"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Проверка наличия заказа без передачи данных: 200, если заказ есть, 404 - если нет",
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Check order existence",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}/raw": {
+            "get": {
+                "description": "Исходное сообщение заказа в том виде, в котором его отправил producer (включая неизвестные поля), - для поиска расхождений с нормализованным представлением. Берётся из orders_raw (database.raw_orders), иначе из журнала order_event_log; заголовок X-Raw-Source - orders_raw или event_log. Хранится как отправлено, суммы старых версий схемы (X-Schema-Version) при чтении переводятся в минимальные единицы валюты",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Original payload of order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        },
+                        "headers": {
+                            "X-Raw-Source": {
+                                "type": "string",
+                                "description": "orders_raw or event_log"
+                            },
+                            "X-Schema-Version": {
+                                "type": "integer",
+                                "description": "schema version the payload was sent with"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}/receipt.pdf": {
+            "get": {
+                "description": "Чек заказа в PDF: покупатель, товары, итоговые суммы и оплата; язык чека - по полю locale заказа (en, ru; для остальных - английский)",
+                "produces": [
+                    "application/pdf"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order receipt in PDF",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}/tracking": {
+            "get": {
+                "description": "Статус доставки заказа у его службы доставки (по delivery_service и track_number) с историей перемещений; статус кешируется, запросы к службам ограничены по частоте. Заголовок X-Tracking-Source - cache или provider",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Shipment tracking of order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Shipment"
+                        },
+                        "headers": {
+                            "X-Tracking-Source": {
+                                "type": "string",
+                                "description": "cache or provider"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Заказы от новых к старым с курсорной пагинацией: next_cursor из ответа передаётся в cursor следующего запроса (с теми же фильтрами)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "List orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Customer ID",
+                        "name": "customer_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/count": {
+            "get": {
+                "description": "Количество заказов (без мягко удалённых) с теми же фильтрами, что у GET /orders",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Count orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Customer ID",
+                        "name": "customer_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/search": {
+            "get": {
+                "description": "Поиск заказов по словам из имени получателя, города, брендов и названий товаров; каждое слово ищется как префикс",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Full-text order search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search words, e.g. nike moscow",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.OrderSearchHit"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/stream": {
+            "get": {
+                "description": "Server-Sent Events: все новые заказы по мере их поступления из Kafka (событие order), ping раз в 15 секунд",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Stream new orders",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stats/customers/top": {
+            "get": {
+                "description": "Клиенты с наибольшим числом заказов (by=count) или суммой оплат (by=amount, только в одной валюте currency - суммы в разных валютах не складываются). Считается агрегирующим SQL; при stats.materialized - по материализованному представлению customer_stats, которое обновляется раз в stats.refresh_interval",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Top customers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "amount or count (default count)",
+                        "name": "by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency, required for by=amount",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of customers (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CustomerStats"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/stats/items/top": {
+            "get": {
+                "description": "Самые продаваемые товары (по nm_id) за окно from..to (по умолчанию - последние 7 дней) по количеству (by=quantity, каждая позиция заказа - одна единица) или выручке (by=revenue, сумма total_price только в одной валюте currency). Считается GROUP BY по таблице items",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Best-selling items",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "quantity or revenue (default quantity)",
+                        "name": "by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency, required for by=revenue",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Orders created at or after, RFC 3339 (default 7 days before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Orders created before, RFC 3339 (default now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ItemStats"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/stats/revenue": {
+            "get": {
+                "description": "Выручка (число заказов и сумма оплат) по периодам day, week или month (начало периода в UTC) и валютам, с group_by=currency,provider - ещё и по платёжным системам. Суммы в разных валютах не складываются, поэтому группировка по валюте есть всегда. Считается GROUP BY в PostgreSQL по таблице payments; from и to ограничивают дату создания заказов",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Revenue report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "currency or currency,provider (default currency)",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "day, week or month (default day)",
+                        "name": "period",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Orders created at or after, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Orders created before, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.RevenueRow"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/status/{token}": {
+            "get": {
+                "description": "Статус заказа по короткому токену (без персональных данных) для ссылок в уведомлениях клиентам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Public order status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Status token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderStatusView"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "rotated_to": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.AuditRecord": {
+            "type": "object",
+            "properties": {
+                "client_ip": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "subject": {
+                    "description": "Subject is the API key prefix, bootstrap for the admin key, anonymous on the public endpoints",
+                    "type": "string"
+                }
+            }
+        },
+        "models.CachePatternStats": {
+            "type": "object",
+            "properties": {
+                "db_fallbacks": {
+                    "type": "integer"
+                },
+                "repopulate_errors": {
+                    "type": "integer"
+                },
+                "repopulated": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CacheStats": {
+            "type": "object",
+            "properties": {
+                "since": {
+                    "type": "string"
+                },
+                "windows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CacheStatsWindow"
+                    }
+                }
+            }
+        },
+        "models.CacheStatsWindow": {
+            "type": "object",
+            "properties": {
+                "patterns": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.CachePatternStats"
+                    }
+                },
+                "window": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ComponentHealth": {
+            "type": "object",
+            "properties": {
+                "last_error": {
+                    "type": "string"
+                },
+                "last_error_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "since": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ConfigReload": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "restart_required": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.ConsumerBacklog": {
+            "type": "object",
+            "properties": {
+                "consume_rate": {
+                    "description": "messages committed per second",
+                    "type": "number"
+                },
+                "estimated_drain_seconds": {
+                    "type": "number"
+                },
+                "measured_at": {
+                    "type": "string"
+                },
+                "messages_behind": {
+                    "type": "integer"
+                },
+                "partitions": {
+                    "description": "the most consumer replicas that get work",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ConsumerProgress": {
+            "type": "object",
+            "properties": {
+                "busy_since": {
+                    "type": "string"
+                },
+                "failing_since": {
+                    "type": "string"
+                },
+                "last_commit_at": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_fetch_at": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CustomerStats": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "customer_id": {
+                    "type": "string"
+                },
+                "last_order_at": {
+                    "type": "string"
+                },
+                "orders": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Delivery": {
+            "type": "object",
+            "required": [
+                "address",
+                "city",
+                "name",
+                "region"
+            ],
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "zip": {
+                    "type": "string",
+                    "maxLength": 20,
+                    "minLength": 5
+                }
+            }
+        },
+        "models.FailedMessage": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "auto_retries": {
+                    "description": "AutoRetries is the number of automatic redrives of the message so far",
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "first_failed_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_failed_at": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "partition": {
+                    "type": "integer"
+                },
+                "payload": {
+                    "type": "string"
+                },
+                "topic": {
+                    "type": "string"
+                },
+                "transient": {
+                    "description": "Transient failures (storage errors) are redriven automatically, see DLQRetryCfg",
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.HealthReport": {
+            "type": "object",
+            "properties": {
+                "components": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ComponentHealth"
+                    }
+                },
+                "score": {
+                    "description": "0-100, mean of component scores",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "uptime": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Item": {
+            "type": "object",
+            "required": [
+                "brand",
+                "name",
+                "rid",
+                "size"
+            ],
+            "properties": {
+                "brand": {
+                    "type": "string"
+                },
+                "chrt_id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nm_id": {
+                    "type": "integer"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "rid": {
+                    "type": "string"
+                },
+                "sale": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 0
+                },
+                "size": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "total_price": {
+                    "type": "integer"
+                },
+                "track_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ItemHit": {
+            "type": "object",
+            "required": [
+                "brand",
+                "name",
+                "rid",
+                "size"
+            ],
+            "properties": {
+                "brand": {
+                    "type": "string"
+                },
+                "chrt_id": {
+                    "type": "integer"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nm_id": {
+                    "type": "integer"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "rid": {
+                    "type": "string"
+                },
+                "sale": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 0
+                },
+                "size": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "total_price": {
+                    "type": "integer"
+                },
+                "track_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ItemStats": {
+            "type": "object",
+            "properties": {
+                "brand": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nm_id": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "$ref": "#/definitions/models.Money"
+                }
+            }
+        },
+        "models.ItemStatusView": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.MessageOffset": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "partition": {
+                    "type": "integer"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Money": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "currency": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Order": {
+            "type": "object",
+            "required": [
+                "customer_id",
+                "date_created",
+                "delivery_service",
+                "entry",
+                "oof_shard",
+                "order_uid",
+                "shardkey"
+            ],
+            "properties": {
+                "customer_id": {
+                    "type": "string"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "description": "DeletedAt is set by the storage for soft-deleted orders (admin reads only), ignored on ingestion",
+                    "type": "string"
+                },
+                "delivery": {
+                    "$ref": "#/definitions/models.Delivery"
+                },
+                "delivery_service": {
+                    "type": "string"
+                },
+                "entry": {
+                    "type": "string"
+                },
+                "internal_signature": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/models.Item"
+                    }
+                },
+                "locale": {
+                    "type": "string"
+                },
+                "oof_shard": {
+                    "type": "string"
+                },
+                "order_uid": {
+                    "type": "string",
+                    "maxLength": 50,
+                    "minLength": 10
+                },
+                "payment": {
+                    "$ref": "#/definitions/models.Payment"
+                },
+                "shardkey": {
+                    "type": "string"
+                },
+                "sm_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "track_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.OrderLogEvent": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "received_at": {
+                    "type": "string"
+                },
+                "schema_version": {
+                    "type": "integer"
+                },
+                "source": {
+                    "$ref": "#/definitions/models.MessageOffset"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.OrderPage": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "orders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.OrderSummary"
+                    }
+                }
+            }
+        },
+        "models.OrderSearchHit": {
+            "type": "object",
+            "properties": {
+                "city": {
+                    "type": "string"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.OrderStatusView": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "minor units of Currency",
+                    "type": "integer"
+                },
+                "amount_formatted": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "delivery_service": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ItemStatusView"
                     }
+                },
+                "track_number": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Delivery": {
+        },
+        "models.OrderSummary": {
+            "type": "object",
+            "properties": {
+                "customer_id": {
+                    "type": "string"
+                },
+                "date_created": {
+                    "type": "string"
+                },
+                "delivery_service": {
+                    "type": "string"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "track_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Payment": {
+            "type": "object",
+            "required": [
+                "bank",
+                "transaction"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "bank": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "custom_fee": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "delivery_cost": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "goods_total": {
+                    "type": "integer"
+                },
+                "payment_dt": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "transaction": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RevenueRow": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "orders": {
+                    "type": "integer"
+                },
+                "period": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Shipment": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "Events are the tracking history, oldest first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ShipmentEvent"
+                    }
+                },
+                "fetched_at": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "track_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ShipmentEvent": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "integer"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.WebhookSubscription": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "event_types": {
+                    "description": "EventTypes limits the delivered events by type (all types if empty)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "URL receives POST requests with the events",
+                    "type": "string"
+                }
+            }
+        },
+        "service.DeliveryResponse": {
             "type": "object",
             "properties": {
                 "address": {
@@ -84,7 +2549,7 @@ const docTemplate = `{
                 }
             }
         },
-        "models.Item": {
+        "service.ItemResponse": {
             "type": "object",
             "properties": {
                 "brand": {
@@ -102,6 +2567,9 @@ const docTemplate = `{
                 "price": {
                     "type": "integer"
                 },
+                "price_formatted": {
+                    "type": "string"
+                },
                 "rid": {
                     "type": "string"
                 },
@@ -117,12 +2585,15 @@ const docTemplate = `{
                 "total_price": {
                     "type": "integer"
                 },
+                "total_price_formatted": {
+                    "type": "string"
+                },
                 "track_number": {
                     "type": "string"
                 }
             }
         },
-        "models.Order": {
+        "service.OrderResponse": {
             "type": "object",
             "properties": {
                 "customer_id": {
@@ -131,8 +2602,12 @@ const docTemplate = `{
                 "date_created": {
                     "type": "string"
                 },
+                "deleted_at": {
+                    "description": "DeletedAt is set for soft-deleted orders, returned by the admin reads only",
+                    "type": "string"
+                },
                 "delivery": {
-                    "$ref": "#/definitions/models.Delivery"
+                    "$ref": "#/definitions/service.DeliveryResponse"
                 },
                 "delivery_service": {
                     "type": "string"
@@ -140,13 +2615,10 @@ const docTemplate = `{
                 "entry": {
                     "type": "string"
                 },
-                "internal_signature": {
-                    "type": "string"
-                },
                 "items": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/models.Item"
+                        "$ref": "#/definitions/service.ItemResponse"
                     }
                 },
                 "locale": {
@@ -159,7 +2631,7 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "payment": {
-                    "$ref": "#/definitions/models.Payment"
+                    "$ref": "#/definitions/service.PaymentResponse"
                 },
                 "shardkey": {
                     "type": "string"
@@ -172,12 +2644,15 @@ const docTemplate = `{
                 }
             }
         },
-        "models.Payment": {
+        "service.PaymentResponse": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "integer"
                 },
+                "amount_formatted": {
+                    "type": "string"
+                },
                 "bank": {
                     "type": "string"
                 },
@@ -187,12 +2662,21 @@ const docTemplate = `{
                 "custom_fee": {
                     "type": "integer"
                 },
+                "custom_fee_formatted": {
+                    "type": "string"
+                },
                 "delivery_cost": {
                     "type": "integer"
                 },
+                "delivery_cost_formatted": {
+                    "type": "string"
+                },
                 "goods_total": {
                     "type": "integer"
                 },
+                "goods_total_formatted": {
+                    "type": "string"
+                },
                 "payment_dt": {
                     "type": "integer"
                 },
@@ -206,6 +2690,48 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "service.createKeyRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.createWebhookRequest": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.seekRequest": {
+            "type": "object",
+            "properties": {
+                "offsets": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// retryQueueSize bounds failed batches waiting for a retry; overflow goes straight to the spool
+	retryQueueSize = 1024
+	retryBackoff   = time.Second
+)
+
+// messageWriter is the part of *kafka.Writer used to retry and replay messages
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// deliveries handles the completion of async writes: failed messages are retried with a synchronous
+// writer and, if they still fail, appended to a spool file in the NDJSON format accepted by -file
+type deliveries struct {
+	retries  chan []kafka.Message
+	writer   messageWriter
+	attempts int
+	backoff  time.Duration // grows linearly with the attempt
+	done     chan struct{}
+
+	spoolMu sync.Mutex
+	spool   *os.File
+	spoolW  *bufio.Writer
+
+	delivered atomic.Int64
+	retried   atomic.Int64
+	spooled   atomic.Int64
+	lost      atomic.Int64
+}
+
+// newDeliveries starts the retry loop; spoolPath may be empty, then messages failing all retries are lost
+func newDeliveries(opts options, attempts int, spoolPath string) (*deliveries, error) {
+	return startDeliveries(&kafka.Writer{
+		Addr:         kafka.TCP(opts.broker),
+		Topic:        opts.topic,
+		Balancer:     opts.keyBy.balancer(),
+		Compression:  opts.compression,
+		MaxAttempts:  1,
+		WriteTimeout: 10 * time.Second,
+		BatchTimeout: 5 * time.Millisecond,
+	}, attempts, spoolPath)
+}
+
+func startDeliveries(writer messageWriter, attempts int, spoolPath string) (*deliveries, error) {
+	d := &deliveries{
+		retries:  make(chan []kafka.Message, retryQueueSize),
+		writer:   writer,
+		attempts: attempts,
+		backoff:  retryBackoff,
+		done:     make(chan struct{}),
+	}
+	if spoolPath != "" {
+		f, err := os.OpenFile(spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("can't open spool file: %v", err)
+		}
+		d.spool, d.spoolW = f, bufio.NewWriter(f)
+	}
+	go d.retryLoop()
+	return d, nil
+}
+
+// completion is the kafka.Writer Completion callback, called once per async batch
+func (d *deliveries) completion(messages []kafka.Message, err error) {
+	if err == nil {
+		d.delivered.Add(int64(len(messages)))
+		return
+	}
+	log.Printf("Delivery of %d messages failed: %v", len(messages), err)
+	select {
+	case d.retries <- messages:
+	default:
+		d.spoolMessages(messages, "retry queue is full")
+	}
+}
+
+// rejected takes messages that WriteMessages refused before batching (e.g. no partitions metadata):
+// the Completion callback is never called for them
+func (d *deliveries) rejected(messages []kafka.Message, err error) {
+	var werr kafka.WriteErrors
+	if errors.As(err, &werr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		// batched already, the completion reports the outcome
+		return
+	}
+	d.completion(messages, err)
+}
+
+func (d *deliveries) retryLoop() {
+	defer close(d.done)
+	for messages := range d.retries {
+		var err error
+		for attempt := 1; attempt <= d.attempts; attempt++ {
+			time.Sleep(d.backoff * time.Duration(attempt))
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			err = d.writer.WriteMessages(ctx, messages...)
+			cancel()
+			if err == nil {
+				d.retried.Add(int64(len(messages)))
+				log.Printf("Redelivered %d messages on attempt %d", len(messages), attempt)
+				break
+			}
+		}
+		if err != nil {
+			d.spoolMessages(messages, err.Error())
+		}
+	}
+}
+
+func (d *deliveries) spoolMessages(messages []kafka.Message, reason string) {
+	if d.spool == nil {
+		d.lost.Add(int64(len(messages)))
+		log.Printf("Lost %d messages (%s), set -spool to keep them", len(messages), reason)
+		return
+	}
+	d.spoolMu.Lock()
+	defer d.spoolMu.Unlock()
+	for _, m := range messages {
+		// generated payloads are single-line JSON, so every message is one replayable line
+		_, err := d.spoolW.Write(m.Value)
+		if err == nil {
+			err = d.spoolW.WriteByte('\n')
+		}
+		if err != nil {
+			d.lost.Add(1)
+			log.Printf("failed to spool message %s: %v", m.Key, err)
+			continue
+		}
+		d.spooled.Add(1)
+	}
+	if err := d.spoolW.Flush(); err != nil {
+		log.Printf("failed to flush spool file: %v", err)
+	}
+	log.Printf("Spooled %d messages to %s (%s)", len(messages), d.spool.Name(), reason)
+}
+
+// close waits for pending retries; the async writer must be closed first so no completion is still running
+func (d *deliveries) close() {
+	close(d.retries)
+	<-d.done
+	if err := d.writer.Close(); err != nil {
+		log.Printf("failed to close retry writer: %v", err)
+	}
+	if d.spool != nil {
+		if err := d.spool.Close(); err != nil {
+			log.Printf("failed to close spool file: %v", err)
+		}
+	}
+	fmt.Printf("Deliveries: delivered=%d redelivered=%d spooled=%d lost=%d\n",
+		d.delivered.Load(), d.retried.Load(), d.spooled.Load(), d.lost.Load())
+}
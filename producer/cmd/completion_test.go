@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+// stubWriter fails the first fails writes
+type stubWriter struct {
+	mu       sync.Mutex
+	fails    int
+	writes   int
+	messages []kafka.Message
+}
+
+func (w *stubWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	if w.writes <= w.fails {
+		return errors.New("connection refused")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *stubWriter) Close() error { return nil }
+
+func testMessages() []kafka.Message {
+	return []kafka.Message{
+		{Key: []byte("uid1"), Value: []byte(`{"order_uid":"uid1","customer_id":"c1"}`)},
+		{Key: []byte("uid2"), Value: []byte(`{"schema_version":2,"payload":{"order_uid":"uid2","customer_id":"c2"}}`)},
+	}
+}
+
+func TestDeliveriesRetry(t *testing.T) {
+	w := &stubWriter{fails: 1}
+	d, err := startDeliveries(w, 3, "")
+	require.NoError(t, err)
+	d.backoff = time.Millisecond
+
+	d.completion(testMessages()[:1], nil)
+	// the failed batch is written again on the second attempt
+	d.completion(testMessages(), errors.New("leader not available"))
+	d.close()
+	require.Equal(t, int64(1), d.delivered.Load())
+	require.Equal(t, int64(2), d.retried.Load())
+	require.Zero(t, d.lost.Load())
+	require.Equal(t, 2, w.writes)
+	require.Len(t, w.messages, 2)
+}
+
+func TestDeliveriesSpoolReplay(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool.ndjson")
+	w := &stubWriter{fails: 100}
+	d, err := startDeliveries(w, 2, spool)
+	require.NoError(t, err)
+	d.backoff = time.Millisecond
+
+	// all the retries fail, the messages go to the spool
+	d.completion(testMessages(), errors.New("leader not available"))
+	d.close()
+	require.Equal(t, 2, w.writes)
+	require.Equal(t, int64(2), d.spooled.Load())
+	require.Zero(t, d.retried.Load())
+
+	data, err := os.ReadFile(spool)
+	require.NoError(t, err)
+	require.Equal(t, string(testMessages()[0].Value)+"\n"+string(testMessages()[1].Value)+"\n", string(data))
+
+	// the spool is replayed with -file, the keys are taken from the payloads, bare or in the envelope
+	f, err := os.Open(spool)
+	require.NoError(t, err)
+	defer f.Close()
+	replayed := &stubWriter{}
+	sent, err := replay(context.Background(), f, replayed, options{rate: 1000, keyBy: keyByOrderUID})
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+	for i, m := range testMessages() {
+		require.Equal(t, m.Key, replayed.messages[i].Key)
+		require.Equal(t, m.Value, replayed.messages[i].Value)
+	}
+}
+
+func TestDeliveriesLost(t *testing.T) {
+	// without -spool the messages failing all retries are lost
+	d, err := startDeliveries(&stubWriter{fails: 100}, 1, "")
+	require.NoError(t, err)
+	d.backoff = time.Millisecond
+	d.completion(testMessages(), errors.New("leader not available"))
+	d.close()
+	require.Equal(t, int64(2), d.lost.Load())
+
+	// a full retry queue spools at once
+	spool := filepath.Join(t.TempDir(), "spool.ndjson")
+	d, err = startDeliveries(&stubWriter{}, 1, spool)
+	require.NoError(t, err)
+	full := &deliveries{retries: make(chan []kafka.Message), spool: d.spool, spoolW: d.spoolW}
+	full.completion(testMessages(), errors.New("leader not available"))
+	require.Equal(t, int64(2), full.spooled.Load())
+	d.close()
+	data, err := os.ReadFile(spool)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestDeliveriesRejected(t *testing.T) {
+	w := &stubWriter{}
+	d, err := startDeliveries(w, 1, "")
+	require.NoError(t, err)
+	d.backoff = time.Millisecond
+
+	// batched messages are reported by the completion, not retried twice
+	d.rejected(testMessages(), kafka.WriteErrors{errors.New("message too large")})
+	d.rejected(testMessages(), context.DeadlineExceeded)
+	// refused before batching: the completion never runs, so they are retried here
+	d.rejected(testMessages()[:1], errors.New("no partitions for topic"))
+	d.close()
+	require.Equal(t, 1, w.writes)
+	require.Equal(t, int64(1), d.retried.Load())
+	require.Zero(t, d.lost.Load())
+}
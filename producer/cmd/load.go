@@ -0,0 +1,133 @@
+package main
+
+import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/producer/stats"
+	"WB_LVL0/server/tracing"
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// pacerResolution is the finest tick of the pacer; higher rates are sent in bursts per tick
+const pacerResolution = time.Millisecond
+
+// runLoad sends orders at opts.rate from opts.workers goroutines and prints latency percentiles at the end.
+// Writes are synchronous so a recorded latency covers the whole broker round trip.
+func runLoad(ctx context.Context, opts options) {
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(opts.broker),
+		Topic:        opts.topic,
+		Balancer:     opts.keyBy.balancer(),
+		Compression:  opts.compression,
+		MaxAttempts:  3,
+		WriteTimeout: 10 * time.Second,
+		BatchSize:    opts.batchSize,
+		BatchTimeout: 5 * time.Millisecond, // default 1s would dominate the measured latency
+		ErrorLogger: kafka.LoggerFunc(func(s string, args ...interface{}) {
+			log.Printf("[KAFKA-ERROR] "+s, args...)
+		}),
+	}
+	defer writer.Close()
+	startMetrics(ctx, opts.metricsAddr, writer)
+
+	rec := stats.NewRecorder()
+	chaos := generator.NewChaos(opts.chaos)
+	jobs := make(chan struct{}, opts.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loadWorker(ctx, writer, chaos, opts.keyBy, opts.envelope, jobs, rec)
+		}()
+	}
+
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-progress.C:
+				log.Printf("load: %s", rec.Summary())
+			}
+		}
+	}()
+
+	pace(ctx, opts.rate, opts.count, jobs)
+	close(jobs)
+	wg.Wait()
+
+	s := rec.Summary()
+	fmt.Printf("\n=== load test report (target %.1f/s, %d workers) ===\n", opts.rate, opts.workers)
+	fmt.Println(s)
+	if opts.chaos > 0 {
+		fmt.Printf("chaos: %v\n", chaos.Counts())
+	}
+	if s.Rate < opts.rate*0.95 {
+		fmt.Printf("achieved rate %.1f/s is below target: add workers or check the broker\n", s.Rate)
+	}
+}
+
+// pace schedules jobs so that rate*elapsed orders are due at any moment, stopping after count jobs if set.
+// A full jobs channel blocks the pacer, so the achieved rate drops when workers cannot keep up.
+func pace(ctx context.Context, rate float64, count int, jobs chan<- struct{}) {
+	t := time.NewTicker(max(time.Duration(float64(time.Second)/rate), pacerResolution))
+	defer t.Stop()
+	start := time.Now()
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		due := int(time.Since(start).Seconds() * rate)
+		if count > 0 {
+			due = min(due, count)
+		}
+		for ; sent < due; sent++ {
+			select {
+			case jobs <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if count > 0 && sent >= count {
+			return
+		}
+	}
+}
+
+func loadWorker(ctx context.Context, writer *kafka.Writer, chaos *generator.Chaos, keyBy keyBy, envelope envelope, jobs <-chan struct{}, rec *stats.Recorder) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for range jobs {
+		sent, value, _, err := chaos.Message(r, generator.RandomOrder(r))
+		if err != nil {
+			log.Printf("marshal order: %v", err)
+			continue
+		}
+		msg := kafka.Message{Key: keyBy.key(sent), Value: envelope.wrap(value)}
+		msgCtx, span := startPublishSpan(ctx, writer.Topic, sent.OrderUID, &msg)
+		start := time.Now()
+		err = writer.WriteMessages(msgCtx, msg)
+		tracing.End(span, err)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		rec.Record(time.Since(start), err)
+	}
+}
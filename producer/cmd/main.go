@@ -1,13 +1,14 @@
 package main
 
 import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/producer/metrics"
 	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/go-faker/faker/v4"
-	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
 	"math/rand"
 	"os"
@@ -16,58 +17,116 @@ import (
 	"time"
 )
 
-const (
-	//kafkaBroker  = "localhost:9092" -- local
-	kafkaBroker  = "kafka:9092"
-	kafkaTopic   = "orders"
-	sendInterval = 5 * time.Second
-)
+func main() {
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid options: %v", err)
+	}
+	generator.Locales = opts.locales
+	shutdownTracing, err := tracing.Init(context.Background(), "wb-producer", opts.tracing)
+	if err != nil {
+		log.Fatalf("can't init tracing: %v", err)
+	}
+	// runs last: the writers have delivered and ended their spans by then
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("failed to flush spans: %v", err)
+		}
+	}()
+	if opts.file != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("Replaying %s (broker=%s topic=%s rate=%v/s count=%d)...\n",
+			opts.file, opts.broker, opts.topic, opts.rate, opts.count)
+		if err := runReplay(ctx, opts); err != nil {
+			log.Fatalf("replay failed: %v", err)
+		}
+		return
+	}
+	if opts.load {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("Starting load test (broker=%s topic=%s rate=%v/s workers=%d count=%d duration=%v chaos=%v%%)...\n",
+			opts.broker, opts.topic, opts.rate, opts.workers, opts.count, opts.duration, opts.chaos)
+		runLoad(ctx, opts)
+		return
+	}
 
-type Address struct {
-	City    string
-	Address string
-	Region  string
-}
+	if opts.transport == models.TransportRabbitMQ {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("Starting Order Producer Service (rabbitmq exchange=%s routing_key=%s rate=%v/s count=%d chaos=%v%%)...\n",
+			opts.exchange, opts.routingKey, opts.rate, opts.count, opts.chaos)
+		if err := runRabbitMQ(ctx, opts); err != nil {
+			log.Fatalf("producer failed: %v", err)
+		}
+		return
+	}
 
-func main() {
-	fmt.Println("Starting Order Producer Service...")
+	fmt.Printf("Starting Order Producer Service (broker=%s topic=%s rate=%v/s count=%d chaos=%v%%)...\n",
+		opts.broker, opts.topic, opts.rate, opts.count, opts.chaos)
 	r := rand.New(rand.NewSource(time.Now().Unix()))
+	chaos := generator.NewChaos(opts.chaos)
+	deliveries, err := newDeliveries(opts, opts.retries, opts.spoolFile)
+	if err != nil {
+		log.Fatalf("can't init deliveries: %v", err)
+	}
+	// runs after writer.Close, which waits for the last completions
+	defer deliveries.close()
+	updates := newUpdates(opts)
+	defer updates.close()
 	writer := &kafka.Writer{
-		Addr:         kafka.TCP(kafkaBroker),
-		Topic:        kafkaTopic,
-		Balancer:     &kafka.LeastBytes{},
+		Addr:         kafka.TCP(opts.broker),
+		Topic:        opts.topic,
+		Balancer:     opts.keyBy.balancer(),
+		Compression:  opts.compression,
 		MaxAttempts:  3,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
-		Async:        true,
+		Async:        opts.async,
 		Logger: kafka.LoggerFunc(func(s string, args ...interface{}) {
 			log.Printf("[KAFKA] "+s, args...)
 		}),
 		ErrorLogger: kafka.LoggerFunc(func(s string, args ...interface{}) {
 			log.Printf("[KAFKA-ERROR] "+s, args...)
 		}),
-		BatchSize:  100,
+		BatchSize:  opts.batchSize,
 		BatchBytes: 1048576, //1MB
+		Completion: deliveries.completion,
 	}
 	defer writer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMetrics(ctx, opts.metricsAddr, writer)
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	// Message generation loop
-	ticker := time.NewTicker(sendInterval)
+	ticker := time.NewTicker(opts.interval())
 	defer ticker.Stop()
 
 	//creating a scheduler for sending messages
+	sent := 0
 	for {
 		select {
 		case <-ticker.C:
-			order := generateRandomOrder(r)
-			if err := sendOrder(writer, order); err != nil {
+			order := generator.RandomOrder(r)
+			if kind, err := sendOrder(writer, deliveries, chaos, r, order, opts.keyBy, opts.envelope); err != nil {
 				fmt.Printf("Error sending order: %v\n", err)
+			} else if kind != generator.ChaosNone {
+				fmt.Printf("Sent broken order (%s): %s\n", kind, order.OrderUID)
 			} else {
 				fmt.Printf("Sent order: %s\n", order.OrderUID)
+				updates.observe(r, order)
+			}
+			sent++
+			if opts.count > 0 && sent >= opts.count {
+				fmt.Printf("Sent %d orders, stopping producer...\n", sent)
+				return
 			}
 
 		case <-quit:
@@ -77,89 +136,41 @@ func main() {
 	}
 }
 
-// send data to consumer
-func sendOrder(writer *kafka.Writer, order models.Order) error {
-	jsonData, err := json.Marshal(order)
+// startMetrics serves the writer stats on addr until ctx is done
+func startMetrics(ctx context.Context, addr string, writer *kafka.Writer) {
+	if addr == "" {
+		return
+	}
+	m := metrics.NewWriter(writer)
+	go m.Run(ctx)
+	go metrics.Serve(ctx, addr, m)
+	log.Printf("Serving producer metrics on %s/metrics and %s/stats", addr, addr)
+}
+
+// send data to consumer, chaos decides whether the order is sent broken
+func sendOrder(writer *kafka.Writer, deliveries *deliveries, chaos *generator.Chaos, r *rand.Rand, order models.Order, keyBy keyBy, envelope envelope) (string, error) {
+	sent, value, kind, err := chaos.Message(r, order)
 	if err != nil {
-		return fmt.Errorf("failed to marshal order: %w", err)
+		return kind, fmt.Errorf("failed to marshal order: %w", err)
 	}
 
 	msg := kafka.Message{
-		Key:   []byte(order.OrderUID),
-		Value: jsonData,
+		Key:   keyBy.key(sent),
+		Value: envelope.wrap(value),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-
-	return writer.WriteMessages(ctx, msg)
-}
-
-// generate random data for testing
-func generateRandomOrder(r *rand.Rand) models.Order {
-	// Generate unique order ID
-	orderUID := uuid.New().String()
-
-	// Generate random items
-	itemCount := rand.Intn(3) + 1 // 1-3 items
-	items := make([]models.Item, itemCount)
-	for i := 0; i < itemCount; i++ {
-		items[i] = models.Item{
-			ChrtID:      r.Intn(10000000),
-			TrackNumber: fmt.Sprintf("TRK%06d", r.Intn(1000000)),
-			Price:       r.Intn(1000) + 100,
-			Rid:         uuid.New().String(),
-			Name:        faker.Word(),
-			Sale:        r.Intn(50),
-			Size:        fmt.Sprintf("%d", r.Intn(10)),
-			TotalPrice:  r.Intn(500) + 50,
-			NmID:        r.Intn(10000000),
-			Brand:       faker.FirstName() + " " + faker.LastName(),
-			Status:      200 + r.Intn(3),
-		}
+	// the trace of the order starts here, with async writes the span ends once the message is queued
+	ctx, span := startPublishSpan(ctx, writer.Topic, order.OrderUID, &msg)
+	if kind != generator.ChaosNone {
+		span.SetAttributes(attribute.String("chaos", kind))
 	}
 
-	// Generate random names and addresses
-	fullName := faker.FirstName() + " " + faker.LastName()
-	email := faker.Email()
-
-	address := Address{}
-	if err := faker.FakeData(&address); err != nil {
-		log.Fatal("can't create fake address")
-	}
-	return models.Order{
-		OrderUID:    orderUID,
-		TrackNumber: fmt.Sprintf("WBIL%08d", r.Intn(100000000)),
-		Entry:       "WBIL",
-		Delivery: models.Delivery{
-			Name:    fullName,
-			Phone:   "+" + fmt.Sprintf("%d", r.Intn(9999999999)),
-			Zip:     fmt.Sprintf("%d", r.Intn(99999)),
-			City:    address.City,
-			Address: address.Address,
-			Region:  address.Region,
-			Email:   email,
-		},
-		Payment: models.Payment{
-			Transaction:  orderUID,
-			RequestID:    "",
-			Currency:     "USD",
-			Provider:     "wbpay",
-			Amount:       r.Intn(10000) + 1000,
-			PaymentDt:    time.Now().Unix(),
-			Bank:         []string{"alpha", "sber", "tinkoff"}[r.Intn(3)],
-			DeliveryCost: r.Intn(2000) + 500,
-			GoodsTotal:   r.Intn(500) + 100,
-			CustomFee:    0,
-		},
-		Items:             items,
-		Locale:            []string{"en", "ru"}[r.Intn(2)],
-		InternalSignature: "",
-		CustomerID:        fmt.Sprintf("user%d", r.Intn(1000)),
-		DeliveryService:   []string{"meest", "russianpost", "dhl"}[r.Intn(3)],
-		Shardkey:          fmt.Sprintf("%d", r.Intn(10)),
-		SmID:              r.Intn(100),
-		DateCreated:       time.Now(),
-		OofShard:          fmt.Sprintf("%d", rand.Intn(5)+1),
+	err = writer.WriteMessages(ctx, msg)
+	tracing.End(span, err)
+	if err != nil {
+		deliveries.rejected([]kafka.Message{msg}, err)
 	}
+	return kind, err
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptionsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "producer.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("topic: yaml-orders\nrate: 5\nkey_by: customer_id\n"), 0o644))
+
+	for _, tc := range []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		topic string
+		rate  float64
+		keyBy keyBy
+	}{
+		// the default producer.yaml is optional, there is none in the package directory
+		{name: "defaults", topic: "orders", rate: 0.2, keyBy: keyByOrderUID},
+		{name: "yaml over defaults", args: []string{"-config", path}, topic: "yaml-orders", rate: 5, keyBy: keyByCustomerID},
+		{name: "env over yaml", args: []string{"-config", path},
+			env:   map[string]string{"KAFKA_TOPIC": "env-orders", "PRODUCER_RATE": "7", "PRODUCER_KEY_BY": "order_uid"},
+			topic: "env-orders", rate: 7, keyBy: keyByOrderUID},
+		{name: "flag over env", args: []string{"-config", path, "-topic", "flag-orders", "-key-by=order_uid"},
+			env: map[string]string{"KAFKA_TOPIC": "env-orders", "PRODUCER_RATE": "7"}, topic: "flag-orders", rate: 7, keyBy: keyByOrderUID},
+		{name: "config from env", env: map[string]string{"PRODUCER_CONFIG": path}, topic: "yaml-orders", rate: 5, keyBy: keyByCustomerID},
+		{name: "config flag over env", args: []string{"-config=" + path},
+			env: map[string]string{"PRODUCER_CONFIG": filepath.Join(dir, "other.yaml")}, topic: "yaml-orders", rate: 5, keyBy: keyByCustomerID},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", "")
+			for _, key := range []string{"PRODUCER_CONFIG", "KAFKA_TOPIC", "PRODUCER_RATE", "PRODUCER_KEY_BY"} {
+				t.Setenv(key, tc.env[key])
+				if tc.env[key] == "" {
+					os.Unsetenv(key)
+				}
+			}
+			o, err := parseOptions(tc.args)
+			require.NoError(t, err)
+			require.Equal(t, tc.topic, o.topic)
+			require.Equal(t, tc.rate, o.rate)
+			require.Equal(t, tc.keyBy, o.keyBy)
+		})
+	}
+
+	// an explicitly named config must exist
+	t.Setenv("PRODUCER_CONFIG", filepath.Join(dir, "missing.yaml"))
+	_, err := parseOptions(nil)
+	require.Error(t, err)
+}
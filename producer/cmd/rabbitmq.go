@@ -0,0 +1,92 @@
+package main
+
+import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/server/rabbitmq"
+	"WB_LVL0/server/tracing"
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"math/rand"
+	"time"
+)
+
+// runRabbitMQ publishes generated orders to the exchange at the configured rate until count or ctx is done,
+// every order waits for the broker confirm. The server declares and binds its queue on start.
+func runRabbitMQ(ctx context.Context, opts options) error {
+	conn, err := amqp.Dial(opts.amqpURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(opts.exchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", opts.exchange, err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	chaos := generator.NewChaos(opts.chaos)
+	ticker := time.NewTicker(opts.interval())
+	defer ticker.Stop()
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down producer...")
+			return nil
+		case <-ticker.C:
+		}
+		order := generator.RandomOrder(r)
+		sentOrder, body, kind, err := chaos.Message(r, order)
+		if err != nil {
+			fmt.Printf("Error sending order: failed to marshal order: %v\n", err)
+			continue
+		}
+		pubCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		pubCtx, span := startAMQPPublishSpan(pubCtx, opts.exchange, opts.routingKey, order.OrderUID)
+		if kind != generator.ChaosNone {
+			span.SetAttributes(attribute.String("chaos", kind))
+		}
+		err = rabbitmq.Publish(pubCtx, ch, opts.exchange, opts.routingKey, amqp.Publishing{
+			ContentType: "application/json",
+			MessageId:   string(opts.keyBy.key(sentOrder)),
+			Body:        opts.envelope.wrap(body),
+		})
+		tracing.End(span, err)
+		cancel()
+		if err != nil {
+			fmt.Printf("Error sending order: %v\n", err)
+		} else if kind != generator.ChaosNone {
+			fmt.Printf("Sent broken order (%s): %s\n", kind, order.OrderUID)
+		} else {
+			fmt.Printf("Sent order: %s\n", order.OrderUID)
+		}
+		sent++
+		if opts.count > 0 && sent >= opts.count {
+			fmt.Printf("Sent %d orders, stopping producer...\n", sent)
+			return nil
+		}
+	}
+}
+
+// startAMQPPublishSpan starts the span of publishing an order to the exchange, rabbitmq.Publish puts its trace
+// context into the message headers
+func startAMQPPublishSpan(ctx context.Context, exchange, routingKey, orderUID string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "publish "+exchange, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(exchange),
+			semconv.MessagingRabbitMQDestinationRoutingKey(routingKey),
+			tracing.OrderUID(orderUID),
+		))
+}
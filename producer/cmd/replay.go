@@ -0,0 +1,108 @@
+package main
+
+import (
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// maxLineSize bounds a single captured payload in the replay file
+const maxLineSize = 16 << 20
+
+// runReplay publishes every non-empty line of opts.file as is, keyed like live orders (see -key-by).
+// Lines that are not valid JSON are sent too (with an empty key): broken payloads are often the incident.
+func runReplay(ctx context.Context, opts options) error {
+	f, err := os.Open(opts.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(opts.broker),
+		Topic:        opts.topic,
+		Balancer:     opts.keyBy.balancer(),
+		Compression:  opts.compression,
+		MaxAttempts:  3,
+		WriteTimeout: 10 * time.Second,
+		BatchTimeout: 5 * time.Millisecond,
+	}
+	defer writer.Close()
+	startMetrics(ctx, opts.metricsAddr, writer)
+
+	sent, err := replay(ctx, f, writer, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %d orders from %s\n", sent, opts.file)
+	return nil
+}
+
+// replay publishes the lines of r at opts.rate and returns the number of messages sent
+func replay(ctx context.Context, r io.Reader, writer messageWriter, opts options) (int, error) {
+	ticker := time.NewTicker(opts.interval())
+	defer ticker.Stop()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line, sent := 0, 0
+	for scanner.Scan() {
+		line++
+		payload := bytes.TrimSpace(scanner.Bytes())
+		if len(payload) == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Interrupted after %d orders\n", sent)
+			return sent, nil
+		case <-ticker.C:
+		}
+
+		msg := kafka.Message{Key: replayKey(payload, opts.keyBy), Value: bytes.Clone(payload)}
+		msgCtx, span := startPublishSpan(ctx, opts.topic, "", &msg)
+		err := writer.WriteMessages(msgCtx, msg)
+		tracing.End(span, err)
+		if err != nil {
+			return sent, fmt.Errorf("line %d: %w", line, err)
+		}
+		sent++
+		log.Printf("Replayed line %d (key=%q)", line, msg.Key)
+		if opts.count > 0 && sent >= opts.count {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return sent, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return sent, nil
+}
+
+// replayKey extracts the key field from a captured payload, bare or in the envelope, nil if it cannot be decoded
+func replayKey(payload []byte, keyBy keyBy) []byte {
+	// only the key fields are decoded, so payloads with broken other fields keep their key
+	var head struct {
+		OrderUID   string `json:"order_uid"`
+		CustomerID string `json:"customer_id"`
+	}
+	env, err := models.OpenEnvelope(payload)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(env.Payload, &head); err != nil {
+		return nil
+	}
+	if key := keyBy.key(models.Order{OrderUID: head.OrderUID, CustomerID: head.CustomerID}); len(key) > 0 {
+		return key
+	}
+	return nil
+}
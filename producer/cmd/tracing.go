@@ -0,0 +1,28 @@
+package main
+
+import (
+	"WB_LVL0/server/tracing"
+	"context"
+	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("producer")
+
+// startPublishSpan starts the span of publishing msg to topic and puts its trace context into the headers
+// of msg, the consumer continues the trace. orderUID may be empty if the payload isn't a known order.
+func startPublishSpan(ctx context.Context, topic, orderUID string, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "publish "+topic, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		))
+	if orderUID != "" {
+		span.SetAttributes(tracing.OrderUID(orderUID))
+	}
+	tracing.Inject(ctx, msg)
+	return ctx, span
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// sentOrdersKept bounds the orders update events may reference
+const sentOrdersKept = 1000
+
+// updates emits cancellation and refund events for previously sent orders on a separate topic
+type updates struct {
+	writer *kafka.Writer
+	sent   *generator.SentOrders
+	ratio  float64
+	keyBy  keyBy
+}
+
+// newUpdates returns nil when update events are disabled
+func newUpdates(opts options) *updates {
+	if opts.updateRatio == 0 {
+		return nil
+	}
+	return &updates{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(opts.broker),
+			Topic:        opts.updatesTopic,
+			Balancer:     opts.keyBy.balancer(),
+			Compression:  opts.compression,
+			MaxAttempts:  3,
+			WriteTimeout: 10 * time.Second,
+			BatchTimeout: 5 * time.Millisecond,
+		},
+		sent:  generator.NewSentOrders(sentOrdersKept),
+		ratio: opts.updateRatio,
+		keyBy: opts.keyBy,
+	}
+}
+
+// observe remembers a sent order and, with the configured ratio, sends an update of an earlier one
+func (u *updates) observe(r *rand.Rand, order models.Order) {
+	if u == nil {
+		return
+	}
+	defer u.sent.Add(order)
+	if r.Float64() >= u.ratio {
+		return
+	}
+	target, ok := u.sent.Random(r)
+	if !ok {
+		return
+	}
+	event := generator.RandomUpdate(r, target)
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to marshal order update: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// keyed like the orders, so updates of one order or customer keep their order
+	msg := kafka.Message{Key: u.keyBy.key(target), Value: data}
+	ctx, span := startPublishSpan(ctx, u.writer.Topic, event.OrderUID, &msg)
+	err = u.writer.WriteMessages(ctx, msg)
+	tracing.End(span, err)
+	if err != nil {
+		log.Printf("Error sending order update: %v", err)
+		return
+	}
+	log.Printf("Sent %s of order %s", event.Type, event.OrderUID)
+}
+
+func (u *updates) close() {
+	if u == nil {
+		return
+	}
+	if err := u.writer.Close(); err != nil {
+		log.Printf("failed to close order updates writer: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"WB_LVL0/server/models"
+	"encoding/json"
+	"math/rand"
+	"sync"
+)
+
+// kinds of broken messages produced in chaos mode
+const (
+	ChaosNone          = "none"
+	ChaosMalformedJSON = "malformed_json"
+	ChaosMissingField  = "missing_field"
+	ChaosBadCurrency   = "bad_currency"
+	ChaosDuplicateUID  = "duplicate_uid"
+)
+
+var chaosKinds = []string{ChaosMalformedJSON, ChaosMissingField, ChaosBadCurrency, ChaosDuplicateUID}
+
+// Chaos replaces a share of generated orders with broken messages to exercise
+// validation, retries and the DLQ on the consumer side. Safe for concurrent use.
+type Chaos struct {
+	percent float64 // 0..100
+
+	mu     sync.Mutex
+	last   *models.Order // last valid order, resent as a duplicate
+	counts map[string]int
+}
+
+func NewChaos(percent float64) *Chaos {
+	return &Chaos{percent: percent, counts: make(map[string]int)}
+}
+
+// Message returns the order actually sent (a duplicate replaces the given one), the Kafka value
+// and the kind of damage applied
+func (c *Chaos) Message(r *rand.Rand, order models.Order) (sent models.Order, value []byte, kind string, err error) {
+	kind = ChaosNone
+	if c.percent > 0 && r.Float64()*100 < c.percent {
+		kind = chaosKinds[r.Intn(len(chaosKinds))]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch kind {
+	case ChaosMissingField:
+		dropField(r, &order)
+	case ChaosBadCurrency:
+		order.Payment.Currency = []string{"", "XXX", "usd", "BTC"}[r.Intn(4)]
+	case ChaosDuplicateUID:
+		if c.last == nil {
+			// nothing sent yet, the first valid order will be duplicated later
+			kind = ChaosNone
+		} else {
+			order = *c.last
+		}
+	}
+
+	value, err = json.Marshal(order)
+	if err != nil {
+		return order, nil, kind, err
+	}
+	if kind == ChaosMalformedJSON {
+		value = value[:r.Intn(len(value)-1)+1]
+	}
+	if kind == ChaosNone {
+		c.last = &order
+	}
+	c.counts[kind]++
+	return order, value, kind, nil
+}
+
+// Counts returns how many messages of every kind were produced so far
+func (c *Chaos) Counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int, len(c.counts))
+	for k, v := range c.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// dropField clears one of the fields required by models.Order.Validate
+func dropField(r *rand.Rand, o *models.Order) {
+	switch r.Intn(5) {
+	case 0:
+		o.TrackNumber = ""
+	case 1:
+		o.CustomerID = ""
+	case 2:
+		o.Delivery.Name = ""
+	case 3:
+		o.Payment.Transaction = ""
+	default:
+		o.Items = nil
+	}
+}
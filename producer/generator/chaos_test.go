@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"WB_LVL0/server/models"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaosDisabled(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	c := NewChaos(0)
+	order := RandomOrder(r)
+	sent, value, kind, err := c.Message(r, order)
+	require.NoError(t, err)
+	require.Equal(t, ChaosNone, kind)
+	require.Equal(t, order.OrderUID, sent.OrderUID)
+
+	var got models.Order
+	require.NoError(t, json.Unmarshal(value, &got))
+	require.Equal(t, order.OrderUID, got.OrderUID)
+}
+
+func TestChaosBreaksEveryMessage(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	c := NewChaos(100)
+	// seed a valid order to duplicate
+	c.last = &models.Order{OrderUID: "seeded-order-uid"}
+
+	for i := 0; i < 200; i++ {
+		_, value, kind, err := c.Message(r, RandomOrder(r))
+		require.NoError(t, err)
+
+		var got models.Order
+		switch kind {
+		case ChaosMalformedJSON:
+			require.Error(t, json.Unmarshal(value, &got))
+		case ChaosDuplicateUID:
+			require.NoError(t, json.Unmarshal(value, &got))
+			require.Equal(t, "seeded-order-uid", got.OrderUID)
+		case ChaosMissingField, ChaosBadCurrency:
+			require.NoError(t, json.Unmarshal(value, &got))
+			var verr *models.ValidationError
+			require.ErrorAs(t, got.Validate(), &verr)
+		default:
+			t.Fatalf("unexpected kind %q", kind)
+		}
+	}
+	require.Zero(t, c.Counts()[ChaosNone])
+}
@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"WB_LVL0/server/models"
+	"fmt"
+	"github.com/go-faker/faker/v4"
+	"github.com/google/uuid"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Locales of generated orders, set from the producer config
+var Locales = []string{"en", "ru"}
+
+type Address struct {
+	City    string
+	Address string
+	Region  string
+}
+
+// RandomOrder generates a random valid order for testing
+func RandomOrder(r *rand.Rand) models.Order {
+	// Generate unique order ID
+	orderUID := uuid.New().String()
+
+	// the amounts are minor units of the currency (cents)
+	const currency = "USD"
+
+	// Generate random items
+	itemCount := rand.Intn(3) + 1 // 1-3 items
+	items := make([]models.Item, itemCount)
+	for i := 0; i < itemCount; i++ {
+		items[i] = models.Item{
+			ChrtID:      r.Intn(10000000),
+			TrackNumber: fmt.Sprintf("TRK%06d", r.Intn(1000000)),
+			Price:       models.NewMoney(r.Int63n(100000)+10000, currency),
+			Rid:         uuid.New().String(),
+			Name:        faker.Word(),
+			Sale:        r.Intn(50),
+			Size:        fmt.Sprintf("%d", r.Intn(10)),
+			TotalPrice:  models.NewMoney(r.Int63n(50000)+5000, currency),
+			NmID:        r.Intn(10000000),
+			Brand:       faker.FirstName() + " " + faker.LastName(),
+			Status:      200 + r.Intn(3),
+		}
+	}
+
+	// Generate random names and addresses
+	fullName := faker.FirstName() + " " + faker.LastName()
+	email := faker.Email()
+
+	address := Address{}
+	if err := faker.FakeData(&address); err != nil {
+		log.Fatal("can't create fake address")
+	}
+	return models.Order{
+		OrderUID:    orderUID,
+		TrackNumber: fmt.Sprintf("WBIL%08d", r.Intn(100000000)),
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    fullName,
+			Phone:   "+" + fmt.Sprintf("%d", r.Intn(9999999999)),
+			Zip:     fmt.Sprintf("%d", r.Intn(99999)),
+			City:    address.City,
+			Address: address.Address,
+			Region:  address.Region,
+			Email:   email,
+		},
+		Payment: models.Payment{
+			Transaction:  orderUID,
+			RequestID:    "",
+			Currency:     currency,
+			Provider:     "wbpay",
+			Amount:       models.NewMoney(r.Int63n(1000000)+100000, currency),
+			PaymentDt:    time.Now().Unix(),
+			Bank:         []string{"alpha", "sber", "tinkoff"}[r.Intn(3)],
+			DeliveryCost: models.NewMoney(r.Int63n(200000)+50000, currency),
+			GoodsTotal:   models.NewMoney(r.Int63n(50000)+10000, currency),
+			CustomFee:    models.NewMoney(0, currency),
+		},
+		Items:             items,
+		Locale:            Locales[r.Intn(len(Locales))],
+		InternalSignature: "",
+		CustomerID:        fmt.Sprintf("user%d", r.Intn(1000)),
+		DeliveryService:   []string{"meest", "russianpost", "dhl"}[r.Intn(3)],
+		Shardkey:          fmt.Sprintf("%d", r.Intn(10)),
+		SmID:              r.Intn(100),
+		DateCreated:       time.Now(),
+		OofShard:          fmt.Sprintf("%d", rand.Intn(5)+1),
+	}
+}
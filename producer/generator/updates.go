@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"WB_LVL0/server/models"
+	"github.com/google/uuid"
+	"math/rand"
+	"time"
+)
+
+var (
+	cancelReasons = []string{"customer_request", "out_of_stock", "payment_failed", "address_unreachable"}
+	refundReasons = []string{"damaged", "wrong_item", "not_delivered", "changed_mind"}
+)
+
+// RandomUpdate generates a cancellation or a partial or full refund of a previously sent order
+func RandomUpdate(r *rand.Rand, order models.Order) models.OrderUpdateEvent {
+	event := models.OrderUpdateEvent{
+		EventID:    uuid.New().String(),
+		OrderUID:   order.OrderUID,
+		CustomerID: order.CustomerID,
+		OccurredAt: time.Now(),
+	}
+	if r.Intn(2) == 0 {
+		event.Type = models.OrderUpdateCancelled
+		event.Reason = cancelReasons[r.Intn(len(cancelReasons))]
+		return event
+	}
+	event.Type = models.OrderUpdateRefunded
+	event.Reason = refundReasons[r.Intn(len(refundReasons))]
+	event.Amount = order.Payment.Amount.Amount
+	if event.Amount > 1 && r.Intn(2) == 0 {
+		event.Amount = r.Int63n(event.Amount-1) + 1
+	}
+	event.Currency = order.Payment.Currency
+	return event
+}
+
+// SentOrders keeps the last sent orders to reference from update events
+type SentOrders struct {
+	orders []models.Order
+	next   int
+}
+
+func NewSentOrders(size int) *SentOrders {
+	return &SentOrders{orders: make([]models.Order, 0, size)}
+}
+
+func (s *SentOrders) Add(order models.Order) {
+	if len(s.orders) < cap(s.orders) {
+		s.orders = append(s.orders, order)
+		return
+	}
+	s.orders[s.next] = order
+	s.next = (s.next + 1) % len(s.orders)
+}
+
+// Random returns one of the kept orders, false if none was sent yet
+func (s *SentOrders) Random(r *rand.Rand) (models.Order, bool) {
+	if len(s.orders) == 0 {
+		return models.Order{}, false
+	}
+	return s.orders[r.Intn(len(s.orders))], true
+}
@@ -0,0 +1,37 @@
+package generator
+
+import (
+	"WB_LVL0/server/models"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandomUpdate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sent := NewSentOrders(2)
+	_, ok := sent.Random(r)
+	require.False(t, ok)
+
+	for i := 0; i < 3; i++ {
+		sent.Add(RandomOrder(r))
+	}
+	require.Len(t, sent.orders, 2)
+
+	for i := 0; i < 100; i++ {
+		order, ok := sent.Random(r)
+		require.True(t, ok)
+		event := RandomUpdate(r, order)
+		require.Equal(t, order.OrderUID, event.OrderUID)
+		switch event.Type {
+		case models.OrderUpdateCancelled:
+			require.Zero(t, event.Amount)
+		case models.OrderUpdateRefunded:
+			require.Positive(t, event.Amount)
+			require.LessOrEqual(t, event.Amount, order.Payment.Amount.Amount)
+		default:
+			t.Fatalf("unexpected type %q", event.Type)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	namespace = "wb"
+	subsystem = "producer"
+
+	// pollInterval of the writer stats; kafka-go resets its counters on every Stats call
+	pollInterval = 5 * time.Second
+)
+
+var (
+	messagesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "messages_total",
+		Help:      "Number of messages written to Kafka.",
+	})
+	writes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "writes_total",
+		Help:      "Number of produce requests (batches) sent to Kafka.",
+	})
+	bytesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "bytes_total",
+		Help:      "Number of message bytes written to Kafka.",
+	})
+	writeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "errors_total",
+		Help:      "Number of failed writes.",
+	})
+	retries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "retries_total",
+		Help:      "Number of retried writes.",
+	})
+	batchSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "batch_size",
+		Help:      "Messages per batch during the last poll interval.",
+	}, []string{"stat"})
+	writeLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "write_latency_seconds",
+		Help:      "Latency of produce requests during the last poll interval.",
+	}, []string{"stat"})
+	batchLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "batch_latency_seconds",
+		Help:      "Time from the first message of a batch until it was written, during the last poll interval.",
+	}, []string{"stat"})
+)
+
+// Stats is the JSON view served on /stats
+type Stats struct {
+	Topic    string    `json:"topic"`
+	Since    time.Time `json:"since"`
+	Messages int64     `json:"messages"`
+	Writes   int64     `json:"writes"`
+	Bytes    int64     `json:"bytes"`
+	Errors   int64     `json:"errors"`
+	Retries  int64     `json:"retries"`
+	// the rest covers the last poll interval
+	BatchSizeAvg int64  `json:"batch_size_avg"`
+	BatchSizeMax int64  `json:"batch_size_max"`
+	WriteTimeAvg string `json:"write_time_avg"`
+	WriteTimeMax string `json:"write_time_max"`
+	BatchTimeAvg string `json:"batch_time_avg"`
+	BatchTimeMax string `json:"batch_time_max"`
+}
+
+// Writer turns the kafka-go writer stats into Prometheus metrics and running totals
+type Writer struct {
+	writer *kafka.Writer
+	mu     sync.Mutex
+	stats  Stats
+}
+
+func NewWriter(w *kafka.Writer) *Writer {
+	return &Writer{writer: w, stats: Stats{Topic: w.Topic, Since: time.Now()}}
+}
+
+// Run polls the writer stats until ctx is done
+func (w *Writer) Run(ctx context.Context) {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			w.poll()
+			return
+		case <-t.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *Writer) poll() {
+	st := w.writer.Stats()
+	messagesSent.Add(float64(st.Messages))
+	writes.Add(float64(st.Writes))
+	bytesSent.Add(float64(st.Bytes))
+	writeErrors.Add(float64(st.Errors))
+	retries.Add(float64(st.Retries))
+	batchSize.WithLabelValues("avg").Set(float64(st.BatchSize.Avg))
+	batchSize.WithLabelValues("max").Set(float64(st.BatchSize.Max))
+	writeLatency.WithLabelValues("avg").Set(st.WriteTime.Avg.Seconds())
+	writeLatency.WithLabelValues("max").Set(st.WriteTime.Max.Seconds())
+	batchLatency.WithLabelValues("avg").Set(st.BatchTime.Avg.Seconds())
+	batchLatency.WithLabelValues("max").Set(st.BatchTime.Max.Seconds())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Messages += st.Messages
+	w.stats.Writes += st.Writes
+	w.stats.Bytes += st.Bytes
+	w.stats.Errors += st.Errors
+	w.stats.Retries += st.Retries
+	w.stats.BatchSizeAvg, w.stats.BatchSizeMax = st.BatchSize.Avg, st.BatchSize.Max
+	w.stats.WriteTimeAvg, w.stats.WriteTimeMax = st.WriteTime.Avg.String(), st.WriteTime.Max.String()
+	w.stats.BatchTimeAvg, w.stats.BatchTimeMax = st.BatchTime.Avg.String(), st.BatchTime.Max.String()
+}
+
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Serve exposes /metrics for Prometheus and /stats as JSON on addr until ctx is done
+func Serve(ctx context.Context, addr string, w *Writer) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/stats", func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(w.Stats()); err != nil {
+			log.Printf("failed to write stats: %v", err)
+		}
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("metrics listener error: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// reservoirSize bounds memory of long runs: percentiles are computed from a uniform sample
+const reservoirSize = 100_000
+
+// Recorder collects latencies and errors of operations, safe for concurrent use
+type Recorder struct {
+	mu      sync.Mutex
+	count   int64
+	errors  int64
+	max     time.Duration
+	sum     time.Duration
+	samples []time.Duration
+	rnd     *rand.Rand
+	started time.Time
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		samples: make([]time.Duration, 0, 1024),
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		started: time.Now(),
+	}
+}
+
+// Record adds an operation result; failed operations count as errors and are excluded from latencies
+func (r *Recorder) Record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+	if err != nil {
+		r.errors++
+		return
+	}
+	r.sum += d
+	r.max = max(r.max, d)
+	ok := r.count - r.errors
+	if len(r.samples) < reservoirSize {
+		r.samples = append(r.samples, d)
+	} else if i := r.rnd.Int63n(ok); i < reservoirSize {
+		r.samples[i] = d
+	}
+}
+
+// Summary is a point-in-time report of a Recorder
+type Summary struct {
+	Count   int64
+	Errors  int64
+	Rate    float64 // operations per second since the recorder was created
+	Mean    time.Duration
+	P50     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+	Elapsed time.Duration
+}
+
+func (r *Recorder) Summary() Summary {
+	r.mu.Lock()
+	samples := slices.Clone(r.samples)
+	s := Summary{Count: r.count, Errors: r.errors, Max: r.max, Elapsed: time.Since(r.started)}
+	if ok := r.count - r.errors; ok > 0 {
+		s.Mean = r.sum / time.Duration(ok)
+	}
+	r.mu.Unlock()
+
+	slices.Sort(samples)
+	s.P50 = percentile(samples, 0.50)
+	s.P95 = percentile(samples, 0.95)
+	s.P99 = percentile(samples, 0.99)
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.Rate = float64(s.Count) / secs
+	}
+	return s
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("count=%d errors=%d rate=%.1f/s mean=%v p50=%v p95=%v p99=%v max=%v",
+		s.Count, s.Errors, s.Rate, s.Mean, s.P50, s.P95, s.P99, s.Max)
+}
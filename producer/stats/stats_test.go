@@ -0,0 +1,25 @@
+package stats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderSummary(t *testing.T) {
+	r := NewRecorder()
+	for i := 1; i <= 100; i++ {
+		r.Record(time.Duration(i)*time.Millisecond, nil)
+	}
+	r.Record(time.Second, errors.New("timeout"))
+
+	s := r.Summary()
+	require.EqualValues(t, 101, s.Count)
+	require.EqualValues(t, 1, s.Errors)
+	require.Equal(t, 50*time.Millisecond, s.P50)
+	require.Equal(t, 99*time.Millisecond, s.P99)
+	require.Equal(t, 100*time.Millisecond, s.Max)
+	require.Equal(t, 50500*time.Microsecond, s.Mean)
+}
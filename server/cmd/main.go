@@ -1,25 +1,19 @@
 package main
 
 import (
-	_ "WB_LVL0/docs"
-	"WB_LVL0/server/internal/service"
-	"WB_LVL0/server/internal/storage"
-	k "WB_LVL0/server/kafka"
+	"WB_LVL0/server/internal/app"
+	"WB_LVL0/server/internal/logging"
 	"WB_LVL0/server/models"
-	"fmt"
-	"github.com/gin-gonic/gin"
+	"WB_LVL0/server/tracing"
+	"context"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-const (
-	configPath = "config.yaml"
-)
+var logger = logging.Component("app")
 
 // @title WB_LVL0 API
 // @version 1.0
@@ -27,46 +21,56 @@ const (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	//init config
-	cfg := models.MustLoad(configPath)
-	//init PostrgeSQL
-	db, err := storage.New(*cfg)
+	//init config: flag > env > yaml > default
+	cfg, err := models.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("can't set connection to postgres: %v", err)
+		fatal("can't load config", err)
 	}
-	//init kafka
-	reader := k.NewReader()
-	defer reader.Close()
-	//init service
-	serv := service.NewService(db)
-	//init router
-	router := gin.Default()
-	router.GET("/", func(c *gin.Context) {
-		//c.File("./server/static/index.html") -- local
-		c.File("./static/index.html")
-
-	})
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	router.GET("/order/:order_uid", serv.GetOrder)
-	router.Static("/static", "./static")
-	//router.Static("/server/static", "./server/static")
-
-	//server start
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
+	if err := logging.SetLevel(cfg.Log.Level); err != nil {
+		fatal("invalid log level", err)
+	}
+	models.SetValidationRules(cfg.Validation)
+	logger.Info("resolved config", "config", cfg.Dump())
+	//init tracing: spans are exported over OTLP, the trace context comes in HTTP and Kafka headers
+	shutdownTracing, err := tracing.Init(context.Background(), "wb-orders", cfg.Tracing)
+	if err != nil {
+		fatal("can't init tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush spans", logging.Err(err))
+		}
+	}()
+	//init storage, router and consumer
+	application, err := app.New(*cfg)
+	if err != nil {
+		fatal("can't init application", err)
+	}
+	// SIGHUP reloads the runtime settings
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		if err := router.Run(cfg.ServConf.Host); err != nil {
-			log.Fatalf("HTTP server error: %v", err)
+		for range hup {
+			if _, err := application.ReloadConfig(); err != nil {
+				logger.Error("can't reload config", logging.Err(err))
+			}
 		}
 	}()
 	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Processing message
-	go func() {
-		k.ReadMSG(db, reader)
-	}()
+	if err := application.Run(ctx); err != nil {
+		fatal("application error", err)
+	}
+}
 
-	fmt.Println("Consumer started. Waiting for messages...")
-	<-quit
-	fmt.Println("Shutting down consumer...")
+func fatal(msg string, err error) {
+	logger.Error(msg, logging.Err(err))
+	os.Exit(1)
 }
@@ -0,0 +1,48 @@
+// Command rebuild recreates the order tables from the order event log, e.g. after a bug of the projection
+// wrote wrong rows. The events are replayed with the database.write_mode of the config; status tokens
+// of the orders are kept. Run it with the consumers stopped, the order tables are locked until it finishes.
+package main
+
+import (
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		config string
+		yes    bool
+	)
+	flag.StringVar(&config, "config", "config.yaml", "server config")
+	flag.BoolVar(&yes, "yes", false, "confirm that the order tables are replaced by the replayed events")
+	flag.Parse()
+	if !yes {
+		log.Fatalf("rebuild truncates the order tables and replays the event log into them, run it with -yes")
+	}
+
+	cfg := models.MustLoad(config)
+	db, err := storage.New(*cfg)
+	if err != nil {
+		log.Fatalf("can't init storage: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	report, err := db.RebuildProjection(ctx)
+	if err != nil {
+		log.Fatalf("rebuild failed, the order tables are unchanged: %v", err)
+	}
+	fmt.Printf("Rebuilt %d orders from %d events in %v (duplicates=%d invalid=%d, write_mode=%s)\n",
+		report.Orders, report.Events, time.Since(start).Round(time.Millisecond), report.Duplicates, report.Invalid,
+		cfg.DBConf.WriteMode)
+}
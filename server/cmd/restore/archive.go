@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxLineSize bounds a single order in an archive
+const maxLineSize = 16 << 20
+
+// archiveReader iterates over the lines of an NDJSON archive, decompressing .zst files on the fly
+type archiveReader struct {
+	name    string
+	file    *os.File
+	zr      *zstd.Decoder
+	scanner *bufio.Scanner
+	line    int
+}
+
+// openArchive opens path ("-" for stdin); files ending in .zst or .zstd are zstd-compressed
+func openArchive(path string) (*archiveReader, error) {
+	a := &archiveReader{name: path, file: os.Stdin}
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		a.file = f
+	}
+
+	var src io.Reader = a.file
+	if strings.HasSuffix(path, ".zst") || strings.HasSuffix(path, ".zstd") {
+		zr, err := zstd.NewReader(a.file)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		a.zr = zr
+		src = zr
+	}
+	a.scanner = bufio.NewScanner(src)
+	a.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return a, nil
+}
+
+// Next returns the next non-empty line, io.EOF at the end of the archive.
+// The returned slice is only valid until the following call.
+func (a *archiveReader) Next() ([]byte, error) {
+	for a.scanner.Scan() {
+		a.line++
+		if line := bytes.TrimSpace(a.scanner.Bytes()); len(line) > 0 {
+			return line, nil
+		}
+	}
+	if err := a.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%d: %v", a.name, a.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// Position is the file:line of the last returned line, for log messages
+func (a *archiveReader) Position() string {
+	return fmt.Sprintf("%s:%d", a.name, a.line)
+}
+
+func (a *archiveReader) Close() error {
+	if a.zr != nil {
+		a.zr.Close()
+	}
+	if a.file == os.Stdin {
+		return nil
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,295 @@
+// Command restore replays orders from NDJSON archives (plain or zstd-compressed, e.g. downloaded S3 exports)
+// into Kafka or directly into storage. Saving is idempotent: orders that are already stored are skipped.
+package main
+
+import (
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	targetKafka   = "kafka"
+	targetStorage = "storage"
+)
+
+// selection of orders to restore, empty fields match everything
+type selection struct {
+	uids     map[string]bool
+	customer string
+	since    time.Time
+	until    time.Time
+}
+
+func (s selection) match(o models.Order) bool {
+	if len(s.uids) > 0 && !s.uids[o.OrderUID] {
+		return false
+	}
+	if s.customer != "" && o.CustomerID != s.customer {
+		return false
+	}
+	if !s.since.IsZero() && o.DateCreated.Before(s.since) {
+		return false
+	}
+	if !s.until.IsZero() && !o.DateCreated.Before(s.until) {
+		return false
+	}
+	return true
+}
+
+// sink receives selected orders; raw is the archived payload as is
+type sink interface {
+	put(ctx context.Context, order models.Order, raw []byte) (saved bool, err error)
+	close() error
+}
+
+// options of a restore run
+type options struct {
+	target, config, broker, topic string
+	sel                           selection
+	dryRun                        bool
+	archives                      []string
+}
+
+func main() {
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid options: %v", err)
+	}
+
+	var out sink
+	switch {
+	case opts.dryRun:
+		// out stays nil: matching orders are only counted
+	case opts.target == targetKafka:
+		out = newKafkaSink(opts.broker, opts.topic)
+	case opts.target == targetStorage:
+		cfg := models.MustLoad(opts.config)
+		// restored orders are checked against the allowed values of the service config
+		models.SetValidationRules(cfg.Validation)
+		db, err := storage.New(*cfg)
+		if err != nil {
+			log.Fatalf("can't init storage: %v", err)
+		}
+		out = storageSink{db: db}
+	}
+	if out != nil {
+		defer out.close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	total, err := restore(ctx, opts.archives, opts.sel, out)
+	if err != nil {
+		log.Fatalf("restore stopped: %v (so far: %s)", err, total)
+	}
+	fmt.Printf("Restore finished: %s\n", total)
+}
+
+func parseOptions(args []string) (options, error) {
+	var (
+		o                            options
+		uids, customer, since, until string
+	)
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.StringVar(&o.target, "target", targetKafka, "where to restore orders: kafka or storage")
+	fs.StringVar(&o.config, "config", "config.yaml", "server config, used by -target storage")
+	fs.StringVar(&o.broker, "broker", "kafka:9092", "Kafka broker, used by -target kafka")
+	fs.StringVar(&o.topic, "topic", "orders", "Kafka topic, used by -target kafka")
+	fs.StringVar(&uids, "uids", "", "comma-separated order_uid list to restore")
+	fs.StringVar(&customer, "customer", "", "restore only orders of this customer_id")
+	fs.StringVar(&since, "since", "", "restore orders created at or after this RFC3339 time")
+	fs.StringVar(&until, "until", "", "restore orders created before this RFC3339 time")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "only count matching orders")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: restore [flags] archive.ndjson[.zst]... (- for stdin)\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	if o.archives = fs.Args(); len(o.archives) == 0 {
+		fs.Usage()
+		return options{}, fmt.Errorf("no archives given")
+	}
+	if !o.dryRun && o.target != targetKafka && o.target != targetStorage {
+		return options{}, fmt.Errorf("unknown target %q", o.target)
+	}
+
+	var err error
+	if o.sel, err = parseSelection(uids, customer, since, until); err != nil {
+		return options{}, fmt.Errorf("invalid selection: %v", err)
+	}
+	return o, nil
+}
+
+// restore restores the archives one by one and stops at the first failing one, the report covers
+// everything read so far
+func restore(ctx context.Context, archives []string, sel selection, out sink) (report, error) {
+	var total report
+	for _, path := range archives {
+		r, err := restoreArchive(ctx, path, sel, out)
+		total.add(r)
+		log.Printf("%s: %s", path, r)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func parseSelection(uids, customer, since, until string) (selection, error) {
+	s := selection{customer: customer}
+	if uids != "" {
+		s.uids = make(map[string]bool)
+		for _, uid := range strings.Split(uids, ",") {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				s.uids[uid] = true
+			}
+		}
+	}
+	var err error
+	if since != "" {
+		if s.since, err = time.Parse(time.RFC3339, since); err != nil {
+			return s, fmt.Errorf("since: %v", err)
+		}
+	}
+	if until != "" {
+		if s.until, err = time.Parse(time.RFC3339, until); err != nil {
+			return s, fmt.Errorf("until: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// report counts what happened to the archived lines
+type report struct {
+	read, matched, restored, existing, invalid int
+}
+
+func (r *report) add(o report) {
+	r.read += o.read
+	r.matched += o.matched
+	r.restored += o.restored
+	r.existing += o.existing
+	r.invalid += o.invalid
+}
+
+func (r report) String() string {
+	return fmt.Sprintf("read=%d matched=%d restored=%d already_stored=%d invalid=%d",
+		r.read, r.matched, r.restored, r.existing, r.invalid)
+}
+
+func restoreArchive(ctx context.Context, path string, sel selection, out sink) (report, error) {
+	var r report
+	a, err := openArchive(path)
+	if err != nil {
+		return r, err
+	}
+	defer a.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+		line, err := a.Next()
+		if errors.Is(err, io.EOF) {
+			return r, nil
+		}
+		if err != nil {
+			return r, err
+		}
+		r.read++
+
+		var order models.Order
+		if err := json.Unmarshal(line, &order); err != nil {
+			r.invalid++
+			log.Printf("%s: skip undecodable order: %v", a.Position(), err)
+			continue
+		}
+		if !sel.match(order) {
+			continue
+		}
+		r.matched++
+		if out == nil {
+			continue
+		}
+
+		saved, err := out.put(ctx, order, line)
+		var verr *models.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			r.invalid++
+			log.Printf("%s: skip invalid order %s: %v", a.Position(), order.OrderUID, err)
+		case err != nil:
+			return r, fmt.Errorf("%s: %v", a.Position(), err)
+		case saved:
+			r.restored++
+		default:
+			r.existing++
+		}
+	}
+}
+
+// kafkaSink publishes the archived payloads unchanged, keyed by order_uid like the producer does
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(broker, topic string) *kafkaSink {
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(broker),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		MaxAttempts:  3,
+		WriteTimeout: 10 * time.Second,
+		BatchTimeout: 5 * time.Millisecond,
+	}}
+}
+
+func (k *kafkaSink) put(ctx context.Context, order models.Order, raw []byte) (bool, error) {
+	msg := kafka.Message{Key: []byte(order.OrderUID), Value: append([]byte(nil), raw...)}
+	if err := k.writer.WriteMessages(ctx, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (k *kafkaSink) close() error {
+	return k.writer.Close()
+}
+
+// storageSink saves orders directly, bypassing Kafka; already stored orders are left untouched
+// (or replaced when the config sets database.write_mode: upsert)
+type storageSink struct {
+	db *storage.Storage
+}
+
+func (s storageSink) put(ctx context.Context, order models.Order, raw []byte) (bool, error) {
+	if err := order.Validate(); err != nil {
+		return false, err
+	}
+	// the archives hold orders of the current schema version
+	err := s.db.SaveOrderRaw(ctx, order, models.RawPayload{Payload: raw, SchemaVersion: models.CurrentSchemaVersion})
+	if errors.Is(err, storage.ErrOrderExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s storageSink) close() error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrder = `{"order_uid": "b563feb7b2b84b6test", "track_number": "WBILMTESTTRACK", "entry": "WBIL",
+	"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+		"address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+	"payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD", "provider": "wbpay",
+		"amount": 1817, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500, "goods_total": 317,
+		"custom_fee": 0},
+	"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest",
+		"name": "Mascaras", "sale": 30, "size": "0", "total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo",
+		"status": 202}],
+	"locale": "en", "internal_signature": "", "customer_id": "test", "delivery_service": "meest", "shardkey": "9",
+	"sm_id": 99, "date_created": "2021-11-26T06:22:19Z", "oof_shard": "1"}`
+
+// archiveLine is testOrder on one line with another order_uid and customer_id
+func archiveLine(uid, customer string) string {
+	line := strings.Join(strings.Fields(testOrder), " ")
+	line = strings.Replace(line, `"order_uid": "b563feb7b2b84b6test"`, `"order_uid": "`+uid+`"`, 1)
+	return strings.Replace(line, `"customer_id": "test"`, `"customer_id": "`+customer+`"`, 1)
+}
+
+func TestParseOptions(t *testing.T) {
+	o, err := parseOptions([]string{"a.ndjson", "b.ndjson.zst"})
+	require.NoError(t, err)
+	require.Equal(t, targetKafka, o.target)
+	require.Equal(t, "kafka:9092", o.broker)
+	require.Equal(t, "orders", o.topic)
+	require.Equal(t, []string{"a.ndjson", "b.ndjson.zst"}, o.archives)
+	require.Equal(t, selection{}, o.sel)
+
+	o, err = parseOptions([]string{"-target", "storage", "-config", "prod.yaml", "-uids", "a, b,,",
+		"-customer", "c1", "-since", "2021-11-01T00:00:00Z", "-until", "2021-12-01T00:00:00Z", "-"})
+	require.NoError(t, err)
+	require.Equal(t, targetStorage, o.target)
+	require.Equal(t, "prod.yaml", o.config)
+	require.Equal(t, map[string]bool{"a": true, "b": true}, o.sel.uids)
+	require.Equal(t, "c1", o.sel.customer)
+	require.Equal(t, time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC), o.sel.since)
+	require.Equal(t, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC), o.sel.until)
+	require.Equal(t, []string{"-"}, o.archives)
+
+	// the target doesn't matter when the orders are only counted
+	o, err = parseOptions([]string{"-dry-run", "-target", "s3", "a.ndjson"})
+	require.NoError(t, err)
+	require.True(t, o.dryRun)
+
+	for _, args := range [][]string{
+		nil,
+		{"-target", "s3", "a.ndjson"},
+		{"-since", "yesterday", "a.ndjson"},
+		{"-until", "2021-12-01", "a.ndjson"},
+		{"-unknown", "a.ndjson"},
+	} {
+		_, err := parseOptions(args)
+		require.Error(t, err, args)
+	}
+}
+
+func TestSelectionMatch(t *testing.T) {
+	order := models.Order{OrderUID: "a", CustomerID: "c1", DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)}
+	for _, tc := range []struct {
+		name  string
+		sel   selection
+		match bool
+	}{
+		{name: "everything", match: true},
+		{name: "uid", sel: selection{uids: map[string]bool{"a": true}}, match: true},
+		{name: "other uid", sel: selection{uids: map[string]bool{"b": true}}},
+		{name: "other customer", sel: selection{customer: "c2"}},
+		{name: "since", sel: selection{since: order.DateCreated}, match: true},
+		{name: "before since", sel: selection{since: order.DateCreated.Add(time.Second)}},
+		// until is exclusive
+		{name: "until", sel: selection{until: order.DateCreated}},
+		{name: "before until", sel: selection{until: order.DateCreated.Add(time.Second)}, match: true},
+	} {
+		require.Equal(t, tc.match, tc.sel.match(order), tc.name)
+	}
+}
+
+// stubSink stores the first put of every order, err fails the puts of an order_uid
+type stubSink struct {
+	saved map[string][]byte
+	err   map[string]error
+}
+
+func (s *stubSink) put(_ context.Context, order models.Order, raw []byte) (bool, error) {
+	if err := s.err[order.OrderUID]; err != nil {
+		return false, err
+	}
+	if _, ok := s.saved[order.OrderUID]; ok {
+		return false, nil
+	}
+	s.saved[order.OrderUID] = append([]byte(nil), raw...)
+	return true, nil
+}
+
+func (s *stubSink) close() error { return nil }
+
+func writeArchive(t *testing.T, name string, lines ...string) string {
+	path := filepath.Join(t.TempDir(), name)
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	if strings.HasSuffix(name, ".zst") {
+		enc, err := zstd.NewWriter(nil)
+		require.NoError(t, err)
+		data = enc.EncodeAll(data, nil)
+		require.NoError(t, enc.Close())
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestRestore(t *testing.T) {
+	plain := writeArchive(t, "orders.ndjson",
+		archiveLine("order-uid-a", "c1"),
+		"",
+		"{not json",
+		archiveLine("order-uid-b", "c2"),
+		archiveLine("order-uid-c", "c1"),
+	)
+	// the second archive repeats an order of the first one
+	compressed := writeArchive(t, "orders.ndjson.zst", archiveLine("order-uid-a", "c1"), archiveLine("order-uid-d", "c1"))
+	sel := selection{customer: "c1"}
+
+	t.Run("dry run", func(t *testing.T) {
+		r, err := restore(context.Background(), []string{plain, compressed}, sel, nil)
+		require.NoError(t, err)
+		require.Equal(t, report{read: 6, matched: 4, invalid: 1}, r)
+	})
+
+	t.Run("restored", func(t *testing.T) {
+		out := &stubSink{saved: map[string][]byte{}, err: map[string]error{
+			"order-uid-c": &models.ValidationError{Field: "payment.currency", Message: "unsupported currency"},
+		}}
+		r, err := restore(context.Background(), []string{plain, compressed}, sel, out)
+		require.NoError(t, err)
+		require.Equal(t, report{read: 6, matched: 4, restored: 2, existing: 1, invalid: 2}, r)
+		require.Len(t, out.saved, 2)
+		// the payload is passed on as archived
+		require.Equal(t, archiveLine("order-uid-d", "c1"), string(out.saved["order-uid-d"]))
+	})
+
+	t.Run("sink failure", func(t *testing.T) {
+		out := &stubSink{saved: map[string][]byte{}, err: map[string]error{"order-uid-c": errors.New("connection refused")}}
+		r, err := restore(context.Background(), []string{plain, compressed}, sel, out)
+		require.ErrorContains(t, err, plain+":5: connection refused")
+		// the next archive is not read
+		require.Equal(t, report{read: 4, matched: 2, restored: 1, invalid: 1}, r)
+	})
+
+	t.Run("missing archive", func(t *testing.T) {
+		_, err := restore(context.Background(), []string{filepath.Join(t.TempDir(), "missing.ndjson")}, sel, nil)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := restore(ctx, []string{plain}, sel, nil)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestStorageSink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	out := storageSink{db: storage.NewWithDB(db)}
+	raw := []byte(archiveLine("order-uid-a", "c1"))
+	var order models.Order
+	require.NoError(t, json.Unmarshal(raw, &order))
+
+	t.Run("saved", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO order_status_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		saved, err := out.put(context.Background(), order, raw)
+		require.NoError(t, err)
+		require.True(t, saved)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("already stored", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		saved, err := out.put(context.Background(), order, raw)
+		require.NoError(t, err)
+		require.False(t, saved)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := order
+		invalid.OrderUID = ""
+		_, err := out.put(context.Background(), invalid, raw)
+		var verr *models.ValidationError
+		require.ErrorAs(t, err, &verr)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+		saved, err := out.put(context.Background(), order, raw)
+		require.ErrorContains(t, err, "connection refused")
+		require.False(t, saved)
+	})
+}
@@ -0,0 +1,65 @@
+// Command seed generates random orders and bulk-loads them straight into Postgres with COPY,
+// bypassing Kafka, to populate local and staging environments.
+package main
+
+import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		config string
+		count  int
+		batch  int
+		days   int
+	)
+	flag.StringVar(&config, "config", "config.yaml", "server config")
+	flag.IntVar(&count, "n", 100_000, "number of orders to generate")
+	flag.IntVar(&batch, "batch", 5_000, "orders per COPY transaction")
+	flag.IntVar(&days, "days", 30, "spread date_created over the last days, 0 - all now")
+	flag.Parse()
+	if count <= 0 || batch <= 0 || days < 0 {
+		log.Fatalf("n and batch must be positive, days non-negative")
+	}
+
+	cfg := models.MustLoad(config)
+	db, err := storage.New(*cfg)
+	if err != nil {
+		log.Fatalf("can't init storage: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	start := time.Now()
+	orders := make([]models.Order, 0, batch)
+	for seeded := 0; seeded < count; {
+		orders = orders[:0]
+		for len(orders) < batch && seeded+len(orders) < count {
+			order := generator.RandomOrder(r)
+			if days > 0 {
+				order.DateCreated = order.DateCreated.Add(-time.Duration(r.Int63n(int64(days) * int64(24*time.Hour))))
+			}
+			orders = append(orders, order)
+		}
+		if err := db.CopyOrders(ctx, orders); err != nil {
+			log.Fatalf("seeding stopped after %d orders: %v", seeded, err)
+		}
+		seeded += len(orders)
+		log.Printf("Seeded %d/%d orders", seeded, count)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("Seeded %d orders in %v (%.0f orders/s)\n", count, elapsed.Round(time.Millisecond), float64(count)/elapsed.Seconds())
+}
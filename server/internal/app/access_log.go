@@ -0,0 +1,102 @@
+package app
+
+import (
+	"WB_LVL0/server/internal/auth"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// HeaderRequestID carries the ID of a request; an ID sent by the caller (e.g. a proxy) is kept
+	HeaderRequestID = "X-Request-ID"
+	// ctxRequestID is the gin context key holding the request ID
+	ctxRequestID = "request_id"
+	// maxRequestIDLen bounds the accepted IDs, longer ones are replaced
+	maxRequestIDLen = 128
+)
+
+// RequestID returns the ID of the request, also sent back in the X-Request-ID header
+func RequestID(c *gin.Context) string {
+	return c.GetString(ctxRequestID)
+}
+
+// requestID assigns the request its ID: the one of X-Request-ID or a new UUID
+func requestID(c *gin.Context) {
+	id := c.GetHeader(HeaderRequestID)
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	c.Set(ctxRequestID, id)
+	c.Header(HeaderRequestID, id)
+	c.Next()
+}
+
+// validRequestID accepts printable ASCII IDs of a sane length, they are logged as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLog logs the requests, server errors at the error level and client errors at warn.
+// Successful requests of the sampled routes are logged with the probability of cfg.SampleRatio
+// unless slower than cfg.Slow.
+func accessLog(cfg models.AccessLogCfg) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		status := c.Writer.Status()
+		if !sampled(cfg, c.FullPath(), status, elapsed) {
+			return
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			logging.Duration("elapsed", elapsed),
+			"client_ip", c.ClientIP(),
+			"size", c.Writer.Size(),
+			"request_id", RequestID(c),
+			"trace_id", tracing.TraceID(c.Request.Context()),
+		}
+		// the caller is known on the authenticated routes only
+		if subject := auth.Subject(c); subject != "" {
+			attrs = append(attrs, "caller", subject)
+		}
+		httpLogger.Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// sampled decides whether the request is logged
+func sampled(cfg models.AccessLogCfg, route string, status int, elapsed time.Duration) bool {
+	if cfg.SampleRatio >= 1 || status >= http.StatusBadRequest || !slices.Contains(cfg.SampledRoutes, route) {
+		return true
+	}
+	if cfg.Slow > 0 && elapsed >= cfg.Slow {
+		return true
+	}
+	return rand.Float64() < cfg.SampleRatio
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"WB_LVL0/server/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestID)
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, RequestID(c)) })
+	call := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(HeaderRequestID, id)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("proxy-42")
+	require.Equal(t, "proxy-42", w.Body.String())
+	require.Equal(t, "proxy-42", w.Header().Get(HeaderRequestID))
+
+	// missing and unusable IDs are replaced
+	for _, id := range []string{"", "two words", strings.Repeat("x", maxRequestIDLen+1)} {
+		w = call(id)
+		require.Len(t, w.Body.String(), 36)
+		require.Equal(t, w.Body.String(), w.Header().Get(HeaderRequestID))
+	}
+}
+
+func TestSampled(t *testing.T) {
+	cfg := models.AccessLogCfg{SampledRoutes: []string{"/order/:order_uid"}, SampleRatio: 0, Slow: time.Second}
+	require.False(t, sampled(cfg, "/order/:order_uid", http.StatusOK, time.Millisecond))
+	// failed, slow and not sampled requests are always logged
+	require.True(t, sampled(cfg, "/order/:order_uid", http.StatusNotFound, time.Millisecond))
+	require.True(t, sampled(cfg, "/order/:order_uid", http.StatusOK, 2*time.Second))
+	require.True(t, sampled(cfg, "/orders", http.StatusOK, time.Millisecond))
+
+	cfg.SampleRatio = 1
+	require.True(t, sampled(cfg, "/order/:order_uid", http.StatusOK, time.Millisecond))
+}
@@ -0,0 +1,533 @@
+package app
+
+import (
+	_ "WB_LVL0/docs"
+	"WB_LVL0/server/internal/audit"
+	"WB_LVL0/server/internal/auth"
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/dlq"
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/internal/notify"
+	"WB_LVL0/server/internal/outbox"
+	"WB_LVL0/server/internal/partitions"
+	"WB_LVL0/server/internal/service"
+	"WB_LVL0/server/internal/stats"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/internal/tracking"
+	"WB_LVL0/server/internal/webhook"
+	k "WB_LVL0/server/kafka"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/rabbitmq"
+	"WB_LVL0/server/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	logger     = logging.Component("app")
+	httpLogger = logging.Component("http")
+	httpTracer = tracing.Tracer("http")
+)
+
+// orderConsumer consumes the orders from the broker of cfg.Transport and publishes quarantined ones again
+type orderConsumer interface {
+	Run(ctx context.Context)
+	Health(ctx context.Context) health.Result
+	Progress() *health.Progress
+	Redrive(ctx context.Context, m models.FailedMessage) error
+}
+
+// App is the whole order service (storage, HTTP router and Kafka consumer)
+// assembled from a config, so it can be embedded in integration tests and other binaries.
+type App struct {
+	cfg      models.Config
+	storage  *storage.Storage
+	consumer orderConsumer
+	relay    *outbox.Relay
+	parts    *partitions.Maintainer
+	audit    *audit.Recorder     // nil - the audit log is disabled
+	webhooks *webhook.Dispatcher // nil - webhooks are disabled
+	alerts   *notify.Alerter     // nil - notifications are disabled
+	tracker  *tracking.Tracker   // nil - shipment tracking is disabled
+	stats    *stats.Refresher    // nil - the analytics are aggregated on every request
+	retrier  *dlq.Retrier        // nil - quarantined messages are redriven manually only
+	hub      *broadcast.Hub
+	health   *health.Registry
+	router   *gin.Engine
+
+	reloadMu sync.Mutex
+	live     models.Config // cfg with the reloaded settings applied
+}
+
+// New connects to the storages and builds the router and the Kafka consumer.
+// Nothing is served or consumed until Run is called.
+func New(cfg models.Config) (_ *App, err error) {
+	const op = "app.New"
+	//init PostrgeSQL and Redis
+	db, err := storage.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: can't set connection to postgres: %v", op, err)
+	}
+	// releases the pools and stops the background work of the storage when a later step fails
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	//init hub of newly ingested orders
+	hub := broadcast.NewHub()
+	//init notifications of ops and business
+	alerts, err := notify.New(db, cfg.Notify)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	//init shipment tracking of orders at their delivery services
+	tracker, err := tracking.New(db, cfg.Tracking)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	//init outbox relay, it also enqueues the deliveries of the webhook subscriptions and evaluates the order alerts
+	var extra []outbox.Destination
+	if cfg.Webhooks.Enabled {
+		extra = append(extra, webhook.NewFanout(db))
+	}
+	if alerts != nil {
+		for _, d := range alerts.Destinations() {
+			extra = append(extra, d)
+		}
+	}
+	relay, err := outbox.NewRelay(db, cfg.Outbox, extra...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	//orders are saved and read through the backend-agnostic repository
+	var repo storage.Repository = db
+	//init service
+	serv := service.NewService(repo, hub)
+	//init consumer of the orders, only the Kafka one can move its offsets and measure the group backlog
+	var consumer orderConsumer
+	var seeker service.ConsumerSeeker
+	var backlog service.BacklogReporter
+	switch cfg.Transport {
+	case models.TransportRabbitMQ:
+		consumer = rabbitmq.NewConsumer(repo, hub, cfg.RabbitMQ)
+	default:
+		kc := k.NewConsumer(repo, hub, cfg.Kafka)
+		consumer, seeker, backlog = kc, kc, kc
+	}
+
+	a := &App{
+		cfg:      cfg,
+		live:     cfg,
+		storage:  db,
+		consumer: consumer,
+		relay:    relay,
+		parts:    partitions.NewMaintainer(db, cfg.DBConf),
+		audit:    audit.NewRecorder(db, cfg.Audit, RequestID),
+		webhooks: webhook.NewDispatcher(db, cfg.Webhooks),
+		alerts:   alerts,
+		tracker:  tracker,
+		stats:    stats.NewRefresher(db, cfg.Stats),
+		retrier:  dlq.NewRetrier(db, consumer, cfg.DLQRetry),
+		hub:      hub,
+		router:   newRouter(cfg.Log.Access),
+	}
+	a.health = a.newHealthRegistry()
+	a.registerRoutes(serv, service.NewAdminService(db, a.consumer, db, seeker, db, a, hub), backlog, auth.New(db, cfg.AuthConf))
+	return a, nil
+}
+
+// newRouter creates the router assigning IDs to the requests, tracing them and logging them and recovered
+// panics as JSON. Gin prints its debug output (routes, warnings) only at the debug level.
+func newRouter(access models.AccessLogCfg) *gin.Engine {
+	if !logging.Enabled(slog.LevelDebug) {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	router := gin.New()
+	router.Use(requestID, traceRequest, accessLog(access), gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		httpLogger.Error("panic recovered", "method", c.Request.Method, "path", c.Request.URL.Path, "request_id", RequestID(c), "panic", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	return router
+}
+
+// traceRequest runs the request in a server span continuing the trace of the caller's traceparent header.
+// Requests of an order are tagged with its UID.
+func traceRequest(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	name := c.Request.Method
+	if route := c.FullPath(); route != "" {
+		name += " " + route
+	}
+	ctx, span := httpTracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(c.FullPath()),
+			semconv.URLPath(c.Request.URL.Path),
+		))
+	defer span.End()
+	span.SetAttributes(attribute.String("http.request.id", RequestID(c)))
+	if uid := c.Param("order_uid"); uid != "" {
+		span.SetAttributes(tracing.OrderUID(uid))
+	}
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+	status := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// registerRoutes registers the routes; backlog is nil for a transport without a consumer group
+func (a *App) registerRoutes(serv *service.Service, admin *service.AdminService, backlog service.BacklogReporter, authenticator *auth.Authenticator) {
+	static := a.cfg.ServConf.StaticDir
+	// records the access to the routes of an order (order_uid parameter), public and admin ones
+	if a.audit != nil {
+		a.router.Use(a.audit.Middleware())
+	}
+	a.router.GET("/", func(c *gin.Context) {
+		c.File(filepath.Join(static, "index.html"))
+	})
+	a.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	a.router.GET("/order/:order_uid", serv.GetOrder)
+	a.router.HEAD("/order/:order_uid", serv.OrderExists)
+	a.router.GET("/order/:order_uid/receipt.pdf", serv.GetReceipt)
+	a.router.GET("/order/:order_uid/raw", service.NewRawService(a.storage).GetRawOrder)
+	if a.tracker != nil {
+		a.router.GET("/order/:order_uid/tracking", service.NewTrackingService(serv.OrderProvider, a.tracker).GetTracking)
+	}
+	a.router.GET("/orders", serv.ListOrders)
+	a.router.GET("/orders/count", serv.CountOrders)
+	a.router.GET("/orders/stream", serv.StreamOrders)
+	search := service.NewSearchService(a.storage)
+	a.router.GET("/orders/search", search.SearchOrders)
+	a.router.GET("/items/search", search.SearchItems)
+	analytics := service.NewStatsService(a.storage)
+	a.router.GET("/stats/customers/top", analytics.TopCustomers)
+	a.router.GET("/stats/revenue", analytics.Revenue)
+	a.router.GET("/stats/items/top", analytics.TopItems)
+	a.router.GET("/customers/:customer_id/orders", service.NewCustomerService(a.storage).ListOrders)
+	a.router.GET("/customers/:customer_id/orders/stream", serv.StreamCustomerOrders)
+	a.router.GET("/status/:token", service.NewStatusService(a.storage).GetStatus)
+	a.router.GET("/metrics", metrics.Handler())
+	a.router.GET("/schemas/order.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/schema+json", models.OrderSchema)
+	})
+	a.router.GET("/healthz/consumer", service.NewConsumerHealthService(a.consumer.Progress(), a.cfg.Health.ConsumerStuckAfter).ConsumerHealth)
+	if backlog != nil {
+		a.router.GET("/consumer/backlog", service.NewBacklogService(backlog).ConsumerBacklog)
+	}
+	a.router.Static("/static", static)
+
+	adminGroup := a.router.Group("/admin", authenticator.Middleware())
+	keys := service.NewKeyService(authenticator)
+	adminGroup.POST("/keys", keys.CreateKey)
+	adminGroup.GET("/keys", keys.ListKeys)
+	adminGroup.DELETE("/keys/:id", keys.RevokeKey)
+	adminGroup.POST("/keys/:id/rotate", keys.RotateKey)
+	adminGroup.GET("/failed-messages", admin.ListFailedMessages)
+	adminGroup.GET("/failed-messages/:id", admin.GetFailedMessage)
+	adminGroup.DELETE("/failed-messages/:id", admin.DiscardFailedMessage)
+	adminGroup.POST("/failed-messages/:id/redrive", admin.RedriveFailedMessage)
+	adminGroup.GET("/cache/stats", admin.CacheStats)
+	if a.cfg.Transport == models.TransportKafka {
+		adminGroup.POST("/consumer/seek", admin.SeekConsumer)
+	}
+	adminGroup.POST("/orders", admin.CreateOrder)
+	adminGroup.GET("/orders/:order_uid", admin.GetOrder)
+	adminGroup.DELETE("/orders/:order_uid", admin.DeleteOrder)
+	adminGroup.POST("/orders/:order_uid/restore", admin.RestoreOrder)
+	adminGroup.GET("/orders/:order_uid/events", admin.OrderEvents)
+	adminGroup.GET("/health/full", service.NewHealthService(a.health).FullHealth)
+	adminGroup.POST("/config/reload", admin.ReloadConfig)
+	adminGroup.GET("/audit", service.NewAuditService(a.storage).ListRecords)
+	webhooks := service.NewWebhookService(a.storage)
+	adminGroup.POST("/webhooks", webhooks.CreateWebhook)
+	adminGroup.GET("/webhooks", webhooks.ListWebhooks)
+	adminGroup.DELETE("/webhooks/:id", webhooks.DeleteWebhook)
+	adminGroup.GET("/webhooks/:id/deliveries", webhooks.ListDeliveries)
+	adminGroup.POST("/webhook-deliveries/:id/retry", webhooks.RetryDelivery)
+}
+
+// newHealthRegistry registers the health checks of all subsystems
+func (a *App) newHealthRegistry() *health.Registry {
+	r := health.NewRegistry()
+	// the report itself is served over HTTP, so the server is up whenever it can be read
+	r.Register("http", func(context.Context) health.Result { return health.Result{Status: health.StatusUp} })
+	r.Register("consumer", a.consumerHealth)
+	r.Register("postgres", health.Ping(health.StatusDown, a.storage.Ping))
+	// reads fall back to Postgres without Redis unless the cache is the only read path
+	redisFailed := health.StatusDegraded
+	if a.cfg.RDBConf.ReadStrategy == models.ReadCacheOnly {
+		redisFailed = health.StatusDown
+	}
+	r.Register("redis", health.Ping(redisFailed, a.storage.PingRedis))
+	r.Register("outbox relay", a.relay.Health)
+	r.Register("partitions", a.parts.Health)
+	if a.audit != nil {
+		r.Register("audit log", a.audit.Health)
+	}
+	if a.webhooks != nil {
+		r.Register("webhooks", a.webhooks.Health)
+	}
+	if a.alerts != nil {
+		r.Register("notifications", a.alerts.Health)
+	}
+	if a.stats != nil {
+		r.Register("customer stats", a.stats.Health)
+	}
+	if a.retrier != nil {
+		r.Register("dlq retrier", a.retrier.Health)
+	}
+	return r
+}
+
+// consumerHealth is the health of the consumer, down also while its loop is stuck (health.consumer_stuck_after)
+func (a *App) consumerHealth(ctx context.Context) health.Result {
+	res := a.consumer.Health(ctx)
+	if p := a.consumer.Progress().Check(a.cfg.Health.ConsumerStuckAfter); p.Status == string(health.StatusDown) {
+		res.Status, res.Err = health.StatusDown, errors.New(p.Reason)
+	}
+	return res
+}
+
+// Handler returns the HTTP handler of the service, e.g. for httptest servers
+func (a *App) Handler() http.Handler {
+	return a.router
+}
+
+// Storage returns the storage used by the service
+func (a *App) Storage() *storage.Storage {
+	return a.storage
+}
+
+// ReloadConfig resolves the config again from its flags, environment and file and applies the changed
+// settings tagged reload:"true" (the cache tunables of storage, the log level and the allowed values of order fields)
+// by swapping in a new snapshot.
+// The other changed settings are reported as requiring a restart.
+func (a *App) ReloadConfig() (models.ConfigReload, error) {
+	const op = "app.ReloadConfig"
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	next, err := a.live.Reload()
+	if err != nil {
+		return models.ConfigReload{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := next.Validate(); err != nil {
+		return models.ConfigReload{}, fmt.Errorf("%s: %v", op, err)
+	}
+	live := a.live
+	applied, restart := live.ApplyReloadable(*next)
+	if len(applied) > 0 {
+		if err := a.storage.ReloadCacheConfig(live.RDBConf); err != nil {
+			return models.ConfigReload{}, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+	a.live = live
+	if err := logging.SetLevel(live.Log.Level); err != nil {
+		return models.ConfigReload{}, fmt.Errorf("%s: %v", op, err)
+	}
+	models.SetValidationRules(live.Validation)
+	logger.Info("config reloaded", "applied", applied, "restart_required", restart)
+	return models.ConfigReload{Applied: applied, RestartRequired: restart}, nil
+}
+
+// Run starts the HTTP server and the Kafka consumer and blocks until ctx is cancelled
+// or the HTTP server fails.
+func (a *App) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:    a.cfg.ServConf.Host,
+		Handler: a.router,
+	}
+	// SSE streams never finish on their own, they are ended when the draining starts
+	srv.RegisterOnShutdown(a.hub.Close)
+	srvErr := make(chan error, 1)
+	//server start
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			srvErr <- fmt.Errorf("HTTP server error: %v", err)
+		}
+	}()
+
+	// background workers stop together when ctx is cancelled or the HTTP server fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Processing message
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		a.consumer.Run(ctx)
+	}()
+	logger.Info("consumer started, waiting for messages")
+
+	// Relaying outbox events
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		a.relay.Run(ctx)
+	}()
+
+	// Creating partitions of the coming months
+	partsDone := make(chan struct{})
+	go func() {
+		defer close(partsDone)
+		a.parts.Run(ctx)
+	}()
+
+	// Writing the audit log
+	auditDone := make(chan struct{})
+	go func() {
+		defer close(auditDone)
+		a.audit.Run(ctx)
+	}()
+
+	// Sending webhook deliveries
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		a.webhooks.Run(ctx)
+	}()
+
+	// Checking the periodic notification rules
+	alertsDone := make(chan struct{})
+	go func() {
+		defer close(alertsDone)
+		a.alerts.Run(ctx)
+	}()
+
+	// Refreshing the materialized analytics
+	statsDone := make(chan struct{})
+	go func() {
+		defer close(statsDone)
+		a.stats.Run(ctx)
+	}()
+
+	// Redriving the transient failures of the quarantine
+	retrierDone := make(chan struct{})
+	go func() {
+		defer close(retrierDone)
+		a.retrier.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-srvErr:
+	}
+	cancel()
+	a.shutdown(srv, consumerDone, relayDone, partsDone, auditDone, webhooksDone, alertsDone, statsDone, retrierDone)
+	return err
+}
+
+// shutdown stops the components one by one within ServConf.ShutdownTimeout,
+// logging which of them did not finish in time. The relay destinations and the storage are closed
+// even when the budget is exhausted.
+func (a *App) shutdown(srv *http.Server, consumerDone, relayDone, partsDone, auditDone, webhooksDone, alertsDone, statsDone, retrierDone <-chan struct{}) {
+	budget := a.cfg.ServConf.ShutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+	logger.Info("shutting down", logging.Duration("budget", budget))
+	start := time.Now()
+
+	shutdownStep(ctx, "http server", func() error {
+		drainCtx, cancel := context.WithTimeout(ctx, a.cfg.ServConf.DrainTimeout)
+		defer cancel()
+		err := srv.Shutdown(drainCtx)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			logger.Warn("requests still in flight after the drain timeout, dropping their connections",
+				logging.Duration("drain_timeout", a.cfg.ServConf.DrainTimeout))
+			return nil
+		}
+		return err
+	})
+	// drops connections still open after the draining step
+	if err := srv.Close(); err != nil {
+		logger.Error("failed to close HTTP server", logging.Err(err))
+	}
+	// before the consumer, whose connection publishes the redrives
+	shutdownStep(ctx, "dlq retrier", func() error {
+		<-retrierDone
+		return nil
+	})
+	shutdownStep(ctx, a.cfg.Transport+" consumer", func() error {
+		<-consumerDone
+		return nil
+	})
+	shutdownStep(ctx, "outbox relay", func() error {
+		<-relayDone
+		return nil
+	})
+	// closes the destinations even when the budget is exhausted
+	a.relay.Close()
+	shutdownStep(ctx, "partition maintainer", func() error {
+		<-partsDone
+		return nil
+	})
+	shutdownStep(ctx, "webhook dispatcher", func() error {
+		<-webhooksDone
+		return nil
+	})
+	shutdownStep(ctx, "notifications", func() error {
+		<-alertsDone
+		return nil
+	})
+	shutdownStep(ctx, "customer stats", func() error {
+		<-statsDone
+		return nil
+	})
+	// after the HTTP server, so the records of the drained requests are written
+	shutdownStep(ctx, "audit log", func() error {
+		<-auditDone
+		a.audit.Close()
+		return nil
+	})
+	// not a step: the connections are released even when the budget is exhausted
+	if err := a.storage.Close(); err != nil {
+		logger.Error("failed to close storage", logging.Err(err))
+	}
+	logger.Info("shutdown finished", logging.Duration("elapsed", time.Since(start)))
+}
+
+// shutdownStep runs stop until it returns or the shutdown budget in ctx runs out
+func shutdownStep(ctx context.Context, name string, stop func() error) {
+	if ctx.Err() != nil {
+		logger.Warn("shutdown step skipped, budget exhausted", "step", name)
+		return
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- stop() }()
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			logger.Error("shutdown step failed", "step", name, logging.Duration("elapsed", time.Since(start)), logging.Err(err))
+			return
+		}
+		if ctx.Err() == nil {
+			logger.Info("shutdown step finished", "step", name, logging.Duration("elapsed", time.Since(start)))
+			return
+		}
+	case <-ctx.Done():
+	}
+	logger.Warn("shutdown step exceeded the budget", "step", name, logging.Duration("elapsed", time.Since(start)))
+}
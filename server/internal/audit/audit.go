@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"WB_LVL0/server/internal/auth"
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// Anonymous is the subject of requests to the public endpoints, they carry no API key
+const Anonymous = "anonymous"
+
+// flushTimeout bounds one write of a batch
+const flushTimeout = 5 * time.Second
+
+var logger = logging.Component("audit")
+
+// Store is interface of the audit log storage (api_audit table)
+type Store interface {
+	SaveAuditRecords(ctx context.Context, records []models.AuditRecord) error
+}
+
+// Recorder records which caller read or changed which order. Requests only queue their records,
+// Run writes them in batches; when the queue is full the records are dropped and counted.
+type Recorder struct {
+	store     Store
+	queue     chan models.AuditRecord
+	batchSize int
+	interval  time.Duration
+	errs      health.LastError // last failed write
+	requestID func(c *gin.Context) string
+}
+
+// NewRecorder creates the recorder of cfg, nil if the audit is disabled. requestID returns the ID
+// of a request stored with its records.
+func NewRecorder(store Store, cfg models.AuditCfg, requestID func(c *gin.Context) string) *Recorder {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Recorder{
+		store:     store,
+		queue:     make(chan models.AuditRecord, cfg.QueueSize),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.FlushInterval,
+		requestID: requestID,
+	}
+}
+
+// Middleware records the requests of the routes addressing an order by the order_uid parameter,
+// after the handler so the record has the response status
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		orderUID := c.Param("order_uid")
+		if orderUID == "" {
+			return
+		}
+		subject := auth.Subject(c)
+		if subject == "" {
+			subject = Anonymous
+		}
+		r.record(models.AuditRecord{
+			Subject:   subject,
+			Method:    c.Request.Method,
+			Endpoint:  c.FullPath(),
+			OrderUID:  orderUID,
+			Status:    c.Writer.Status(),
+			ClientIP:  c.ClientIP(),
+			RequestID: r.requestID(c),
+			CreatedAt: time.Now(),
+		})
+	}
+}
+
+func (r *Recorder) record(rec models.AuditRecord) {
+	select {
+	case r.queue <- rec:
+	default:
+		metrics.AuditDropped.Inc()
+		logger.Error("audit queue is full, record dropped", "subject", rec.Subject, "method", rec.Method,
+			"endpoint", rec.Endpoint, "order_uid", rec.OrderUID, "request_id", rec.RequestID)
+	}
+}
+
+// Run writes the queued records until ctx is cancelled, then writes the rest.
+// Records of the requests finishing later are written by Close.
+func (r *Recorder) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	batch := make([]models.AuditRecord, 0, r.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			r.drain(batch)
+			return
+		case rec := <-r.queue:
+			batch = append(batch, rec)
+			if len(batch) < r.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		batch = r.flush(batch)
+	}
+}
+
+// Close writes the records queued after Run returned, e.g. by the requests drained on shutdown
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.drain(nil)
+}
+
+// drain writes the batch and the records still queued
+func (r *Recorder) drain(batch []models.AuditRecord) {
+	for {
+		select {
+		case rec := <-r.queue:
+			batch = append(batch, rec)
+			if len(batch) >= r.batchSize {
+				batch = r.flush(batch)
+			}
+		default:
+			r.flush(batch)
+			return
+		}
+	}
+}
+
+// flush writes the batch and returns it emptied; a failed batch is logged and dropped,
+// keeping it would grow the queue while the database is down
+func (r *Recorder) flush(batch []models.AuditRecord) []models.AuditRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	err := r.store.SaveAuditRecords(ctx, batch)
+	if err != nil {
+		metrics.AuditDropped.Add(float64(len(batch)))
+		logger.Error("failed to write audit records", "records", len(batch), logging.Err(err))
+	}
+	r.errs.Set(err)
+	return batch[:0]
+}
+
+// Health is degraded while the last write of records failed
+func (r *Recorder) Health(context.Context) health.Result {
+	return r.errs.Result()
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	batches [][]models.AuditRecord
+	err     error
+}
+
+func (m *memStore) SaveAuditRecords(ctx context.Context, records []models.AuditRecord) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, append([]models.AuditRecord(nil), records...))
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memStore{}
+	r := NewRecorder(store, models.AuditCfg{Enabled: true, QueueSize: 10, BatchSize: 2, FlushInterval: time.Hour},
+		func(*gin.Context) string { return "req-1" })
+
+	router := gin.New()
+	router.Use(r.Middleware())
+	router.GET("/order/:order_uid", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.DELETE("/admin/orders/:order_uid", func(c *gin.Context) {
+		c.Set("auth.subject", "wb_1234abcd")
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/order/uid1", nil),
+		httptest.NewRequest(http.MethodDelete, "/admin/orders/uid2", nil),
+		// no order is addressed
+		httptest.NewRequest(http.MethodGet, "/orders", nil),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	r.Close()
+
+	require.Len(t, store.batches, 1)
+	records := store.batches[0]
+	require.Len(t, records, 2)
+	require.Equal(t, Anonymous, records[0].Subject)
+	require.Equal(t, "/order/:order_uid", records[0].Endpoint)
+	require.Equal(t, "uid1", records[0].OrderUID)
+	require.Equal(t, "req-1", records[0].RequestID)
+	require.Equal(t, "wb_1234abcd", records[1].Subject)
+	require.Equal(t, http.MethodDelete, records[1].Method)
+	require.Equal(t, http.StatusNoContent, records[1].Status)
+}
+
+func TestRecorderDrops(t *testing.T) {
+	store := &memStore{}
+	r := NewRecorder(store, models.AuditCfg{Enabled: true, QueueSize: 1, BatchSize: 10, FlushInterval: time.Hour}, nil)
+	dropped := testutil.ToFloat64(metrics.AuditDropped)
+
+	// the queue holds one record, the next one is dropped
+	r.record(models.AuditRecord{OrderUID: "uid1"})
+	r.record(models.AuditRecord{OrderUID: "uid2"})
+	require.Equal(t, dropped+1, testutil.ToFloat64(metrics.AuditDropped))
+
+	// a failed write drops the batch and degrades the health
+	store.err = errors.New("connection refused")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+	require.Equal(t, dropped+2, testutil.ToFloat64(metrics.AuditDropped))
+	require.Error(t, r.Health(context.Background()).Err)
+
+	require.Nil(t, NewRecorder(store, models.AuditCfg{}, nil))
+}
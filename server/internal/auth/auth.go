@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderAPIKey carries the API key; "Authorization: Bearer <key>" is accepted as well
+	HeaderAPIKey = "X-API-Key"
+	keyPrefix    = "wb_"
+	prefixLen    = len(keyPrefix) + 8
+	// ctxSubject is the gin context key holding the authenticated caller (key prefix or "bootstrap")
+	ctxSubject = "auth.subject"
+)
+
+// KeyStore is interface of the API key storage
+type KeyStore interface {
+	CreateAPIKey(ctx context.Context, name, prefix, secretHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	RotateAPIKey(ctx context.Context, id int64, prefix, secretHash string) (*models.APIKey, error)
+	APIKeyActive(ctx context.Context, secretHash string) (bool, error)
+}
+
+type cachedLookup struct {
+	active  bool
+	expires time.Time
+}
+
+var logger = logging.Component("http")
+
+// Authenticator checks API keys against the store, caching lookups for a short TTL,
+// and manages key creation, rotation and revocation.
+type Authenticator struct {
+	store         KeyStore
+	bootstrapHash string
+	ttl           time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+func New(store KeyStore, cfg models.Auth) *Authenticator {
+	a := &Authenticator{
+		store: store,
+		ttl:   cfg.KeyCacheTTL,
+		cache: make(map[string]cachedLookup),
+	}
+	if cfg.AdminKey != "" {
+		a.bootstrapHash = HashSecret(cfg.AdminKey)
+	}
+	return a
+}
+
+// HashSecret returns the hex sha256 of the secret as stored in the database
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateSecret returns a new random secret and its public prefix
+func generateSecret() (secret, prefix string, err error) {
+	buf := make([]byte, 24)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	random := base64.RawURLEncoding.EncodeToString(buf)
+	prefix = keyPrefix + random[:prefixLen-len(keyPrefix)]
+	return prefix + "_" + random[8:], prefix, nil
+}
+
+// Middleware rejects requests without a valid API key
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader(HeaderAPIKey)
+		if secret == "" {
+			secret = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if secret == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key required"})
+			return
+		}
+		hash := HashSecret(secret)
+		if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrapHash)) == 1 {
+			c.Set(ctxSubject, "bootstrap")
+			c.Next()
+			return
+		}
+		active, err := a.lookup(c.Request.Context(), hash)
+		if err != nil {
+			logger.Error("api key lookup failed", logging.Err(err))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "can't verify api key"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+			return
+		}
+		c.Set(ctxSubject, subjectOf(secret))
+		c.Next()
+	}
+}
+
+// Subject returns the authenticated caller of the request (empty if unauthenticated)
+func Subject(c *gin.Context) string {
+	return c.GetString(ctxSubject)
+}
+
+// subjectOf identifies a key by its public prefix, never by the secret
+func subjectOf(secret string) string {
+	if len(secret) > prefixLen && strings.HasPrefix(secret, keyPrefix) {
+		return secret[:prefixLen]
+	}
+	return "unknown"
+}
+
+func (a *Authenticator) lookup(ctx context.Context, hash string) (bool, error) {
+	now := time.Now()
+	a.mu.Lock()
+	entry, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.active, nil
+	}
+	active, err := a.store.APIKeyActive(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+	a.mu.Lock()
+	a.cache[hash] = cachedLookup{active: active, expires: now.Add(a.ttl)}
+	a.mu.Unlock()
+	return active, nil
+}
+
+// invalidate drops cached lookups so revocations take effect immediately on this instance
+func (a *Authenticator) invalidate() {
+	a.mu.Lock()
+	a.cache = make(map[string]cachedLookup)
+	a.mu.Unlock()
+}
+
+// CreateKey generates and stores a new key; the returned key contains the secret
+func (a *Authenticator) CreateKey(ctx context.Context, name string) (*models.APIKey, error) {
+	secret, prefix, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.store.CreateAPIKey(ctx, name, prefix, HashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	key.Secret = secret
+	return key, nil
+}
+
+func (a *Authenticator) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	return a.store.ListAPIKeys(ctx)
+}
+
+func (a *Authenticator) RevokeKey(ctx context.Context, id int64) error {
+	if err := a.store.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+	a.invalidate()
+	return nil
+}
+
+// RotateKey revokes the key and returns its replacement with a new secret
+func (a *Authenticator) RotateKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	secret, prefix, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.store.RotateAPIKey(ctx, id, prefix, HashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	a.invalidate()
+	key.Secret = secret
+	return key, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	hashes  map[string]bool
+	lookups int
+}
+
+func (m *memStore) CreateAPIKey(ctx context.Context, name, prefix, secretHash string) (*models.APIKey, error) {
+	m.hashes[secretHash] = true
+	return &models.APIKey{ID: int64(len(m.hashes)), Name: name, Prefix: prefix}, nil
+}
+
+func (m *memStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) { return nil, nil }
+
+func (m *memStore) RevokeAPIKey(ctx context.Context, id int64) error {
+	for h := range m.hashes {
+		m.hashes[h] = false
+	}
+	return nil
+}
+
+func (m *memStore) RotateAPIKey(ctx context.Context, id int64, prefix, secretHash string) (*models.APIKey, error) {
+	return nil, nil
+}
+
+func (m *memStore) APIKeyActive(ctx context.Context, secretHash string) (bool, error) {
+	m.lookups++
+	return m.hashes[secretHash], nil
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memStore{hashes: make(map[string]bool)}
+	a := New(store, models.Auth{AdminKey: "bootstrap-secret", KeyCacheTTL: time.Minute})
+
+	router := gin.New()
+	router.GET("/admin", a.Middleware(), func(c *gin.Context) { c.String(http.StatusOK, Subject(c)) })
+	call := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if key != "" {
+			req.Header.Set(HeaderAPIKey, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, call("").Code)
+	require.Equal(t, http.StatusUnauthorized, call("wrong").Code)
+	require.Equal(t, "bootstrap", call("bootstrap-secret").Body.String())
+
+	key, err := a.CreateKey(context.Background(), "ops")
+	require.NoError(t, err)
+	w := call(key.Secret)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, key.Prefix, w.Body.String())
+
+	// the second request is served from the lookup cache
+	lookups := store.lookups
+	require.Equal(t, http.StatusOK, call(key.Secret).Code)
+	require.Equal(t, lookups, store.lookups)
+
+	// revocation invalidates the cache
+	require.NoError(t, a.RevokeKey(context.Background(), key.ID))
+	require.Equal(t, http.StatusUnauthorized, call(key.Secret).Code)
+}
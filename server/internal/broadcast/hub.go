@@ -0,0 +1,85 @@
+package broadcast
+
+import (
+	"WB_LVL0/server/models"
+	"sync"
+)
+
+// subscriberBuffer is how many orders can wait for a slow subscriber before new ones are dropped
+const subscriberBuffer = 64
+
+type subscriber struct {
+	ch     chan models.Order
+	filter func(models.Order) bool
+}
+
+// Hub fans out newly ingested orders to all subscribers (SSE streams etc.).
+// Publishing never blocks: a subscriber that can't keep up misses orders.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe registers a subscriber receiving orders accepted by filter (all orders if filter is nil).
+// The returned function unsubscribes and closes the channel. After Close the channel is closed at once.
+func (h *Hub) Subscribe(filter func(models.Order) bool) (<-chan models.Order, func()) {
+	sub := &subscriber{
+		ch:     make(chan models.Order, subscriberBuffer),
+		filter: filter,
+	}
+	h.mu.Lock()
+	if h.closed {
+		close(sub.ch)
+	} else {
+		h.subs[sub] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	return sub.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// the channel of a subscriber removed by Close is already closed
+		if _, ok := h.subs[sub]; ok {
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Close closes the channels of all subscribers, ending their streams, e.g. on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish sends the order to every matching subscriber
+func (h *Hub) Publish(order models.Order) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		if sub.filter != nil && !sub.filter(order) {
+			continue
+		}
+		select {
+		case sub.ch <- order:
+		default:
+		}
+	}
+}
+
+// ByCustomer returns a filter accepting only orders of the given customer
+func ByCustomer(customerID string) func(models.Order) bool {
+	return func(o models.Order) bool {
+		return o.CustomerID == customerID
+	}
+}
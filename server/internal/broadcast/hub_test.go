@@ -0,0 +1,58 @@
+package broadcast
+
+import (
+	"WB_LVL0/server/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubFilterByCustomer(t *testing.T) {
+	hub := NewHub()
+	orders, unsubscribe := hub.Subscribe(ByCustomer("user1"))
+	defer unsubscribe()
+
+	hub.Publish(models.Order{OrderUID: "a", CustomerID: "user2"})
+	hub.Publish(models.Order{OrderUID: "b", CustomerID: "user1"})
+
+	got := <-orders
+	require.Equal(t, "b", got.OrderUID)
+	require.Len(t, orders, 0)
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	hub := NewHub()
+	orders, unsubscribe := hub.Subscribe(nil)
+	unsubscribe()
+	unsubscribe()
+
+	hub.Publish(models.Order{OrderUID: "a"})
+	_, ok := <-orders
+	require.False(t, ok)
+}
+
+func TestHubDoesNotBlockOnSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	_, unsubscribe := hub.Subscribe(nil)
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		hub.Publish(models.Order{})
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	orders, unsubscribe := hub.Subscribe(nil)
+	hub.Close()
+	_, ok := <-orders
+	require.False(t, ok)
+	unsubscribe()
+
+	// streams opened during the shutdown end at once
+	late, unsubscribe := hub.Subscribe(nil)
+	_, ok = <-late
+	require.False(t, ok)
+	unsubscribe()
+	hub.Publish(models.Order{OrderUID: "a"})
+}
@@ -0,0 +1,93 @@
+package dlq
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"time"
+)
+
+// Store claims the quarantined messages due for an automatic redrive and removes the redriven ones
+type Store interface {
+	ClaimRetryableFailedMessages(ctx context.Context, cfg models.DLQRetryCfg) ([]models.FailedMessage, error)
+	DeleteFailedMessage(ctx context.Context, id int64) error
+}
+
+// Redriver publishes a quarantined message again to the consumed topic or queue
+type Redriver interface {
+	Redrive(ctx context.Context, m models.FailedMessage) error
+}
+
+var logger = logging.Component("dlq")
+
+// Retrier redrives the transient failures of the quarantine with growing delays, so a message that failed
+// during a short database incident is processed without an operator
+type Retrier struct {
+	store    Store
+	redriver Redriver
+	cfg      models.DLQRetryCfg
+	errs     health.LastError
+}
+
+// NewRetrier returns nil if the automatic redrives are disabled
+func NewRetrier(store Store, redriver Redriver, cfg models.DLQRetryCfg) *Retrier {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Retrier{store: store, redriver: redriver, cfg: cfg}
+}
+
+// Run redrives the due messages every interval until ctx is cancelled
+func (r *Retrier) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := r.retry(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("automatic redrive failed", logging.Err(err))
+		}
+		r.errs.Set(err)
+	}
+}
+
+// retry redrives one batch of the due messages. A message is removed from the quarantine once redriven;
+// failing again it comes back with one more automatic redrive counted.
+func (r *Retrier) retry(ctx context.Context) error {
+	messages, err := r.store.ClaimRetryableFailedMessages(ctx, r.cfg)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, m := range messages {
+		m.AutoRetries++
+		if err := r.redriver.Redrive(ctx, m); err != nil {
+			// the claim expires after the initial delay, then it is tried again
+			metrics.DLQAutoRetries.WithLabelValues("failed").Inc()
+			lastErr = err
+			continue
+		}
+		if err := r.store.DeleteFailedMessage(ctx, m.ID); err != nil {
+			// redriven anyway: the record is redriven again later, the consumer skips the duplicate order
+			logger.Error("failed to remove redriven message", "id", m.ID, logging.Err(err))
+		}
+		metrics.DLQAutoRetries.WithLabelValues("redriven").Inc()
+		logger.Info("message redriven automatically", "id", m.ID, "topic", m.Topic, "auto_retries", m.AutoRetries,
+			"max_attempts", r.cfg.MaxAttempts)
+	}
+	return lastErr
+}
+
+// Health is degraded while the last redrives failed
+func (r *Retrier) Health(context.Context) health.Result {
+	return r.errs.Result()
+}
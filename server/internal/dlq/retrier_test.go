@@ -0,0 +1,53 @@
+package dlq
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubStore struct {
+	due     []models.FailedMessage
+	deleted []int64
+}
+
+func (s *stubStore) ClaimRetryableFailedMessages(context.Context, models.DLQRetryCfg) ([]models.FailedMessage, error) {
+	return s.due, nil
+}
+
+func (s *stubStore) DeleteFailedMessage(_ context.Context, id int64) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+type redriverFunc func(m models.FailedMessage) error
+
+func (f redriverFunc) Redrive(_ context.Context, m models.FailedMessage) error { return f(m) }
+
+func TestRetry(t *testing.T) {
+	store := &stubStore{due: []models.FailedMessage{{ID: 1, AutoRetries: 0}, {ID: 2, AutoRetries: 2}}}
+	var redriven []models.FailedMessage
+	r := NewRetrier(store, redriverFunc(func(m models.FailedMessage) error {
+		if m.ID == 2 {
+			return errors.New("not connected")
+		}
+		redriven = append(redriven, m)
+		return nil
+	}), models.DLQRetryCfg{Enabled: true, MaxAttempts: 5})
+
+	// the redriven message carries one more automatic redrive and leaves the quarantine,
+	// the failed one stays claimed until its lease expires
+	require.EqualError(t, r.retry(context.Background()), "not connected")
+	require.Equal(t, []models.FailedMessage{{ID: 1, AutoRetries: 1}}, redriven)
+	require.Equal(t, []int64{1}, store.deleted)
+}
+
+func TestNewRetrierDisabled(t *testing.T) {
+	r := NewRetrier(&stubStore{}, nil, models.DLQRetryCfg{})
+	require.Nil(t, r)
+	// a disabled retrier returns at once
+	r.Run(context.Background())
+}
@@ -0,0 +1,165 @@
+package health
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a single component check
+const checkTimeout = 2 * time.Second
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// score of a status, the composite score is the mean over components
+func (s Status) score() int {
+	switch s {
+	case StatusUp:
+		return 100
+	case StatusDegraded:
+		return 50
+	default:
+		return 0
+	}
+}
+
+// Result of a check. Err may be set for an up component: it is the last error it has recovered from.
+type Result struct {
+	Status Status
+	Err    error
+	ErrAt  time.Time
+}
+
+// Check reports the current state of a component
+type Check func(ctx context.Context) Result
+
+// Ping makes a Check from a probe: the component is failed while the probe fails
+func Ping(failed Status, probe func(ctx context.Context) error) Check {
+	return func(ctx context.Context) Result {
+		if err := probe(ctx); err != nil {
+			return Result{Status: failed, Err: err}
+		}
+		return Result{Status: StatusUp}
+	}
+}
+
+// Registry aggregates the checks of all subsystems into a models.HealthReport
+type Registry struct {
+	started    time.Time
+	mu         sync.Mutex
+	components []*component
+}
+
+type component struct {
+	name      string
+	check     Check
+	status    Status
+	since     time.Time
+	lastErr   string
+	lastErrAt time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{started: time.Now()}
+}
+
+// Register adds a component, reports keep the registration order
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components = append(r.components, &component{name: name, check: check, status: StatusUp, since: time.Now()})
+}
+
+// Report runs all checks concurrently and remembers status changes and errors between calls
+func (r *Registry) Report(ctx context.Context) models.HealthReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	results := make([]Result, len(r.components))
+	var wg sync.WaitGroup
+	for i, c := range r.components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+	report := models.HealthReport{
+		Status:     string(StatusUp),
+		StartedAt:  r.started,
+		Uptime:     now.Sub(r.started).Round(time.Second).String(),
+		Components: make([]models.ComponentHealth, 0, len(r.components)),
+	}
+	worst, total := StatusUp, 0
+	for i, c := range r.components {
+		res := results[i]
+		if res.Status != c.status {
+			c.status, c.since = res.Status, now
+		}
+		if res.Err != nil {
+			c.lastErr, c.lastErrAt = res.Err.Error(), res.ErrAt
+			if c.lastErrAt.IsZero() {
+				c.lastErrAt = now
+			}
+		}
+
+		ch := models.ComponentHealth{Name: c.name, Status: string(c.status), Since: c.since, LastError: c.lastErr}
+		if !c.lastErrAt.IsZero() {
+			at := c.lastErrAt
+			ch.LastErrorAt = &at
+		}
+		report.Components = append(report.Components, ch)
+
+		total += c.status.score()
+		if c.status.score() < worst.score() {
+			worst = c.status
+		}
+	}
+	report.Status = string(worst)
+	report.Score = 100
+	if len(r.components) > 0 {
+		report.Score = total / len(r.components)
+	}
+	return report
+}
+
+// LastError remembers the outcome of the last iteration of a background loop, safe for concurrent use
+type LastError struct {
+	mu      sync.Mutex
+	err     error
+	at      time.Time
+	failing bool
+}
+
+// Set records an iteration result, nil marks the loop as recovered but keeps the last error
+func (l *LastError) Set(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failing = err != nil
+	if err != nil {
+		l.err, l.at = err, time.Now()
+	}
+}
+
+// Result is degraded while the last iteration failed
+func (l *LastError) Result() Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := StatusUp
+	if l.failing {
+		status = StatusDegraded
+	}
+	return Result{Status: status, Err: l.err, ErrAt: l.at}
+}
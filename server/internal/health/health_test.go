@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryReport(t *testing.T) {
+	r := NewRegistry()
+	dbErr := errors.New("connection refused")
+	var dbDown bool
+	r.Register("http", func(context.Context) Result { return Result{Status: StatusUp} })
+	r.Register("db", Ping(StatusDown, func(context.Context) error {
+		if dbDown {
+			return dbErr
+		}
+		return nil
+	}))
+
+	report := r.Report(context.Background())
+	require.Equal(t, "up", report.Status)
+	require.Equal(t, 100, report.Score)
+	require.Len(t, report.Components, 2)
+	require.Nil(t, report.Components[1].LastErrorAt)
+
+	dbDown = true
+	report = r.Report(context.Background())
+	require.Equal(t, "down", report.Status)
+	require.Equal(t, 50, report.Score)
+	require.Equal(t, "db", report.Components[1].Name)
+	require.Equal(t, "connection refused", report.Components[1].LastError)
+	downSince := report.Components[1].Since
+
+	// the last error stays visible after recovery
+	dbDown = false
+	report = r.Report(context.Background())
+	require.Equal(t, "up", report.Status)
+	require.Equal(t, "connection refused", report.Components[1].LastError)
+	require.True(t, report.Components[1].Since.After(downSince))
+}
+
+func TestLastError(t *testing.T) {
+	var l LastError
+	require.Equal(t, StatusUp, l.Result().Status)
+
+	l.Set(errors.New("fetch failed"))
+	res := l.Result()
+	require.Equal(t, StatusDegraded, res.Status)
+	require.EqualError(t, res.Err, "fetch failed")
+
+	l.Set(nil)
+	res = l.Result()
+	require.Equal(t, StatusUp, res.Status)
+	require.EqualError(t, res.Err, "fetch failed")
+}
+
+func TestProgress(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := Progress{now: func() time.Time { return now }}
+	// waiting for messages is not being stuck
+	now = now.Add(time.Hour)
+	require.Equal(t, "up", p.Check(time.Minute).Status)
+
+	p.Fetched()
+	now = now.Add(30 * time.Second)
+	require.Equal(t, "up", p.Check(time.Minute).Status)
+	now = now.Add(time.Minute)
+	res := p.Check(time.Minute)
+	require.Equal(t, "down", res.Status)
+	require.Equal(t, "processing a message for 1m30s", res.Reason)
+
+	p.Committed(nil)
+	res = p.Check(time.Minute)
+	require.Equal(t, "up", res.Status)
+	require.Nil(t, res.BusySince)
+	require.Equal(t, now, *res.LastCommitAt)
+
+	// failing continuously, an empty fetch in between resets it
+	p.Failed(errors.New("connection refused"))
+	now = now.Add(50 * time.Second)
+	p.Failed(errors.New("connection refused"))
+	require.Equal(t, "up", p.Check(time.Minute).Status)
+	now = now.Add(20 * time.Second)
+	res = p.Check(time.Minute)
+	require.Equal(t, "down", res.Status)
+	require.Equal(t, "failing for 1m10s: connection refused", res.Reason)
+	p.Recovered()
+	res = p.Check(time.Minute)
+	require.Equal(t, "up", res.Status)
+	require.Equal(t, "connection refused", res.LastError)
+}
@@ -0,0 +1,104 @@
+package health
+
+import (
+	"WB_LVL0/server/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Progress tracks whether the loop of a consumer moves on: when it last fetched and committed a message,
+// since when it is busy with the current one and since when it has been failing without a success in between.
+// Waiting for the messages of an idle topic is not being stuck. Safe for concurrent use.
+type Progress struct {
+	mu           sync.Mutex
+	fetchedAt    time.Time
+	committedAt  time.Time
+	busySince    time.Time
+	failingSince time.Time
+	err          error
+	now          func() time.Time
+}
+
+func (p *Progress) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// Fetched records a message received, the loop is busy with it until Committed
+func (p *Progress) Fetched() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetchedAt = p.clock()
+	p.busySince = p.fetchedAt
+	p.failingSince = time.Time{}
+}
+
+// Committed records the message done with; a failed commit leaves the loop failing
+func (p *Progress) Committed(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busySince = time.Time{}
+	if err != nil {
+		p.fail(err)
+		return
+	}
+	p.committedAt = p.clock()
+	p.failingSince = time.Time{}
+}
+
+// Failed records a failed fetch or connection attempt
+func (p *Progress) Failed(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail(err)
+}
+
+func (p *Progress) fail(err error) {
+	if p.failingSince.IsZero() {
+		p.failingSince = p.clock()
+	}
+	p.err = err
+}
+
+// Recovered records a success without a message, e.g. an empty fetch or a reconnection
+func (p *Progress) Recovered() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failingSince = time.Time{}
+}
+
+// Check reports the loop down if it has been busy with a message or failing for longer than stuckAfter
+func (p *Progress) Check(stuckAfter time.Duration) models.ConsumerProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock()
+	res := models.ConsumerProgress{
+		Status:       string(StatusUp),
+		LastFetchAt:  timePtr(p.fetchedAt),
+		LastCommitAt: timePtr(p.committedAt),
+		BusySince:    timePtr(p.busySince),
+		FailingSince: timePtr(p.failingSince),
+	}
+	if p.err != nil {
+		res.LastError = p.err.Error()
+	}
+	switch {
+	case !p.busySince.IsZero() && now.Sub(p.busySince) > stuckAfter:
+		res.Status = string(StatusDown)
+		res.Reason = fmt.Sprintf("processing a message for %s", now.Sub(p.busySince).Round(time.Second))
+	case !p.failingSince.IsZero() && now.Sub(p.failingSince) > stuckAfter:
+		res.Status = string(StatusDown)
+		res.Reason = fmt.Sprintf("failing for %s: %v", now.Sub(p.failingSince).Round(time.Second), p.err)
+	}
+	return res
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
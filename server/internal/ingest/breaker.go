@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	breakerFailureThreshold = 3
+	breakerProbeInterval    = 5 * time.Second
+)
+
+// circuitBreaker stops consumption after consecutive database outages
+// and probes the database until it is healthy again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	threshold int
+	interval  time.Duration
+	probe     func(ctx context.Context) error
+	logger    *slog.Logger
+}
+
+func newCircuitBreaker(probe func(ctx context.Context) error, logger *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: breakerFailureThreshold,
+		interval:  breakerProbeInterval,
+		probe:     probe,
+		logger:    logger,
+	}
+}
+
+// failure records a database outage and reports whether it opened the circuit
+func (b *circuitBreaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		metrics.ConsumerCircuitOpen.Set(1)
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// waitClosed blocks while the circuit is open, probing the database every interval.
+// It returns ctx.Err() if ctx is cancelled first.
+func (b *circuitBreaker) waitClosed(ctx context.Context) error {
+	if !b.isOpen() {
+		return nil
+	}
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, b.interval)
+		err := b.probe(probeCtx)
+		cancel()
+		if err != nil {
+			b.logger.Warn("circuit open, database still unavailable", logging.Err(err))
+			continue
+		}
+		b.mu.Lock()
+		b.open = false
+		b.failures = 0
+		b.mu.Unlock()
+		metrics.ConsumerCircuitOpen.Set(0)
+		b.logger.Info("database is available again, resuming consumption")
+		return nil
+	}
+}
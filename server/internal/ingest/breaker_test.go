@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	probes := 0
+	b := newCircuitBreaker(func(ctx context.Context) error {
+		probes++
+		if probes < 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, slog.Default())
+	b.interval = time.Millisecond
+
+	require.False(t, b.failure())
+	require.False(t, b.failure())
+	require.True(t, b.failure())
+	require.True(t, b.isOpen())
+
+	require.NoError(t, b.waitClosed(context.Background()))
+	require.False(t, b.isOpen())
+	require.Equal(t, 2, probes)
+}
+
+func TestCircuitBreakerCancelled(t *testing.T) {
+	b := newCircuitBreaker(func(ctx context.Context) error { return errors.New("down") }, slog.Default())
+	b.interval = time.Millisecond
+	for i := 0; i < breakerFailureThreshold; i++ {
+		b.failure()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, b.waitClosed(ctx), context.DeadlineExceeded)
+}
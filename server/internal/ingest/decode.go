@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"WB_LVL0/server/models"
+	"encoding/json"
+	"fmt"
+)
+
+// DecodeErrorKind tells why Decode rejected a message
+type DecodeErrorKind int
+
+const (
+	// Invalid is a message that isn't an order: undecodable, an unsupported envelope or an invalid order
+	Invalid DecodeErrorKind = iota
+	// TooLarge is a message over validation.max_message_bytes or an order over validation.max_items
+	TooLarge
+)
+
+// DecodeError is a message rejected by Decode, retrying it doesn't help
+type DecodeError struct {
+	Kind DecodeErrorKind
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Decoded is an order message accepted by Decode
+type Decoded struct {
+	Order models.Order
+	// Raw is the payload of the message as sent, with the version it was sent with
+	Raw models.RawPayload
+	// Payload is Raw decoded to models.CurrentSchemaVersion
+	Payload []byte
+	// UnknownFields are the fields of the payload dropped by json.Unmarshal
+	UnknownFields []string
+}
+
+// Decode decodes and validates an order message the way the consumers do, for every transport and for
+// POST /admin/orders: the size limits, the envelope, the JSON Schema, the unknown fields and the rules of
+// the order. The error is a DecodeError; Decoded holds what was decoded before it.
+func Decode(message []byte) (Decoded, error) {
+	var d Decoded
+	// reject oversized orders before decoding them
+	if err := models.CheckMessageSize(message); err != nil {
+		return d, &DecodeError{Kind: TooLarge, Err: fmt.Errorf("oversized order: %w", err)}
+	}
+	env, err := models.OpenEnvelope(message)
+	if err != nil {
+		return d, invalid("invalid order message: %w", err)
+	}
+	d.Raw = models.RawPayload{Payload: env.Payload, SchemaVersion: env.SchemaVersion}
+	// a copy of the payload decoded to the current schema version, the raw one is stored as sent
+	if d.Payload, err = models.UpgradePayload(env.SchemaVersion, env.Payload); err != nil {
+		return d, invalid("invalid order message: %w", err)
+	}
+	// types and required fields, which json.Unmarshal would turn into zero values
+	if err := models.ValidateSchema(d.Payload); err != nil {
+		return d, invalid("invalid order message: %w", err)
+	}
+	if d.UnknownFields, err = models.CheckUnknownFields(d.Payload); err != nil {
+		return d, invalid("invalid order message: %w", err)
+	}
+	if err := json.Unmarshal(d.Payload, &d.Order); err != nil {
+		return d, invalid("failed to unmarshal order: %w", err)
+	}
+	if err := d.Order.CheckItems(); err != nil {
+		return d, &DecodeError{Kind: TooLarge, Err: fmt.Errorf("oversized order: %w", err)}
+	}
+	// soft deletion is not part of the message
+	d.Order.DeletedAt = nil
+	if err := d.Order.Validate(); err != nil {
+		return d, invalid("invalid order data: %w", err)
+	}
+	return d, nil
+}
+
+func invalid(format string, err error) error {
+	return &DecodeError{Kind: Invalid, Err: fmt.Errorf(format, err)}
+}
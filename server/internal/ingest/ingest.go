@@ -0,0 +1,352 @@
+package ingest
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxUnknownFields bounds the distinct unknown fields counted by path and remembered, the producer chooses them
+	maxUnknownFields = 100
+	// otherUnknownFields is the path the unknown fields beyond maxUnknownFields are counted under
+	otherUnknownFields = "other"
+
+	maxRetryAttempt = 5
+	initialBackoff  = 100 * time.Millisecond
+	maxBackoff      = 5 * time.Second
+)
+
+// ErrStopped is returned for a message left unprocessed because the consumer was stopped
+var ErrStopped = errors.New("consumer stopped")
+
+// Message is a consumed order message, whatever the transport
+type Message struct {
+	Topic     string // topic or queue
+	Partition int    // -1 without partitions
+	Offset    int64  // unique per failure without offsets
+	Key       string
+	Value     []byte
+	// AutoRetries is the number of automatic redrives in the models.HeaderAutoRetries header
+	AutoRetries int
+	// At is stored with the order for exactly once, nil otherwise
+	At *models.MessageOffset
+	// LogAttrs locate the message in the logs (partition and offset, delivery tag)
+	LogAttrs []any
+}
+
+// ParseAutoRetries parses the value of the models.HeaderAutoRetries header of any transport,
+// a missing or malformed one counts no redrives
+func ParseAutoRetries(header string) int {
+	n, err := strconv.Atoi(header)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// logArgs returns the log arguments args followed by the location of m
+func (m Message) logArgs(args ...any) []any {
+	return append(append(make([]any, 0, len(args)+len(m.LogAttrs)), args...), m.LogAttrs...)
+}
+
+// Settler settles a message with its broker
+type Settler interface {
+	// Ack settles a processed message, or one skipped as a duplicate
+	Ack() error
+	// DeadLetter moves a message failed after the retries, already quarantined, to the DLQ
+	DeadLetter(ctx context.Context, processingErr error) error
+	// Requeue gives back a message left unprocessed because the consumer was stopped
+	Requeue() error
+}
+
+// Pipeline decodes, validates and saves the consumed orders with retries; a failed message is quarantined
+// and dead-lettered, an unavailable database pauses it
+type Pipeline struct {
+	db      storage.Repository
+	hub     *broadcast.Hub
+	breaker *circuitBreaker
+	logger  *slog.Logger
+
+	mu sync.Mutex
+	// unknownFields are the unknown fields already logged as a warning, at most maxUnknownFields
+	unknownFields map[string]struct{}
+}
+
+// New creates the pipeline saving into db and publishing saved orders to hub, logging to logger
+func New(db storage.Repository, hub *broadcast.Hub, logger *slog.Logger) *Pipeline {
+	return &Pipeline{
+		db:            db,
+		hub:           hub,
+		breaker:       newCircuitBreaker(db.Ping, logger),
+		logger:        logger,
+		unknownFields: make(map[string]struct{}),
+	}
+}
+
+// Paused reports whether consumption is paused because the database is unavailable
+func (p *Pipeline) Paused() bool { return p.breaker.isOpen() }
+
+// WaitAvailable blocks while consumption is paused, it returns the error of ctx if ctx is cancelled first
+func (p *Pipeline) WaitAvailable(ctx context.Context) error { return p.breaker.waitClosed(ctx) }
+
+// Process processes msg with retries and settles it with s: acks it once processed, dead-letters it after
+// the retries and requeues it if ctx is cancelled meanwhile (ErrStopped), so no order is dead-lettered
+// because of a database outage or a shutdown
+func (p *Pipeline) Process(ctx context.Context, msg Message, s Settler) error {
+	err := p.processWithRetry(ctx, msg, s)
+	if errors.Is(err, ErrStopped) {
+		if reqErr := s.Requeue(); reqErr != nil {
+			p.logger.Error("failed to requeue message", msg.logArgs(logging.Err(reqErr))...)
+		}
+	}
+	return err
+}
+
+func (p *Pipeline) processWithRetry(ctx context.Context, msg Message, s Settler) error {
+	var lastErr error
+	var firstFailedAt time.Time
+	attempts := 0
+
+	for attempt := 0; attempt < maxRetryAttempt; attempt++ {
+		if attempt > 0 {
+			backoff := calculateBackoff(attempt)
+			p.logger.Info("retrying message", msg.logArgs("attempt", attempt, "attempts", maxRetryAttempt,
+				logging.Duration("backoff", backoff))...)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt)))
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w while retrying: %w", ErrStopped, ctx.Err())
+			case <-time.After(backoff):
+			}
+		}
+
+		err := p.processMessage(ctx, msg)
+		if err == nil {
+			p.breaker.success()
+			if err := s.Ack(); err != nil {
+				return fmt.Errorf("failed to ack message: %w", err)
+			}
+			return nil
+		}
+
+		// The database is unreachable: the order itself is fine, so don't burn retries
+		// and don't send it to the DLQ. Wait for the circuit to close and try again.
+		if p.isDBOutage(err) {
+			if p.breaker.failure() {
+				p.logger.Error("database is unavailable, pausing consumption", logging.Err(err))
+			}
+			if p.breaker.isOpen() {
+				if err := p.breaker.waitClosed(ctx); err != nil {
+					return fmt.Errorf("%w while database is unavailable: %w", ErrStopped, err)
+				}
+				// the failures before the outage don't count against the message
+				attempt, attempts, lastErr, firstFailedAt = -1, 0, nil, time.Time{}
+				continue
+			}
+		}
+
+		lastErr = err
+		attempts++
+		if firstFailedAt.IsZero() {
+			firstFailedAt = time.Now()
+		}
+		p.logger.Warn("message processing failed",
+			msg.logArgs("attempt", attempt+1, "attempts", maxRetryAttempt, logging.Err(err))...)
+
+		// Don't retry for invalid and oversized messages
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			break
+		}
+	}
+	// All retries failed, keep the raw payload in Postgres (survives DLQ retention)
+	if err := p.quarantine(msg, lastErr, attempts, firstFailedAt); err != nil {
+		p.logger.Error("failed to quarantine message", msg.logArgs(logging.Err(err))...)
+	}
+	// and send to DLQ
+	if err := s.DeadLetter(ctx, lastErr); err != nil {
+		return fmt.Errorf("failed to send to DLQ: %w (original error: %v)", err, lastErr)
+	}
+	return lastErr
+}
+
+// isDBOutage reports whether err is a storage failure caused by an unreachable database
+func (p *Pipeline) isDBOutage(err error) bool {
+	var se *saveError
+	if !errors.As(err, &se) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return p.db.Ping(ctx) != nil
+}
+
+// quarantine stores the failed message in the failed_messages table; storage failures are transient
+// and redriven automatically (dlq_retry), counting the redrives the message has had already
+func (p *Pipeline) quarantine(msg Message, processingErr error, attempts int, firstFailedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return p.db.SaveFailedMessage(ctx, models.FailedMessage{
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           msg.Key,
+		Payload:       string(msg.Value),
+		Error:         processingErr.Error(),
+		Attempts:      attempts,
+		FirstFailedAt: firstFailedAt,
+		LastFailedAt:  time.Now(),
+		Transient:     isTransient(processingErr),
+		AutoRetries:   msg.AutoRetries,
+	})
+}
+
+// isTransient reports whether err is a failure of the storage, which may succeed later, rather than of the message
+func isTransient(err error) bool {
+	var se *saveError
+	return errors.As(err, &se)
+}
+
+// calculateBackoff returns the exponential backoff of attempt with ±10% jitter, against a thundering herd
+func calculateBackoff(attempt int) time.Duration {
+	backoff := float64(initialBackoff) * math.Pow(2, float64(attempt))
+	if backoff > float64(maxBackoff) {
+		backoff = float64(maxBackoff)
+	}
+	jitter := rand.Float64() * (backoff * 0.2)
+	return time.Duration(backoff - (backoff * 0.1) + jitter)
+}
+
+// saveError marks failures of the storage (as opposed to invalid messages)
+type saveError struct {
+	err error
+}
+
+func (e *saveError) Error() string {
+	return fmt.Sprintf("failed to save order: %v", e.err)
+}
+
+func (e *saveError) Unwrap() error {
+	return e.err
+}
+
+// processMessage saves the order of msg; ctx carries the trace of the message, its cancellation
+// doesn't interrupt the save
+func (p *Pipeline) processMessage(ctx context.Context, msg Message) error {
+	startTime := time.Now()
+	p.logger.Debug("processing message", msg.LogAttrs...)
+
+	d, err := Decode(msg.Value)
+	if d.Raw.Payload != nil {
+		metrics.MessagesBySchemaVersion.WithLabelValues(strconv.Itoa(d.Raw.SchemaVersion)).Inc()
+	}
+	if d.Order.OrderUID != "" {
+		p.reportUnknownFields(d.Order.OrderUID, d.UnknownFields)
+		trace.SpanFromContext(ctx).SetAttributes(tracing.OrderUID(d.Order.OrderUID))
+	}
+	if err != nil {
+		countOversized(err)
+		return err
+	}
+	order := d.Order
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	// save to PostgreSQL and redis, with the offset of the message for exactly once
+	if err := p.save(ctx, order, d.Raw, msg); err != nil {
+		// redelivered message: it was processed already, nothing to do
+		if errors.Is(err, storage.ErrOffsetApplied) {
+			metrics.RedeliveredMessages.Inc()
+			p.logger.Info("redelivered message skipped", msg.logArgs("order_uid", order.OrderUID)...)
+			return nil
+		}
+		// the same order in another message (or a redelivery without exactly once): the order is already
+		// stored, the message is in the event log
+		if errors.Is(err, storage.ErrOrderExists) {
+			metrics.DuplicateOrders.Inc()
+			p.logger.Info("duplicate order skipped", msg.logArgs("order_uid", order.OrderUID)...)
+			return nil
+		}
+		return &saveError{err: err}
+	}
+	// notify live subscribers (SSE streams)
+	p.hub.Publish(order)
+
+	p.logger.Info("order processed", "order_uid", order.OrderUID, "items", len(order.Items),
+		"schema_version", d.Raw.SchemaVersion, logging.Duration("elapsed", time.Since(startTime)))
+
+	return nil
+}
+
+// save stores the order of msg with raw, its payload as sent, and the offset of msg only for exactly once
+func (p *Pipeline) save(ctx context.Context, order models.Order, raw models.RawPayload, msg Message) error {
+	if msg.At != nil {
+		return p.db.SaveOrderAt(ctx, order, raw, *msg.At)
+	}
+	return p.db.SaveOrderRaw(ctx, order, raw)
+}
+
+// reportUnknownFields counts the fields of the message of an order dropped by json.Unmarshal; the fields not
+// seen before are logged as a warning, later messages with them at debug level
+func (p *Pipeline) reportUnknownFields(orderUID string, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	seen := true
+	for _, field := range fields {
+		label, added := p.rememberUnknownField(field)
+		metrics.UnknownFields.WithLabelValues(label).Inc()
+		if added {
+			seen = false
+		}
+	}
+	level := slog.LevelWarn
+	if seen {
+		level = slog.LevelDebug
+	}
+	p.logger.Log(context.Background(), level, "unknown order fields dropped", "order_uid", orderUID, "fields", fields)
+}
+
+// rememberUnknownField returns the path field is counted under and whether it wasn't seen before. Beyond
+// maxUnknownFields distinct fields the new ones are counted as otherUnknownFields and not remembered,
+// so a producer sending arbitrary names grows neither the metric series nor the memory.
+func (p *Pipeline) rememberUnknownField(field string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.unknownFields[field]; ok {
+		return field, false
+	}
+	if len(p.unknownFields) >= maxUnknownFields {
+		return otherUnknownFields, false
+	}
+	p.unknownFields[field] = struct{}{}
+	if len(p.unknownFields) == maxUnknownFields {
+		p.logger.Warn("too many distinct unknown order fields, counting the new ones as other", "limit", maxUnknownFields)
+	}
+	return field, true
+}
+
+// countOversized counts the TooLargeError err of a message, which is quarantined without retries
+func countOversized(err error) {
+	var tooLarge *models.TooLargeError
+	if errors.As(err, &tooLarge) {
+		metrics.OversizedMessages.WithLabelValues(tooLarge.What).Inc()
+	}
+}
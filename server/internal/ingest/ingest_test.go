@@ -0,0 +1,199 @@
+package ingest
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubRepo struct {
+	storage.Repository
+	saveErr error
+	raw     []string
+	at      []models.MessageOffset
+	failed  []models.FailedMessage
+	// pingErrs fail the first pings
+	pingErrs int
+	pings    int
+}
+
+func (r *stubRepo) SaveOrderRaw(_ context.Context, order models.Order, _ models.RawPayload) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	r.raw = append(r.raw, order.OrderUID)
+	return nil
+}
+
+func (r *stubRepo) SaveOrderAt(_ context.Context, _ models.Order, _ models.RawPayload, at models.MessageOffset) error {
+	r.at = append(r.at, at)
+	return nil
+}
+
+func (r *stubRepo) SaveFailedMessage(_ context.Context, m models.FailedMessage) error {
+	r.failed = append(r.failed, m)
+	return nil
+}
+
+func (r *stubRepo) Ping(context.Context) error {
+	r.pings++
+	if r.pings <= r.pingErrs {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// settlement records how a message was settled
+type settlement struct {
+	acked, deadLettered, requeued bool
+}
+
+func (s *settlement) Ack() error { s.acked = true; return nil }
+
+func (s *settlement) DeadLetter(context.Context, error) error { s.deadLettered = true; return nil }
+
+func (s *settlement) Requeue() error { s.requeued = true; return nil }
+
+const testOrder = `{"order_uid": "b563feb7b2b84b6test", "track_number": "WBILMTESTTRACK", "entry": "WBIL",
+	"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+		"address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+	"payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD", "provider": "wbpay",
+		"amount": 1817, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500, "goods_total": 317,
+		"custom_fee": 0},
+	"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest",
+		"name": "Mascaras", "sale": 30, "size": "0", "total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo",
+		"status": 202}],
+	"locale": "en", "internal_signature": "", "customer_id": "test", "delivery_service": "meest", "shardkey": "9",
+	"sm_id": 99, "date_created": "2021-11-26T06:22:19Z", "oof_shard": "1"}`
+
+func TestProcessSavesAt(t *testing.T) {
+	repo := &stubRepo{}
+	p := New(repo, broadcast.NewHub(), slog.Default())
+	at := models.MessageOffset{Group: "g", Topic: "orders", Partition: 2, Offset: 41}
+
+	// exactly once stores the offset with the order
+	var s settlement
+	require.NoError(t, p.Process(context.Background(), Message{Value: []byte(testOrder), At: &at}, &s))
+	require.Equal(t, settlement{acked: true}, s)
+	require.Equal(t, []models.MessageOffset{at}, repo.at)
+	require.Empty(t, repo.raw)
+
+	s = settlement{}
+	require.NoError(t, p.Process(context.Background(), Message{Value: []byte(testOrder)}, &s))
+	require.Equal(t, settlement{acked: true}, s)
+	require.Equal(t, []string{"b563feb7b2b84b6test"}, repo.raw)
+}
+
+func TestDecode(t *testing.T) {
+	d, err := Decode([]byte(strings.Replace(testOrder, `"oof_shard": "1"`, `"oof_shard": "1", "deleted_at": "2021-11-27T00:00:00Z"`, 1)))
+	require.NoError(t, err)
+	require.Equal(t, "b563feb7b2b84b6test", d.Order.OrderUID)
+	require.Equal(t, models.SchemaVersionBare, d.Raw.SchemaVersion)
+	// the amounts are upgraded to minor units in a copy, the raw payload stays as sent
+	require.EqualValues(t, 181700, d.Order.Payment.Amount.Amount)
+	require.Contains(t, string(d.Raw.Payload), `"amount": 1817,`)
+	// soft deletion is not taken from the message
+	require.Nil(t, d.Order.DeletedAt)
+
+	for _, message := range []string{"{", `{"schema_version": 99, "payload": {}}`,
+		strings.Replace(testOrder, `"USD"`, `"GBP"`, 1)} {
+		_, err := Decode([]byte(message))
+		var de *DecodeError
+		require.ErrorAs(t, err, &de, message)
+		require.Equal(t, Invalid, de.Kind, message)
+	}
+}
+
+func TestProcessInvalidNotRetried(t *testing.T) {
+	repo := &stubRepo{}
+	p := New(repo, broadcast.NewHub(), slog.Default())
+
+	var s settlement
+	require.Error(t, p.Process(context.Background(), Message{Value: []byte("{")}, &s))
+	require.Equal(t, settlement{deadLettered: true}, s)
+	require.Len(t, repo.failed, 1)
+	require.Equal(t, 1, repo.failed[0].Attempts)
+	require.False(t, repo.failed[0].Transient)
+}
+
+func TestProcessStoppedDuringBackoff(t *testing.T) {
+	repo := &stubRepo{saveErr: errors.New("statement timeout")}
+	p := New(repo, broadcast.NewHub(), slog.Default())
+
+	// the shutdown doesn't wait for the backoff, the message is given back unprocessed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var s settlement
+	start := time.Now()
+	err := p.Process(ctx, Message{Value: []byte(testOrder)}, &s)
+	require.ErrorIs(t, err, ErrStopped)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, settlement{requeued: true}, s)
+	require.Empty(t, repo.failed)
+}
+
+func TestQuarantineTransient(t *testing.T) {
+	repo := &stubRepo{}
+	p := New(repo, broadcast.NewHub(), slog.Default())
+	msg := Message{Topic: "orders", Partition: -1, Key: "m-1", AutoRetries: 2}
+	require.NoError(t, p.quarantine(msg, &saveError{err: fmt.Errorf("statement timeout")}, 5, time.Now()))
+	require.True(t, repo.failed[0].Transient)
+	require.Equal(t, 2, repo.failed[0].AutoRetries)
+	require.Equal(t, "m-1", repo.failed[0].Key)
+}
+
+func TestProcessAfterOutage(t *testing.T) {
+	// the saves fail throughout, the database is unreachable for the first ones until the circuit opens
+	repo := &stubRepo{saveErr: errors.New("statement timeout"), pingErrs: breakerFailureThreshold}
+	p := New(repo, broadcast.NewHub(), slog.Default())
+	p.breaker.interval = time.Millisecond
+
+	var s settlement
+	start := time.Now()
+	err := p.Process(context.Background(), Message{Value: []byte(testOrder)}, &s)
+	require.ErrorContains(t, err, "statement timeout")
+	require.Equal(t, settlement{deadLettered: true}, s)
+	require.False(t, p.Paused())
+
+	// the failures before the circuit closed again are forgotten
+	require.Len(t, repo.failed, 1)
+	require.Equal(t, maxRetryAttempt, repo.failed[0].Attempts)
+	require.True(t, repo.failed[0].FirstFailedAt.After(start))
+}
+
+func TestRememberUnknownField(t *testing.T) {
+	p := New(&stubRepo{}, broadcast.NewHub(), slog.Default())
+	label, added := p.rememberUnknownField("items[].color")
+	require.Equal(t, "items[].color", label)
+	require.True(t, added)
+	_, added = p.rememberUnknownField("items[].color")
+	require.False(t, added)
+
+	// past the limit the new fields are folded into other and not remembered
+	for i := 1; i < maxUnknownFields; i++ {
+		p.rememberUnknownField(fmt.Sprintf("field%d", i))
+	}
+	label, added = p.rememberUnknownField("delivery.floor")
+	require.Equal(t, otherUnknownFields, label)
+	require.False(t, added)
+	require.Len(t, p.unknownFields, maxUnknownFields)
+	label, _ = p.rememberUnknownField("items[].color")
+	require.Equal(t, "items[].color", label)
+}
+
+func TestParseAutoRetries(t *testing.T) {
+	require.Equal(t, 3, ParseAutoRetries("3"))
+	// a missing or malformed header counts no redrives
+	for _, v := range []string{"", "three", "-1"} {
+		require.Zero(t, ParseAutoRetries(v), v)
+	}
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// level of the whole service, changed by SetLevel (e.g. on a config reload)
+var level = new(slog.LevelVar)
+
+// handler writes JSON lines to stderr. Component loggers are created at package init,
+// so the handler exists from the start and only its level is configured.
+var handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+
+func init() {
+	slog.SetDefault(slog.New(handler))
+	// the remaining users of the standard logger (libraries) log at info through the same handler
+	log.SetFlags(0)
+}
+
+// Component returns the logger of a part of the service, its records carry component=name
+func Component(name string) *slog.Logger {
+	return slog.New(handler).With("component", name)
+}
+
+// SetLevel sets the minimal level of the logged records: debug, info, warn or error
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Enabled reports whether records of the level are logged
+func Enabled(l slog.Level) bool {
+	return handler.Enabled(context.Background(), l)
+}
+
+// Err is the attribute of an error
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// Duration is the attribute of a duration rounded to milliseconds and formatted like 1.5s
+func Duration(key string, d time.Duration) slog.Attr {
+	return slog.String(key, d.Round(time.Millisecond).String())
+}
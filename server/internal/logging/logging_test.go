@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer level.Set(slog.LevelInfo)
+	require.True(t, Enabled(slog.LevelInfo))
+	require.False(t, Enabled(slog.LevelDebug))
+
+	require.NoError(t, SetLevel("debug"))
+	require.True(t, Enabled(slog.LevelDebug))
+	require.NoError(t, SetLevel("WARN"))
+	require.False(t, Enabled(slog.LevelInfo))
+
+	require.Error(t, SetLevel("verbose"))
+	require.True(t, Enabled(slog.LevelWarn))
+}
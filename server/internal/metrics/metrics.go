@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wb"
+
+var (
+	// DuplicateOrders counts messages whose order_uid was already stored (Kafka redelivery)
+	DuplicateOrders = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "duplicate_orders_total",
+		Help:      "Number of already stored orders received again and skipped as no-ops.",
+	})
+
+	// RedeliveredMessages counts messages at or before the offset stored in Postgres for their partition
+	RedeliveredMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "redelivered_messages_total",
+		Help:      "Number of messages already processed according to the stored offsets and skipped.",
+	})
+
+	// OversizedMessages counts messages quarantined for exceeding validation.max_message_bytes or max_items
+	OversizedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "oversized_messages_total",
+		Help:      "Number of messages rejected before decoding for their size or number of items.",
+	}, []string{"limit"})
+
+	// MessagesBySchemaVersion counts decoded messages by the schema version of their envelope, 0 for bare
+	// orders, to tell when the producers of an old version are gone
+	MessagesBySchemaVersion = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_by_schema_version_total",
+		Help:      "Number of order messages decoded by the schema version of their envelope (0 - no envelope).",
+	}, []string{"version"})
+
+	// UnknownFields counts the fields of accepted messages that the order has no place for, by path
+	// (items[].color), under validation.unknown_fields warn; the paths beyond the first 100 are counted as other
+	UnknownFields = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "unknown_fields_total",
+		Help:      "Number of unknown fields dropped from accepted order messages, by field path (other beyond 100 paths).",
+	}, []string{"field"})
+
+	// DLQAutoRetries counts the automatic redrives of quarantined messages by result: redriven or failed
+	DLQAutoRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dlq",
+		Name:      "auto_retries_total",
+		Help:      "Number of automatic redrives of transient failures from the quarantine by result.",
+	}, []string{"result"})
+
+	// CacheDBFallbacks counts GetOrder calls that missed the cache and went to Postgres
+	CacheDBFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "db_fallbacks_total",
+		Help:      "Number of order reads served from Postgres because of a cache miss.",
+	}, []string{"pattern"})
+
+	// CacheRepopulations counts writes of orders read from Postgres back into Redis
+	CacheRepopulations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "repopulations_total",
+		Help:      "Number of orders written back to Redis after a Postgres fallback, by result.",
+	}, []string{"pattern", "result"})
+
+	// CacheHits counts order reads served by the cache, from Redis or the in-process fallback
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Number of order reads served by the cache, by source (redis, local).",
+	}, []string{"source"})
+
+	// CacheMisses counts cache reads that found no usable order
+	CacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Number of cache reads without an order, by reason (absent, stale, error).",
+	}, []string{"reason"})
+
+	// CacheSets counts writes of orders into Redis
+	CacheSets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "sets_total",
+		Help:      "Number of orders written to Redis, by result.",
+	}, []string{"result"})
+
+	// CacheEvictions counts orders evicted from Redis as least recently used
+	CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Number of orders evicted from Redis above the cache limit.",
+	})
+
+	// BloomRejections counts order reads answered as not found by the Bloom filter without a Postgres query
+	BloomRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "bloom_rejections_total",
+		Help:      "Number of reads of unknown order UIDs rejected by the Bloom filter.",
+	})
+
+	// CachePreloadDuration is how long the last startup warm-up took
+	CachePreloadDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "preload_duration_seconds",
+		Help:      "Duration of the last cache warm-up.",
+	})
+
+	// DBQueryDuration is the latency of storage operations against Postgres
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of storage queries by operation and result (ok, not_found, error).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	// ConsumerRebalances counts consumer group generation changes seen by the reader
+	ConsumerRebalances = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "rebalances_total",
+		Help:      "Number of consumer group rebalances (generation changes).",
+	})
+
+	// ConsumerFetchErrors counts errors reported by the Kafka reader
+	ConsumerFetchErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "fetch_errors_total",
+		Help:      "Number of fetch errors reported by the Kafka reader.",
+	})
+
+	// ConsumerFetchTimeouts counts fetch timeouts reported by the Kafka reader
+	ConsumerFetchTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "fetch_timeouts_total",
+		Help:      "Number of fetch timeouts reported by the Kafka reader.",
+	})
+
+	// ConsumerLag is the reader's lag behind the end of the last fetched partition
+	ConsumerLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "lag",
+		Help:      "Consumer lag reported by the Kafka reader.",
+	})
+
+	// ConsumerActivePartitions is the number of partitions messages were consumed from since the last stats poll
+	ConsumerActivePartitions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "active_partitions",
+		Help:      "Number of distinct partitions consumed from during the last stats interval.",
+	})
+
+	// ConsumerPartitionOffset is the last consumed offset per partition
+	ConsumerPartitionOffset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "partition_offset",
+		Help:      "Last consumed offset per partition.",
+	}, []string{"partition"})
+
+	// ConsumerMessagesBehind is the backlog of the consumer group over all partitions of the topic
+	ConsumerMessagesBehind = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_behind",
+		Help:      "Messages of the topic not yet committed by the consumer group, summed over partitions.",
+	})
+
+	// ConsumerConsumeRate is the recent commit rate of the consumer group
+	ConsumerConsumeRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "consume_rate",
+		Help:      "Messages committed by the consumer group per second, smoothed.",
+	})
+
+	// ConsumerEstimatedDrain is how long the group needs to drain its backlog, -1 while it commits nothing
+	ConsumerEstimatedDrain = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "estimated_drain_seconds",
+		Help:      "Time to drain the backlog at the current commit rate, -1 if the group commits nothing.",
+	})
+
+	// AuditDropped counts the audit records lost because the queue was full or their write failed
+	AuditDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "dropped_records_total",
+		Help:      "Audit records of order access dropped because the queue was full or the write failed.",
+	})
+
+	// WebhookDeliveries counts the attempts of webhook deliveries by outcome: delivered, retry or dead
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "Attempts of webhook deliveries by outcome (delivered, retry - failed and rescheduled, dead - out of attempts).",
+	}, []string{"result"})
+
+	// Notifications counts the alerts sent by notifier and outcome: sent or failed
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notify",
+		Name:      "notifications_total",
+		Help:      "Alerts of the notification rules by notifier and outcome (sent, failed).",
+	}, []string{"notifier", "result"})
+
+	// TrackingRequests counts the shipment status requests by provider and result: cache, fetched, rate_limited or error
+	TrackingRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tracking",
+		Name:      "requests_total",
+		Help:      "Shipment status requests by provider and result (cache - served from Redis, fetched, rate_limited, error).",
+	}, []string{"provider", "result"})
+
+	// ConsumerCircuitOpen is 1 while consumption is paused because the database is unavailable
+	ConsumerCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "circuit_open",
+		Help:      "1 if consumption is paused by the database circuit breaker, 0 otherwise.",
+	})
+)
+
+// Handler exposes all registered metrics for Prometheus scraping
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
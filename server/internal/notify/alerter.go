@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var logger = logging.Component("notify")
+
+// Store is interface of the data the periodic rules are evaluated on
+type Store interface {
+	CountFailedMessagesSince(ctx context.Context, since time.Time) (int64, error)
+}
+
+type rule struct {
+	models.NotifyRuleCfg
+	notifiers []Notifier
+	// firing is set while a dlq_growth rule is above its threshold, so it alerts once and then on resolve
+	firing bool
+	// notified are the notifiers that got the pending alert of a dlq_growth rule, a retry skips them
+	notified map[Notifier]bool
+}
+
+// Alerter evaluates the notification rules and sends the alerts of fired ones to their notifiers.
+// Order rules are evaluated by the outbox relay on order_saved events, every notifier of them is a destination
+// of its own (see Destinations), so a failed alert is retried with the event for that notifier only;
+// dlq_growth rules are checked every check interval by Run.
+type Alerter struct {
+	store      Store
+	cfg        models.NotifyCfg
+	orderRules []*rule
+	dlqRules   []*rule
+	now        func() time.Time
+	errs       health.LastError // last failed check or alert of the dlq_growth rules
+}
+
+// New creates the alerter of cfg, nil if notifications are disabled
+func New(store Store, cfg models.NotifyCfg) (*Alerter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	notifiers := make(map[string]Notifier, len(cfg.Notifiers))
+	for _, nc := range cfg.Notifiers {
+		n, err := NewNotifier(nc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[nc.Name] = n
+	}
+	a := &Alerter{store: store, cfg: cfg, now: time.Now}
+	for _, rc := range cfg.Rules {
+		r := &rule{NotifyRuleCfg: rc}
+		for _, name := range rc.Notifiers {
+			n, ok := notifiers[name]
+			if !ok {
+				return nil, fmt.Errorf("notify rule %s: unknown notifier %q", rc.Name, name)
+			}
+			r.notifiers = append(r.notifiers, n)
+		}
+		switch rc.Type {
+		case models.RuleOrderAmount:
+			a.orderRules = append(a.orderRules, r)
+		case models.RuleDLQGrowth:
+			a.dlqRules = append(a.dlqRules, r)
+		default:
+			return nil, fmt.Errorf("notify rule %s: unknown type %q", rc.Name, rc.Type)
+		}
+	}
+	return a, nil
+}
+
+// Run checks the dlq_growth rules every check interval until ctx is cancelled
+func (a *Alerter) Run(ctx context.Context) {
+	if a == nil || len(a.dlqRules) == 0 {
+		return
+	}
+	ticker := time.NewTicker(a.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := a.checkDLQ(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("dlq growth check failed", logging.Err(err))
+		}
+		a.errs.Set(err)
+	}
+}
+
+// checkDLQ alerts when a rule starts firing and when it is resolved; a failed alert is sent again on the next check
+func (a *Alerter) checkDLQ(ctx context.Context) error {
+	var errs []error
+	for _, r := range a.dlqRules {
+		n, err := a.store.CountFailedMessagesSince(ctx, a.now().Add(-r.Window))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var alert Alert
+		switch {
+		case n >= r.Threshold && !r.firing:
+			alert = Alert{Rule: r.Name, Subject: "DLQ is growing: " + r.Name,
+				Text: fmt.Sprintf("%d messages failed within %v (threshold %d), see GET /admin/failed-messages", n, r.Window, r.Threshold)}
+		case n < r.Threshold && r.firing:
+			alert = Alert{Rule: r.Name, Subject: "Resolved: " + r.Name,
+				Text: fmt.Sprintf("%d messages failed within %v (threshold %d)", n, r.Window, r.Threshold)}
+		default:
+			// the change was reverted before all the notifiers got its alert
+			r.notified = nil
+			continue
+		}
+		if r.notified == nil {
+			r.notified = make(map[Notifier]bool, len(r.notifiers))
+		}
+		var failed bool
+		for _, n := range r.notifiers {
+			if r.notified[n] {
+				continue
+			}
+			if err := send(ctx, r, n, alert); err != nil {
+				errs = append(errs, err)
+				failed = true
+				continue
+			}
+			r.notified[n] = true
+		}
+		if !failed {
+			r.firing, r.notified = !r.firing, nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func send(ctx context.Context, r *rule, n Notifier, alert Alert) error {
+	if err := n.Notify(ctx, alert); err != nil {
+		metrics.Notifications.WithLabelValues(n.Name(), "failed").Inc()
+		return fmt.Errorf("notifier %s: %w", n.Name(), err)
+	}
+	metrics.Notifications.WithLabelValues(n.Name(), "sent").Inc()
+	logger.Info("alert sent", "rule", r.Name, "notifier", n.Name(), "subject", alert.Subject)
+	return nil
+}
+
+// Health is degraded while the last check of the dlq_growth rules failed
+func (a *Alerter) Health(context.Context) health.Result {
+	return a.errs.Result()
+}
+
+// Destinations returns the outbox destinations of the notifiers of the order rules, one per notifier,
+// so the relay records the delivery to each of them
+func (a *Alerter) Destinations() []*Destination {
+	var dests []*Destination
+	byNotifier := make(map[Notifier]*Destination)
+	for _, r := range a.orderRules {
+		for _, n := range r.notifiers {
+			d, ok := byNotifier[n]
+			if !ok {
+				d = &Destination{notifier: n}
+				byNotifier[n] = d
+				dests = append(dests, d)
+			}
+			d.rules = append(d.rules, r)
+		}
+	}
+	return dests
+}
+
+// Destination evaluates the order rules of one notifier on order_saved events, named
+// models.NotifyDestination:<notifier>. A notifier of several fired rules gets all their alerts again
+// when one of them fails.
+type Destination struct {
+	notifier Notifier
+	rules    []*rule
+}
+
+// Name, Accepts, Deliver and Close make the notifier an outbox destination
+
+func (d *Destination) Name() string { return models.NotifyDestination + ":" + d.notifier.Name() }
+
+func (d *Destination) Accepts(event models.OutboxEvent) bool {
+	// the events delivered before the notifiers had destinations of their own were alerted on already
+	return event.EventType == models.EventOrderSaved && !slices.Contains(event.Delivered, models.NotifyDestination)
+}
+
+func (d *Destination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	var order models.OrderSavedEvent
+	if err := json.Unmarshal(event.Payload, &order); err != nil {
+		// a malformed event will not parse on a retry either
+		logger.Error("failed to decode order event", "event_id", event.ID, logging.Err(err))
+		return nil
+	}
+	var errs []error
+	for _, r := range d.rules {
+		if alert, ok := orderAlert(r, order.Order); ok {
+			errs = append(errs, send(ctx, r, d.notifier, alert))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Destination) Close() error { return nil }
+
+// orderAlert returns the alert of an order_amount rule if the order fires it
+func orderAlert(r *rule, order models.Order) (Alert, bool) {
+	p := order.Payment
+	if (r.Currency != "" && p.Currency != r.Currency) || p.Amount.Amount <= r.Threshold {
+		return Alert{}, false
+	}
+	amount, threshold := p.Amount, p.Money(r.Threshold)
+	return Alert{
+		Rule:    r.Name,
+		Subject: fmt.Sprintf("Order %s for %s", order.OrderUID, amount),
+		Text: fmt.Sprintf("Order %s of customer %s is paid %s via %s (rule %s: above %s)",
+			order.OrderUID, order.CustomerID, amount, p.Provider, r.Name, threshold),
+	}, true
+}
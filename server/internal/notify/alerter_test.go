@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubNotifier struct {
+	name   string
+	alerts []Alert
+	err    error
+}
+
+func (n *stubNotifier) Name() string {
+	if n.name == "" {
+		return "stub"
+	}
+	return n.name
+}
+
+func (n *stubNotifier) Notify(_ context.Context, alert Alert) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+type stubStore struct {
+	failed int64
+	since  time.Time
+}
+
+func (s *stubStore) CountFailedMessagesSince(_ context.Context, since time.Time) (int64, error) {
+	s.since = since
+	return s.failed, nil
+}
+
+func TestOrderRules(t *testing.T) {
+	n := &stubNotifier{}
+	a := &Alerter{orderRules: []*rule{
+		{NotifyRuleCfg: models.NotifyRuleCfg{Name: "big-usd", Type: models.RuleOrderAmount, Threshold: 100000, Currency: "USD"}, notifiers: []Notifier{n}},
+	}}
+	dests := a.Destinations()
+	require.Len(t, dests, 1)
+	d := dests[0]
+	require.Equal(t, "notifications:stub", d.Name())
+	event := func(eventType, currency string, amount int64) models.OutboxEvent {
+		order := models.Order{OrderUID: "b563feb7b2b84b6test", CustomerID: "test",
+			Payment: models.Payment{Currency: currency, Amount: models.NewMoney(amount, currency), Provider: "wbpay"}}
+		payload, err := json.Marshal(models.OrderSavedEvent{Order: order})
+		require.NoError(t, err)
+		return models.OutboxEvent{ID: 1, EventType: eventType, Payload: payload}
+	}
+
+	require.True(t, d.Accepts(event(models.EventOrderSaved, "USD", 1)))
+	require.False(t, d.Accepts(event(models.EventOrderUpdated, "USD", 1)))
+	require.Empty(t, (&Alerter{}).Destinations())
+	// alerted on before the notifiers had destinations of their own
+	legacy := event(models.EventOrderSaved, "USD", 1)
+	legacy.Delivered = []string{models.NotifyDestination}
+	require.False(t, d.Accepts(legacy))
+
+	require.NoError(t, d.Deliver(context.Background(), event(models.EventOrderSaved, "USD", 100000)))
+	require.NoError(t, d.Deliver(context.Background(), event(models.EventOrderSaved, "RUB", 500000)))
+	require.Empty(t, n.alerts)
+
+	require.NoError(t, d.Deliver(context.Background(), event(models.EventOrderSaved, "USD", 250050)))
+	require.Equal(t, []Alert{{
+		Rule:    "big-usd",
+		Subject: "Order b563feb7b2b84b6test for 2500.50 USD",
+		Text:    "Order b563feb7b2b84b6test of customer test is paid 2500.50 USD via wbpay (rule big-usd: above 1000.00 USD)",
+	}}, n.alerts)
+
+	// a failed alert is retried by the outbox with the event
+	n.err = errors.New("chat is unavailable")
+	require.ErrorContains(t, d.Deliver(context.Background(), event(models.EventOrderSaved, "USD", 250050)), "notifier stub: chat is unavailable")
+}
+
+func TestOrderRulesDestinations(t *testing.T) {
+	ops, business := &stubNotifier{name: "ops"}, &stubNotifier{name: "business"}
+	a := &Alerter{orderRules: []*rule{
+		{NotifyRuleCfg: models.NotifyRuleCfg{Name: "big", Type: models.RuleOrderAmount, Threshold: 100}, notifiers: []Notifier{ops, business}},
+		{NotifyRuleCfg: models.NotifyRuleCfg{Name: "huge", Type: models.RuleOrderAmount, Threshold: 1000}, notifiers: []Notifier{ops}},
+	}}
+	payload, err := json.Marshal(models.OrderSavedEvent{Order: models.Order{OrderUID: "test",
+		Payment: models.Payment{Currency: "USD", Amount: models.NewMoney(5000, "USD")}}})
+	require.NoError(t, err)
+	event := models.OutboxEvent{ID: 1, EventType: models.EventOrderSaved, Payload: payload}
+
+	// each notifier is delivered to on its own, a failing one doesn't fail the others
+	dests := a.Destinations()
+	require.Len(t, dests, 2)
+	require.Equal(t, "notifications:ops", dests[0].Name())
+	require.Equal(t, "notifications:business", dests[1].Name())
+	business.err = errors.New("webhook is gone")
+	require.NoError(t, dests[0].Deliver(context.Background(), event))
+	require.Error(t, dests[1].Deliver(context.Background(), event))
+	require.Len(t, ops.alerts, 2)
+
+	// the retry reaches the failed notifier only
+	business.err = nil
+	require.NoError(t, dests[1].Deliver(context.Background(), event))
+	require.Len(t, business.alerts, 1)
+	require.Len(t, ops.alerts, 2)
+}
+
+func TestDLQRule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	n := &stubNotifier{}
+	store := &stubStore{}
+	a := &Alerter{store: store, now: func() time.Time { return now }, dlqRules: []*rule{
+		{NotifyRuleCfg: models.NotifyRuleCfg{Name: "dlq", Type: models.RuleDLQGrowth, Threshold: 10, Window: 15 * time.Minute}, notifiers: []Notifier{n}},
+	}}
+
+	store.failed = 3
+	require.NoError(t, a.checkDLQ(context.Background()))
+	require.Equal(t, now.Add(-15*time.Minute), store.since)
+	require.Empty(t, n.alerts)
+
+	// the alert is sent when the rule starts firing, not on every check
+	store.failed = 12
+	require.NoError(t, a.checkDLQ(context.Background()))
+	require.NoError(t, a.checkDLQ(context.Background()))
+	require.Len(t, n.alerts, 1)
+	require.Equal(t, "DLQ is growing: dlq", n.alerts[0].Subject)
+
+	// a failed resolve is sent again on the next check, to the failed notifiers only
+	ops := &stubNotifier{name: "ops"}
+	a.dlqRules[0].notifiers = append(a.dlqRules[0].notifiers, ops)
+	store.failed = 2
+	n.err = errors.New("smtp is down")
+	require.Error(t, a.checkDLQ(context.Background()))
+	require.Len(t, ops.alerts, 1)
+	n.err = nil
+	require.NoError(t, a.checkDLQ(context.Background()))
+	require.Len(t, n.alerts, 2)
+	require.Equal(t, "Resolved: dlq", n.alerts[1].Subject)
+	require.Len(t, ops.alerts, 1)
+	require.False(t, a.dlqRules[0].firing)
+}
+
+func TestChatNotifiers(t *testing.T) {
+	var paths []string
+	var bodies []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(data, &body))
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+	t.Setenv("TEST_BOT_TOKEN", "123:abc")
+
+	tg, err := NewNotifier(models.NotifierCfg{Name: "ops", Type: "telegram", BotToken: "${TEST_BOT_TOKEN}", ChatID: "-100"})
+	require.NoError(t, err)
+	tg.(*telegramNotifier).apiURL = srv.URL
+	slack, err := NewNotifier(models.NotifierCfg{Name: "business", Type: "slack", WebhookURL: srv.URL + "/services/T0/B0"})
+	require.NoError(t, err)
+
+	alert := Alert{Rule: "dlq", Subject: "DLQ is growing", Text: "12 messages failed"}
+	require.NoError(t, tg.Notify(context.Background(), alert))
+	require.NoError(t, slack.Notify(context.Background(), alert))
+	require.Equal(t, []string{"/bot123:abc/sendMessage", "/services/T0/B0"}, paths)
+	require.Equal(t, []map[string]string{
+		{"chat_id": "-100", "text": "DLQ is growing\n\n12 messages failed"},
+		{"text": "*DLQ is growing*\n12 messages failed"},
+	}, bodies)
+
+	// only the ${NAME} references are expanded, a bare $ is a part of the password
+	t.Setenv("TEST_SMTP_USER", "alerts")
+	email, err := NewNotifier(models.NotifierCfg{Name: "mail", Type: "email", SMTPAddress: "smtp.example.com:587",
+		Username: "${TEST_SMTP_USER}", Password: "pa$$w0rd$HOME${TEST_MISSING}"})
+	require.NoError(t, err)
+	require.Equal(t, "alerts", email.(*emailNotifier).username)
+	require.Equal(t, "pa$$w0rd$HOME", email.(*emailNotifier).password)
+
+	_, err = NewNotifier(models.NotifierCfg{Name: "pager", Type: "pagerduty"})
+	require.ErrorContains(t, err, `unknown type "pagerduty"`)
+}
+
+func TestNewDisabled(t *testing.T) {
+	a, err := New(&stubStore{}, models.NotifyCfg{})
+	require.NoError(t, err)
+	require.Nil(t, a)
+	// a disabled alerter returns at once
+	a.Run(context.Background())
+}
@@ -0,0 +1,205 @@
+package notify
+
+import (
+	"WB_LVL0/server/models"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds one request of a notifier to its channel
+const requestTimeout = 10 * time.Second
+
+// Alert is a message of a fired rule
+type Alert struct {
+	Rule    string
+	Subject string
+	Text    string
+}
+
+// Notifier sends alerts to a channel of ops or business
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// envRef is a reference ${NAME} to an env variable in the credentials
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in s with the env variables; unlike os.ExpandEnv it leaves
+// a bare $ alone, so a password containing $ is kept as is
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// NewNotifier builds a notifier from config, ${NAME} in the credentials is replaced with the env variable
+func NewNotifier(cfg models.NotifierCfg) (Notifier, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("notifier name is required")
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	switch cfg.Type {
+	case "email":
+		host, _, err := net.SplitHostPort(cfg.SMTPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: invalid smtp_address: %v", cfg.Name, err)
+		}
+		return &emailNotifier{name: cfg.Name, addr: cfg.SMTPAddress, host: host,
+			username: expandEnv(cfg.Username), password: expandEnv(cfg.Password), from: cfg.From, to: cfg.To}, nil
+	case "telegram":
+		return &telegramNotifier{name: cfg.Name, apiURL: "https://api.telegram.org",
+			token: expandEnv(cfg.BotToken), chatID: cfg.ChatID, client: client}, nil
+	case "slack":
+		return &slackNotifier{name: cfg.Name, url: expandEnv(cfg.WebhookURL), client: client}, nil
+	default:
+		return nil, fmt.Errorf("notifier %s: unknown type %q (expected email, telegram or slack)", cfg.Name, cfg.Type)
+	}
+}
+
+type emailNotifier struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (n *emailNotifier) Name() string { return n.name }
+
+// Notify sends the alert as a plain text email, upgrading the connection with STARTTLS when the server offers it
+func (n *emailNotifier) Notify(ctx context.Context, alert Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(alert)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *emailNotifier) message(alert Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", alert.Subject))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(alert.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+type telegramNotifier struct {
+	name   string
+	apiURL string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func (n *telegramNotifier) Name() string { return n.name }
+
+func (n *telegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.client, n.apiURL+"/bot"+n.token+"/sendMessage", map[string]string{
+		"chat_id": n.chatID,
+		"text":    alert.Subject + "\n\n" + alert.Text,
+	})
+}
+
+type slackNotifier struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (n *slackNotifier) Name() string { return n.name }
+
+func (n *slackNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.client, n.url, map[string]string{
+		"text": "*" + alert.Subject + "*\n" + alert.Text,
+	})
+}
+
+// postJSON posts body to the chat API, any 2xx response is a success
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// the URL of telegram contains the bot token, keep it out of the logs
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("responded %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
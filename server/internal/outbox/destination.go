@@ -0,0 +1,345 @@
+package outbox
+
+import (
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/rabbitmq"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/segmentio/kafka-go"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Destination delivers outbox events to an external system
+type Destination interface {
+	Name() string
+	// Accepts reports whether the event passes the destination's filtering rules
+	Accepts(event models.OutboxEvent) bool
+	Deliver(ctx context.Context, event models.OutboxEvent) error
+	Close() error
+}
+
+// NewDestination builds a destination from config
+func NewDestination(cfg models.OutboxDestination) (Destination, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("outbox destination name is required")
+	}
+	f := filter{eventTypes: cfg.EventTypes, match: cfg.Match}
+	switch cfg.Type {
+	case "kafka":
+		return newKafkaDestination(cfg, f)
+	case "webhook":
+		return &webhookDestination{name: cfg.Name, url: cfg.Address, filter: f, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "nats":
+		return newNATSDestination(cfg, f)
+	case "rabbitmq":
+		return &rabbitDestination{filter: f, name: cfg.Name, url: cfg.Address, exchange: cfg.Topic}, nil
+	default:
+		return nil, fmt.Errorf("outbox destination %s: unknown type %q (expected kafka, webhook, nats or rabbitmq)", cfg.Name, cfg.Type)
+	}
+}
+
+// filter implements per-destination filtering rules
+type filter struct {
+	eventTypes []string
+	match      map[string][]string
+}
+
+func (f filter) Accepts(event models.OutboxEvent) bool {
+	if len(f.eventTypes) > 0 && !slices.Contains(f.eventTypes, event.EventType) {
+		return false
+	}
+	if len(f.match) == 0 {
+		return true
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(event.Payload, &fields); err != nil {
+		return false
+	}
+	for field, allowed := range f.match {
+		v, ok := fields[field]
+		if !ok || !slices.Contains(allowed, fmt.Sprint(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// dedupeScanLimit bounds the messages read back to find an event published before a relay crash
+	dedupeScanLimit = 10000
+	// clockSkew between the database, whose time the claims carry, and the broker timestamps
+	clockSkew = time.Minute
+)
+
+// kafkaDestination publishes every event once per claim: the writer doesn't retry by itself, and an event
+// claimed again (after a failed write or a relay crash) is first looked up in its partition, so an event
+// written before the crash isn't published twice. kafka-go has no idempotent or transactional producer,
+// this read-back stands in for it.
+type kafkaDestination struct {
+	filter
+	name    string
+	address string
+	topic   string
+	writer  *kafka.Writer
+}
+
+func newKafkaDestination(cfg models.OutboxDestination, f filter) (*kafkaDestination, error) {
+	var codec kafka.Compression
+	if cfg.Compression != "" {
+		if err := codec.UnmarshalText([]byte(cfg.Compression)); err != nil {
+			return nil, fmt.Errorf("outbox destination %s: %v", cfg.Name, err)
+		}
+	}
+	return &kafkaDestination{
+		filter:  f,
+		name:    cfg.Name,
+		address: cfg.Address,
+		topic:   cfg.Topic,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Address),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Compression:  codec,
+			// a lost ack must not be resent blindly, the relay retries the event with the read-back
+			MaxAttempts:  1,
+			WriteTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+func (d *kafkaDestination) Name() string { return d.name }
+
+func (d *kafkaDestination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	if event.Claims > 1 {
+		published, err := d.published(ctx, event)
+		if err != nil {
+			return fmt.Errorf("outbox destination %s: looking for event %d: %w", d.name, event.ID, err)
+		}
+		if published {
+			logger.Info("event already published, skipped", "event_id", event.ID, "destination", d.name)
+			return nil
+		}
+	}
+	return d.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.AggregateID),
+		Value: event.Payload,
+		Headers: []kafka.Header{
+			{Key: "event_id", Value: []byte(strconv.FormatInt(event.ID, 10))},
+			{Key: "event_type", Value: []byte(event.EventType)},
+		},
+	})
+}
+
+// published reports whether the event is in its partition already: the messages written since the event
+// was first claimed are read, at most dedupeScanLimit of them
+func (d *kafkaDestination) published(ctx context.Context, event models.OutboxEvent) (bool, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return false, err
+	}
+	partitions, err := conn.ReadPartitions(d.topic)
+	conn.Close()
+	if err != nil {
+		return false, err
+	}
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	slices.Sort(ids)
+	// the partition the writer's Hash balancer picks for the key
+	partition := (&kafka.Hash{}).Balance(kafka.Message{Key: []byte(event.AggregateID)}, ids...)
+
+	leader, err := kafka.DialLeader(ctx, "tcp", d.address, d.topic, partition)
+	if err != nil {
+		return false, err
+	}
+	defer leader.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		leader.SetDeadline(deadline)
+	} else {
+		leader.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+	first, err := leader.ReadOffset(event.FirstClaimedAt.Add(-clockSkew))
+	if err != nil {
+		return false, err
+	}
+	last, err := leader.ReadLastOffset()
+	if err != nil {
+		return false, err
+	}
+	if first < 0 || first >= last {
+		return false, nil
+	}
+	if _, err := leader.Seek(first, kafka.SeekAbsolute); err != nil {
+		return false, err
+	}
+	id := []byte(strconv.FormatInt(event.ID, 10))
+	for offset := first; offset < last; {
+		if offset-first >= dedupeScanLimit {
+			logger.Warn("event not found within the scan limit, publishing it", "event_id", event.ID,
+				"destination", d.name, "partition", partition, "from_offset", first)
+			return false, nil
+		}
+		msg, err := leader.ReadMessage(10e6)
+		if err != nil {
+			return false, err
+		}
+		offset = msg.Offset + 1
+		for _, h := range msg.Headers {
+			if h.Key == "event_id" && bytes.Equal(h.Value, id) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (d *kafkaDestination) Close() error { return d.writer.Close() }
+
+type webhookDestination struct {
+	filter
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (d *webhookDestination) Name() string { return d.name }
+
+func (d *webhookDestination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", strconv.FormatInt(event.ID, 10))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", d.url, resp.Status)
+	}
+	return nil
+}
+
+func (d *webhookDestination) Close() error { return nil }
+
+type natsDestination struct {
+	filter
+	name    string
+	subject string
+	conn    *nats.Conn
+}
+
+func newNATSDestination(cfg models.OutboxDestination, f filter) (*natsDestination, error) {
+	conn, err := nats.Connect(cfg.Address, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("outbox destination %s: %v", cfg.Name, err)
+	}
+	return &natsDestination{filter: f, name: cfg.Name, subject: cfg.Topic, conn: conn}, nil
+}
+
+func (d *natsDestination) Name() string { return d.name }
+
+func (d *natsDestination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	msg := nats.NewMsg(d.subject)
+	msg.Data = event.Payload
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(event.ID, 10))
+	msg.Header.Set("Event-Type", event.EventType)
+	if err := d.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	// make sure the server received the message before it is marked delivered
+	return d.conn.FlushWithContext(ctx)
+}
+
+func (d *natsDestination) Close() error {
+	d.conn.Close()
+	return nil
+}
+
+// rabbitDestination publishes the events to a topic exchange routed by the event type.
+// It connects on the first delivery and again after a failed one, the relay retries the event.
+type rabbitDestination struct {
+	filter
+	name     string
+	url      string
+	exchange string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel // in confirm mode
+}
+
+func (d *rabbitDestination) Name() string { return d.name }
+
+func (d *rabbitDestination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ch == nil || d.ch.IsClosed() {
+		if err := d.connect(); err != nil {
+			return err
+		}
+	}
+	err := rabbitmq.Publish(ctx, d.ch, d.exchange, event.EventType, amqp.Publishing{
+		ContentType: "application/json",
+		MessageId:   strconv.FormatInt(event.ID, 10),
+		Type:        event.EventType,
+		Headers:     amqp.Table{"aggregate_id": event.AggregateID},
+		Body:        event.Payload,
+	})
+	if err != nil {
+		d.disconnect()
+	}
+	return err
+}
+
+func (d *rabbitDestination) connect() error {
+	d.disconnect()
+	conn, err := amqp.Dial(d.url)
+	if err != nil {
+		return fmt.Errorf("outbox destination %s: %v", d.name, err)
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err == nil {
+		err = ch.ExchangeDeclare(d.exchange, amqp.ExchangeTopic, true, false, false, false, nil)
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("outbox destination %s: %v", d.name, err)
+	}
+	d.conn, d.ch = conn, ch
+	return nil
+}
+
+func (d *rabbitDestination) disconnect() {
+	if d.conn != nil {
+		d.conn.Close()
+	}
+	d.conn, d.ch = nil, nil
+}
+
+func (d *rabbitDestination) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.disconnect()
+	return nil
+}
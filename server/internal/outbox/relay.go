@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"slices"
+	"time"
+)
+
+// Store is interface of the outbox table
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkOutboxDelivered(ctx context.Context, eventID int64, destination string) error
+	MarkOutboxPublished(ctx context.Context, eventID int64) error
+}
+
+var logger = logging.Component("outbox")
+
+// Relay polls the outbox and fans every event out to all destinations accepting it.
+// Delivery to each destination is recorded separately, so a failing destination
+// is retried without redelivering to the others. Delivery is at-least-once.
+// Relays of several service instances share the outbox by leasing batches; the order of events
+// is kept within a batch only.
+type Relay struct {
+	store        Store
+	destinations []Destination
+	interval     time.Duration
+	batchSize    int
+	lease        time.Duration
+	errs         health.LastError
+}
+
+// NewRelay creates the destinations from config; extra are the destinations built by the service itself,
+// e.g. the fanout to the webhook subscriptions
+func NewRelay(store Store, cfg models.OutboxCfg, extra ...Destination) (*Relay, error) {
+	r := &Relay{store: store, interval: cfg.PollInterval, batchSize: cfg.BatchSize, lease: cfg.Lease, destinations: extra}
+	for _, dc := range cfg.Destinations {
+		d, err := NewDestination(dc)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.destinations = append(r.destinations, d)
+	}
+	return r, nil
+}
+
+// Run relays events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	if len(r.destinations) == 0 {
+		logger.Warn("no destinations configured, events stay in the outbox table")
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := r.relayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("relay failed", logging.Err(err))
+		}
+		r.errs.Set(err)
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) error {
+	events, err := r.store.ClaimOutboxEvents(ctx, r.batchSize, r.lease)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if r.relayEvent(ctx, event) {
+			if err := r.store.MarkOutboxPublished(ctx, event.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// relayEvent delivers the event to the remaining destinations and reports whether all succeeded
+func (r *Relay) relayEvent(ctx context.Context, event models.OutboxEvent) bool {
+	done := true
+	for _, d := range r.destinations {
+		if slices.Contains(event.Delivered, d.Name()) || !d.Accepts(event) {
+			continue
+		}
+		if err := d.Deliver(ctx, event); err != nil {
+			logger.Warn("event delivery failed", "event_id", event.ID, "destination", d.Name(), logging.Err(err))
+			done = false
+			continue
+		}
+		if err := r.store.MarkOutboxDelivered(ctx, event.ID, d.Name()); err != nil {
+			logger.Error("event delivered but not recorded", "event_id", event.ID, "destination", d.Name(), logging.Err(err))
+			done = false
+		}
+	}
+	return done
+}
+
+// Health is degraded while the last batch failed
+func (r *Relay) Health(context.Context) health.Result {
+	return r.errs.Result()
+}
+
+func (r *Relay) Close() {
+	for _, d := range r.destinations {
+		if err := d.Close(); err != nil {
+			logger.Error("failed to close destination", "destination", d.Name(), logging.Err(err))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	events    []models.OutboxEvent
+	delivered map[int64][]string
+	published map[int64]bool
+}
+
+func (m *memStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var res []models.OutboxEvent
+	for _, e := range m.events {
+		if !m.published[e.ID] {
+			e.Delivered = m.delivered[e.ID]
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (m *memStore) MarkOutboxDelivered(ctx context.Context, eventID int64, destination string) error {
+	m.delivered[eventID] = append(m.delivered[eventID], destination)
+	return nil
+}
+
+func (m *memStore) MarkOutboxPublished(ctx context.Context, eventID int64) error {
+	m.published[eventID] = true
+	return nil
+}
+
+type fakeDestination struct {
+	filter
+	name     string
+	fail     bool
+	received []int64
+}
+
+func (d *fakeDestination) Name() string { return d.name }
+
+func (d *fakeDestination) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	if d.fail {
+		return errors.New("unavailable")
+	}
+	d.received = append(d.received, event.ID)
+	return nil
+}
+
+func (d *fakeDestination) Close() error { return nil }
+
+func TestRelayFanOut(t *testing.T) {
+	store := &memStore{
+		events: []models.OutboxEvent{
+			{ID: 1, EventType: models.EventOrderSaved, Payload: []byte(`{"customer_id":"user1"}`)},
+			{ID: 2, EventType: models.EventOrderSaved, Payload: []byte(`{"customer_id":"user2"}`)},
+		},
+		delivered: make(map[int64][]string),
+		published: make(map[int64]bool),
+	}
+	all := &fakeDestination{name: "all"}
+	user1 := &fakeDestination{name: "user1", filter: filter{match: map[string][]string{"customer_id": {"user1"}}}}
+	broken := &fakeDestination{name: "broken", filter: filter{eventTypes: []string{models.EventOrderSaved}}, fail: true}
+	relay := &Relay{store: store, destinations: []Destination{all, user1, broken}, batchSize: 10}
+
+	require.NoError(t, relay.relayBatch(context.Background()))
+	require.Equal(t, []int64{1, 2}, all.received)
+	require.Equal(t, []int64{1}, user1.received)
+	require.False(t, store.published[1])
+
+	// the failed destination is retried without redelivering to the others
+	broken.fail = false
+	require.NoError(t, relay.relayBatch(context.Background()))
+	require.Equal(t, []int64{1, 2}, all.received)
+	require.Equal(t, []int64{1, 2}, broken.received)
+	require.True(t, store.published[1])
+	require.True(t, store.published[2])
+}
+
+func TestNewDestinationUnknownType(t *testing.T) {
+	_, err := NewDestination(models.OutboxDestination{Name: "x", Type: "smtp"})
+	require.Error(t, err)
+}
+
+func TestNewDestinationCompression(t *testing.T) {
+	d, err := NewDestination(models.OutboxDestination{Name: "x", Type: "kafka", Address: "kafka:9092", Topic: "t", Compression: "zstd"})
+	require.NoError(t, err)
+	require.Equal(t, kafka.Zstd, d.(*kafkaDestination).writer.Compression)
+	require.NoError(t, d.Close())
+
+	_, err = NewDestination(models.OutboxDestination{Name: "x", Type: "kafka", Address: "kafka:9092", Topic: "t", Compression: "brotli"})
+	require.Error(t, err)
+}
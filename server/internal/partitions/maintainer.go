@@ -0,0 +1,71 @@
+package partitions
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"time"
+)
+
+// defaultInterval is used when the config leaves the check interval unset
+const defaultInterval = 12 * time.Hour
+
+// Store creates the monthly partitions of the orders tables
+type Store interface {
+	CreateOrderPartitions(ctx context.Context, month time.Time) error
+}
+
+var logger = logging.Component("partitions")
+
+// Maintainer keeps the partitions of the current and the coming months created, so new orders
+// never land in the default partitions while the service is running
+type Maintainer struct {
+	store    Store
+	ahead    int
+	interval time.Duration
+	now      func() time.Time
+	errs     health.LastError
+}
+
+func NewMaintainer(store Store, cfg models.DatabaseCfg) *Maintainer {
+	m := &Maintainer{store: store, ahead: cfg.PartitionsAhead, interval: cfg.PartitionCheckInterval, now: time.Now}
+	if m.interval <= 0 {
+		m.interval = defaultInterval
+	}
+	return m
+}
+
+// Run ensures the partitions at once and then every interval until ctx is cancelled
+func (m *Maintainer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		err := m.ensure(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("partition maintenance failed", logging.Err(err))
+		}
+		m.errs.Set(err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Maintainer) ensure(ctx context.Context) error {
+	now := m.now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= m.ahead; i++ {
+		if err := m.store.CreateOrderPartitions(ctx, month.AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Health is degraded while the last run failed
+func (m *Maintainer) Health(context.Context) health.Result {
+	return m.errs.Result()
+}
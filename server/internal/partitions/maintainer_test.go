@@ -0,0 +1,47 @@
+package partitions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	months []time.Time
+	fail   bool
+}
+
+func (m *memStore) CreateOrderPartitions(ctx context.Context, month time.Time) error {
+	if m.fail {
+		return errors.New("unavailable")
+	}
+	m.months = append(m.months, month)
+	return nil
+}
+
+func TestEnsureCreatesMonthsAhead(t *testing.T) {
+	store := &memStore{}
+	m := &Maintainer{store: store, ahead: 2, now: func() time.Time {
+		return time.Date(2025, time.November, 17, 13, 0, 0, 0, time.UTC)
+	}}
+
+	require.NoError(t, m.ensure(context.Background()))
+	require.Equal(t, []time.Time{
+		time.Date(2025, time.November, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}, store.months)
+}
+
+func TestRunReportsFailure(t *testing.T) {
+	store := &memStore{fail: true}
+	m := &Maintainer{store: store, interval: time.Hour, now: time.Now}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m.Run(ctx)
+	require.Error(t, m.Health(context.Background()).Err)
+}
@@ -0,0 +1,148 @@
+package receipt
+
+import (
+	"WB_LVL0/server/models"
+	"strings"
+	"time"
+)
+
+// defaultLocale is used for the orders of locales without labels
+const defaultLocale = "en"
+
+// labels are the texts of a receipt in a language and its formats of dates and amounts
+type labels struct {
+	Title  string
+	PageOf string // "%d", "%s": the page number and the page count
+
+	OrderSection    string
+	OrderUID        string
+	Date            string
+	TrackNumber     string
+	DeliveryService string
+
+	CustomerSection string
+	CustomerID      string
+	Recipient       string
+	Phone           string
+	Email           string
+	Address         string
+
+	ItemsSection string
+	ItemName     string
+	Brand        string
+	Size         string
+	Price        string
+	Sale         string
+	Total        string
+
+	GoodsTotal   string
+	DeliveryCost string
+	CustomFee    string
+	Amount       string
+
+	PaymentSection string
+	Transaction    string
+	Provider       string
+	Bank           string
+	PaidAt         string
+
+	dateLayout string
+	decimalSep string
+}
+
+var locales = map[string]labels{
+	"en": {
+		Title:  "Receipt",
+		PageOf: "Page %d of %s",
+
+		OrderSection:    "Order",
+		OrderUID:        "Order number",
+		Date:            "Date",
+		TrackNumber:     "Track number",
+		DeliveryService: "Delivery service",
+
+		CustomerSection: "Customer",
+		CustomerID:      "Customer ID",
+		Recipient:       "Recipient",
+		Phone:           "Phone",
+		Email:           "Email",
+		Address:         "Address",
+
+		ItemsSection: "Items",
+		ItemName:     "Name",
+		Brand:        "Brand",
+		Size:         "Size",
+		Price:        "Price",
+		Sale:         "Sale",
+		Total:        "Total",
+
+		GoodsTotal:   "Goods",
+		DeliveryCost: "Delivery",
+		CustomFee:    "Customs fee",
+		Amount:       "Total paid",
+
+		PaymentSection: "Payment",
+		Transaction:    "Transaction",
+		Provider:       "Provider",
+		Bank:           "Bank",
+		PaidAt:         "Paid at",
+
+		dateLayout: "Jan 2, 2006 15:04 MST",
+		decimalSep: ".",
+	},
+	"ru": {
+		Title:  "Чек",
+		PageOf: "Страница %d из %s",
+
+		OrderSection:    "Заказ",
+		OrderUID:        "Номер заказа",
+		Date:            "Дата",
+		TrackNumber:     "Трек-номер",
+		DeliveryService: "Служба доставки",
+
+		CustomerSection: "Покупатель",
+		CustomerID:      "ID покупателя",
+		Recipient:       "Получатель",
+		Phone:           "Телефон",
+		Email:           "Email",
+		Address:         "Адрес",
+
+		ItemsSection: "Товары",
+		ItemName:     "Наименование",
+		Brand:        "Бренд",
+		Size:         "Размер",
+		Price:        "Цена",
+		Sale:         "Скидка",
+		Total:        "Сумма",
+
+		GoodsTotal:   "Товары",
+		DeliveryCost: "Доставка",
+		CustomFee:    "Таможенный сбор",
+		Amount:       "Итого оплачено",
+
+		PaymentSection: "Оплата",
+		Transaction:    "Транзакция",
+		Provider:       "Платёжная система",
+		Bank:           "Банк",
+		PaidAt:         "Дата оплаты",
+
+		dateLayout: "02.01.2006 15:04 MST",
+		decimalSep: ",",
+	},
+}
+
+func localeLabels(locale string) labels {
+	if l, ok := locales[strings.ToLower(locale)]; ok {
+		return l
+	}
+	return locales[defaultLocale]
+}
+
+// date formats t in UTC, the time zone of the customer is unknown
+func (l labels) date(t time.Time) string {
+	return t.UTC().Format(l.dateLayout)
+}
+
+func (l labels) money(m models.Money) string {
+	return strings.Replace(m.Decimal(), ".", l.decimalSep, 1) + " " + m.Currency
+}
@@ -0,0 +1,169 @@
+package receipt
+
+import (
+	"WB_LVL0/server/models"
+	_ "embed"
+	"fmt"
+	"github.com/jung-kurt/gofpdf"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DejaVu Sans covers Latin and Cyrillic, the service image has no system fonts to fall back to
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	regularFont []byte
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	boldFont []byte
+)
+
+const (
+	fontFamily = "DejaVu"
+	margin     = 15.0
+	lineHeight = 6.0
+	// contentWidth is the width of A4 within the margins, in mm
+	contentWidth = 210 - 2*margin
+)
+
+// itemColumns are the widths (mm) and alignments of the items table: #, name, brand, size, price, sale, total
+var itemColumns = []struct {
+	width float64
+	align string
+}{{8, "C"}, {62, "L"}, {32, "L"}, {14, "C"}, {24, "R"}, {14, "R"}, {26, "R"}}
+
+// Render writes the PDF receipt of the order in the language of its locale (English for the unknown ones)
+func Render(w io.Writer, order *models.Order) error {
+	l := localeLabels(order.Locale)
+	money := l.money
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fontFamily, "", regularFont)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", boldFont)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+lineHeight)
+	pdf.SetTitle(l.Title+" "+order.OrderUID, true)
+	pdf.SetCreator("WB order service", true)
+	pdf.SetCreationDate(order.DateCreated)
+	pdf.AliasNbPages("")
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont(fontFamily, "B", 16)
+		pdf.CellFormat(contentWidth/2, 10, l.Title, "", 0, "L", false, 0, "")
+		pdf.SetFont(fontFamily, "", 9)
+		pdf.CellFormat(contentWidth/2, 10, order.OrderUID, "", 1, "R", false, 0, "")
+		pdf.Line(margin, pdf.GetY(), margin+contentWidth, pdf.GetY())
+		pdf.Ln(4)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin)
+		pdf.SetFont(fontFamily, "", 8)
+		pdf.CellFormat(contentWidth, 4, fmt.Sprintf(l.PageOf, pdf.PageNo(), "{nb}"), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	section(pdf, l.OrderSection, [][2]string{
+		{l.OrderUID, order.OrderUID},
+		{l.Date, l.date(order.DateCreated)},
+		{l.TrackNumber, order.TrackNumber},
+		{l.DeliveryService, order.DeliveryService},
+	})
+	d := order.Delivery
+	section(pdf, l.CustomerSection, [][2]string{
+		{l.CustomerID, order.CustomerID},
+		{l.Recipient, d.Name},
+		{l.Phone, d.Phone},
+		{l.Email, d.Email},
+		{l.Address, strings.Join(nonEmpty(d.Zip, d.Region, d.City, d.Address), ", ")},
+	})
+
+	heading(pdf, l.ItemsSection)
+	pdf.SetFont(fontFamily, "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	header := []string{"#", l.ItemName, l.Brand, l.Size, l.Price, l.Sale, l.Total}
+	for c, col := range itemColumns {
+		pdf.CellFormat(col.width, lineHeight+1, header[c], "B", 0, col.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont(fontFamily, "", 9)
+	for i, item := range order.Items {
+		row := []string{strconv.Itoa(i + 1), item.Name, item.Brand, item.Size,
+			money(item.Price), strconv.Itoa(item.Sale) + "%", money(item.TotalPrice)}
+		for c, col := range itemColumns {
+			pdf.CellFormat(col.width, lineHeight, fit(pdf, row[c], col.width-2), "B", 0, col.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(4)
+
+	p := order.Payment
+	totals := [][2]string{
+		{l.GoodsTotal, money(p.GoodsTotal)},
+		{l.DeliveryCost, money(p.DeliveryCost)},
+	}
+	if p.CustomFee.Amount != 0 {
+		totals = append(totals, [2]string{l.CustomFee, money(p.CustomFee)})
+	}
+	pdf.SetFont(fontFamily, "", 10)
+	for _, row := range totals {
+		pdf.CellFormat(contentWidth-40, lineHeight, row[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(40, lineHeight, row[1], "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont(fontFamily, "B", 12)
+	pdf.CellFormat(contentWidth-40, lineHeight+2, l.Amount, "T", 0, "R", false, 0, "")
+	pdf.CellFormat(40, lineHeight+2, money(p.Amount), "T", 1, "R", false, 0, "")
+	pdf.Ln(4)
+
+	section(pdf, l.PaymentSection, [][2]string{
+		{l.Transaction, p.Transaction},
+		{l.Provider, p.Provider},
+		{l.Bank, p.Bank},
+		{l.PaidAt, l.date(time.Unix(p.PaymentDt, 0))},
+	})
+
+	return pdf.Output(w)
+}
+
+func heading(pdf *gofpdf.Fpdf, title string) {
+	pdf.SetFont(fontFamily, "B", 11)
+	pdf.CellFormat(contentWidth, lineHeight+1, title, "", 1, "L", false, 0, "")
+}
+
+// section writes the titled label-value rows, the empty values are skipped
+func section(pdf *gofpdf.Fpdf, title string, rows [][2]string) {
+	heading(pdf, title)
+	for _, row := range rows {
+		if row[1] == "" {
+			continue
+		}
+		pdf.SetFont(fontFamily, "", 9)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.CellFormat(45, lineHeight, row[0], "", 0, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.MultiCell(contentWidth-45, lineHeight, row[1], "", "L", false)
+	}
+	pdf.Ln(3)
+}
+
+// fit shortens s with an ellipsis to the width, so a long item name doesn't overflow its column
+func fit(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func nonEmpty(values ...string) []string {
+	out := values[:0:0]
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
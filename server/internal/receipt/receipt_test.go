@@ -0,0 +1,58 @@
+package receipt
+
+import (
+	"WB_LVL0/server/models"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testOrder(locale string, items int) *models.Order {
+	order := &models.Order{
+		OrderUID:        "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Locale:          locale,
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery: models.Delivery{Name: "Иван Петров", Phone: "+9720000000", Zip: "2639809",
+			City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay",
+			Amount: models.NewMoney(181700, "USD"), PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: models.NewMoney(150000, "USD"), GoodsTotal: models.NewMoney(31700, "USD")},
+	}
+	for i := 0; i < items; i++ {
+		order.Items = append(order.Items, models.Item{Name: "Тушь для ресниц с очень длинным названием, которое не помещается в колонку",
+			Brand: "Vivienne Sabo", Size: "0", Price: models.NewMoney(45300, "USD"), Sale: 30, TotalPrice: models.NewMoney(31700, "USD")})
+	}
+	return order
+}
+
+func TestRender(t *testing.T) {
+	for _, locale := range []string{"en", "ru", "fr"} {
+		var buf bytes.Buffer
+		require.NoError(t, Render(&buf, testOrder(locale, 1)), locale)
+		require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")), locale)
+		require.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("/Type /Page\n")), locale)
+	}
+
+	// long orders continue on the next pages
+	var buf bytes.Buffer
+	require.NoError(t, Render(&buf, testOrder("ru", 80)))
+	require.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("/Type /Page\n")))
+}
+
+func TestLabels(t *testing.T) {
+	ru := localeLabels("RU")
+	require.Equal(t, "Чек", ru.Title)
+	require.Equal(t, "1817,00 USD", ru.money(models.NewMoney(181700, "USD")))
+	require.Equal(t, "26.11.2021 06:22 UTC", ru.date(time.Date(2021, 11, 26, 9, 22, 0, 0, time.FixedZone("MSK", 3*3600))))
+
+	// unknown locales fall back to English
+	en := localeLabels("fr")
+	require.Equal(t, "Receipt", en.Title)
+	require.Equal(t, "1817.00 USD", en.money(models.NewMoney(181700, "USD")))
+	require.Equal(t, "150 JPY", en.money(models.NewMoney(150, "JPY")))
+	require.Equal(t, "Nov 26, 2021 06:22 UTC", en.date(time.Date(2021, 11, 26, 6, 22, 0, 0, time.UTC)))
+}
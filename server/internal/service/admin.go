@@ -0,0 +1,429 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/ingest"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// FailedMessageProvider is interface of the quarantine storage (failed_messages table)
+type FailedMessageProvider interface {
+	ListFailedMessages(ctx context.Context, limit, offset int) ([]models.FailedMessage, error)
+	GetFailedMessage(ctx context.Context, id int64) (*models.FailedMessage, error)
+	DeleteFailedMessage(ctx context.Context, id int64) error
+}
+
+// MessageRedriver publishes a quarantined message again to the topic it was read from
+type MessageRedriver interface {
+	Redrive(ctx context.Context, m models.FailedMessage) error
+}
+
+// CacheStatsProvider reports how often reads fall back to the database and repopulate the cache
+type CacheStatsProvider interface {
+	CacheStats() models.CacheStats
+}
+
+// ConsumerSeeker moves the consumer group offsets to reprocess messages
+type ConsumerSeeker interface {
+	Seek(ctx context.Context, req models.SeekRequest) (map[int]int64, error)
+}
+
+// OrderArchive saves orders past Kafka, soft-deletes and restores them, keeping their rows for audits
+type OrderArchive interface {
+	// SaveOrderRaw saves the order with raw, the payload of its message as sent
+	SaveOrderRaw(ctx context.Context, order models.Order, raw models.RawPayload) error
+	GetStoredOrder(ctx context.Context, orderUID string, includeDeleted bool) (*models.Order, error)
+	SoftDeleteOrder(ctx context.Context, orderUID string) error
+	RestoreOrder(ctx context.Context, orderUID string) error
+	// OrderEvents returns the event log of the order, oldest first
+	OrderEvents(ctx context.Context, orderUID string) ([]models.OrderLogEvent, error)
+}
+
+// ConfigReloader applies the changed runtime settings of the config without a restart
+type ConfigReloader interface {
+	ReloadConfig() (models.ConfigReload, error)
+}
+
+// AdminService contains operational handlers mounted under /admin
+type AdminService struct {
+	failed   FailedMessageProvider
+	redriver MessageRedriver
+	cache    CacheStatsProvider
+	seeker   ConsumerSeeker
+	orders   OrderArchive
+	config   ConfigReloader
+	hub      *broadcast.Hub
+}
+
+// NewAdminService creates the admin handlers, the orders created through them are published to hub like
+// the consumed ones
+func NewAdminService(f FailedMessageProvider, redriver MessageRedriver, cs CacheStatsProvider, seeker ConsumerSeeker, orders OrderArchive, config ConfigReloader, hub *broadcast.Hub) *AdminService {
+	return &AdminService{failed: f, redriver: redriver, cache: cs, seeker: seeker, orders: orders, config: config, hub: hub}
+}
+
+// GetOrder handler
+// @Summary Get order including soft-deleted
+// @Description Заказ из PostgreSQL в обход кеша; с include_deleted=true возвращаются и мягко удалённые заказы (с полем deleted_at)
+// @Tags admin
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Param include_deleted query bool false "Include soft-deleted orders"
+// @Success 200 {object} OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{order_uid} [get]
+func (a *AdminService) GetOrder(c *gin.Context) {
+	includeDeleted := false
+	if v := c.Query("include_deleted"); v != "" {
+		var err error
+		if includeDeleted, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "include_deleted must be a boolean"})
+			return
+		}
+	}
+	order, err := a.orders.GetStoredOrder(c.Request.Context(), c.Param("order_uid"), includeDeleted)
+	if err != nil {
+		a.orderError(c, "getting stored order", err)
+		return
+	}
+	c.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+// CreateOrder handler
+// @Summary Create order
+// @Description Сохраняет заказ в обход Kafka (тело - сообщение заказа, в конверте {schema_version, produced_at, payload} или без него). Заказ проверяется теми же правилами, что и в консьюмере, включая JSON Schema сообщения и ограничения размера сообщения и числа товаров (413); при ошибке в details перечислены все недопустимые поля (field, tag, value, message)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param order body models.Order true "Order message"
+// @Success 201 {object} OrderResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /admin/orders [post]
+func (a *AdminService) CreateOrder(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	d, err := ingest.Decode(body)
+	if err != nil {
+		var de *ingest.DecodeError
+		if errors.As(err, &de) && de.Kind == ingest.TooLarge {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		invalidOrder(c, err)
+		return
+	}
+	order := d.Order
+	if err := a.orders.SaveOrderRaw(c.Request.Context(), order, d.Raw); err != nil {
+		if errors.Is(err, storage.ErrOrderExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "order already exists"})
+			return
+		}
+		a.orderError(c, "creating order", err)
+		return
+	}
+	// notify live subscribers (SSE streams)
+	a.hub.Publish(order)
+	c.JSON(http.StatusCreated, newOrderResponse(&order))
+}
+
+// invalidOrder responds 400 listing the invalid fields of ValidationErrors err in details
+func invalidOrder(c *gin.Context, err error) {
+	var details models.ValidationErrors
+	if errors.As(err, &details) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order", "details": details})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// DeleteOrder handler
+// @Summary Soft-delete order
+// @Description Помечает заказ удалённым (deleted_at): данные сохраняются для аудита, но заказ больше не отдаётся чтением и страницей статуса
+// @Tags admin
+// @Param order_uid path string true "Order UID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{order_uid} [delete]
+func (a *AdminService) DeleteOrder(c *gin.Context) {
+	if err := a.orders.SoftDeleteOrder(c.Request.Context(), c.Param("order_uid")); err != nil {
+		a.orderError(c, "soft delete of order", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreOrder handler
+// @Summary Restore soft-deleted order
+// @Tags admin
+// @Param order_uid path string true "Order UID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{order_uid}/restore [post]
+func (a *AdminService) RestoreOrder(c *gin.Context) {
+	if err := a.orders.RestoreOrder(c.Request.Context(), c.Param("order_uid")); err != nil {
+		a.orderError(c, "restore of order", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// OrderEvents handler
+// @Summary Event log of order
+// @Description Все события заказа из неизменяемого журнала order_event_log: полученные сообщения (включая дубликаты и замены) с исходным payload, версией его схемы (schema_version) и позицией в Kafka, удаления и восстановления
+// @Tags admin
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Success 200 {array} models.OrderLogEvent
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{order_uid}/events [get]
+func (a *AdminService) OrderEvents(c *gin.Context) {
+	events, err := a.orders.OrderEvents(c.Request.Context(), c.Param("order_uid"))
+	if err != nil {
+		a.orderError(c, "getting order events", err)
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// ReloadConfig handler
+// @Summary Reload config
+// @Description Перечитывает конфигурацию (флаги, переменные окружения, config.yaml) и применяет без перезапуска изменённые параметры кеша; остальные изменения перечисляются в restart_required. То же делает сигнал SIGHUP
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ConfigReload
+// @Failure 500 {object} map[string]string
+// @Router /admin/config/reload [post]
+func (a *AdminService) ReloadConfig(c *gin.Context) {
+	reload, err := a.config.ReloadConfig()
+	if err != nil {
+		logger.Error("error of config reload", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reload)
+}
+
+func (a *AdminService) orderError(c *gin.Context, action string, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	logger.Error("error of "+action, logging.Err(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// SeekConsumer handler
+// @Summary Replay messages from a timestamp or offsets
+// @Description Переносит offsets группы консьюмеров на момент времени или на заданные offsets по партициям. Другие реплики консьюмера должны быть остановлены
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body seekRequest true "timestamp (RFC3339) or offsets per partition"
+// @Success 200 {object} map[string]int64
+// @Failure 400 {object} map[string]string
+// @Router /admin/consumer/seek [post]
+func (a *AdminService) SeekConsumer(c *gin.Context) {
+	var req seekRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offsets, err := a.seeker.Seek(c.Request.Context(), req.toModel())
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("error of consumer seek", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"offsets": offsets})
+}
+
+// CacheStats handler
+// @Summary Cache repopulation stats
+// @Description Сколько раз чтение заказа ушло в PostgreSQL и заказ был заново записан в Redis (по шаблонам ключей и окнам времени)
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.CacheStats
+// @Router /admin/cache/stats [get]
+func (a *AdminService) CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, a.cache.CacheStats())
+}
+
+// ListFailedMessages handler
+// @Summary List quarantined messages
+// @Description Сообщения, которые не удалось обработать (таблица failed_messages), сначала последние
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.FailedMessage
+// @Failure 400 {object} map[string]string
+// @Router /admin/failed-messages [get]
+func (a *AdminService) ListFailedMessages(c *gin.Context) {
+	limit, offset, err := pageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	messages, err := a.failed.ListFailedMessages(c.Request.Context(), limit, offset)
+	if err != nil {
+		logger.Error("error of listing failed messages", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// GetFailedMessage handler
+// @Summary Get quarantined message
+// @Tags admin
+// @Produce json
+// @Param id path int true "Failed message ID"
+// @Success 200 {object} models.FailedMessage
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/failed-messages/{id} [get]
+func (a *AdminService) GetFailedMessage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	message, err := a.failed.GetFailedMessage(c.Request.Context(), id)
+	if err != nil {
+		a.failedMessageError(c, "getting failed message", err)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// RedriveFailedMessage handler
+// @Summary Redrive quarantined message
+// @Description Отправляет сообщение заново в топик, из которого оно было прочитано (с тем же ключом), и удаляет его из карантина; если обработка снова не удастся, сообщение вернётся в карантин новой записью
+// @Tags admin
+// @Param id path int true "Failed message ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/failed-messages/{id}/redrive [post]
+func (a *AdminService) RedriveFailedMessage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := c.Request.Context()
+	message, err := a.failed.GetFailedMessage(ctx, id)
+	if err != nil {
+		a.failedMessageError(c, "getting failed message", err)
+		return
+	}
+	if err := a.redriver.Redrive(ctx, *message); err != nil {
+		logger.Error("error of redriving failed message", "id", id, logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// the message is published, a record left behind would only be redriven twice
+	if err := a.failed.DeleteFailedMessage(ctx, id); err != nil {
+		a.failedMessageError(c, "deleting redriven message", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DiscardFailedMessage handler
+// @Summary Discard quarantined message
+// @Description Удаляет сообщение из карантина без повторной обработки
+// @Tags admin
+// @Param id path int true "Failed message ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/failed-messages/{id} [delete]
+func (a *AdminService) DiscardFailedMessage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := a.failed.DeleteFailedMessage(c.Request.Context(), id); err != nil {
+		a.failedMessageError(c, "discarding failed message", err)
+		return
+	}
+	logger.Info("failed message discarded", "id", id)
+	c.Status(http.StatusNoContent)
+}
+
+func (a *AdminService) failedMessageError(c *gin.Context, action string, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Error("error of "+action, logging.Err(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// pageParams parses limit/offset query parameters
+func pageParams(c *gin.Context) (int, int, error) {
+	limit, err := limitParam(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = o
+	}
+	return limit, offset, nil
+}
+
+// limitParam parses the limit query parameter, capped at maxListLimit
+func limitParam(c *gin.Context) (int, error) {
+	limit := defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(l, maxListLimit)
+	}
+	return limit, nil
+}
+
+// timeParam parses an optional RFC 3339 time query parameter, zero if absent
+func timeParam(c *gin.Context, name string) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New(name + " must be an RFC 3339 time")
+	}
+	return t, nil
+}
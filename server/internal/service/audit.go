@@ -0,0 +1,61 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// AuditProvider reads the audit log of order access
+type AuditProvider interface {
+	ListAuditRecords(ctx context.Context, f models.AuditFilter) ([]models.AuditRecord, error)
+}
+
+// AuditService serves the audit log for the data-access reviews
+type AuditService struct {
+	audit AuditProvider
+}
+
+func NewAuditService(a AuditProvider) *AuditService {
+	return &AuditService{audit: a}
+}
+
+// ListRecords handler
+// @Summary Audit log of order access
+// @Description Кто (префикс API-ключа, bootstrap или anonymous для публичных эндпоинтов) читал или менял какой заказ: метод, маршрут, статус ответа, IP, X-Request-ID, время; от новых к старым
+// @Tags admin
+// @Produce json
+// @Param subject query string false "API key prefix, bootstrap or anonymous"
+// @Param order_uid query string false "Order UID"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.AuditRecord
+// @Failure 400 {object} map[string]string
+// @Router /admin/audit [get]
+func (s *AuditService) ListRecords(c *gin.Context) {
+	f := models.AuditFilter{Subject: c.Query("subject"), OrderUID: c.Query("order_uid")}
+	var err error
+	if f.Limit, f.Offset, err = pageParams(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.From, err = timeParam(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.To, err = timeParam(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	records, err := s.audit.ListAuditRecords(c.Request.Context(), f)
+	if err != nil {
+		logger.Error("error of listing audit records", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, records)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"WB_LVL0/server/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// BacklogReporter measures the backlog of the consumer group
+type BacklogReporter interface {
+	Backlog() (models.ConsumerBacklog, error)
+}
+
+type BacklogService struct {
+	reporter BacklogReporter
+}
+
+func NewBacklogService(r BacklogReporter) *BacklogService {
+	return &BacklogService{reporter: r}
+}
+
+// ConsumerBacklog handler
+// @Summary Backlog of the consumer group for autoscaling
+// @Description Число сообщений топика, ещё не подтверждённых группой консьюмеров (по всем партициям), скорость подтверждения за последние замеры и оценка времени разбора очереди (null, пока группа ничего не подтверждает). Одинаково на всех репликах, обновляется раз в 15 секунд; 503, если замер не удался
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.ConsumerBacklog
+// @Failure 503 {object} map[string]string
+// @Router /consumer/backlog [get]
+func (h *BacklogService) ConsumerBacklog(c *gin.Context) {
+	backlog, err := h.reporter.Backlog()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, backlog)
+}
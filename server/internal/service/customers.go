@@ -0,0 +1,54 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// CustomerOrdersReader reads the orders of a customer, newest first
+type CustomerOrdersReader interface {
+	CustomerOrders(ctx context.Context, customerID string, limit int, after *models.OrderCursor) (*models.OrderPage, error)
+}
+
+// CustomerService serves the order history of customers
+type CustomerService struct {
+	reader CustomerOrdersReader
+}
+
+func NewCustomerService(r CustomerOrdersReader) *CustomerService {
+	return &CustomerService{reader: r}
+}
+
+// ListOrders handler
+// @Summary Orders of a customer
+// @Description Заказы клиента от новых к старым с курсорной пагинацией: next_cursor из ответа передаётся в cursor следующего запроса. Последние redis.customer_orders_limit заказов хранятся в Redis и обновляются при сохранении заказов, более старые читаются из PostgreSQL
+// @Tags customers
+// @Produce json
+// @Param customer_id path string true "Customer ID"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} models.OrderPage
+// @Failure 400 {object} map[string]string
+// @Router /customers/{customer_id}/orders [get]
+func (s *CustomerService) ListOrders(c *gin.Context) {
+	limit, err := limitParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := cursorParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := s.reader.CustomerOrders(c.Request.Context(), c.Param("customer_id"), limit, after)
+	if err != nil {
+		logger.Error("error of listing orders of customer", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
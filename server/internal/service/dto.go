@@ -0,0 +1,145 @@
+package service
+
+import (
+	"WB_LVL0/server/models"
+	"time"
+)
+
+// The HTTP API has its own types: models.Order is also the Kafka message and the database mapping,
+// so fields are hidden or renamed here without changing the message schema.
+
+// OrderResponse is an order returned by the API, internal_signature is not exposed
+type OrderResponse struct {
+	OrderUID        string           `json:"order_uid"`
+	TrackNumber     string           `json:"track_number"`
+	Entry           string           `json:"entry"`
+	Delivery        DeliveryResponse `json:"delivery"`
+	Payment         PaymentResponse  `json:"payment"`
+	Items           []ItemResponse   `json:"items"`
+	Locale          string           `json:"locale"`
+	CustomerID      string           `json:"customer_id"`
+	DeliveryService string           `json:"delivery_service"`
+	Shardkey        string           `json:"shardkey"`
+	SmID            int              `json:"sm_id"`
+	DateCreated     time.Time        `json:"date_created"`
+	OofShard        string           `json:"oof_shard"`
+	// DeletedAt is set for soft-deleted orders, returned by the admin reads only
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type DeliveryResponse struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+// PaymentResponse has the amounts in minor units of the currency and, in *_formatted, as decimals
+// with the currency code (18.17 USD), so clients don't need to know the decimal places of currencies
+type PaymentResponse struct {
+	Transaction           string `json:"transaction"`
+	RequestID             string `json:"request_id"`
+	Currency              string `json:"currency"`
+	Provider              string `json:"provider"`
+	Amount                int64  `json:"amount"`
+	AmountFormatted       string `json:"amount_formatted"`
+	PaymentDt             int64  `json:"payment_dt"`
+	Bank                  string `json:"bank"`
+	DeliveryCost          int64  `json:"delivery_cost"`
+	DeliveryCostFormatted string `json:"delivery_cost_formatted"`
+	GoodsTotal            int64  `json:"goods_total"`
+	GoodsTotalFormatted   string `json:"goods_total_formatted"`
+	CustomFee             int64  `json:"custom_fee"`
+	CustomFeeFormatted    string `json:"custom_fee_formatted"`
+}
+
+// ItemResponse has the prices in minor units of the payment currency and formatted like PaymentResponse
+type ItemResponse struct {
+	ChrtID              int    `json:"chrt_id"`
+	TrackNumber         string `json:"track_number"`
+	Price               int64  `json:"price"`
+	PriceFormatted      string `json:"price_formatted"`
+	Rid                 string `json:"rid"`
+	Name                string `json:"name"`
+	Sale                int    `json:"sale"`
+	Size                string `json:"size"`
+	TotalPrice          int64  `json:"total_price"`
+	TotalPriceFormatted string `json:"total_price_formatted"`
+	NmID                int    `json:"nm_id"`
+	Brand               string `json:"brand"`
+	Status              int    `json:"status"`
+}
+
+// newOrderResponse maps a stored order to its API representation
+func newOrderResponse(o *models.Order) OrderResponse {
+	items := make([]ItemResponse, 0, len(o.Items))
+	for _, it := range o.Items {
+		items = append(items, ItemResponse{
+			ChrtID:              it.ChrtID,
+			TrackNumber:         it.TrackNumber,
+			Price:               it.Price.Amount,
+			PriceFormatted:      it.Price.String(),
+			Rid:                 it.Rid,
+			Name:                it.Name,
+			Sale:                it.Sale,
+			Size:                it.Size,
+			TotalPrice:          it.TotalPrice.Amount,
+			TotalPriceFormatted: it.TotalPrice.String(),
+			NmID:                it.NmID,
+			Brand:               it.Brand,
+			Status:              it.Status,
+		})
+	}
+	return OrderResponse{
+		OrderUID:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: DeliveryResponse{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: PaymentResponse{
+			Transaction:           o.Payment.Transaction,
+			RequestID:             o.Payment.RequestID,
+			Currency:              o.Payment.Currency,
+			Provider:              o.Payment.Provider,
+			Amount:                o.Payment.Amount.Amount,
+			AmountFormatted:       o.Payment.Amount.String(),
+			PaymentDt:             o.Payment.PaymentDt,
+			Bank:                  o.Payment.Bank,
+			DeliveryCost:          o.Payment.DeliveryCost.Amount,
+			DeliveryCostFormatted: o.Payment.DeliveryCost.String(),
+			GoodsTotal:            o.Payment.GoodsTotal.Amount,
+			GoodsTotalFormatted:   o.Payment.GoodsTotal.String(),
+			CustomFee:             o.Payment.CustomFee.Amount,
+			CustomFeeFormatted:    o.Payment.CustomFee.String(),
+		},
+		Items:           items,
+		Locale:          o.Locale,
+		CustomerID:      o.CustomerID,
+		DeliveryService: o.DeliveryService,
+		Shardkey:        o.Shardkey,
+		SmID:            o.SmID,
+		DateCreated:     o.DateCreated,
+		OofShard:        o.OofShard,
+		DeletedAt:       o.DeletedAt,
+	}
+}
+
+// seekRequest is the body of POST /admin/consumer/seek
+type seekRequest struct {
+	Timestamp *time.Time    `json:"timestamp,omitempty"`
+	Offsets   map[int]int64 `json:"offsets,omitempty"`
+}
+
+func (r seekRequest) toModel() models.SeekRequest {
+	return models.SeekRequest{Timestamp: r.Timestamp, Offsets: r.Offsets}
+}
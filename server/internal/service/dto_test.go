@@ -0,0 +1,55 @@
+package service
+
+import (
+	"WB_LVL0/server/models"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderResponse(t *testing.T) {
+	deleted := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	order := &models.Order{
+		OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK", Entry: "WBIL",
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", RequestID: "r1", Currency: "USD", Provider: "wbpay",
+			Amount: models.NewMoney(1817, "USD"), PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: models.NewMoney(1500, "USD"), GoodsTotal: models.NewMoney(317, "USD"), CustomFee: models.NewMoney(1, "USD")},
+		Items: []models.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: models.NewMoney(453, "USD"), Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: models.NewMoney(317, "USD"), NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+		Locale: "en", InternalSignature: "secret", CustomerID: "test", DeliveryService: "meest", Shardkey: "9",
+		SmID: 99, DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OofShard: "1", DeletedAt: &deleted,
+	}
+
+	var want, got map[string]any
+	b, err := json.Marshal(order)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &want))
+	b, err = json.Marshal(newOrderResponse(order))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &got))
+
+	// amounts are also formatted in the payment currency
+	payment := got["payment"].(map[string]any)
+	require.Equal(t, "18.17 USD", payment["amount_formatted"])
+	require.Equal(t, "15.00 USD", payment["delivery_cost_formatted"])
+	require.Equal(t, "3.17 USD", payment["goods_total_formatted"])
+	require.Equal(t, "0.01 USD", payment["custom_fee_formatted"])
+	item := got["items"].([]any)[0].(map[string]any)
+	require.Equal(t, "4.53 USD", item["price_formatted"])
+	require.Equal(t, "3.17 USD", item["total_price_formatted"])
+	for _, key := range []string{"amount_formatted", "delivery_cost_formatted", "goods_total_formatted", "custom_fee_formatted"} {
+		delete(payment, key)
+	}
+	delete(item, "price_formatted")
+	delete(item, "total_price_formatted")
+
+	// every other field but internal_signature keeps its name and value
+	require.NotContains(t, got, "internal_signature")
+	delete(want, "internal_signature")
+	require.Equal(t, want, got)
+
+	require.Equal(t, []ItemResponse{}, newOrderResponse(&models.Order{}).Items)
+}
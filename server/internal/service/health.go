@@ -0,0 +1,67 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// HealthReporter aggregates the health of all subsystems
+type HealthReporter interface {
+	Report(ctx context.Context) models.HealthReport
+}
+
+type HealthService struct {
+	reporter HealthReporter
+}
+
+func NewHealthService(r HealthReporter) *HealthService {
+	return &HealthService{reporter: r}
+}
+
+// FullHealth handler
+// @Summary Composite health of all subsystems
+// @Description Статус, время в текущем статусе и последняя ошибка каждого компонента (HTTP, consumer, PostgreSQL, Redis, outbox relay), общий статус и оценка 0-100. 503, если хотя бы один компонент недоступен
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Failure 503 {object} models.HealthReport
+// @Router /admin/health/full [get]
+func (h *HealthService) FullHealth(c *gin.Context) {
+	report := h.reporter.Report(c.Request.Context())
+	code := http.StatusOK
+	if report.Status == string(health.StatusDown) {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
+// ConsumerHealthService serves the readiness of the consumer loop for probes
+type ConsumerHealthService struct {
+	progress   *health.Progress
+	stuckAfter time.Duration
+}
+
+func NewConsumerHealthService(progress *health.Progress, stuckAfter time.Duration) *ConsumerHealthService {
+	return &ConsumerHealthService{progress: progress, stuckAfter: stuckAfter}
+}
+
+// ConsumerHealth handler
+// @Summary Readiness of the consumer loop
+// @Description Время последнего полученного и подтверждённого сообщения, с какого момента обрабатывается текущее и с какого момента идут ошибки без успехов. 503, если сообщение обрабатывается или ошибки идут дольше health.consumer_stuck_after; ожидание сообщений пустого топика ошибкой не считается
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.ConsumerProgress
+// @Failure 503 {object} models.ConsumerProgress
+// @Router /healthz/consumer [get]
+func (h *ConsumerHealthService) ConsumerHealth(c *gin.Context) {
+	progress := h.progress.Check(h.stuckAfter)
+	code := http.StatusOK
+	if progress.Status == string(health.StatusDown) {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, progress)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// APIKeyManager creates, lists, revokes and rotates API keys
+type APIKeyManager interface {
+	CreateKey(ctx context.Context, name string) (*models.APIKey, error)
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeKey(ctx context.Context, id int64) error
+	RotateKey(ctx context.Context, id int64) (*models.APIKey, error)
+}
+
+// KeyService contains API key management handlers mounted under /admin/keys
+type KeyService struct {
+	keys APIKeyManager
+}
+
+func NewKeyService(k APIKeyManager) *KeyService {
+	return &KeyService{keys: k}
+}
+
+type createKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateKey handler
+// @Summary Create API key
+// @Description Секрет возвращается только в этом ответе, в базе хранится его хеш
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body createKeyRequest true "Key name"
+// @Success 201 {object} models.APIKey
+// @Failure 400 {object} map[string]string
+// @Router /admin/keys [post]
+func (k *KeyService) CreateKey(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, err := k.keys.CreateKey(c.Request.Context(), req.Name)
+	if err != nil {
+		logger.Error("error of creating api key", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListKeys handler
+// @Summary List API keys
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Router /admin/keys [get]
+func (k *KeyService) ListKeys(c *gin.Context) {
+	keys, err := k.keys.ListKeys(c.Request.Context())
+	if err != nil {
+		logger.Error("error of listing api keys", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeKey handler
+// @Summary Revoke API key
+// @Tags admin
+// @Param id path int true "Key ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /admin/keys/{id} [delete]
+func (k *KeyService) RevokeKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := k.keys.RevokeKey(c.Request.Context(), id); err != nil {
+		keyError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RotateKey handler
+// @Summary Rotate API key
+// @Description Отзывает ключ и возвращает новый с тем же именем
+// @Tags admin
+// @Produce json
+// @Param id path int true "Key ID"
+// @Success 201 {object} models.APIKey
+// @Failure 404 {object} map[string]string
+// @Router /admin/keys/{id}/rotate [post]
+func (k *KeyService) RotateKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	key, err := k.keys.RotateKey(c.Request.Context(), id)
+	if err != nil {
+		keyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func keyError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Error("error of managing api key", logging.Err(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
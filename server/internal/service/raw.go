@@ -0,0 +1,65 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// HeaderRawSource tells where the original payload came from: orders_raw or event_log
+	HeaderRawSource = "X-Raw-Source"
+	// HeaderSchemaVersion is the schema version the original payload was sent with
+	HeaderSchemaVersion = "X-Schema-Version"
+)
+
+// RawOrderProvider returns the original payloads of the stored orders
+type RawOrderProvider interface {
+	RawOrderPayload(ctx context.Context, orderUID string) (models.RawPayload, models.RawSource, error)
+}
+
+// RawService serves the original order payloads for debugging the normalized representation
+type RawService struct {
+	orders RawOrderProvider
+}
+
+func NewRawService(o RawOrderProvider) *RawService {
+	return &RawService{orders: o}
+}
+
+// GetRawOrder handler
+// @Summary Original payload of order
+// @Description Исходное сообщение заказа в том виде, в котором его отправил producer (включая неизвестные поля), - для поиска расхождений с нормализованным представлением. Берётся из orders_raw (database.raw_orders), иначе из журнала order_event_log; заголовок X-Raw-Source - orders_raw или event_log. Хранится как отправлено, суммы старых версий схемы (X-Schema-Version) при чтении переводятся в минимальные единицы валюты
+// @Tags orders
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Success 200 {object} object
+// @Header 200 {string} X-Raw-Source "orders_raw or event_log"
+// @Header 200 {integer} X-Schema-Version "schema version the payload was sent with"
+// @Failure 404 {object} map[string]string
+// @Router /order/{order_uid}/raw [get]
+func (r *RawService) GetRawOrder(c *gin.Context) {
+	raw, source, err := r.orders.RawOrderPayload(c.Request.Context(), c.Param("order_uid"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "raw order not found"})
+			return
+		}
+		logger.Error("error of getting raw order", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	payload, err := models.UpgradePayload(raw.SchemaVersion, raw.Payload)
+	if err != nil {
+		logger.Error("error of decoding raw order", "schema_version", raw.SchemaVersion, logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.Header(HeaderRawSource, string(source))
+	c.Header(HeaderSchemaVersion, strconv.Itoa(raw.SchemaVersion))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+}
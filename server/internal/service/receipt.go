@@ -0,0 +1,43 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/receipt"
+	"WB_LVL0/server/models"
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetReceipt handler
+// @Summary Order receipt in PDF
+// @Description Чек заказа в PDF: покупатель, товары, итоговые суммы и оплата; язык чека - по полю locale заказа (en, ru; для остальных - английский)
+// @Tags orders
+// @Produce application/pdf
+// @Param order_uid path string true "Order UID"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]string
+// @Router /order/{order_uid}/receipt.pdf [get]
+func (s *Service) GetReceipt(c *gin.Context) {
+	orderUID := c.Param("order_uid")
+	order, _, err := s.OrderProvider.GetOrder(c.Request.Context(), orderUID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		logger.Error("error of getting order", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	// rendered in memory, so a failure is reported with an error status instead of a truncated file
+	var buf bytes.Buffer
+	if err := receipt.Render(&buf, order); err != nil {
+		logger.Error("error of rendering receipt", "order_uid", orderUID, logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.Header("Content-Disposition", `inline; filename="receipt-`+orderUID+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Searcher finds orders by full-text search and items by their brand and product
+type Searcher interface {
+	SearchOrders(ctx context.Context, text string, limit, offset int) ([]models.OrderSearchHit, error)
+	SearchItems(ctx context.Context, q models.ItemSearch, limit, offset int) ([]models.ItemHit, error)
+}
+
+// SearchService serves the order search for support and the item search for merchandising
+type SearchService struct {
+	searcher Searcher
+}
+
+func NewSearchService(s Searcher) *SearchService {
+	return &SearchService{searcher: s}
+}
+
+// SearchOrders handler
+// @Summary Full-text order search
+// @Description Поиск заказов по словам из имени получателя, города, брендов и названий товаров; каждое слово ищется как префикс
+// @Tags orders
+// @Produce json
+// @Param q query string true "Search words, e.g. nike moscow"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.OrderSearchHit
+// @Failure 400 {object} map[string]string
+// @Router /orders/search [get]
+func (s *SearchService) SearchOrders(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, offset, err := pageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hits, err := s.searcher.SearchOrders(c.Request.Context(), text, limit, offset)
+	if err != nil {
+		logger.Error("error of order search", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, hits)
+}
+
+// SearchItems handler
+// @Summary Item search by brand and product
+// @Description Товары бренда (brand, без учёта регистра) и/или артикула (nm_id) вместе с order_uid их заказов, от новых заказов к старым, - например, все заказы с брендом X. Нужен хотя бы один из параметров
+// @Tags orders
+// @Produce json
+// @Param brand query string false "Brand, e.g. Vivienne Sabo"
+// @Param nm_id query int false "Product nm_id"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.ItemHit
+// @Failure 400 {object} map[string]string
+// @Router /items/search [get]
+func (s *SearchService) SearchItems(c *gin.Context) {
+	q := models.ItemSearch{Brand: strings.TrimSpace(c.Query("brand"))}
+	if v := c.Query("nm_id"); v != "" {
+		nmID, err := strconv.Atoi(v)
+		if err != nil || nmID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nm_id must be a positive integer"})
+			return
+		}
+		q.NmID = nmID
+	}
+	if q.Brand == "" && q.NmID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "brand or nm_id is required"})
+		return
+	}
+	limit, offset, err := pageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hits, err := s.searcher.SearchItems(c.Request.Context(), q, limit, offset)
+	if err != nil {
+		logger.Error("error of item search", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, hits)
+}
@@ -1,42 +1,168 @@
 package service
 
 import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/logging"
 	"WB_LVL0/server/models"
+	"context"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
 )
 
+var logger = logging.Component("http")
+
+// HeaderOrderSource tells where the order was read from: local (the in-process cache), redis or db
+const HeaderOrderSource = "X-Order-Source"
+
 type Service struct {
 	OrderProvider
+	hub *broadcast.Hub
 }
 
-// OrderProvider is interface that the database implement
+// OrderProvider is the part of storage.Repository the order endpoints use
 type OrderProvider interface {
-	GetOrder(orderUID string) (*models.Order, error)
+	GetOrder(ctx context.Context, orderUID string) (*models.Order, models.OrderSource, error)
+	ListOrders(ctx context.Context, f models.OrderFilter, limit int, after *models.OrderCursor) (*models.OrderPage, error)
+	CountOrders(ctx context.Context, f models.OrderFilter) (int64, error)
+	OrderExists(ctx context.Context, orderUID string) (bool, error)
 }
 
-func NewService(o OrderProvider) *Service {
-	return &Service{o}
+func NewService(o OrderProvider, hub *broadcast.Hub) *Service {
+	return &Service{OrderProvider: o, hub: hub}
 }
 
 // GetOrder handler
 // @Summary Get order by UID
-// @Description Получить заказ по его уникальному идентификатору
+// @Description Получить заказ по его уникальному идентификатору; заголовок X-Order-Source - откуда прочитан заказ: local, redis или db
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param order_uid path string true "Order UID"
-// @Success 200 {object} models.Order
+// @Success 200 {object} OrderResponse
+// @Header 200 {string} X-Order-Source "local, redis or db"
 // @Failure 400 {object} map[string]string
 // @Router /order/{order_uid} [get]
 func (s *Service) GetOrder(c *gin.Context) {
 	orderUID := c.Param("order_uid")
 	//get order from PostgreSQL or Redis
-	order, err := s.OrderProvider.GetOrder(orderUID)
+	order, source, err := s.OrderProvider.GetOrder(c.Request.Context(), orderUID)
 	if err != nil {
-		log.Printf("error of getting order: %v", err)
+		logger.Error("error of getting order", logging.Err(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error: ": err.Error()})
+		return
+	}
+	c.Header(HeaderOrderSource, string(source))
+	c.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+// OrderExists handler
+// @Summary Check order existence
+// @Description Проверка наличия заказа без передачи данных: 200, если заказ есть, 404 - если нет
+// @Tags orders
+// @Param order_uid path string true "Order UID"
+// @Success 200
+// @Failure 404
+// @Router /order/{order_uid} [head]
+func (s *Service) OrderExists(c *gin.Context) {
+	exists, err := s.OrderProvider.OrderExists(c.Request.Context(), c.Param("order_uid"))
+	if err != nil {
+		logger.Error("error of checking order", logging.Err(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// CountOrders handler
+// @Summary Count orders
+// @Description Количество заказов (без мягко удалённых) с теми же фильтрами, что у GET /orders
+// @Tags orders
+// @Produce json
+// @Param customer_id query string false "Customer ID"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Success 200 {object} map[string]int64
+// @Failure 400 {object} map[string]string
+// @Router /orders/count [get]
+func (s *Service) CountOrders(c *gin.Context) {
+	f, err := orderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	count, err := s.OrderProvider.CountOrders(c.Request.Context(), f)
+	if err != nil {
+		logger.Error("error of counting orders", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": count})
+}
+
+// ListOrders handler
+// @Summary List orders
+// @Description Заказы от новых к старым с курсорной пагинацией: next_cursor из ответа передаётся в cursor следующего запроса (с теми же фильтрами)
+// @Tags orders
+// @Produce json
+// @Param customer_id query string false "Customer ID"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} models.OrderPage
+// @Failure 400 {object} map[string]string
+// @Router /orders [get]
+func (s *Service) ListOrders(c *gin.Context) {
+	limit, err := limitParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := cursorParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f, err := orderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := s.OrderProvider.ListOrders(c.Request.Context(), f, limit, after)
+	if err != nil {
+		logger.Error("error of listing orders", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// cursorParam parses the cursor query parameter, nil for the first page
+func cursorParam(c *gin.Context) (*models.OrderCursor, error) {
+	v := c.Query("cursor")
+	if v == "" {
+		return nil, nil
+	}
+	cursor, err := models.DecodeOrderCursor(v)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// orderFilter parses the customer_id, from and to query parameters of the order list
+func orderFilter(c *gin.Context) (models.OrderFilter, error) {
+	f := models.OrderFilter{CustomerID: c.Query("customer_id")}
+	var err error
+	if f.From, err = timeParam(c, "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = timeParam(c, "to"); err != nil {
+		return f, err
 	}
-	c.JSON(http.StatusOK, order)
+	return f, nil
 }
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/internal/tracking"
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+type stubOrders struct {
+	OrderProvider
+	source models.OrderSource
+}
+
+func (s stubOrders) GetOrder(_ context.Context, orderUID string) (*models.Order, models.OrderSource, error) {
+	return &models.Order{OrderUID: orderUID}, s.source, nil
+}
+
+func TestGetOrderSource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/order/:order_uid", NewService(stubOrders{source: models.OrderFromRedis}, broadcast.NewHub()).GetOrder)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/uid1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "redis", w.Header().Get(HeaderOrderSource))
+	require.Contains(t, w.Body.String(), `"order_uid":"uid1"`)
+}
+
+type missingOrders struct {
+	OrderProvider
+}
+
+func (missingOrders) GetOrder(context.Context, string) (*models.Order, models.OrderSource, error) {
+	return nil, "", storage.ErrOrderNotFound
+}
+
+func TestGetReceipt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/order/:order_uid/receipt.pdf", NewService(stubOrders{}, broadcast.NewHub()).GetReceipt)
+	router.GET("/missing/:order_uid/receipt.pdf", NewService(missingOrders{}, broadcast.NewHub()).GetReceipt)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/uid1/receipt.pdf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	require.Equal(t, `inline; filename="receipt-uid1.pdf"`, w.Header().Get("Content-Disposition"))
+	require.True(t, strings.HasPrefix(w.Body.String(), "%PDF-"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing/uid1/receipt.pdf", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+type rawOrdersFunc func(orderUID string) (models.RawPayload, models.RawSource, error)
+
+func (f rawOrdersFunc) RawOrderPayload(_ context.Context, orderUID string) (models.RawPayload, models.RawSource, error) {
+	return f(orderUID)
+}
+
+func TestGetRawOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/order/:order_uid/raw", NewRawService(rawOrdersFunc(func(orderUID string) (models.RawPayload, models.RawSource, error) {
+		switch orderUID {
+		case "missing":
+			return models.RawPayload{}, "", storage.ErrOrderNotFound
+		case "legacy":
+			return models.RawPayload{Payload: []byte(`{"order_uid": "legacy", "payment": {"currency": "USD", "amount": 1817}}`),
+				SchemaVersion: 1}, models.RawFromOrders, nil
+		}
+		return models.RawPayload{Payload: []byte(`{"order_uid": "uid1", "unknown_field": 1}`),
+			SchemaVersion: models.CurrentSchemaVersion}, models.RawFromEventLog, nil
+	})).GetRawOrder)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/uid1/raw", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "event_log", w.Header().Get(HeaderRawSource))
+	require.Equal(t, "2", w.Header().Get(HeaderSchemaVersion))
+	require.Equal(t, `{"order_uid": "uid1", "unknown_field": 1}`, w.Body.String())
+
+	// the amounts of an older version are upgraded to minor units
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/legacy/raw", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Header().Get(HeaderSchemaVersion))
+	require.JSONEq(t, `{"order_uid": "legacy", "payment": {"currency": "USD", "amount": 181700}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/missing/raw", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConsumerHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var progress health.Progress
+	router := gin.New()
+	router.GET("/healthz/consumer", NewConsumerHealthService(&progress, 10*time.Millisecond).ConsumerHealth)
+
+	// an idle consumer is ready
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/consumer", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status": "up"}`, w.Body.String())
+
+	progress.Fetched()
+	time.Sleep(20 * time.Millisecond)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/consumer", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var res models.ConsumerProgress
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Equal(t, "down", res.Status)
+	require.NotNil(t, res.BusySince)
+	require.Contains(t, res.Reason, "processing a message")
+}
+
+type backlogFunc func() (models.ConsumerBacklog, error)
+
+func (f backlogFunc) Backlog() (models.ConsumerBacklog, error) { return f() }
+
+func TestConsumerBacklog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var err error
+	drain := 12.5
+	router := gin.New()
+	router.GET("/consumer/backlog", NewBacklogService(backlogFunc(func() (models.ConsumerBacklog, error) {
+		return models.ConsumerBacklog{MessagesBehind: 250, EstimatedDrainSeconds: &drain, ConsumeRate: 20, Partitions: 3,
+			MeasuredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}, err
+	})).ConsumerBacklog)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/consumer/backlog", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"messages_behind": 250, "estimated_drain_seconds": 12.5, "consume_rate": 20, "partitions": 3,
+		"measured_at": "2024-05-01T12:00:00Z"}`, w.Body.String())
+
+	err = errors.New("offset fetch: connection refused")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/consumer/backlog", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+type stubStats struct {
+	top     func(by, currency string, limit int) ([]models.CustomerStats, error)
+	revenue func(q models.RevenueQuery) ([]models.RevenueRow, error)
+	items   func(q models.TopItemsQuery) ([]models.ItemStats, error)
+}
+
+func (s stubStats) TopCustomers(_ context.Context, by, currency string, limit int) ([]models.CustomerStats, error) {
+	return s.top(by, currency, limit)
+}
+
+func (s stubStats) Revenue(_ context.Context, q models.RevenueQuery) ([]models.RevenueRow, error) {
+	return s.revenue(q)
+}
+
+func (s stubStats) TopItems(_ context.Context, q models.TopItemsQuery) ([]models.ItemStats, error) {
+	return s.items(q)
+}
+
+func TestTopCustomers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var got []any
+	router.GET("/stats/customers/top", NewStatsService(stubStats{top: func(by, currency string, limit int) ([]models.CustomerStats, error) {
+		got = []any{by, currency, limit}
+		amount := models.NewMoney(250050, currency)
+		return []models.CustomerStats{{CustomerID: "big", Orders: 3, Amount: &amount}}, nil
+	}}).TopCustomers)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/customers/top?by=amount&currency=usd&limit=5", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []any{models.StatsByAmount, "USD", 5}, got)
+	require.Contains(t, w.Body.String(), `"amount":{"amount":250050,"currency":"USD"}`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/customers/top", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []any{models.StatsByCount, "", defaultListLimit}, got)
+
+	for _, query := range []string{"by=amount", "by=revenue", "limit=0"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/customers/top?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestRevenue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var got models.RevenueQuery
+	router.GET("/stats/revenue", NewStatsService(stubStats{revenue: func(q models.RevenueQuery) ([]models.RevenueRow, error) {
+		got = q
+		return []models.RevenueRow{{Period: q.From, Provider: "wbpay", Orders: 2, Amount: models.NewMoney(3634, "USD")}}, nil
+	}}).Revenue)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/revenue?group_by=currency,provider&period=month&from=2024-01-01T00:00:00Z", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, models.RevenueQuery{Period: models.PeriodMonth, ByProvider: true, From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, got)
+	require.JSONEq(t, `[{"period":"2024-01-01T00:00:00Z","provider":"wbpay","orders":2,"amount":{"amount":3634,"currency":"USD"}}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/revenue", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, models.RevenueQuery{Period: models.PeriodDay}, got)
+
+	for _, query := range []string{"period=year", "group_by=bank", "to=yesterday"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/revenue?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestTopItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var got models.TopItemsQuery
+	router.GET("/stats/items/top", NewStatsService(stubStats{items: func(q models.TopItemsQuery) ([]models.ItemStats, error) {
+		got = q
+		revenue := models.NewMoney(3170, q.Currency)
+		return []models.ItemStats{{NmID: 2389212, Brand: "Vivienne Sabo", Name: "Mascaras", Quantity: 10, Revenue: &revenue}}, nil
+	}}).TopItems)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/items/top?by=revenue&currency=rub&from=2024-01-01T00:00:00Z&to=2024-01-08T00:00:00Z&limit=3", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, models.TopItemsQuery{By: models.StatsByRevenue, Currency: "RUB", Limit: 3,
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)}, got)
+	require.JSONEq(t, `[{"nm_id":2389212,"brand":"Vivienne Sabo","name":"Mascaras","quantity":10,"revenue":{"amount":3170,"currency":"RUB"}}]`, w.Body.String())
+
+	// the last week by default
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/items/top", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, models.StatsByQuantity, got.By)
+	require.WithinDuration(t, time.Now(), got.To, time.Minute)
+	require.Equal(t, defaultItemsWindow, got.To.Sub(got.From))
+
+	for _, query := range []string{"by=revenue", "by=price", "from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", "limit=x"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/items/top?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+type itemSearcher struct {
+	Searcher
+	got []any
+}
+
+func (s *itemSearcher) SearchItems(_ context.Context, q models.ItemSearch, limit, offset int) ([]models.ItemHit, error) {
+	s.got = []any{q, limit, offset}
+	return []models.ItemHit{{OrderUID: "uid1", Item: models.Item{NmID: q.NmID, Brand: "Nike"}}}, nil
+}
+
+func TestSearchItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	searcher := &itemSearcher{}
+	router.GET("/items/search", NewSearchService(searcher).SearchItems)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/search?brand=nike&nm_id=42&limit=10", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []any{models.ItemSearch{Brand: "nike", NmID: 42}, 10, 0}, searcher.got)
+	require.Contains(t, w.Body.String(), `"order_uid":"uid1"`)
+	require.Contains(t, w.Body.String(), `"nm_id":42`)
+
+	for _, query := range []string{"", "brand=", "nm_id=x", "nm_id=-1"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/search?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+type trackerFunc func(deliveryService, trackNumber string) (*models.Shipment, bool, error)
+
+func (f trackerFunc) Track(_ context.Context, deliveryService, trackNumber string) (*models.Shipment, bool, error) {
+	return f(deliveryService, trackNumber)
+}
+
+func TestGetTracking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var trackErr error
+	router := gin.New()
+	router.GET("/order/:order_uid/tracking", NewTrackingService(stubOrders{}, trackerFunc(func(_, trackNumber string) (*models.Shipment, bool, error) {
+		if trackErr != nil {
+			return nil, false, trackErr
+		}
+		return &models.Shipment{TrackNumber: trackNumber, Provider: "dhl", Status: models.ShipmentDelivered}, true, nil
+	})).GetTracking)
+	track := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/uid1/tracking", nil))
+		return w
+	}
+
+	w := track()
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "cache", w.Header().Get(HeaderTrackingSource))
+	require.Contains(t, w.Body.String(), `"status":"delivered"`)
+
+	trackErr = &tracking.RateLimitedError{Provider: "dhl", RetryAfter: 1500 * time.Millisecond}
+	w = track()
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	trackErr = fmt.Errorf("%w: meest", tracking.ErrNoProvider)
+	require.Equal(t, http.StatusNotFound, track().Code)
+
+	trackErr = errors.New("tracking dhl: connection refused")
+	require.Equal(t, http.StatusBadGateway, track().Code)
+}
+
+type stubFailed struct {
+	FailedMessageProvider
+	deleted []int64
+}
+
+func (s *stubFailed) GetFailedMessage(_ context.Context, id int64) (*models.FailedMessage, error) {
+	if id != 7 {
+		return nil, models.ErrNotFound
+	}
+	return &models.FailedMessage{ID: 7, Topic: "orders", Key: "uid1", Payload: `{"order_uid":"uid1"}`}, nil
+}
+
+func (s *stubFailed) DeleteFailedMessage(_ context.Context, id int64) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+type redriverFunc func(ctx context.Context, m models.FailedMessage) error
+
+func (f redriverFunc) Redrive(ctx context.Context, m models.FailedMessage) error { return f(ctx, m) }
+
+func TestRedriveFailedMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	failed := &stubFailed{}
+	var redriven []models.FailedMessage
+	var redriveErr error
+	admin := NewAdminService(failed, redriverFunc(func(_ context.Context, m models.FailedMessage) error {
+		redriven = append(redriven, m)
+		return redriveErr
+	}), nil, nil, nil, nil, nil)
+	router := gin.New()
+	router.POST("/failed-messages/:id/redrive", admin.RedriveFailedMessage)
+	redrive := func(id string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/failed-messages/"+id+"/redrive", nil))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, redrive("7"))
+	require.Len(t, redriven, 1)
+	require.Equal(t, "orders", redriven[0].Topic)
+	require.Equal(t, []int64{7}, failed.deleted)
+
+	require.Equal(t, http.StatusNotFound, redrive("8"))
+	require.Equal(t, http.StatusBadRequest, redrive("x"))
+
+	// a message that isn't published stays quarantined
+	redriveErr = errors.New("kafka is down")
+	require.Equal(t, http.StatusInternalServerError, redrive("7"))
+	require.Equal(t, []int64{7}, failed.deleted)
+}
+
+type stubArchive struct {
+	OrderArchive
+	saved map[string]models.RawPayload
+}
+
+func (s *stubArchive) SaveOrderRaw(_ context.Context, order models.Order, raw models.RawPayload) error {
+	if _, ok := s.saved[order.OrderUID]; ok {
+		return storage.ErrOrderExists
+	}
+	s.saved[order.OrderUID] = raw
+	return nil
+}
+
+func TestCreateOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	archive := &stubArchive{saved: make(map[string]models.RawPayload)}
+	hub := broadcast.NewHub()
+	published, unsubscribe := hub.Subscribe(nil)
+	defer unsubscribe()
+	router := gin.New()
+	router.POST("/orders", NewAdminService(nil, nil, nil, nil, archive, nil, hub).CreateOrder)
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+		return w
+	}
+	order := `{"order_uid":"b563feb7b2b84b6test","track_number":"WBILMTESTTRACK","entry":"WBIL",
+	"delivery":{"name":"Test Testov","phone":"+9720000000","zip":"2639809","city":"Kiryat Mozkin","address":"Ploshad Mira 15","region":"Kraiot","email":"test@gmail.com"},
+	"payment":{"transaction":"b563feb7b2b84b6test","currency":"USD","provider":"wbpay","amount":1817,"payment_dt":1637907727,"bank":"alpha","delivery_cost":1500,"goods_total":317,"custom_fee":0},
+	"items":[{"chrt_id":9934930,"track_number":"WBILMTESTTRACK","price":453,"rid":"ab4219087a764ae0btest","name":"Mascaras","sale":30,"size":"0","total_price":317,"nm_id":2389212,"brand":"Vivienne Sabo","status":202}],
+	"locale":"en","internal_signature":"","customer_id":"test","delivery_service":"meest","shardkey":"9","sm_id":99,"date_created":"2021-11-26T06:22:19Z","oof_shard":"1"}`
+
+	w := create(order)
+	require.Equal(t, http.StatusCreated, w.Code)
+	// the body is stored as sent, amounts in major units
+	require.Equal(t, models.SchemaVersionBare, archive.saved["b563feb7b2b84b6test"].SchemaVersion)
+	require.JSONEq(t, order, string(archive.saved["b563feb7b2b84b6test"].Payload))
+	// the created order reaches the live subscribers like a consumed one
+	require.Equal(t, "b563feb7b2b84b6test", (<-published).OrderUID)
+	require.Equal(t, http.StatusConflict, create(order).Code)
+	require.Empty(t, published)
+	require.Equal(t, http.StatusBadRequest, create("{").Code)
+
+	// the details list every invalid field
+	w = create(strings.Replace(strings.Replace(order, `"USD"`, `"GBP"`, 1), `"sale":30`, `"sale":130`, 1))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Details []models.ValidationError `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Details, 2)
+	require.Equal(t, models.ValidationError{Field: "payment.currency", Tag: "allowed", Value: "GBP",
+		Message: "must be one of USD, EUR, RUB"}, resp.Details[0])
+	require.Equal(t, "items[0].sale", resp.Details[1].Field)
+
+	// mistyped and missing fields are reported by the schema instead of becoming zero values
+	w = create(strings.Replace(strings.Replace(order, `"amount":1817`, `"amount":"1817"`, 1), `"price":453,`, ``, 1))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	resp.Details = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, []models.ValidationError{
+		{Field: "items[0].price", Tag: "required", Message: "is required"},
+		{Field: "payment.amount", Tag: "type", Value: "1817", Message: "must be integer, got string"},
+	}, resp.Details)
+
+	// oversized orders are rejected before decoding
+	defer models.SetValidationRules(models.ValidationCfg{Currencies: []string{"USD", "EUR", "RUB"},
+		Providers: []string{"wbpay", "applepay", "googlepay"}, Locales: []string{"en", "ru"}, MaxMessageBytes: 1 << 20, MaxItems: 1000, Schema: true,
+		UnknownFields: models.UnknownFieldsWarn})
+	models.SetValidationRules(models.ValidationCfg{MaxMessageBytes: 100})
+	require.Equal(t, http.StatusRequestEntityTooLarge, create(order).Code)
+}
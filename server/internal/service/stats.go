@@ -0,0 +1,168 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatsReader computes the analytics of the orders
+type StatsReader interface {
+	TopCustomers(ctx context.Context, by, currency string, limit int) ([]models.CustomerStats, error)
+	Revenue(ctx context.Context, q models.RevenueQuery) ([]models.RevenueRow, error)
+	TopItems(ctx context.Context, q models.TopItemsQuery) ([]models.ItemStats, error)
+}
+
+// defaultItemsWindow is the window of the item sales without from
+const defaultItemsWindow = 7 * 24 * time.Hour
+
+// StatsService serves the business analytics
+type StatsService struct {
+	reader StatsReader
+}
+
+func NewStatsService(r StatsReader) *StatsService {
+	return &StatsService{reader: r}
+}
+
+// TopCustomers handler
+// @Summary Top customers
+// @Description Клиенты с наибольшим числом заказов (by=count) или суммой оплат (by=amount, только в одной валюте currency - суммы в разных валютах не складываются). Считается агрегирующим SQL; при stats.materialized - по материализованному представлению customer_stats, которое обновляется раз в stats.refresh_interval
+// @Tags stats
+// @Produce json
+// @Param by query string false "amount or count (default count)"
+// @Param currency query string false "Currency, required for by=amount"
+// @Param limit query int false "Number of customers (default 50, max 500)"
+// @Success 200 {array} models.CustomerStats
+// @Failure 400 {object} map[string]string
+// @Router /stats/customers/top [get]
+func (s *StatsService) TopCustomers(c *gin.Context) {
+	by := c.DefaultQuery("by", models.StatsByCount)
+	if by != models.StatsByCount && by != models.StatsByAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be amount or count"})
+		return
+	}
+	currency := strings.ToUpper(strings.TrimSpace(c.Query("currency")))
+	if by == models.StatsByAmount && currency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency is required for by=amount, amounts of different currencies are not comparable"})
+		return
+	}
+	limit, err := limitParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	top, err := s.reader.TopCustomers(c.Request.Context(), by, currency, limit)
+	if err != nil {
+		logger.Error("error of ranking customers", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, top)
+}
+
+// Revenue handler
+// @Summary Revenue report
+// @Description Выручка (число заказов и сумма оплат) по периодам day, week или month (начало периода в UTC) и валютам, с group_by=currency,provider - ещё и по платёжным системам. Суммы в разных валютах не складываются, поэтому группировка по валюте есть всегда. Считается GROUP BY в PostgreSQL по таблице payments; from и to ограничивают дату создания заказов
+// @Tags stats
+// @Produce json
+// @Param group_by query string false "currency or currency,provider (default currency)"
+// @Param period query string false "day, week or month (default day)"
+// @Param from query string false "Orders created at or after, RFC 3339"
+// @Param to query string false "Orders created before, RFC 3339"
+// @Success 200 {array} models.RevenueRow
+// @Failure 400 {object} map[string]string
+// @Router /stats/revenue [get]
+func (s *StatsService) Revenue(c *gin.Context) {
+	q := models.RevenueQuery{Period: c.DefaultQuery("period", models.PeriodDay)}
+	switch q.Period {
+	case models.PeriodDay, models.PeriodWeek, models.PeriodMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, week or month"})
+		return
+	}
+	for _, group := range strings.Split(c.DefaultQuery("group_by", "currency"), ",") {
+		switch strings.TrimSpace(group) {
+		case "currency":
+		case "provider":
+			q.ByProvider = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must list currency and provider"})
+			return
+		}
+	}
+	var err error
+	if q.From, err = timeParam(c, "from"); err == nil {
+		q.To, err = timeParam(c, "to")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := s.reader.Revenue(c.Request.Context(), q)
+	if err != nil {
+		logger.Error("error of revenue report", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// TopItems handler
+// @Summary Best-selling items
+// @Description Самые продаваемые товары (по nm_id) за окно from..to (по умолчанию - последние 7 дней) по количеству (by=quantity, каждая позиция заказа - одна единица) или выручке (by=revenue, сумма total_price только в одной валюте currency). Считается GROUP BY по таблице items
+// @Tags stats
+// @Produce json
+// @Param by query string false "quantity or revenue (default quantity)"
+// @Param currency query string false "Currency, required for by=revenue"
+// @Param from query string false "Orders created at or after, RFC 3339 (default 7 days before to)"
+// @Param to query string false "Orders created before, RFC 3339 (default now)"
+// @Param limit query int false "Number of items (default 50, max 500)"
+// @Success 200 {array} models.ItemStats
+// @Failure 400 {object} map[string]string
+// @Router /stats/items/top [get]
+func (s *StatsService) TopItems(c *gin.Context) {
+	q := models.TopItemsQuery{
+		By:       c.DefaultQuery("by", models.StatsByQuantity),
+		Currency: strings.ToUpper(strings.TrimSpace(c.Query("currency"))),
+	}
+	if q.By != models.StatsByQuantity && q.By != models.StatsByRevenue {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be quantity or revenue"})
+		return
+	}
+	if q.By == models.StatsByRevenue && q.Currency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency is required for by=revenue, amounts of different currencies are not comparable"})
+		return
+	}
+	var err error
+	if q.Limit, err = limitParam(c); err == nil {
+		if q.From, err = timeParam(c, "from"); err == nil {
+			q.To, err = timeParam(c, "to")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultItemsWindow)
+	}
+	if !q.From.Before(q.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	top, err := s.reader.TopItems(c.Request.Context(), q)
+	if err != nil {
+		logger.Error("error of ranking items", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, top)
+}
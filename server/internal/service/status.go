@@ -0,0 +1,48 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// StatusProvider resolves public status tokens generated at ingestion
+type StatusProvider interface {
+	GetOrderStatus(ctx context.Context, token string) (*models.OrderStatusView, error)
+}
+
+// StatusService serves the customer-facing order status page
+type StatusService struct {
+	status StatusProvider
+}
+
+func NewStatusService(p StatusProvider) *StatusService {
+	return &StatusService{status: p}
+}
+
+// GetStatus handler
+// @Summary Public order status
+// @Description Статус заказа по короткому токену (без персональных данных) для ссылок в уведомлениях клиентам
+// @Tags status
+// @Produce json
+// @Param token path string true "Status token"
+// @Success 200 {object} models.OrderStatusView
+// @Failure 404 {object} map[string]string
+// @Router /status/{token} [get]
+func (s *StatusService) GetStatus(c *gin.Context) {
+	view, err := s.status.GetOrderStatus(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status not found"})
+			return
+		}
+		logger.Error("error of getting order status", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=60")
+	c.JSON(http.StatusOK, view)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/models"
+	"github.com/gin-gonic/gin"
+	"io"
+	"time"
+)
+
+// keepAliveInterval keeps idle SSE connections open through proxies
+const keepAliveInterval = 15 * time.Second
+
+// StreamOrders handler
+// @Summary Stream new orders
+// @Description Server-Sent Events: все новые заказы по мере их поступления из Kafka (событие order), ping раз в 15 секунд
+// @Tags orders
+// @Produce text/event-stream
+// @Success 200 {object} OrderResponse
+// @Router /orders/stream [get]
+func (s *Service) StreamOrders(c *gin.Context) {
+	s.stream(c, nil)
+}
+
+// StreamCustomerOrders handler
+// @Summary Stream new orders of a customer
+// @Description Server-Sent Events: новые заказы клиента по мере их поступления из Kafka
+// @Tags customers
+// @Produce text/event-stream
+// @Param customer_id path string true "Customer ID"
+// @Success 200 {object} OrderResponse
+// @Router /customers/{customer_id}/orders/stream [get]
+func (s *Service) StreamCustomerOrders(c *gin.Context) {
+	s.stream(c, broadcast.ByCustomer(c.Param("customer_id")))
+}
+
+// stream sends the published orders passing the filter (nil - all) until the client disconnects
+func (s *Service) stream(c *gin.Context, filter func(models.Order) bool) {
+	orders, unsubscribe := s.hub.Subscribe(filter)
+	defer unsubscribe()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case order, ok := <-orders:
+			if !ok {
+				return false
+			}
+			c.SSEvent("order", newOrderResponse(&order))
+			return true
+		case <-keepAlive.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
+}
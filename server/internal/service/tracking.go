@@ -0,0 +1,78 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/tracking"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// HeaderTrackingSource tells where the shipment status came from: cache or provider
+const HeaderTrackingSource = "X-Tracking-Source"
+
+// ShipmentTracker returns the shipment statuses from the delivery services
+type ShipmentTracker interface {
+	Track(ctx context.Context, deliveryService, trackNumber string) (*models.Shipment, bool, error)
+}
+
+// TrackingService serves the shipment tracking of orders
+type TrackingService struct {
+	orders  OrderProvider
+	tracker ShipmentTracker
+}
+
+func NewTrackingService(o OrderProvider, t ShipmentTracker) *TrackingService {
+	return &TrackingService{orders: o, tracker: t}
+}
+
+// GetTracking handler
+// @Summary Shipment tracking of order
+// @Description Статус доставки заказа у его службы доставки (по delivery_service и track_number) с историей перемещений; статус кешируется, запросы к службам ограничены по частоте. Заголовок X-Tracking-Source - cache или provider
+// @Tags orders
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Success 200 {object} models.Shipment
+// @Header 200 {string} X-Tracking-Source "cache or provider"
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /order/{order_uid}/tracking [get]
+func (t *TrackingService) GetTracking(c *gin.Context) {
+	order, _, err := t.orders.GetOrder(c.Request.Context(), c.Param("order_uid"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		logger.Error("error of getting order", logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	shipment, cached, err := t.tracker.Track(c.Request.Context(), order.DeliveryService, order.TrackNumber)
+	var limited *tracking.RateLimitedError
+	switch {
+	case err == nil:
+	case errors.Is(err, tracking.ErrNoProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.As(err, &limited):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	default:
+		logger.Error("error of tracking shipment", "order_uid", order.OrderUID, logging.Err(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	source := "provider"
+	if cached {
+		source = "cache"
+	}
+	c.Header(HeaderTrackingSource, source)
+	c.JSON(http.StatusOK, shipment)
+}
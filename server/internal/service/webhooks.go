@@ -0,0 +1,180 @@
+package service
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// WebhookManager manages the webhook subscriptions and their deliveries
+type WebhookManager interface {
+	CreateWebhook(ctx context.Context, sub models.WebhookSubscription) (*models.WebhookSubscription, error)
+	ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	ListWebhookDeliveries(ctx context.Context, f models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, id int64) error
+}
+
+// WebhookService contains the webhook handlers mounted under /admin/webhooks
+type WebhookService struct {
+	webhooks WebhookManager
+}
+
+func NewWebhookService(m WebhookManager) *WebhookService {
+	return &WebhookService{webhooks: m}
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types"`
+}
+
+func (r createWebhookRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, t := range r.EventTypes {
+		if !slices.Contains(models.WebhookEventTypes, t) {
+			return errors.New("unknown event type " + strconv.Quote(t))
+		}
+	}
+	return nil
+}
+
+// CreateWebhook handler
+// @Summary Create webhook subscription
+// @Description События заказов (order_saved, order_updated; пустой event_types - все) отправляются POST-запросом на url с подписью X-Webhook-Signature (HMAC-SHA256 секретом подписки). Секрет возвращается только в этом ответе
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body createWebhookRequest true "URL and event types"
+// @Success 201 {object} models.WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Router /admin/webhooks [post]
+func (w *WebhookService) CreateWebhook(c *gin.Context) {
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, err := w.webhooks.CreateWebhook(c.Request.Context(), models.WebhookSubscription{URL: req.URL, EventTypes: req.EventTypes})
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+// ListWebhooks handler
+// @Summary List webhook subscriptions
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription
+// @Router /admin/webhooks [get]
+func (w *WebhookService) ListWebhooks(c *gin.Context) {
+	subs, err := w.webhooks.ListWebhooks(c.Request.Context())
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// DeleteWebhook handler
+// @Summary Delete webhook subscription
+// @Description Удаляет подписку вместе с её доставками
+// @Tags admin
+// @Param id path int true "Subscription ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id} [delete]
+func (w *WebhookService) DeleteWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := w.webhooks.DeleteWebhook(c.Request.Context(), id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries handler
+// @Summary Deliveries of webhook subscription
+// @Description Доставки событий подписке от новых к старым: статус (pending, delivered, dead), число попыток, код и текст последней ошибки, время следующей попытки
+// @Tags admin
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Param status query string false "pending, delivered or dead"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Router /admin/webhooks/{id}/deliveries [get]
+func (w *WebhookService) ListDeliveries(c *gin.Context) {
+	f := models.WebhookDeliveryFilter{Status: c.Query("status")}
+	var err error
+	if f.SubscriptionID, err = strconv.ParseInt(c.Param("id"), 10, 64); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	switch f.Status {
+	case "", models.WebhookPending, models.WebhookDelivered, models.WebhookDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or dead"})
+		return
+	}
+	if f.Limit, f.Offset, err = pageParams(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deliveries, err := w.webhooks.ListWebhookDeliveries(c.Request.Context(), f)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryDelivery handler
+// @Summary Retry dead webhook delivery
+// @Description Возвращает доставку, исчерпавшую попытки, в очередь с новым набором попыток
+// @Tags admin
+// @Param id path int true "Delivery ID"
+// @Success 202
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhook-deliveries/{id}/retry [post]
+func (w *WebhookService) RetryDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := w.webhooks.RetryWebhookDelivery(c.Request.Context(), id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func webhookError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Error("error of managing webhooks", logging.Err(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
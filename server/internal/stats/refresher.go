@@ -0,0 +1,61 @@
+package stats
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"time"
+)
+
+// Store recomputes the materialized analytics
+type Store interface {
+	RefreshCustomerStats(ctx context.Context) error
+}
+
+var logger = logging.Component("stats")
+
+// Refresher keeps the customer_stats view at most one refresh interval behind the orders
+type Refresher struct {
+	store    Store
+	interval time.Duration
+	errs     health.LastError
+}
+
+// NewRefresher returns nil if the analytics are not materialized
+func NewRefresher(store Store, cfg models.StatsCfg) *Refresher {
+	if !cfg.Materialized {
+		return nil
+	}
+	return &Refresher{store: store, interval: cfg.RefreshInterval}
+}
+
+// Run refreshes the view at once, so the orders saved while the service was down are counted,
+// and then every interval until ctx is cancelled
+func (r *Refresher) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := r.store.RefreshCustomerStats(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("customer stats refresh failed", logging.Err(err))
+		} else if err == nil {
+			logger.Debug("customer stats refreshed", logging.Duration("took", time.Since(start)))
+		}
+		r.errs.Set(err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Health is degraded while the last refresh failed
+func (r *Refresher) Health(context.Context) health.Result {
+	return r.errs.Result()
+}
@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type storeFunc func(ctx context.Context) error
+
+func (f storeFunc) RefreshCustomerStats(ctx context.Context) error { return f(ctx) }
+
+func TestRunRefreshesAtOnce(t *testing.T) {
+	refreshes := 0
+	r := NewRefresher(storeFunc(func(context.Context) error {
+		refreshes++
+		return errors.New("view is locked")
+	}), models.StatsCfg{Materialized: true, RefreshInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.Run(ctx)
+	require.Equal(t, 1, refreshes)
+	require.Error(t, r.Health(context.Background()).Err)
+}
+
+func TestNewRefresherDisabled(t *testing.T) {
+	r := NewRefresher(storeFunc(func(context.Context) error { return nil }), models.StatsCfg{})
+	require.Nil(t, r)
+	// a disabled refresher returns at once
+	r.Run(context.Background())
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// auditColumns is the number of the inserted columns of api_audit
+const auditColumns = 8
+
+// SaveAuditRecords writes a batch of API access records into api_audit with one statement
+func (s *Storage) SaveAuditRecords(ctx context.Context, records []models.AuditRecord) error {
+	const op = "storage.SaveAuditRecords"
+	if len(records) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(`INSERT INTO api_audit (subject, method, endpoint, order_uid, status, client_ip, request_id, created_at) VALUES `)
+	args := make([]any, 0, len(records)*auditColumns)
+	for i, r := range records {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&b, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+		args = append(args, r.Subject, r.Method, r.Endpoint, r.OrderUID, r.Status, r.ClientIP, r.RequestID, r.CreatedAt)
+	}
+	if _, err := s.db.ExecContext(ctx, b.String(), args...); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// ListAuditRecords returns the access records matching the filter, newest first
+func (s *Storage) ListAuditRecords(ctx context.Context, f models.AuditFilter) ([]models.AuditRecord, error) {
+	const op = "storage.ListAuditRecords"
+	var where []string
+	var args []any
+	cond := func(expr string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(expr, len(args)))
+	}
+	if f.Subject != "" {
+		cond("subject = $%d", f.Subject)
+	}
+	if f.OrderUID != "" {
+		cond("order_uid = $%d", f.OrderUID)
+	}
+	if !f.From.IsZero() {
+		cond("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		cond("created_at < $%d", f.To)
+	}
+	query := `SELECT id, subject, method, endpoint, order_uid, status, client_ip, request_id, created_at FROM api_audit`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	records := make([]models.AuditRecord, 0)
+	for rows.Next() {
+		var r models.AuditRecord
+		err := rows.Scan(&r.ID, &r.Subject, &r.Method, &r.Endpoint, &r.OrderUID, &r.Status, &r.ClientIP, &r.RequestID, &r.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		records = append(records, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return records, nil
+}
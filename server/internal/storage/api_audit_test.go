@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRecords(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	now := time.Now()
+
+	records := []models.AuditRecord{
+		{Subject: "anonymous", Method: "GET", Endpoint: "/order/:order_uid", OrderUID: "uid1", Status: 200, ClientIP: "10.0.0.1", RequestID: "r1", CreatedAt: now},
+		{Subject: "wb_1234abcd", Method: "DELETE", Endpoint: "/admin/orders/:order_uid", OrderUID: "uid1", Status: 204, ClientIP: "10.0.0.2", RequestID: "r2", CreatedAt: now},
+	}
+	mock.ExpectExec(`INSERT INTO api_audit .* VALUES \(\$1, .*\$8\), \(\$9, .*\$16\)`).
+		WithArgs("anonymous", "GET", "/order/:order_uid", "uid1", 200, "10.0.0.1", "r1", now,
+			"wb_1234abcd", "DELETE", "/admin/orders/:order_uid", "uid1", 204, "10.0.0.2", "r2", now).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	require.NoError(t, storage.SaveAuditRecords(context.Background(), records))
+
+	rows := sqlmock.NewRows([]string{"id", "subject", "method", "endpoint", "order_uid", "status", "client_ip", "request_id", "created_at"}).
+		AddRow(2, "wb_1234abcd", "DELETE", "/admin/orders/:order_uid", "uid1", 204, "10.0.0.2", "r2", now)
+	mock.ExpectQuery(`FROM api_audit WHERE subject = \$1 AND created_at >= \$2 ORDER BY created_at DESC, id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("wb_1234abcd", now, 50, 0).
+		WillReturnRows(rows)
+	got, err := storage.ListAuditRecords(context.Background(), models.AuditFilter{Subject: "wb_1234abcd", From: now, Limit: 50})
+	require.NoError(t, err)
+	require.Equal(t, []models.AuditRecord{{ID: 2, Subject: "wb_1234abcd", Method: "DELETE", Endpoint: "/admin/orders/:order_uid",
+		OrderUID: "uid1", Status: 204, ClientIP: "10.0.0.2", RequestID: "r2", CreatedAt: now}}, got)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrAPIKeyNotFound is returned when there is no active API key with the requested id or hash
+var ErrAPIKeyNotFound = fmt.Errorf("api key %w", models.ErrNotFound)
+
+// CreateAPIKey stores a new key by the hash of its secret
+func (s *Storage) CreateAPIKey(ctx context.Context, name, prefix, secretHash string) (*models.APIKey, error) {
+	const op = "storage.CreateAPIKey"
+	key := &models.APIKey{Name: name, Prefix: prefix}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (name, prefix, secret_hash) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		name, prefix, secretHash,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns all keys including revoked ones, newest first
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	const op = "storage.ListAPIKeys"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, prefix, created_at, revoked_at, rotated_to FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var key models.APIKey
+		var revokedAt sql.NullTime
+		var rotatedTo sql.NullInt64
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &revokedAt, &rotatedTo); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		if rotatedTo.Valid {
+			key.RotatedTo = &rotatedTo.Int64
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks an active key as revoked
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64) error {
+	const op = "storage.RevokeAPIKey"
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RotateAPIKey atomically revokes an active key and creates its replacement with the same name
+func (s *Storage) RotateAPIKey(ctx context.Context, id int64, prefix, secretHash string) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := s.retryTx(ctx, "storage.RotateAPIKey", func(ctx context.Context) (err error) {
+		key, err = s.rotateAPIKey(ctx, id, prefix, secretHash)
+		return err
+	})
+	return key, err
+}
+
+func (s *Storage) rotateAPIKey(ctx context.Context, id int64, prefix, secretHash string) (*models.APIKey, error) {
+	const op = "storage.RotateAPIKey"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	key := &models.APIKey{Prefix: prefix}
+	err = tx.QueryRowContext(ctx,
+		`SELECT name FROM api_keys WHERE id = $1 AND revoked_at IS NULL FOR UPDATE`, id,
+	).Scan(&key.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO api_keys (name, prefix, secret_hash) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		key.Name, prefix, secretHash,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = tx.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = now(), rotated_to = $2 WHERE id = $1`, id, key.ID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+// APIKeyActive reports whether an active (not revoked) key with the secret hash exists
+func (s *Storage) APIKeyActive(ctx context.Context, secretHash string) (bool, error) {
+	const op = "storage.APIKeyActive"
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM api_keys WHERE secret_hash = $1 AND revoked_at IS NULL)`, secretHash,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// maxBloomBits is the largest Redis bitmap, SETBIT offsets are below 2^32
+const maxBloomBits = 1 << 32
+
+// bloomFilter is a Bloom filter of the stored order UIDs kept in a Redis bitmap, so all service
+// instances share it. Reads of UIDs it rules out are answered without a Postgres query.
+//
+// The filter is trusted only while its ready key exists: it is set once the bitmap holds every
+// stored UID and dropped when adding a saved order fails, then reads go to Postgres
+// until the next startup rebuilds the filter. The keys carry the sizing, so resizing starts a new filter.
+type bloomFilter struct {
+	bits   uint64
+	hashes int
+	key    string
+	ready  string
+	cancel context.CancelFunc // stops the build, nil - none running
+}
+
+// newBloomFilter sizes the filter for capacity UIDs at the false positive rate fpRate;
+// it returns nil if capacity is 0 (filter off)
+func newBloomFilter(capacity int, fpRate float64) (*bloomFilter, error) {
+	if capacity <= 0 {
+		return nil, nil
+	}
+	// optimal m = -n*ln(p)/ln(2)^2 bits and k = m/n*ln(2) hashes
+	bits := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if bits > maxBloomBits {
+		return nil, fmt.Errorf("bloom filter of %d UIDs at %v false positives exceeds %d bits", capacity, fpRate, uint64(maxBloomBits))
+	}
+	hashes := max(1, int(math.Round(bits/float64(capacity)*math.Ln2)))
+	key := fmt.Sprintf("orders:bloom:%d:%d", uint64(bits), hashes)
+	return &bloomFilter{bits: uint64(bits), hashes: hashes, key: key, ready: key + ":ready"}, nil
+}
+
+// offsets are the bits of the UIDs, derived from two halves of the FNV-128a hash of each (double hashing)
+func (f *bloomFilter) offsets(orderUIDs ...string) []interface{} {
+	offsets := make([]interface{}, 0, len(orderUIDs)*f.hashes)
+	for _, uid := range orderUIDs {
+		h := fnv.New128a()
+		h.Write([]byte(uid))
+		sum := h.Sum(nil)
+		h1, h2 := binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:])
+		for i := 0; i < f.hashes; i++ {
+			offsets = append(offsets, (h1+uint64(i)*h2)%f.bits)
+		}
+	}
+	return offsets
+}
+
+var (
+	// bloomAddScript sets the bits ARGV of KEYS[1]
+	bloomAddScript = redis.NewScript(`
+for i = 1, #ARGV do
+	redis.call('SETBIT', KEYS[1], ARGV[i], 1)
+end
+return 0
+`)
+	// bloomCheckScript returns 0 if the filter KEYS[1] is ready (KEYS[2]) and any of the bits ARGV is unset
+	bloomCheckScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 1
+end
+for i = 1, #ARGV do
+	if redis.call('GETBIT', KEYS[1], ARGV[i]) == 0 then
+		return 0
+	end
+end
+return 1
+`)
+)
+
+// mayExist reports whether the order may be stored. It is false only if the filter is ready
+// and rules the UID out; errors of Redis don't reject reads.
+func (s *Storage) mayExist(ctx context.Context, orderUID string) bool {
+	if s.bloom == nil {
+		return true
+	}
+	found, err := bloomCheckScript.Run(ctx, s.redis, []string{s.bloom.key, s.bloom.ready}, s.bloom.offsets(orderUID)...).Int()
+	if err != nil || found == 1 {
+		return true
+	}
+	metrics.BloomRejections.Inc()
+	return false
+}
+
+// addToBloom adds saved orders to the filter. If that fails, the filter is marked not ready,
+// it would reject the orders otherwise.
+func (s *Storage) addToBloom(ctx context.Context, orderUIDs ...string) {
+	if s.bloom == nil || len(orderUIDs) == 0 {
+		return
+	}
+	err := bloomAddScript.Run(ctx, s.redis, []string{s.bloom.key}, s.bloom.offsets(orderUIDs...)...).Err()
+	if err == nil {
+		return
+	}
+	logger.Error("failed to add orders to the bloom filter, disabling it until restart", "orders", len(orderUIDs), logging.Err(err))
+	if err := s.redis.Del(ctx, s.bloom.ready).Err(); err != nil {
+		logger.Error("failed to disable the bloom filter", logging.Err(err))
+	}
+}
+
+// buildBloom adds every stored UID, soft-deleted ones included, to the filter paging through order_keys
+// and marks it ready. A ready filter is left as is, orders are added to it when saved.
+func (s *Storage) buildBloom(ctx context.Context) error {
+	const op = "storage.buildBloom"
+	n, err := s.redis.Exists(ctx, s.bloom.ready).Result()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	start := time.Now()
+	added := 0
+	after := ""
+	for {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT order_uid FROM order_keys WHERE order_uid > $1 ORDER BY order_uid LIMIT $2`, after, preloadPage)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+		uids, err := scanOrderUIDs(op, rows)
+		if err != nil {
+			return err
+		}
+		if len(uids) > 0 {
+			if err := bloomAddScript.Run(ctx, s.redis, []string{s.bloom.key}, s.bloom.offsets(uids...)...).Err(); err != nil {
+				return fmt.Errorf("%s: %v", op, err)
+			}
+			added += len(uids)
+		}
+		if len(uids) < preloadPage {
+			break
+		}
+		after = uids[len(uids)-1]
+	}
+	if err := s.redis.Set(ctx, s.bloom.ready, 1, 0).Err(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	logger.Info("bloom filter built", "orders", added, logging.Duration("elapsed", time.Since(start)))
+	return nil
+}
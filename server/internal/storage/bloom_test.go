@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/metrics"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBloomFilter(t *testing.T) {
+	f, err := newBloomFilter(1_000_000, 0.01)
+	require.NoError(t, err)
+	require.Equal(t, uint64(9585059), f.bits)
+	require.Equal(t, 7, f.hashes)
+	require.Equal(t, "orders:bloom:9585059:7", f.key)
+	require.Len(t, f.offsets("a", "b"), 14)
+	require.Equal(t, f.offsets("a"), f.offsets("a"))
+
+	off, err := newBloomFilter(0, 0.01)
+	require.NoError(t, err)
+	require.Nil(t, off)
+
+	_, err = newBloomFilter(1_000_000_000, 0.0001)
+	require.Error(t, err)
+}
+
+func TestGetOrderBloomRejects(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	bloom, err := newBloomFilter(1000, 0.01)
+	require.NoError(t, err)
+	// no DB: a rejected UID must not be read
+	storage := &Storage{redis: rdb, bloom: bloom}
+
+	rejections := testutil.ToFloat64(metrics.BloomRejections)
+	mock.ExpectEvalSha(bloomCheckScript.Hash(), []string{bloom.key, bloom.ready}, bloom.offsets("garbage")...).SetVal(int64(0))
+	_, _, err = storage.GetOrder(context.Background(), "garbage")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+	require.Equal(t, rejections+1, testutil.ToFloat64(metrics.BloomRejections))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// a filter that isn't ready or unreachable doesn't reject
+	mock.ExpectEvalSha(bloomCheckScript.Hash(), []string{bloom.key, bloom.ready}, bloom.offsets("uid1")...).SetVal(int64(1))
+	require.True(t, storage.mayExist(context.Background(), "uid1"))
+	mock.ExpectEvalSha(bloomCheckScript.Hash(), []string{bloom.key, bloom.ready}, bloom.offsets("uid1")...).SetErr(errors.New("connection refused"))
+	require.True(t, storage.mayExist(context.Background(), "uid1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddToBloom(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	bloom, err := newBloomFilter(1000, 0.01)
+	require.NoError(t, err)
+	storage := &Storage{redis: rdb, bloom: bloom}
+
+	mock.ExpectEvalSha(bloomAddScript.Hash(), []string{bloom.key}, bloom.offsets("uid1", "uid2")...).SetVal(int64(0))
+	storage.addToBloom(context.Background(), "uid1", "uid2")
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// a saved order missing from the filter would be rejected, so the filter stops being trusted
+	mock.ExpectEvalSha(bloomAddScript.Hash(), []string{bloom.key}, bloom.offsets("uid3")...).SetErr(errors.New("connection refused"))
+	mock.ExpectDel(bloom.ready).SetVal(1)
+	storage.addToBloom(context.Background(), "uid3")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
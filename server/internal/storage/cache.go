@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// getFromCache reads the order from the two cache tiers: the in-process hot layer, then Redis.
+// Orders read from Redis are kept in the hot layer for redis.local_cache_ttl.
+func (s *Storage) getFromCache(ctx context.Context, orderUID string) (*models.Order, models.OrderSource, error) {
+	// the hot layer also serves the orders cached while Redis is unreachable
+	if order, ok := s.local.get(orderUID); ok {
+		metrics.CacheHits.WithLabelValues("local").Inc()
+		return order, models.OrderFromLocal, nil
+	}
+	val, err := s.redis.Get(ctx, orderUID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			metrics.CacheMisses.WithLabelValues("absent").Inc()
+			return nil, "", fmt.Errorf("not found in cache")
+		}
+		metrics.CacheMisses.WithLabelValues("error").Inc()
+		return nil, "", fmt.Errorf("redis get error: %v", err)
+	}
+
+	var order models.Order
+	if err := decodeCached(val, &order); err != nil {
+		reason := "error"
+		if errors.Is(err, errStaleCache) {
+			reason = "stale"
+		}
+		metrics.CacheMisses.WithLabelValues(reason).Inc()
+		return nil, "", fmt.Errorf("cache decode error: %w", err)
+	}
+	metrics.CacheHits.WithLabelValues("redis").Inc()
+	s.local.put(&order)
+	// a read makes the order recently used; only existing members are updated,
+	// so an order evicted meanwhile isn't tracked again. Hot-layer hits don't reach Redis,
+	// a hot order is touched again once its local copy expires.
+	if err := s.redis.ZAddXX(ctx, lruKey, &redis.Z{Score: s.accessScore(), Member: orderUID}).Err(); err != nil {
+		logger.Warn("failed to touch cached order", "order_uid", orderUID, logging.Err(err))
+	}
+
+	return &order, models.OrderFromRedis, nil
+}
+
+// cache is the current snapshot of the cache config
+func (s *Storage) cache() *models.Redis {
+	if c := s.reloaded.Load(); c != nil {
+		return c
+	}
+	return &s.cacheCfg
+}
+
+// ReloadCacheConfig validates the cache config and swaps it in for the next operations.
+// Only the settings tagged reload:"true" take effect, the others were used at startup.
+func (s *Storage) ReloadCacheConfig(c models.Redis) error {
+	const op = "storage.ReloadCacheConfig"
+	for _, validate := range []func() error{c.ValidateReadStrategy, c.ValidateCacheCodec, c.ValidateCacheCompression, c.ValidateCacheTTLJitter} {
+		if err := validate(); err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+	s.reloaded.Store(&c)
+	return nil
+}
+
+// cacheLimit is how many recently used orders Redis keeps
+func (s *Storage) cacheLimit() int {
+	if s.cache().CacheLimit <= 0 {
+		return defaultCacheLimit
+	}
+	return s.cache().CacheLimit
+}
+
+// lruKey is the ZSET of cached order UIDs scored by their last access time (unix ms)
+const lruKey = "orders:lru"
+
+// accessScore is the LRU score of an access now
+func (s *Storage) accessScore() float64 {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	return float64(now().UnixMilli())
+}
+
+// cacheTTL is the expiration of a cached order before the jitter
+func (s *Storage) cacheTTL() time.Duration {
+	if s.cache().CacheTTL <= 0 {
+		return defaultCacheTTL
+	}
+	return s.cache().CacheTTL
+}
+
+// entryTTL is the expiration of one cached order: cacheTTL with a random jitter of ±redis.cache_ttl_jitter percent
+func (s *Storage) entryTTL() time.Duration {
+	spread := s.cacheTTL() * time.Duration(s.cache().CacheTTLJitter) / 100
+	if spread <= 0 {
+		return s.cacheTTL()
+	}
+	return s.cacheTTL() - spread + rand.N(2*spread+1)
+}
+
+// maxEntryTTL is the longest expiration entryTTL gives
+func (s *Storage) maxEntryTTL() time.Duration {
+	return s.cacheTTL() + s.cacheTTL()*time.Duration(max(s.cache().CacheTTLJitter, 0))/100
+}
+
+// invalidateOrder is the cache hook of every order mutation (replace, soft delete, restore):
+// the copies in Redis and in the process are dropped together with the LRU tracking
+// and the cached history of the customer, so the next reads repopulate them from PostgreSQL
+func (s *Storage) invalidateOrder(ctx context.Context, orderUID string) error {
+	s.local.remove(orderUID)
+	_, err := s.redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, orderUID)
+		p.ZRem(ctx, lruKey, orderUID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to invalidate cached order %s: %v", orderUID, err)
+	}
+	return s.forgetCustomerOrders(ctx, orderUID)
+}
+
+// cacheOrder writes the order through the hot layer to Redis; while Redis fails
+// the hot layer keeps serving it
+func (s *Storage) cacheOrder(ctx context.Context, order *models.Order) error {
+	s.local.put(order)
+	if err := s.saveToRedis(ctx, order); err != nil {
+		metrics.CacheSets.WithLabelValues("error").Inc()
+		return err
+	}
+	metrics.CacheSets.WithLabelValues("ok").Inc()
+	return nil
+}
+
+// trimLua is the cache maintenance (KEYS[1] - lruKey, ARGV[1] - expiry score, ARGV[2] - cache limit):
+// - Drops the UIDs whose orders have expired
+// - Evicts the least recently used orders above the limit (the lowest scores), DEL is chunked
+// to stay within the Lua stack
+//
+// It returns the number of evicted orders.
+const trimLua = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+local over = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[2])
+if over <= 0 then
+	return 0
+end
+local olds = redis.call('ZRANGE', KEYS[1], 0, over - 1)
+for i = 1, #olds, 1000 do
+	redis.call('DEL', unpack(olds, i, math.min(i + 999, #olds)))
+end
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, over - 1)
+return over
+`
+
+// saveLua caches the order (KEYS[2], ARGV[3] - data, ARGV[4] - TTL in ms, ARGV[5] - access score)
+// and then trims the cache
+const saveLua = `
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[4])
+redis.call('ZADD', KEYS[1], ARGV[5], KEYS[2])
+` + trimLua
+
+// Scripts run atomically, so concurrent writers can't evict an order another one has just cached
+var (
+	trimScript = redis.NewScript(trimLua)
+	saveScript = redis.NewScript(saveLua)
+)
+
+// expiryScore is the access score before which cached orders have expired whatever their jitter
+func (s *Storage) expiryScore(now float64) string {
+	return strconv.FormatFloat(now-float64(s.maxEntryTTL().Milliseconds()), 'f', 0, 64)
+}
+
+// saveToRedis stores an order in Redis with two-phase caching:
+// 1. Primary storage: Order encoded with redis.cache_codec stored as key-value with redis.cache_ttl (72 hours by default)
+// spread by redis.cache_ttl_jitter
+// 2. LRU tracking: Order UID scored by the access time in the lruKey ZSET, reads refresh the score
+//
+// and trims the cache in the same script
+func (s *Storage) saveToRedis(ctx context.Context, order *models.Order) error {
+	data, err := s.encodeCached(order)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	score := s.accessScore()
+	evicted, err := saveScript.Run(ctx, s.redis, []string{lruKey, order.OrderUID},
+		s.expiryScore(score), s.cacheLimit(), data, s.entryTTL().Milliseconds(), score).Int64()
+	if err != nil {
+		return fmt.Errorf("redis save script error: %v", err)
+	}
+	metrics.CacheEvictions.Add(float64(evicted))
+	return nil
+}
+
+// cacheOrders caches a batch of orders in one pipeline: a SET per order and a single ZADD
+// of their LRU members. The caller trims the cache afterwards. If the pipeline fails
+// the orders are kept in the in-process cache.
+func (s *Storage) cacheOrders(ctx context.Context, orders []*models.Order) error {
+	score := s.accessScore()
+	members := make([]*redis.Z, 0, len(orders))
+	_, err := s.redis.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, order := range orders {
+			data, err := s.encodeCached(order)
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			p.Set(ctx, order.OrderUID, data, s.entryTTL())
+			members = append(members, &redis.Z{Score: score, Member: order.OrderUID})
+		}
+		p.ZAdd(ctx, lruKey, members...)
+		return nil
+	})
+	if err != nil {
+		metrics.CacheSets.WithLabelValues("error").Add(float64(len(orders)))
+		for _, order := range orders {
+			s.local.put(order)
+		}
+		return fmt.Errorf("redis pipeline error: %v", err)
+	}
+	metrics.CacheSets.WithLabelValues("ok").Add(float64(len(orders)))
+	return nil
+}
+
+// trimCache runs the cache maintenance (see trimLua) at the access score now
+func (s *Storage) trimCache(ctx context.Context, now float64) error {
+	evicted, err := trimScript.Run(ctx, s.redis, []string{lruKey}, s.expiryScore(now), s.cacheLimit()).Int64()
+	if err != nil {
+		return fmt.Errorf("redis trim script error: %v", err)
+	}
+	metrics.CacheEvictions.Add(float64(evicted))
+	return nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+)
+
+// Header bytes of compressed cache entries. They differ from the first byte of both
+// encodings ('{' of JSON, a map of MessagePack), so plain entries need no header.
+const (
+	headerGzip   byte = 0x01
+	headerSnappy byte = 0x02
+	// headerMinorUnits starts every entry written since the amounts are cached in minor units,
+	// the entries without it hold major units and are read from the database again
+	headerMinorUnits byte = 0x03
+)
+
+// errStaleCache is returned for the entries cached before the amounts moved to minor units
+var errStaleCache = errors.New("stale entry cached in major units")
+
+// encodeCached encodes the order with redis.cache_codec. MessagePack uses the json tags,
+// so both encodings carry the same field names. Entries from redis.cache_compress_threshold
+// bytes are compressed with redis.cache_compression.
+func (s *Storage) encodeCached(order *models.Order) ([]byte, error) {
+	data, err := s.marshalCached(order)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < s.cache().CacheCompressThreshold {
+		return append([]byte{headerMinorUnits}, data...), nil
+	}
+	switch s.cache().CacheCompression {
+	case models.CompressionGzip:
+		var buf bytes.Buffer
+		buf.Write([]byte{headerMinorUnits, headerGzip})
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case models.CompressionSnappy:
+		return append([]byte{headerMinorUnits, headerSnappy}, snappy.Encode(nil, data)...), nil
+	}
+	return append([]byte{headerMinorUnits}, data...), nil
+}
+
+func (s *Storage) marshalCached(order *models.Order) ([]byte, error) {
+	if s.cache().CacheCodec != models.CodecMsgpack {
+		return json.Marshal(order)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+	if err := enc.Encode(order); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCached decodes a cached order of either encoding, compressed or not: a JSON object starts with '{',
+// a MessagePack map never does, so entries written before a codec or compression switch stay readable
+func decodeCached(data []byte, order *models.Order) error {
+	if len(data) == 0 || data[0] != headerMinorUnits {
+		return errStaleCache
+	}
+	if err := decodeEntry(data[1:], order); err != nil {
+		return err
+	}
+	// MessagePack doesn't go through the JSON decoding that sets the currency of the amounts
+	order.SetCurrency()
+	return nil
+}
+
+func decodeEntry(data []byte, order *models.Order) error {
+	if len(data) > 0 {
+		switch data[0] {
+		case headerGzip:
+			zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+			if err != nil {
+				return fmt.Errorf("gzip: %v", err)
+			}
+			plain, err := io.ReadAll(zr)
+			if err != nil {
+				return fmt.Errorf("gzip: %v", err)
+			}
+			return decodeEntry(plain, order)
+		case headerSnappy:
+			plain, err := snappy.Decode(nil, data[1:])
+			if err != nil {
+				return fmt.Errorf("snappy: %v", err)
+			}
+			return decodeEntry(plain, order)
+		case '{':
+			return json.Unmarshal(data, order)
+		}
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(order)
+}
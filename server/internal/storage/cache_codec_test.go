@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheCodecs(t *testing.T) {
+	order := &models.Order{
+		OrderUID:    "test123",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery:    models.Delivery{Name: "Test User", City: "Moscow"},
+		Payment:     models.Payment{Amount: models.NewMoney(1817, "USD"), Currency: "USD"},
+		Items:       []models.Item{{ChrtID: 9934930, Name: "Mascaras", Price: models.NewMoney(453, "USD")}},
+	}
+	order.SetCurrency()
+
+	jsonData, err := (&Storage{}).encodeCached(order)
+	require.NoError(t, err)
+	packed, err := (&Storage{cacheCfg: models.Redis{CacheCodec: models.CodecMsgpack}}).encodeCached(order)
+	require.NoError(t, err)
+	require.Less(t, len(packed), len(jsonData))
+
+	// either encoding decodes, whatever the configured codec
+	for _, data := range [][]byte{jsonData, packed} {
+		var decoded models.Order
+		require.NoError(t, decodeCached(data, &decoded))
+		require.Equal(t, order.OrderUID, decoded.OrderUID)
+		require.True(t, order.DateCreated.Equal(decoded.DateCreated))
+		require.Equal(t, order.Delivery, decoded.Delivery)
+		require.Equal(t, order.Payment, decoded.Payment)
+		require.Equal(t, order.Items, decoded.Items)
+	}
+}
+
+func TestCacheCompression(t *testing.T) {
+	order := &models.Order{OrderUID: "test123", Delivery: models.Delivery{Name: "Test User"}, Payment: models.Payment{Currency: "USD"}}
+	for i := 0; i < 50; i++ {
+		order.Items = append(order.Items, models.Item{ChrtID: i, Name: "Mascaras", Brand: "Vivienne Sabo", Price: models.NewMoney(453, "USD")})
+	}
+	order.SetCurrency()
+	plain, err := (&Storage{}).encodeCached(order)
+	require.NoError(t, err)
+
+	for _, cfg := range []models.Redis{
+		{CacheCompression: models.CompressionGzip, CacheCompressThreshold: 1024},
+		{CacheCompression: models.CompressionSnappy, CacheCompressThreshold: 1024},
+		{CacheCompression: models.CompressionSnappy, CacheCodec: models.CodecMsgpack},
+	} {
+		data, err := (&Storage{cacheCfg: cfg}).encodeCached(order)
+		require.NoError(t, err)
+		require.Less(t, len(data), len(plain)/2, cfg.CacheCompression)
+
+		var decoded models.Order
+		require.NoError(t, decodeCached(data, &decoded))
+		require.Equal(t, order.Items, decoded.Items)
+	}
+
+	// entries below the threshold are stored as is
+	small := &models.Order{OrderUID: "test123"}
+	data, err := (&Storage{cacheCfg: models.Redis{CacheCompression: models.CompressionGzip, CacheCompressThreshold: 1024}}).encodeCached(small)
+	require.NoError(t, err)
+	require.Equal(t, []byte{headerMinorUnits, '{'}, data[:2])
+}
+
+func TestCacheStaleEntry(t *testing.T) {
+	// an entry cached before the amounts moved to minor units is read from the database again
+	var decoded models.Order
+	require.ErrorIs(t, decodeCached([]byte(`{"order_uid":"test123","payment":{"amount":18}}`), &decoded), errStaleCache)
+	require.ErrorIs(t, decodeCached(nil, &decoded), errStaleCache)
+}
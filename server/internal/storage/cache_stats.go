@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsBuckets is the number of one-minute buckets kept for windowed cache stats
+const statsBuckets = 60
+
+var (
+	statsWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+	uuidRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+type statsBucket struct {
+	minute   int64
+	patterns map[string]*models.CachePatternStats
+}
+
+// cacheStats counts Postgres fallbacks and Redis repopulations per key pattern
+// in one-minute buckets, so effectiveness of preload and TTL can be seen over time windows.
+type cacheStats struct {
+	mu      sync.Mutex
+	since   time.Time
+	total   map[string]*models.CachePatternStats
+	buckets [statsBuckets]statsBucket
+	now     func() time.Time
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{
+		since: time.Now(),
+		total: make(map[string]*models.CachePatternStats),
+		now:   time.Now,
+	}
+}
+
+// keyPattern groups cache keys to keep metric labels low-cardinality:
+// namespaced keys ("customer:42") by their prefix, order UIDs by their shape.
+func keyPattern(key string) string {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		return key[:i] + ":*"
+	}
+	if uuidRegex.MatchString(key) {
+		return "order_uid:uuid"
+	}
+	return "order_uid:other"
+}
+
+func (c *cacheStats) dbFallback(key string) {
+	pattern := keyPattern(key)
+	metrics.CacheDBFallbacks.WithLabelValues(pattern).Inc()
+	c.add(pattern, func(s *models.CachePatternStats) { s.DBFallbacks++ })
+}
+
+func (c *cacheStats) repopulated(key string, err error) {
+	pattern := keyPattern(key)
+	if err != nil {
+		metrics.CacheRepopulations.WithLabelValues(pattern, "error").Inc()
+		c.add(pattern, func(s *models.CachePatternStats) { s.RepopulateErrors++ })
+		return
+	}
+	metrics.CacheRepopulations.WithLabelValues(pattern, "ok").Inc()
+	c.add(pattern, func(s *models.CachePatternStats) { s.Repopulated++ })
+}
+
+func (c *cacheStats) add(pattern string, inc func(*models.CachePatternStats)) {
+	if c == nil {
+		return
+	}
+	minute := c.now().Unix() / 60
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.buckets[minute%statsBuckets]
+	if b.minute != minute || b.patterns == nil {
+		b.minute = minute
+		b.patterns = make(map[string]*models.CachePatternStats)
+	}
+	inc(patternStats(b.patterns, pattern))
+	inc(patternStats(c.total, pattern))
+}
+
+func patternStats(m map[string]*models.CachePatternStats, pattern string) *models.CachePatternStats {
+	s, ok := m[pattern]
+	if !ok {
+		s = &models.CachePatternStats{}
+		m[pattern] = s
+	}
+	return s
+}
+
+func (c *cacheStats) snapshot() models.CacheStats {
+	minute := c.now().Unix() / 60
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := models.CacheStats{Since: c.since}
+	for _, w := range statsWindows {
+		minutes := int64(w / time.Minute)
+		window := models.CacheStatsWindow{Window: w.String(), Patterns: make(map[string]models.CachePatternStats)}
+		for _, b := range c.buckets {
+			if b.patterns == nil || b.minute <= minute-minutes {
+				continue
+			}
+			for pattern, s := range b.patterns {
+				agg := window.Patterns[pattern]
+				agg.DBFallbacks += s.DBFallbacks
+				agg.Repopulated += s.Repopulated
+				agg.RepopulateErrors += s.RepopulateErrors
+				window.Patterns[pattern] = agg
+			}
+		}
+		res.Windows = append(res.Windows, window)
+	}
+	total := models.CacheStatsWindow{Window: "total", Patterns: make(map[string]models.CachePatternStats)}
+	for pattern, s := range c.total {
+		total.Patterns[pattern] = *s
+	}
+	res.Windows = append(res.Windows, total)
+	return res
+}
+
+// CacheStats returns Postgres fallback and cache repopulation counters per key pattern
+func (s *Storage) CacheStats() models.CacheStats {
+	if s.stats == nil {
+		return models.CacheStats{}
+	}
+	return s.stats.snapshot()
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStatsWindows(t *testing.T) {
+	now := time.Date(2025, 7, 4, 12, 0, 0, 0, time.UTC)
+	stats := newCacheStats()
+	stats.now = func() time.Time { return now }
+
+	const uid = "b563feb7-b2b8-4b6b-9c3b-2f1a5a0a6f11"
+	stats.dbFallback(uid)
+	stats.repopulated(uid, nil)
+
+	now = now.Add(10 * time.Minute)
+	stats.dbFallback(uid)
+	stats.repopulated(uid, errors.New("redis down"))
+	stats.dbFallback("customer:42")
+
+	snap := stats.snapshot()
+	byWindow := make(map[string]int)
+	for i, w := range snap.Windows {
+		byWindow[w.Window] = i
+	}
+
+	lastMinute := snap.Windows[byWindow["1m0s"]].Patterns["order_uid:uuid"]
+	require.EqualValues(t, 1, lastMinute.DBFallbacks)
+	require.EqualValues(t, 0, lastMinute.Repopulated)
+	require.EqualValues(t, 1, lastMinute.RepopulateErrors)
+
+	lastHour := snap.Windows[byWindow["1h0m0s"]].Patterns["order_uid:uuid"]
+	require.EqualValues(t, 2, lastHour.DBFallbacks)
+	require.EqualValues(t, 1, lastHour.Repopulated)
+
+	total := snap.Windows[byWindow["total"]]
+	require.EqualValues(t, 1, total.Patterns["customer:*"].DBFallbacks)
+}
+
+func TestKeyPattern(t *testing.T) {
+	require.Equal(t, "order_uid:uuid", keyPattern("b563feb7-b2b8-4b6b-9c3b-2f1a5a0a6f11"))
+	require.Equal(t, "order_uid:other", keyPattern("test123"))
+	require.Equal(t, "recent:*", keyPattern("recent:user1"))
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultConnectAttempts = 5
+	defaultConnectDelay    = time.Second
+)
+
+// waitFor pings the dependency until it answers.
+// This is necessary because when running in Docker, the server might try to connect
+// before the database or Redis is fully initialized. The delay between attempts grows
+// exponentially with jitter, so several replicas starting together don't ping in lockstep.
+func waitFor(ctx context.Context, name string, cfg models.ConnectCfg, ping func(context.Context) error) error {
+	attempts, delay, maxDelay := cfg.Attempts, cfg.InitialDelay, cfg.MaxDelay
+	if attempts <= 0 {
+		attempts = defaultConnectAttempts
+	}
+	if delay <= 0 {
+		delay = defaultConnectDelay
+	}
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = ping(ctx); err == nil {
+			return nil
+		}
+		if i == attempts-1 {
+			break
+		}
+		// equal jitter: half of the delay is kept, the other half is random
+		sleep := delay/2 + rand.N(delay/2+1)
+		logger.Warn("waiting for "+name, "attempt", i+1, "attempts", attempts, logging.Err(err), logging.Duration("next_in", sleep))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sleep):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+	return fmt.Errorf("%s is not reachable after %d attempts: %v", name, attempts, err)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitFor(t *testing.T) {
+	cfg := models.ConnectCfg{Attempts: 4, InitialDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+	down := errors.New("connection refused")
+
+	calls := 0
+	err := waitFor(context.Background(), "DB", cfg, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return down
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = waitFor(context.Background(), "Redis", cfg, func(context.Context) error {
+		calls++
+		return down
+	})
+	require.ErrorContains(t, err, "Redis is not reachable after 4 attempts")
+	require.Equal(t, 4, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = waitFor(ctx, "DB", models.ConnectCfg{Attempts: 3, InitialDelay: time.Hour}, func(context.Context) error {
+		return down
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
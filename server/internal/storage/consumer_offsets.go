@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrOffsetApplied is returned by SaveOrderAt for a message at or before the stored offset of its partition,
+// i.e. a redelivered message whose order is already committed
+var ErrOffsetApplied = errors.New("message offset already applied")
+
+// SaveConsumerOffset stores the offset of a message finished without saving an order
+// (a duplicate or a message moved to the DLQ). Stored offsets only move forward.
+func (s *Storage) SaveConsumerOffset(ctx context.Context, at models.MessageOffset) error {
+	const op = "storage.SaveConsumerOffset"
+	if err := storeOffset(ctx, s.db, at); err != nil && !errors.Is(err, ErrOffsetApplied) {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// ConsumerOffsets returns the last stored offset of every partition of the topic consumed by the group
+func (s *Storage) ConsumerOffsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	const op = "storage.ConsumerOffsets"
+	rows, err := s.db.QueryContext(ctx, `SELECT kafka_partition, kafka_offset FROM consumer_offsets
+	WHERE group_id = $1 AND topic = $2`, group, topic)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		offsets[partition] = offset
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return offsets, nil
+}
+
+// ResetConsumerOffsets moves the stored offsets back or forth so consumption continues at next
+// (the offset of the next message of every partition), e.g. after the group offsets were moved by a seek
+func (s *Storage) ResetConsumerOffsets(ctx context.Context, group, topic string, next map[int]int64) error {
+	const op = "storage.ResetConsumerOffsets"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+	for partition, offset := range next {
+		_, err = tx.ExecContext(ctx, `INSERT INTO consumer_offsets (group_id, topic, kafka_partition, kafka_offset, updated_at)
+	VALUES ($1, $2, $3, $4, now())
+	ON CONFLICT (group_id, topic, kafka_partition) DO UPDATE SET kafka_offset = EXCLUDED.kafka_offset, updated_at = now()`,
+			group, topic, partition, offset-1)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// storeOffset records at as the last processed offset of its partition,
+// ErrOffsetApplied if the stored offset is not behind it
+func storeOffset(ctx context.Context, q querier, at models.MessageOffset) error {
+	res, err := q.ExecContext(ctx, `INSERT INTO consumer_offsets (group_id, topic, kafka_partition, kafka_offset, updated_at)
+	VALUES ($1, $2, $3, $4, now())
+	ON CONFLICT (group_id, topic, kafka_partition) DO UPDATE SET kafka_offset = EXCLUDED.kafka_offset, updated_at = now()
+	WHERE consumer_offsets.kafka_offset < EXCLUDED.kafka_offset`, at.Group, at.Topic, at.Partition, at.Offset)
+	if err != nil {
+		return fmt.Errorf("failed to store consumer offset: %w", err)
+	}
+	stored, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store consumer offset: %w", err)
+	}
+	if stored == 0 {
+		return ErrOffsetApplied
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerOffsets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	at := models.MessageOffset{Group: "order-consumers", Topic: "orders", Partition: 1, Offset: 42}
+
+	t.Run("stored with the order", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO consumer_offsets").WithArgs("order-consumers", "orders", 1, int64(42)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// the message is appended to the event log with its position
+		mock.ExpectExec("INSERT INTO order_event_log").
+			WithArgs("test123", "order_received", sqlmock.AnyArg(), models.CurrentSchemaVersion, "orders", int64(1), int64(42)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO order_status_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, storage.SaveOrderAt(context.Background(), models.Order{OrderUID: "test123"}, models.RawPayload{}, at))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("redelivered message", func(t *testing.T) {
+		// the stored offset is not behind, nothing else is written
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO consumer_offsets").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := storage.SaveOrderAt(context.Background(), models.Order{OrderUID: "test123"}, models.RawPayload{}, at)
+		require.ErrorIs(t, err, ErrOffsetApplied)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("offset without an order", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO consumer_offsets").WillReturnResult(sqlmock.NewResult(0, 1))
+		require.NoError(t, storage.SaveConsumerOffset(context.Background(), at))
+		// an older offset is not an error
+		mock.ExpectExec("INSERT INTO consumer_offsets").WillReturnResult(sqlmock.NewResult(0, 0))
+		require.NoError(t, storage.SaveConsumerOffset(context.Background(), at))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("read", func(t *testing.T) {
+		mock.ExpectQuery("SELECT kafka_partition, kafka_offset FROM consumer_offsets").WithArgs("order-consumers", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"kafka_partition", "kafka_offset"}).AddRow(0, 7).AddRow(1, 42))
+
+		offsets, err := storage.ConsumerOffsets(context.Background(), "order-consumers", "orders")
+		require.NoError(t, err)
+		require.Equal(t, map[int]int64{0: 7, 1: 42}, offsets)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		// the stored offset is the one before the next message
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO consumer_offsets").WithArgs("order-consumers", "orders", 1, int64(9)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, storage.ResetConsumerOffsets(context.Background(), "order-consumers", "orders", map[int]int64{1: 10}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
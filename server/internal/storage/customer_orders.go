@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// The latest orders of a customer are kept in Redis by two keys expiring with the cache:
+// a ZSET of order UIDs scored by date_created and a HASH of their summaries.
+// A missing ZSET means the history isn't cached and is rebuilt from PostgreSQL on the next read.
+func customerOrdersKey(customerID string) string { return "customer:" + customerID + ":orders" }
+
+func customerSummariesKey(customerID string) string { return "customer:" + customerID + ":summaries" }
+
+var (
+	// customerAddScript adds a saved order (ARGV[1] - score, ARGV[2] - UID, ARGV[3] - summary) to a cached
+	// history only, a partial history must not look complete. It keeps the ARGV[4] latest orders
+	// and extends the expiration to ARGV[5] ms.
+	customerAddScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+local over = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[4])
+if over > 0 then
+	local olds = redis.call('ZRANGE', KEYS[1], 0, over - 1)
+	redis.call('HDEL', KEYS[2], unpack(olds))
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, over - 1)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+redis.call('PEXPIRE', KEYS[2], ARGV[5])
+return 1
+`)
+	// customerReadScript returns the number of cached orders followed by the summaries of the ARGV[1]
+	// latest orders after the order ARGV[2] (from the newest if empty), newest first.
+	// It returns nil if the history isn't cached and 0 if the order ARGV[2] isn't in it.
+	customerReadScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local start = 0
+if ARGV[2] ~= '' then
+	local rank = redis.call('ZREVRANK', KEYS[1], ARGV[2])
+	if not rank then
+		return 0
+	end
+	start = rank + 1
+end
+local card = redis.call('ZCARD', KEYS[1])
+local uids = redis.call('ZREVRANGE', KEYS[1], start, start + tonumber(ARGV[1]) - 1)
+if #uids == 0 then
+	return {card}
+end
+local summaries = redis.call('HMGET', KEYS[2], unpack(uids))
+table.insert(summaries, 1, card)
+return summaries
+`)
+)
+
+// CustomerOrders returns a page of orders of the customer, newest first. The latest orders are
+// served from Redis; if the history isn't cached it is read from PostgreSQL and cached for the next
+// reads. Pages past the cached history are read from PostgreSQL. Soft-deleted orders are skipped.
+func (s *Storage) CustomerOrders(ctx context.Context, customerID string, limit int, after *models.OrderCursor) (*models.OrderPage, error) {
+	const op = "storage.CustomerOrders"
+	keep := s.cache().CustomerOrdersLimit
+	if keep <= 0 {
+		orders, err := s.customerOrders(ctx, customerID, after, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		return orderPage(orders, limit), nil
+	}
+
+	afterUID := ""
+	if after != nil {
+		afterUID = after.OrderUID
+	}
+	keys := []string{customerOrdersKey(customerID), customerSummariesKey(customerID)}
+	res, err := customerReadScript.Run(ctx, s.redis, keys, limit+1, afterUID).Result()
+	switch values := res.(type) {
+	case []interface{}:
+		page, err := s.cachedCustomerPage(ctx, customerID, values, limit, keep, after)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		return page, nil
+	case int64:
+		// the cursor is past the cached history
+		orders, err := s.customerOrders(ctx, customerID, after, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		return orderPage(orders, limit), nil
+	}
+	if err != redis.Nil {
+		logger.Warn("failed to read cached orders of customer", "op", op, "customer_id", customerID, logging.Err(err))
+	}
+	if after != nil {
+		orders, err := s.customerOrders(ctx, customerID, after, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		return orderPage(orders, limit), nil
+	}
+
+	// the first page rebuilds the history, one extra order tells whether there is a next page
+	orders, err := s.customerOrders(ctx, customerID, nil, max(keep, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := s.cacheCustomerOrders(ctx, customerID, orders[:min(keep, len(orders))]); err != nil {
+		logger.Warn("failed to cache orders of customer", "op", op, "customer_id", customerID, logging.Err(err))
+	}
+	return orderPage(orders, limit), nil
+}
+
+// cachedCustomerPage makes a page of the cached summaries. The cached history holds at most keep
+// latest orders; if it is full and runs out before the page does, the page continues from PostgreSQL.
+func (s *Storage) cachedCustomerPage(ctx context.Context, customerID string, values []interface{}, limit, keep int, after *models.OrderCursor) (*models.OrderPage, error) {
+	cached, _ := values[0].(int64)
+	orders := make([]models.OrderSummary, 0, len(values)-1)
+	for _, v := range values[1:] {
+		// a summary trimmed meanwhile is skipped
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var o models.OrderSummary
+		if err := json.Unmarshal([]byte(data), &o); err != nil {
+			logger.Warn("bad cached order summary", "customer_id", customerID, logging.Err(err))
+			continue
+		}
+		orders = append(orders, o)
+	}
+	if len(orders) > limit || cached < int64(keep) {
+		return orderPage(orders, limit), nil
+	}
+	from := after
+	if len(orders) > 0 {
+		last := orders[len(orders)-1]
+		from = &models.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}
+	}
+	older, err := s.customerOrders(ctx, customerID, from, limit+1-len(orders))
+	if err != nil {
+		return nil, err
+	}
+	return orderPage(append(orders, older...), limit), nil
+}
+
+// customerOrders reads up to limit orders of the customer after the cursor from PostgreSQL,
+// using idx_orders_customer
+func (s *Storage) customerOrders(ctx context.Context, customerID string, after *models.OrderCursor, limit int) (_ []models.OrderSummary, err error) {
+	defer s.observeQuery(opCustomer, time.Now(), &err)
+	const columns = `SELECT o.order_uid, o.track_number, o.customer_id, o.delivery_service, o.date_created
+	FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL
+	WHERE o.customer_id = $1`
+	var rows *sql.Rows
+	if after == nil {
+		rows, err = s.db.QueryContext(ctx, columns+`
+	ORDER BY o.date_created DESC, o.order_uid DESC LIMIT $2`, customerID, limit)
+	} else {
+		rows, err = s.db.QueryContext(ctx, columns+` AND (o.date_created, o.order_uid) < ($2, $3)
+	ORDER BY o.date_created DESC, o.order_uid DESC LIMIT $4`, customerID, after.DateCreated, after.OrderUID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := make([]models.OrderSummary, 0)
+	for rows.Next() {
+		var o models.OrderSummary
+		if err := rows.Scan(&o.OrderUID, &o.TrackNumber, &o.CustomerID, &o.DeliveryService, &o.DateCreated); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// cacheCustomerOrders replaces the cached history of the customer with orders read from PostgreSQL
+func (s *Storage) cacheCustomerOrders(ctx context.Context, customerID string, orders []models.OrderSummary) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ordersKey, summariesKey := customerOrdersKey(customerID), customerSummariesKey(customerID)
+	_, err := s.redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, ordersKey, summariesKey)
+		members := make([]*redis.Z, 0, len(orders))
+		summaries := make([]interface{}, 0, 2*len(orders))
+		for _, o := range orders {
+			data, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			members = append(members, &redis.Z{Score: float64(o.DateCreated.UnixMilli()), Member: o.OrderUID})
+			summaries = append(summaries, o.OrderUID, data)
+		}
+		p.ZAdd(ctx, ordersKey, members...)
+		p.HSet(ctx, summariesKey, summaries...)
+		p.PExpire(ctx, ordersKey, s.cacheTTL())
+		p.PExpire(ctx, summariesKey, s.cacheTTL())
+		return nil
+	})
+	return err
+}
+
+// addCustomerOrder adds a saved order to the cached history of its customer
+func (s *Storage) addCustomerOrder(ctx context.Context, order models.Order) {
+	if s.cache().CustomerOrdersLimit <= 0 {
+		return
+	}
+	summary := models.OrderSummary{
+		OrderUID:        order.OrderUID,
+		TrackNumber:     order.TrackNumber,
+		CustomerID:      order.CustomerID,
+		DeliveryService: order.DeliveryService,
+		DateCreated:     order.DateCreated,
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		logger.Error("failed to marshal order summary", "order_uid", order.OrderUID, logging.Err(err))
+		return
+	}
+	keys := []string{customerOrdersKey(order.CustomerID), customerSummariesKey(order.CustomerID)}
+	err = customerAddScript.Run(ctx, s.redis, keys, order.DateCreated.UnixMilli(), order.OrderUID, data,
+		s.cache().CustomerOrdersLimit, s.cacheTTL().Milliseconds()).Err()
+	if err != nil {
+		logger.Warn("failed to add order to the cached orders of customer", "order_uid", order.OrderUID, "customer_id", order.CustomerID, logging.Err(err))
+	}
+}
+
+// forgetCustomerOrders drops the cached history of the order's customer, the next read rebuilds it
+func (s *Storage) forgetCustomerOrders(ctx context.Context, orderUID string) error {
+	if s.cache().CustomerOrdersLimit <= 0 {
+		return nil
+	}
+	var customerID string
+	err := s.db.QueryRowContext(ctx, `SELECT customer_id FROM orders WHERE order_uid = $1`, orderUID).Scan(&customerID)
+	if err != nil {
+		return fmt.Errorf("failed to find customer of order %s: %v", orderUID, err)
+	}
+	if err := s.redis.Del(ctx, customerOrdersKey(customerID), customerSummariesKey(customerID)).Err(); err != nil {
+		return fmt.Errorf("failed to drop cached orders of customer %s: %v", customerID, err)
+	}
+	return nil
+}
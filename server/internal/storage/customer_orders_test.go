@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomerOrders(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+	storage := &Storage{db: db, redis: rdb, cacheCfg: models.Redis{CustomerOrdersLimit: 2, CacheTTL: time.Hour}}
+	keys := []string{"customer:c1:orders", "customer:c1:summaries"}
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	summary := models.OrderSummary{OrderUID: "uid1", TrackNumber: "WBIL1", CustomerID: "c1", DeliveryService: "meest", DateCreated: created}
+	data, err := json.Marshal(summary)
+	require.NoError(t, err)
+
+	t.Run("cached", func(t *testing.T) {
+		// a summary trimmed between ZREVRANGE and HMGET comes back as nil
+		redisMock.ExpectEvalSha(customerReadScript.Hash(), keys, 51, "").SetVal([]interface{}{int64(1), string(data), nil})
+		page, err := storage.CustomerOrders(context.Background(), "c1", 50, nil)
+		require.NoError(t, err)
+		require.Len(t, page.Orders, 1)
+		require.True(t, created.Equal(page.Orders[0].DateCreated))
+		require.Equal(t, "WBIL1", page.Orders[0].TrackNumber)
+		require.Empty(t, page.NextCursor)
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("rebuilt from postgres", func(t *testing.T) {
+		redisMock.ExpectEvalSha(customerReadScript.Hash(), keys, 2, "").RedisNil()
+		dbMock.ExpectQuery("SELECT.*FROM orders o.*WHERE o.customer_id").WithArgs("c1", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}).
+				AddRow("uid1", "WBIL1", "c1", "meest", created).
+				AddRow("uid0", "WBIL0", "c1", "meest", created.Add(-time.Hour)))
+		redisMock.ExpectTxPipeline()
+		redisMock.ExpectDel(keys...).SetVal(0)
+		redisMock.ExpectZAdd(keys[0], &redis.Z{Score: float64(created.UnixMilli()), Member: "uid1"},
+			&redis.Z{Score: float64(created.Add(-time.Hour).UnixMilli()), Member: "uid0"}).SetVal(2)
+		redisMock.Regexp().ExpectHSet(keys[1], "uid1", ".*", "uid0", ".*").SetVal(2)
+		redisMock.ExpectPExpire(keys[0], time.Hour).SetVal(true)
+		redisMock.ExpectPExpire(keys[1], time.Hour).SetVal(true)
+		redisMock.ExpectTxPipelineExec()
+
+		page, err := storage.CustomerOrders(context.Background(), "c1", 1, nil)
+		require.NoError(t, err)
+		require.Len(t, page.Orders, 1)
+		require.Equal(t, "uid1", page.Orders[0].OrderUID)
+		require.Equal(t, models.OrderCursor{DateCreated: created, OrderUID: "uid1"}.Encode(), page.NextCursor)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("continued from postgres", func(t *testing.T) {
+		// the cached history is full and ends within the page, older orders are read from PostgreSQL
+		after := &models.OrderCursor{DateCreated: created.Add(time.Hour), OrderUID: "uid2"}
+		redisMock.ExpectEvalSha(customerReadScript.Hash(), keys, 3, "uid2").SetVal([]interface{}{int64(2), string(data)})
+		dbMock.ExpectQuery("SELECT.*WHERE o.customer_id = \\$1 AND \\(o.date_created, o.order_uid\\) <").WithArgs("c1", created, "uid1", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}).
+				AddRow("uid0", "WBIL0", "c1", "meest", created.Add(-time.Hour)))
+		page, err := storage.CustomerOrders(context.Background(), "c1", 2, after)
+		require.NoError(t, err)
+		require.Len(t, page.Orders, 2)
+		require.Equal(t, "uid0", page.Orders[1].OrderUID)
+		require.Empty(t, page.NextCursor)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("cursor past the cache", func(t *testing.T) {
+		after := &models.OrderCursor{DateCreated: created.Add(-time.Hour), OrderUID: "uid0"}
+		redisMock.ExpectEvalSha(customerReadScript.Hash(), keys, 2, "uid0").SetVal(int64(0))
+		dbMock.ExpectQuery("SELECT.*FROM orders o.*WHERE o.customer_id").WithArgs("c1", after.DateCreated, "uid0", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}))
+		page, err := storage.CustomerOrders(context.Background(), "c1", 1, after)
+		require.NoError(t, err)
+		require.Empty(t, page.Orders)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("saved order", func(t *testing.T) {
+		order := models.Order{OrderUID: "uid1", TrackNumber: "WBIL1", CustomerID: "c1", DeliveryService: "meest", DateCreated: created}
+		redisMock.ExpectEvalSha(customerAddScript.Hash(), keys, created.UnixMilli(), "uid1", data, 2, time.Hour.Milliseconds()).SetVal(int64(1))
+		storage.addCustomerOrder(context.Background(), order)
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("off", func(t *testing.T) {
+		storage := &Storage{db: db, redis: rdb}
+		dbMock.ExpectQuery("SELECT.*FROM orders o.*WHERE o.customer_id").WithArgs("c1", 51).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}))
+		page, err := storage.CustomerOrders(context.Background(), "c1", 50, nil)
+		require.NoError(t, err)
+		require.Empty(t, page.Orders)
+		require.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
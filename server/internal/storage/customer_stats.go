@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// liveCustomerStats aggregates the orders as the customer_stats view does, for stats.materialized off
+const liveCustomerStats = `(SELECT o.customer_id, p.currency, count(*) AS orders, sum(p.amount) AS amount,
+		max(o.date_created) AS last_order_at
+	FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL
+	JOIN payments p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+	GROUP BY o.customer_id, p.currency)`
+
+// TopCustomers returns the limit customers with the most orders (by models.StatsByCount) or the largest amount paid
+// (by models.StatsByAmount, in the currency only). With a currency the totals of its orders are ranked, otherwise the
+// orders in all currencies are counted. The customer_stats view or the live aggregate serves them, see stats.materialized;
+// a healthy replica is used if configured.
+func (s *Storage) TopCustomers(ctx context.Context, by, currency string, limit int) (_ []models.CustomerStats, err error) {
+	const op = "storage.TopCustomers"
+	defer s.observeQuery(opTopCustomers, time.Now(), &err)
+	source := "customer_stats"
+	if !s.statsMaterialized {
+		source = liveCustomerStats
+	}
+	var query string
+	var args []any
+	switch {
+	case by == models.StatsByCount && currency == "":
+		query = `SELECT customer_id, sum(orders), NULL, max(last_order_at) FROM ` + source + ` s
+	GROUP BY customer_id ORDER BY 2 DESC, customer_id LIMIT $1`
+		args = []any{limit}
+	case by == models.StatsByCount || by == models.StatsByAmount && currency != "":
+		column := "orders"
+		if by == models.StatsByAmount {
+			column = "amount"
+		}
+		query = `SELECT customer_id, orders, amount, last_order_at FROM ` + source + ` s
+	WHERE currency = $1 ORDER BY ` + column + ` DESC, customer_id LIMIT $2`
+		args = []any{currency, limit}
+	case by == models.StatsByAmount:
+		return nil, fmt.Errorf("%s: ranking by amount needs a currency", op)
+	default:
+		return nil, fmt.Errorf("%s: unknown ranking %q", op, by)
+	}
+
+	if r := s.replicas.pick(); r != nil {
+		top, err := topCustomers(ctx, r.db, query, args, currency)
+		if err == nil {
+			return top, nil
+		}
+		logger.Warn("replica read failed, using the primary", "op", op, "replica", r.name, logging.Err(err))
+	}
+	top, err := topCustomers(ctx, s.db, query, args, currency)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return top, nil
+}
+
+func topCustomers(ctx context.Context, db *sql.DB, query string, args []any, currency string) ([]models.CustomerStats, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := make([]models.CustomerStats, 0)
+	for rows.Next() {
+		var c models.CustomerStats
+		var amount sql.NullInt64
+		if err := rows.Scan(&c.CustomerID, &c.Orders, &amount, &c.LastOrderAt); err != nil {
+			return nil, err
+		}
+		if amount.Valid {
+			money := models.NewMoney(amount.Int64, currency)
+			c.Amount = &money
+		}
+		top = append(top, c)
+	}
+	return top, rows.Err()
+}
+
+// RefreshCustomerStats recomputes the customer_stats view; reads keep being served from the old data meanwhile
+func (s *Storage) RefreshCustomerStats(ctx context.Context) error {
+	const op = "storage.RefreshCustomerStats"
+	if _, err := s.db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY customer_stats`); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopCustomers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db, statsMaterialized: true}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"customer_id", "orders", "amount", "last_order_at"}
+
+	mock.ExpectQuery("SELECT customer_id, orders, amount, last_order_at FROM customer_stats s\\s+WHERE currency = \\$1 ORDER BY amount DESC").
+		WithArgs("USD", 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("big", 3, 250050, at).AddRow("small", 7, 1817, at))
+	top, err := storage.TopCustomers(context.Background(), models.StatsByAmount, "USD", 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	require.Equal(t, "big", top[0].CustomerID)
+	require.Equal(t, &models.Money{Amount: 250050, Currency: "USD"}, top[0].Amount)
+
+	// the orders in all currencies are counted, the amounts are left out
+	mock.ExpectQuery("SELECT customer_id, sum\\(orders\\), NULL, max\\(last_order_at\\) FROM customer_stats s\\s+GROUP BY customer_id").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("small", 9, nil, at))
+	top, err = storage.TopCustomers(context.Background(), models.StatsByCount, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []models.CustomerStats{{CustomerID: "small", Orders: 9, LastOrderAt: at}}, top)
+
+	// without the materialized view the orders are aggregated
+	storage.statsMaterialized = false
+	mock.ExpectQuery("FROM \\(SELECT o.customer_id, p.currency, count\\(\\*\\)").WithArgs("RUB", 5).
+		WillReturnRows(sqlmock.NewRows(columns))
+	top, err = storage.TopCustomers(context.Background(), models.StatsByCount, "RUB", 5)
+	require.NoError(t, err)
+	require.Empty(t, top)
+
+	_, err = storage.TopCustomers(context.Background(), models.StatsByAmount, "", 5)
+	require.ErrorContains(t, err, "needs a currency")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// rebuildBatch is the number of events read from the log at once by RebuildProjection
+const rebuildBatch = 500
+
+// appendOrderEvent appends an event to the order_event_log within the caller's transaction; the payload
+// of raw is stored as sent and may be nil, at is the Kafka position of a consumed message
+func appendOrderEvent(ctx context.Context, tx querier, orderUID, eventType string, raw models.RawPayload, at *models.MessageOffset) error {
+	var topic sql.NullString
+	var partition, offset sql.NullInt64
+	if at != nil {
+		topic = sql.NullString{String: at.Topic, Valid: true}
+		partition = sql.NullInt64{Int64: int64(at.Partition), Valid: true}
+		offset = sql.NullInt64{Int64: at.Offset, Valid: true}
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO order_event_log (order_uid, event_type, payload, schema_version, topic, kafka_partition, kafka_offset)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`, orderUID, eventType, nullableJSON(raw.Payload), raw.SchemaVersion, topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("failed to append order event: %w", err)
+	}
+	return nil
+}
+
+// nullableJSON keeps a nil payload NULL instead of an empty JSONB value
+func nullableJSON(payload []byte) any {
+	if payload == nil {
+		return nil
+	}
+	return payload
+}
+
+// OrderEvents returns the event log of the order, oldest first; ErrOrderNotFound if it has no events
+func (s *Storage) OrderEvents(ctx context.Context, orderUID string) ([]models.OrderLogEvent, error) {
+	const op = "storage.OrderEvents"
+	rows, err := s.db.QueryContext(ctx, `SELECT id, order_uid, event_type, payload, schema_version, topic, kafka_partition, kafka_offset, received_at
+	FROM order_event_log WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]models.OrderLogEvent, 0)
+	for rows.Next() {
+		e, err := scanOrderEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrOrderNotFound)
+	}
+	return events, nil
+}
+
+func scanOrderEvent(rows *sql.Rows) (models.OrderLogEvent, error) {
+	var e models.OrderLogEvent
+	var payload []byte
+	var topic sql.NullString
+	var partition, offset sql.NullInt64
+	err := rows.Scan(&e.ID, &e.OrderUID, &e.Type, &payload, &e.SchemaVersion, &topic, &partition, &offset, &e.ReceivedAt)
+	if err != nil {
+		return e, err
+	}
+	if payload != nil {
+		e.Payload = json.RawMessage(payload)
+	}
+	if topic.Valid {
+		e.Source = &models.MessageOffset{Topic: topic.String, Partition: int(partition.Int64), Offset: offset.Int64}
+	}
+	return e, nil
+}
+
+// RebuildProjection recreates the order tables (orders and their rows, search documents, raw payloads)
+// from the event log in one transaction, a failed rebuild leaves them as they were. The received events
+// are replayed in order with the write mode of the service; status tokens of the rebuilt orders are kept,
+// so the links shared with customers still work. The previously cached orders are dropped afterwards.
+// The tables are locked until the commit, reads and saves of orders wait for the rebuild.
+func (s *Storage) RebuildProjection(ctx context.Context) (models.RebuildReport, error) {
+	const op = "storage.RebuildProjection"
+	var report models.RebuildReport
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	// only the orders stored before the rebuild may be cached
+	cached, err := storedOrderCustomers(ctx, tx)
+	if err != nil {
+		return report, fmt.Errorf("%s: %v", op, err)
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TEMP TABLE rebuild_tokens ON COMMIT DROP AS
+	SELECT token, order_uid FROM order_status_tokens`)
+	if err != nil {
+		return report, fmt.Errorf("%s: failed to keep status tokens: %v", op, err)
+	}
+	// the tables referencing order_keys (status tokens, raw payloads, search documents) are emptied by CASCADE
+	if _, err = tx.ExecContext(ctx, `TRUNCATE order_keys, orders, deliveries, payments, items CASCADE`); err != nil {
+		return report, fmt.Errorf("%s: failed to truncate order tables: %v", op, err)
+	}
+
+	upsert := s.writeMode == models.WriteUpsert
+	for lastID := int64(0); ; {
+		events, err := readEventBatch(ctx, tx, lastID)
+		if err != nil {
+			return report, fmt.Errorf("%s: %v", op, err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, e := range events {
+			if err := s.replayEvent(ctx, tx, e, upsert, &report); err != nil {
+				return report, fmt.Errorf("%s: event %d: %v", op, e.ID, err)
+			}
+		}
+		lastID = events[len(events)-1].ID
+		report.Events += len(events)
+		logger.Info("order events replayed", "events", report.Events, "orders", report.Orders)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_status_tokens (token, order_uid)
+	SELECT t.token, t.order_uid FROM rebuild_tokens t JOIN order_keys k ON k.order_uid = t.order_uid`)
+	if err != nil {
+		return report, fmt.Errorf("%s: failed to restore status tokens: %v", op, err)
+	}
+	missing, err := queryStrings(ctx, tx, `SELECT k.order_uid FROM order_keys k
+	WHERE NOT EXISTS (SELECT 1 FROM order_status_tokens t WHERE t.order_uid = k.order_uid)`)
+	if err != nil {
+		return report, fmt.Errorf("%s: %v", op, err)
+	}
+	for _, orderUID := range missing {
+		if _, err := insertStatusToken(ctx, tx, orderUID); err != nil {
+			return report, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if current, err := queryStrings(ctx, s.db, `SELECT order_uid FROM order_keys`); err == nil {
+		s.addToBloom(ctx, current...)
+	} else {
+		logger.Error("failed to list rebuilt orders for the bloom filter", logging.Err(err))
+	}
+	if err := s.dropCachedOrders(ctx, cached); err != nil {
+		logger.Error("failed to drop cached orders after the rebuild", logging.Err(err))
+	}
+	return report, nil
+}
+
+// storedOrderCustomers returns the customers of the stored orders by order_uid
+func storedOrderCustomers(ctx context.Context, tx querier) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT order_uid, customer_id FROM orders`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored orders: %v", err)
+	}
+	defer rows.Close()
+	customers := make(map[string]string)
+	for rows.Next() {
+		var orderUID, customerID string
+		if err := rows.Scan(&orderUID, &customerID); err != nil {
+			return nil, fmt.Errorf("failed to list stored orders: %v", err)
+		}
+		customers[orderUID] = customerID
+	}
+	return customers, rows.Err()
+}
+
+// dropCachedOrders is invalidateOrder of many orders whose customers are known (customers by order_uid),
+// the keys are deleted in pipelines of rebuildBatch orders
+func (s *Storage) dropCachedOrders(ctx context.Context, customers map[string]string) error {
+	pipe := s.redis.Pipeline()
+	queued := 0
+	for orderUID, customerID := range customers {
+		s.local.remove(orderUID)
+		pipe.Del(ctx, orderUID)
+		pipe.ZRem(ctx, lruKey, orderUID)
+		if s.cache().CustomerOrdersLimit > 0 {
+			pipe.Del(ctx, customerOrdersKey(customerID), customerSummariesKey(customerID))
+		}
+		if queued++; queued%rebuildBatch == 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if queued%rebuildBatch == 0 {
+		return nil
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// replayEvent applies one event of the log to the order tables being rebuilt, the payload of the event is
+// decoded from the version it was sent with
+func (s *Storage) replayEvent(ctx context.Context, tx querier, e models.OrderLogEvent, upsert bool, report *models.RebuildReport) error {
+	switch e.Type {
+	case models.OrderEventReceived, models.OrderEventUpdated:
+		order, err := decodeRawOrder(models.RawPayload{Payload: e.Payload, SchemaVersion: e.SchemaVersion})
+		if err != nil {
+			report.Invalid++
+			logger.Warn("undecodable order event skipped", "id", e.ID, "order_uid", e.OrderUID, logging.Err(err))
+			return nil
+		}
+		// an update replaces the order whatever the write mode
+		replaced, err := s.projectOrder(ctx, tx, order, models.RawPayload{Payload: e.Payload, SchemaVersion: e.SchemaVersion},
+			upsert || e.Type == models.OrderEventUpdated)
+		if errors.Is(err, ErrOrderExists) {
+			report.Duplicates++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !replaced {
+			report.Orders++
+		}
+	case models.OrderEventDeleted:
+		_, err := tx.ExecContext(ctx, `UPDATE order_keys SET deleted_at = COALESCE(deleted_at, $2) WHERE order_uid = $1`,
+			e.OrderUID, e.ReceivedAt)
+		if err != nil {
+			return fmt.Errorf("failed to delete order: %w", err)
+		}
+	case models.OrderEventRestored:
+		if _, err := tx.ExecContext(ctx, `UPDATE order_keys SET deleted_at = NULL WHERE order_uid = $1`, e.OrderUID); err != nil {
+			return fmt.Errorf("failed to restore order: %w", err)
+		}
+	default:
+		logger.Warn("unknown order event skipped", "id", e.ID, "type", e.Type)
+	}
+	return nil
+}
+
+func readEventBatch(ctx context.Context, tx querier, afterID int64) ([]models.OrderLogEvent, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, order_uid, event_type, payload, schema_version, topic, kafka_partition, kafka_offset, received_at
+	FROM order_event_log WHERE id > $1 ORDER BY id LIMIT $2`, afterID, rebuildBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order events: %v", err)
+	}
+	defer rows.Close()
+	var events []models.OrderLogEvent
+	for rows.Next() {
+		e, err := scanOrderEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read order events: %v", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// queryStrings returns the first column of the rows of the query
+func queryStrings(ctx context.Context, q querier, query string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+var eventColumns = []string{"id", "order_uid", "event_type", "payload", "schema_version", "topic", "kafka_partition", "kafka_offset", "received_at"}
+
+func TestOrderEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT .* FROM order_event_log WHERE order_uid = \\$1 ORDER BY id").WithArgs("test123").
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(1, "test123", models.OrderEventReceived, []byte(`{"order_uid":"test123"}`), 1, "orders", 0, 7, at).
+			AddRow(2, "test123", models.OrderEventDeleted, nil, 2, nil, nil, nil, at))
+
+	events, err := storage.OrderEvents(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.JSONEq(t, `{"order_uid":"test123"}`, string(events[0].Payload))
+	require.Equal(t, 1, events[0].SchemaVersion)
+	require.Equal(t, &models.MessageOffset{Topic: "orders", Partition: 0, Offset: 7}, events[0].Source)
+	require.Nil(t, events[1].Payload)
+	require.Nil(t, events[1].Source)
+
+	mock.ExpectQuery("SELECT .* FROM order_event_log").WithArgs("missing").WillReturnRows(sqlmock.NewRows(eventColumns))
+	_, err = storage.OrderEvents(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRebuildProjection(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+	storage := &Storage{db: db, redis: rdb}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	payload := []byte(`{"order_uid":"test123","customer_id":"new","payment":{"currency":"USD","amount":1817}}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT order_uid, customer_id FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "customer_id"}).AddRow("test123", "old"))
+	mock.ExpectExec("CREATE TEMP TABLE rebuild_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("TRUNCATE order_keys, orders, deliveries, payments, items CASCADE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT .* FROM order_event_log WHERE id > \\$1").WithArgs(int64(0), rebuildBatch).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(1, "test123", models.OrderEventReceived, payload, 1, "orders", 0, 1, at).
+			AddRow(2, "test123", models.OrderEventReceived, payload, 1, "orders", 0, 2, at).
+			AddRow(3, "test123", models.OrderEventUpdated, payload, 1, nil, nil, nil, at).
+			AddRow(4, "test123", models.OrderEventDeleted, nil, 2, nil, nil, nil, at).
+			AddRow(5, "broken", models.OrderEventReceived, []byte(`[]`), 2, nil, nil, nil, at))
+	// the first received event projects the order, its amounts are upgraded from the version it was sent with
+	mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WithArgs("test123", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		"USD", sqlmock.AnyArg(), models.NewMoney(181700, "USD"), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+	// the insert write mode keeps it on the redelivery
+	mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	// but an update replaces it
+	mock.ExpectQuery("INSERT INTO order_keys .* ON CONFLICT \\(order_uid\\) DO UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectExec("DELETE FROM orders").WithArgs("test123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE order_keys SET deleted_at = COALESCE\\(deleted_at, \\$2\\)").WithArgs("test123", at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT .* FROM order_event_log WHERE id > \\$1").WithArgs(int64(5), rebuildBatch).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+	mock.ExpectExec("INSERT INTO order_status_tokens .* FROM rebuild_tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT k.order_uid FROM order_keys k").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("test123"))
+	mock.ExpectExec("INSERT INTO order_status_tokens").WithArgs(sqlmock.AnyArg(), "test123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT order_uid FROM order_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("test123"))
+	// the orders cached before the rebuild are dropped
+	redisMock.ExpectDel("test123").SetVal(1)
+	redisMock.ExpectZRem(lruKey, "test123").SetVal(1)
+
+	report, err := storage.RebuildProjection(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, models.RebuildReport{Events: 5, Orders: 1, Duplicates: 1, Invalid: 1}, report)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"context"
+	"fmt"
+	"time"
+)
+
+// OrderExists reports whether the order is stored and not soft-deleted without reading it:
+// the bloom filter rejects unknown UIDs and cached orders answer without PostgreSQL
+func (s *Storage) OrderExists(ctx context.Context, orderUID string) (_ bool, err error) {
+	const op = "storage.OrderExists"
+	if !s.mayExist(ctx, orderUID) {
+		return false, nil
+	}
+	if _, ok := s.local.get(orderUID); ok {
+		return true, nil
+	}
+	n, err := s.redis.Exists(ctx, orderUID).Result()
+	if err == nil && n > 0 {
+		return true, nil
+	}
+	if err != nil {
+		logger.Warn("failed to check cached order", "op", op, "order_uid", orderUID, logging.Err(err))
+	}
+
+	defer s.observeQuery(opOrderExists, time.Now(), &err)
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM order_keys WHERE order_uid = $1 AND deleted_at IS NULL)`,
+		orderUID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderExists(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+	storage := &Storage{db: db, redis: rdb}
+	query := `SELECT EXISTS \(SELECT 1 FROM order_keys WHERE order_uid = \$1 AND deleted_at IS NULL\)`
+
+	// a cached order answers without PostgreSQL
+	redisMock.ExpectExists("uid1").SetVal(1)
+	exists, err := storage.OrderExists(context.Background(), "uid1")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	redisMock.ExpectExists("uid2").SetVal(0)
+	dbMock.ExpectQuery(query).WithArgs("uid2").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	exists, err = storage.OrderExists(context.Background(), "uid2")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Redis failures fall back to PostgreSQL
+	redisMock.ExpectExists("uid3").SetErr(errors.New("connection refused"))
+	dbMock.ExpectQuery(query).WithArgs("uid3").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	exists, err = storage.OrderExists(context.Background(), "uid3")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
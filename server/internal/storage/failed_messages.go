@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFailedMessageNotFound is returned when there is no quarantine record with the requested id
+var ErrFailedMessageNotFound = fmt.Errorf("failed message %w", models.ErrNotFound)
+
+// failedMessageColumns are the columns read by scanFailedMessage
+const failedMessageColumns = `id, topic, kafka_partition, kafka_offset, message_key, payload,
+		error, attempts, first_failed_at, last_failed_at, transient, auto_retries`
+
+// SaveFailedMessage persists a message that could not be processed.
+// The same Kafka message (topic, partition, offset) failing again updates the existing record.
+func (s *Storage) SaveFailedMessage(ctx context.Context, m models.FailedMessage) error {
+	const op = "storage.SaveFailedMessage"
+	query := `INSERT INTO failed_messages (
+		topic, kafka_partition, kafka_offset, message_key, payload,
+		error, attempts, first_failed_at, last_failed_at, transient, auto_retries
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE SET
+		error = EXCLUDED.error,
+		attempts = failed_messages.attempts + EXCLUDED.attempts,
+		last_failed_at = EXCLUDED.last_failed_at,
+		transient = EXCLUDED.transient,
+		auto_retries = GREATEST(failed_messages.auto_retries, EXCLUDED.auto_retries),
+		next_retry_at = NULL`
+
+	_, err := s.db.ExecContext(ctx, query,
+		m.Topic,
+		m.Partition,
+		m.Offset,
+		m.Key,
+		[]byte(m.Payload),
+		m.Error,
+		m.Attempts,
+		m.FirstFailedAt,
+		m.LastFailedAt,
+		m.Transient,
+		m.AutoRetries,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// ListFailedMessages returns quarantine records, most recent failures first
+func (s *Storage) ListFailedMessages(ctx context.Context, limit, offset int) ([]models.FailedMessage, error) {
+	const op = "storage.ListFailedMessages"
+	query := `SELECT ` + failedMessageColumns + `
+	FROM failed_messages ORDER BY last_failed_at DESC, id DESC LIMIT $1 OFFSET $2`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.FailedMessage, 0)
+	for rows.Next() {
+		m, err := scanFailedMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		messages = append(messages, *m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return messages, nil
+}
+
+// CountFailedMessagesSince returns the number of messages that first failed at or after since
+func (s *Storage) CountFailedMessagesSince(ctx context.Context, since time.Time) (int64, error) {
+	const op = "storage.CountFailedMessagesSince"
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM failed_messages WHERE first_failed_at >= $1`, since).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	return n, nil
+}
+
+// GetFailedMessage returns a single quarantine record
+func (s *Storage) GetFailedMessage(ctx context.Context, id int64) (*models.FailedMessage, error) {
+	const op = "storage.GetFailedMessage"
+	query := `SELECT ` + failedMessageColumns + `
+	FROM failed_messages WHERE id = $1`
+
+	m, err := scanFailedMessage(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFailedMessageNotFound
+		}
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return m, nil
+}
+
+// ClaimRetryableFailedMessages returns up to cfg.BatchSize transient failures due for an automatic redrive:
+// redriven less than cfg.MaxAttempts times and failed at least cfg.InitialDelay*2^auto_retries (at most
+// cfg.MaxDelay) ago. They are leased for cfg.InitialDelay, so other instances skip them and a failed redrive
+// is tried again after it.
+func (s *Storage) ClaimRetryableFailedMessages(ctx context.Context, cfg models.DLQRetryCfg) ([]models.FailedMessage, error) {
+	const op = "storage.ClaimRetryableFailedMessages"
+	query := `UPDATE failed_messages SET next_retry_at = now() + make_interval(secs => $3)
+	WHERE id IN (
+		SELECT id FROM failed_messages
+		WHERE transient AND auto_retries < $2
+			AND COALESCE(next_retry_at,
+				last_failed_at + make_interval(secs => LEAST($3 * power(2, auto_retries), $4))) <= now()
+		ORDER BY last_failed_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + failedMessageColumns
+
+	rows, err := s.db.QueryContext(ctx, query, cfg.BatchSize, cfg.MaxAttempts,
+		cfg.InitialDelay.Seconds(), cfg.MaxDelay.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.FailedMessage, 0)
+	for rows.Next() {
+		m, err := scanFailedMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		messages = append(messages, *m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return messages, nil
+}
+
+// DeleteFailedMessage removes a quarantine record, after its message is redriven or discarded
+func (s *Storage) DeleteFailedMessage(ctx context.Context, id int64) error {
+	const op = "storage.DeleteFailedMessage"
+	res, err := s.db.ExecContext(ctx, `DELETE FROM failed_messages WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return ErrFailedMessageNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFailedMessage(row rowScanner) (*models.FailedMessage, error) {
+	var m models.FailedMessage
+	var payload []byte
+	err := row.Scan(
+		&m.ID,
+		&m.Topic,
+		&m.Partition,
+		&m.Offset,
+		&m.Key,
+		&payload,
+		&m.Error,
+		&m.Attempts,
+		&m.FirstFailedAt,
+		&m.LastFailedAt,
+		&m.Transient,
+		&m.AutoRetries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.Payload = string(payload)
+	return &m, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedMessages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := &Storage{db: db}
+	now := time.Now()
+
+	t.Run("save", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO failed_messages").
+			WithArgs("orders", 1, int64(42), "key", []byte(`{"bad":`), "boom", 5, now, now, true, 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := storage.SaveFailedMessage(context.Background(), models.FailedMessage{
+			Topic: "orders", Partition: 1, Offset: 42, Key: "key", Payload: `{"bad":`,
+			Error: "boom", Attempts: 5, FirstFailedAt: now, LastFailedAt: now, Transient: true, AutoRetries: 2,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("count since", func(t *testing.T) {
+		since := now.Add(-time.Hour)
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM failed_messages WHERE first_failed_at >= \\$1").WithArgs(since).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		n, err := storage.CountFailedMessagesSince(context.Background(), since)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{
+			"id", "topic", "kafka_partition", "kafka_offset", "message_key", "payload",
+			"error", "attempts", "first_failed_at", "last_failed_at", "transient", "auto_retries",
+		}).AddRow(7, "orders", 1, 42, "key", []byte(`{"bad":`), "boom", 5, now, now, false, 0)
+		mock.ExpectQuery("SELECT.*FROM failed_messages WHERE id").WithArgs(int64(7)).WillReturnRows(rows)
+
+		m, err := storage.GetFailedMessage(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, `{"bad":`, m.Payload)
+		require.Equal(t, 5, m.Attempts)
+	})
+
+	t.Run("claim retryable", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{
+			"id", "topic", "kafka_partition", "kafka_offset", "message_key", "payload",
+			"error", "attempts", "first_failed_at", "last_failed_at", "transient", "auto_retries",
+		}).AddRow(9, "orders", 0, 43, "key", []byte(`{}`), "failed to save order: timeout", 5, now, now, true, 1)
+		mock.ExpectQuery("UPDATE failed_messages SET next_retry_at .* WHERE transient AND auto_retries < \\$2").
+			WithArgs(20, 5, 60.0, 3600.0).WillReturnRows(rows)
+
+		messages, err := storage.ClaimRetryableFailedMessages(context.Background(), models.DLQRetryCfg{
+			MaxAttempts: 5, InitialDelay: time.Minute, MaxDelay: time.Hour, BatchSize: 20,
+		})
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		require.True(t, messages[0].Transient)
+		require.Equal(t, 1, messages[0].AutoRetries)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery("SELECT.*FROM failed_messages WHERE id").WillReturnError(sql.ErrNoRows)
+
+		_, err := storage.GetFailedMessage(context.Background(), 8)
+		require.ErrorIs(t, err, models.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM failed_messages WHERE id").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		require.NoError(t, storage.DeleteFailedMessage(context.Background(), 7))
+
+		mock.ExpectExec("DELETE FROM failed_messages WHERE id").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+		require.ErrorIs(t, storage.DeleteFailedMessage(context.Background(), 7), models.ErrNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
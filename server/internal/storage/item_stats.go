@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TopItems returns the best-selling products of the orders created within the window of q. By models.StatsByRevenue
+// the items of the orders paid in q.Currency are ranked, by models.StatsByQuantity the items of all the orders unless
+// a currency is set. The sales are summed from the items table: the window prunes its partitions and idx_items_sales
+// covers the grouping. Soft-deleted orders are left out; a healthy replica serves the stats if configured.
+func (s *Storage) TopItems(ctx context.Context, q models.TopItemsQuery) (_ []models.ItemStats, err error) {
+	const op = "storage.TopItems"
+	defer s.observeQuery(opTopItems, time.Now(), &err)
+	var query string
+	args := []any{q.From, q.To}
+	switch {
+	case q.By == models.StatsByQuantity && q.Currency == "":
+		query = `SELECT i.nm_id, max(i.brand), max(i.name), count(*) AS quantity, NULL
+	FROM items i
+	JOIN order_keys k ON k.order_uid = i.order_uid AND k.deleted_at IS NULL
+	WHERE i.date_created >= $1 AND i.date_created < $2
+	GROUP BY i.nm_id
+	ORDER BY quantity DESC, i.nm_id LIMIT $3`
+		args = append(args, q.Limit)
+	case q.By == models.StatsByQuantity || q.By == models.StatsByRevenue && q.Currency != "":
+		column := "quantity"
+		if q.By == models.StatsByRevenue {
+			column = "revenue"
+		}
+		query = `SELECT i.nm_id, max(i.brand), max(i.name), count(*) AS quantity, sum(i.total_price) AS revenue
+	FROM items i
+	JOIN order_keys k ON k.order_uid = i.order_uid AND k.deleted_at IS NULL
+	JOIN payments p ON p.order_uid = i.order_uid AND p.date_created = i.date_created
+	WHERE i.date_created >= $1 AND i.date_created < $2 AND p.currency = $3
+	GROUP BY i.nm_id
+	ORDER BY ` + column + ` DESC, i.nm_id LIMIT $4`
+		args = append(args, q.Currency, q.Limit)
+	case q.By == models.StatsByRevenue:
+		return nil, fmt.Errorf("%s: ranking by revenue needs a currency", op)
+	default:
+		return nil, fmt.Errorf("%s: unknown ranking %q", op, q.By)
+	}
+
+	if r := s.replicas.pick(); r != nil {
+		top, err := topItems(ctx, r.db, query, args, q.Currency)
+		if err == nil {
+			return top, nil
+		}
+		logger.Warn("replica read failed, using the primary", "op", op, "replica", r.name, logging.Err(err))
+	}
+	top, err := topItems(ctx, s.db, query, args, q.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return top, nil
+}
+
+func topItems(ctx context.Context, db *sql.DB, query string, args []any, currency string) ([]models.ItemStats, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := make([]models.ItemStats, 0)
+	for rows.Next() {
+		var item models.ItemStats
+		var revenue sql.NullInt64
+		if err := rows.Scan(&item.NmID, &item.Brand, &item.Name, &item.Quantity, &revenue); err != nil {
+			return nil, err
+		}
+		if revenue.Valid {
+			money := models.NewMoney(revenue.Int64, currency)
+			item.Revenue = &money
+		}
+		top = append(top, item)
+	}
+	return top, rows.Err()
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	columns := []string{"nm_id", "brand", "name", "quantity", "revenue"}
+
+	mock.ExpectQuery("JOIN payments p .*AND p.currency = \\$3\\s+GROUP BY i.nm_id\\s+ORDER BY revenue DESC, i.nm_id LIMIT \\$4").
+		WithArgs(from, to, "RUB", 5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2389212, "Vivienne Sabo", "Mascaras", 10, 3170))
+	top, err := storage.TopItems(context.Background(), models.TopItemsQuery{By: models.StatsByRevenue, Currency: "RUB", From: from, To: to, Limit: 5})
+	require.NoError(t, err)
+	require.Equal(t, []models.ItemStats{{NmID: 2389212, Brand: "Vivienne Sabo", Name: "Mascaras", Quantity: 10,
+		Revenue: &models.Money{Amount: 3170, Currency: "RUB"}}}, top)
+
+	// the quantities of all the orders, without the revenues of different currencies
+	mock.ExpectQuery("count\\(\\*\\) AS quantity, NULL\\s+FROM items i\\s+JOIN order_keys k .*ORDER BY quantity DESC, i.nm_id LIMIT \\$3").
+		WithArgs(from, to, 5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2389212, "Vivienne Sabo", "Mascaras", 12, nil))
+	top, err = storage.TopItems(context.Background(), models.TopItemsQuery{By: models.StatsByQuantity, From: from, To: to, Limit: 5})
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	require.Nil(t, top[0].Revenue)
+
+	_, err = storage.TopItems(context.Background(), models.TopItemsQuery{By: models.StatsByRevenue, From: from, To: to, Limit: 5})
+	require.ErrorContains(t, err, "needs a currency")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListOrders returns a page of the orders matching the filter, newest first, starting after the cursor
+// (nil - the first page). Keyset pagination keeps every page an index range scan of idx_orders_date_created_uid
+// (idx_orders_customer with a customer filter) however deep it is.
+// Soft-deleted orders are skipped; a healthy replica serves the list if configured.
+func (s *Storage) ListOrders(ctx context.Context, f models.OrderFilter, limit int, after *models.OrderCursor) (_ *models.OrderPage, err error) {
+	const op = "storage.ListOrders"
+	defer s.observeQuery(opListOrders, time.Now(), &err)
+	if r := s.replicas.pick(); r != nil {
+		page, err := listOrders(ctx, r.db, f, limit, after)
+		if err == nil {
+			return page, nil
+		}
+		logger.Warn("replica read failed, using the primary", "op", op, "replica", r.name, logging.Err(err))
+	}
+	page, err := listOrders(ctx, s.db, f, limit, after)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return page, nil
+}
+
+// CountOrders returns the number of the orders matching the filter, soft-deleted ones are not counted
+func (s *Storage) CountOrders(ctx context.Context, f models.OrderFilter) (_ int64, err error) {
+	const op = "storage.CountOrders"
+	defer s.observeQuery(opCountOrders, time.Now(), &err)
+	where, args := orderConditions(f, nil)
+	// order_keys has the dates of the orders, the orders are joined for a customer filter only
+	query := `SELECT count(*) FROM order_keys o`
+	where = append([]string{"o.deleted_at IS NULL"}, where...)
+	if f.CustomerID != "" {
+		query = `SELECT count(*) FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL`
+		where = where[1:]
+	}
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, " AND ")
+	}
+	var count int64
+	if r := s.replicas.pick(); r != nil {
+		err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
+		if err == nil {
+			return count, nil
+		}
+		logger.Warn("replica read failed, using the primary", "op", op, "replica", r.name, logging.Err(err))
+	}
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	return count, nil
+}
+
+// orderConditions appends the values of the filter to args and returns the WHERE conditions
+// over the orders aliased o
+func orderConditions(f models.OrderFilter, args []any) ([]string, []any) {
+	var where []string
+	cond := func(expr string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(expr, len(args)))
+	}
+	if f.CustomerID != "" {
+		cond("o.customer_id = $%d", f.CustomerID)
+	}
+	if !f.From.IsZero() {
+		cond("o.date_created >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		cond("o.date_created < $%d", f.To)
+	}
+	return where, args
+}
+
+func listOrders(ctx context.Context, db *sql.DB, f models.OrderFilter, limit int, after *models.OrderCursor) (*models.OrderPage, error) {
+	query := `SELECT o.order_uid, o.track_number, o.customer_id, o.delivery_service, o.date_created
+	FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL`
+	where, args := orderConditions(f, nil)
+	if after != nil {
+		args = append(args, after.DateCreated, after.OrderUID)
+		where = append(where, fmt.Sprintf("(o.date_created, o.order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, " AND ")
+	}
+	// one extra row tells whether there is a next page
+	args = append(args, limit+1)
+	query += fmt.Sprintf("\n\tORDER BY o.date_created DESC, o.order_uid DESC LIMIT $%d", len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]models.OrderSummary, 0, limit+1)
+	for rows.Next() {
+		var o models.OrderSummary
+		if err := rows.Scan(&o.OrderUID, &o.TrackNumber, &o.CustomerID, &o.DeliveryService, &o.DateCreated); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orderPage(orders, limit), nil
+}
+
+// orderPage makes a page of the first limit orders, an order past them means there is a next page
+func orderPage(orders []models.OrderSummary, limit int) *models.OrderPage {
+	page := &models.OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = models.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}.Encode()
+	}
+	return page
+}
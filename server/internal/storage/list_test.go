@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListOrdersKeyset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	columns := []string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}
+	newest := time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`ORDER BY o.date_created DESC, o.order_uid DESC LIMIT \$1`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("uid3", "WB3", "c1", "meest", newest).
+			AddRow("uid2", "WB2", "c1", "meest", newest.Add(-time.Hour)).
+			AddRow("uid1", "WB1", "c2", "meest", newest.Add(-2*time.Hour)))
+
+	page, err := storage.ListOrders(context.Background(), models.OrderFilter{}, 2, nil)
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	cursor, err := models.DecodeOrderCursor(page.NextCursor)
+	require.NoError(t, err)
+	require.Equal(t, "uid2", cursor.OrderUID)
+
+	mock.ExpectQuery(`WHERE \(o.date_created, o.order_uid\) < \(\$1, \$2\)`).
+		WithArgs(newest.Add(-time.Hour), "uid2", 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("uid1", "WB1", "c2", "meest", newest.Add(-2*time.Hour)))
+
+	page, err = storage.ListOrders(context.Background(), models.OrderFilter{}, 2, &cursor)
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	require.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListOrdersFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	cursor := &models.OrderCursor{DateCreated: from.Add(time.Hour), OrderUID: "uid2"}
+
+	mock.ExpectQuery(`WHERE o.customer_id = \$1 AND o.date_created >= \$2 AND o.date_created < \$3 `+
+		`AND \(o.date_created, o.order_uid\) < \(\$4, \$5\)\s+ORDER BY o.date_created DESC, o.order_uid DESC LIMIT \$6`).
+		WithArgs("c1", from, to, cursor.DateCreated, "uid2", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "customer_id", "delivery_service", "date_created"}))
+	page, err := storage.ListOrders(context.Background(), models.OrderFilter{CustomerID: "c1", From: from, To: to}, 2, cursor)
+	require.NoError(t, err)
+	require.Empty(t, page.Orders)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM order_keys o\s+WHERE o.deleted_at IS NULL AND o.date_created >= \$1$`).WithArgs(from).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	count, err := storage.CountOrders(context.Background(), models.OrderFilter{From: from})
+	require.NoError(t, err)
+	require.Equal(t, int64(42), count)
+
+	// a customer filter joins the orders
+	mock.ExpectQuery(`FROM orders o\s+JOIN order_keys k .* WHERE o.customer_id = \$1$`).WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	count, err = storage.CountOrders(context.Background(), models.OrderFilter{CustomerID: "c1"})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// localCache is the in-process hot layer in front of Redis: a small LRU of the orders
+// read or cached recently, which also serves them while Redis is unreachable.
+// Its entries live briefly: an order changed or deleted through another instance
+// is only invalidated in Redis. A nil localCache is disabled.
+type localCache struct {
+	mu    sync.Mutex
+	limit int
+	ttl   time.Duration
+	ll    *list.List // front - most recently used
+	items map[string]*list.Element
+}
+
+type localEntry struct {
+	order   *models.Order
+	expires time.Time
+}
+
+// newLocalCache returns nil (disabled) for a non-positive size
+func newLocalCache(size int, ttl time.Duration) *localCache {
+	if size <= 0 {
+		return nil
+	}
+	return &localCache{limit: size, ttl: ttl, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *localCache) get(orderUID string) (*models.Order, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[orderUID]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*localEntry)
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, orderUID)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.order, true
+}
+
+func (c *localCache) put(order *models.Order) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &localEntry{order: order, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.items[order.OrderUID]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[order.OrderUID] = c.ll.PushFront(e)
+	if c.ll.Len() > c.limit {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*localEntry).order.OrderUID)
+	}
+}
+
+func (c *localCache) remove(orderUID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[orderUID]; ok {
+		c.ll.Remove(el)
+		delete(c.items, orderUID)
+	}
+}
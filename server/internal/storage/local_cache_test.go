@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCache(t *testing.T) {
+	c := newLocalCache(2, time.Minute)
+	c.put(&models.Order{OrderUID: "a"})
+	c.put(&models.Order{OrderUID: "b"})
+	_, ok := c.get("a") // b is the least recently used now
+	require.True(t, ok)
+	c.put(&models.Order{OrderUID: "c"})
+
+	_, ok = c.get("b")
+	require.False(t, ok)
+	_, ok = c.get("a")
+	require.True(t, ok)
+	c.remove("a")
+	_, ok = c.get("a")
+	require.False(t, ok)
+
+	expired := newLocalCache(2, -time.Second)
+	expired.put(&models.Order{OrderUID: "a"})
+	_, ok = expired.get("a")
+	require.False(t, ok)
+
+	// disabled
+	off := newLocalCache(0, time.Minute)
+	off.put(&models.Order{OrderUID: "a"})
+	_, ok = off.get("a")
+	require.False(t, ok)
+}
+
+func TestGetOrderRedisDown(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+	storage := &Storage{db: db, redis: rdb, stats: newCacheStats(), local: newLocalCache(10, time.Minute)}
+	down := errors.New("connection refused")
+
+	redisMock.ExpectGet("test123").SetErr(down)
+	dbMock.ExpectQuery("SELECT.*FROM orders o").WithArgs("test123", false).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"track_number", "entry", "locale", "internal_signature", "customer_id",
+			"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "deleted_at",
+			"name", "phone", "zip", "city", "address", "region", "email",
+			"transaction", "request_id", "currency", "provider", "amount",
+			"payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee", "items",
+		}).AddRow(
+			"WBIL12345678", "WBIL", "en", "", "test_customer",
+			"meest", "1", 1, time.Now(), "1", nil,
+			"Test User", "+1234567890", "12345", "Moscow", "Test Address", "Test Region", "test@example.com",
+			"test123", "", "USD", "wbpay", 1000,
+			time.Now().Unix(), "sber", 500, 500, 0, nil,
+		))
+	redisMock.Regexp().ExpectEvalSha(saveScript.Hash(), []string{lruKey, "test123"}, ".*", ".*", ".*", ".*", ".*").SetErr(down)
+
+	// the DB read succeeds, failing to cache it doesn't fail the request
+	order, source, err := storage.GetOrder(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, "Test User", order.Delivery.Name)
+	require.Equal(t, models.OrderFromDB, source)
+
+	// while Redis is down the order is served from the process
+	order, source, err = storage.GetOrder(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, "Test User", order.Delivery.Name)
+	require.Equal(t, models.OrderFromLocal, source)
+
+	require.NoError(t, dbMock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestGetFromCacheHotLayer(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	now := time.UnixMilli(1_700_000_000_000)
+	storage := &Storage{redis: rdb, now: func() time.Time { return now }, local: newLocalCache(10, time.Minute)}
+
+	mock.ExpectGet("test123").SetVal("\x03" + `{"order_uid":"test123","track_number":"WBIL12345678"}`)
+	mock.ExpectZAddXX(lruKey, &redis.Z{Score: float64(now.UnixMilli()), Member: "test123"}).SetVal(0)
+	order, source, err := storage.getFromCache(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, "WBIL12345678", order.TrackNumber)
+	require.Equal(t, models.OrderFromRedis, source)
+
+	// the next read doesn't reach Redis
+	order, _, err = storage.getFromCache(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, "WBIL12345678", order.TrackNumber)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// an invalidated order is read from Redis again
+	mock.ExpectTxPipeline()
+	mock.ExpectDel("test123").SetVal(1)
+	mock.ExpectZRem(lruKey, "test123").SetVal(1)
+	mock.ExpectTxPipelineExec()
+	require.NoError(t, storage.invalidateOrder(context.Background(), "test123"))
+	mock.ExpectGet("test123").RedisNil()
+	_, _, err = storage.getFromCache(context.Background(), "test123")
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
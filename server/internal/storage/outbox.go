@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// insertOutboxEvent writes an event within the caller's transaction
+func insertOutboxEvent(ctx context.Context, tx querier, eventType, aggregateID string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox event: %v", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`,
+		eventType, aggregateID, data)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents leases the oldest unpublished events not leased by another relay and returns them
+// with the destinations they were already delivered to and the number and time of their first claim.
+// SKIP LOCKED lets relays of several service instances claim disjoint batches; events a relay fails
+// to publish are claimable again once the lease ends.
+func (s *Storage) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (_ []models.OutboxEvent, err error) {
+	const op = "storage.ClaimOutboxEvents"
+	defer s.observeQuery(opClaimOutbox, time.Now(), &err)
+	query := `WITH claimed AS (
+		UPDATE outbox SET locked_until = now() + make_interval(secs => $2),
+			claims = claims + 1, first_claimed_at = COALESCE(first_claimed_at, now())
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, aggregate_id, payload, created_at, claims, first_claimed_at
+	)
+	SELECT c.id, c.event_type, c.aggregate_id, c.payload, c.created_at, c.claims, c.first_claimed_at,
+		COALESCE(array_agg(d.destination) FILTER (WHERE d.destination IS NOT NULL), '{}')
+	FROM claimed c
+	LEFT JOIN outbox_deliveries d ON d.event_id = c.id
+	GROUP BY c.id, c.event_type, c.aggregate_id, c.payload, c.created_at, c.claims, c.first_claimed_at
+	ORDER BY c.id`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]models.OutboxEvent, 0)
+	for rows.Next() {
+		var e models.OutboxEvent
+		var payload []byte
+		err := rows.Scan(&e.ID, &e.EventType, &e.AggregateID, &payload, &e.CreatedAt, &e.Claims, &e.FirstClaimedAt,
+			pq.Array(&e.Delivered))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered records delivery of the event to one destination
+func (s *Storage) MarkOutboxDelivered(ctx context.Context, eventID int64, destination string) error {
+	const op = "storage.MarkOutboxDelivered"
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO outbox_deliveries (event_id, destination) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		eventID, destination)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// MarkOutboxPublished marks the event as delivered to all its destinations
+func (s *Storage) MarkOutboxPublished(ctx context.Context, eventID int64) error {
+	const op = "storage.MarkOutboxPublished"
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
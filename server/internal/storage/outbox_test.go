@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimOutboxEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	created := time.Now()
+	mock.ExpectQuery("UPDATE outbox SET locked_until.*FOR UPDATE SKIP LOCKED").WithArgs(10, 30.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "created_at", "claims", "first_claimed_at", "delivered"}).
+			AddRow(1, "order_saved", "uid1", []byte(`{}`), created, 2, created, "{kafka}").
+			AddRow(2, "order_saved", "uid2", []byte(`{}`), created, 1, created, "{}"))
+
+	events, err := storage.ClaimOutboxEvents(context.Background(), 10, 30*time.Second)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, []string{"kafka"}, events[0].Delivered)
+	require.Empty(t, events[1].Delivered)
+	require.Equal(t, 2, events[0].Claims)
+	require.Equal(t, created, events[0].FirstClaimedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CreateOrderPartitions creates the partitions of the month of the orders tables, a no-op if they exist.
+// Orders of the month already stored in the default partitions are moved into the new ones.
+func (s *Storage) CreateOrderPartitions(ctx context.Context, month time.Time) error {
+	const op = "storage.CreateOrderPartitions"
+	if _, err := s.db.ExecContext(ctx, `SELECT create_order_partitions($1)`, month.Format(time.DateOnly)); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// hitsKey is the ZSET of order UIDs scored by read count, kept for the frequent preload policy
+	hitsKey = "orders:hits"
+	// hitsKeep bounds hitsKey to this many cache limits of the most read orders
+	hitsKeep = 10
+	// preloadPage is the page size of the full-table preload
+	preloadPage = 1000
+	// preloadChunk is how many orders one Redis pipeline of the preload writes
+	preloadChunk = 100
+)
+
+// preloadCache warms up the cache according to redis.preload_policy:
+// - none: nothing is loaded
+// - recent (default): the newest orders up to the cache limit, within PreloadWindow if set
+// - frequent: the most read orders counted while the policy is on
+// - all: every stored order, page by page
+//
+// Soft-deleted orders are skipped. The warm-up stops when ctx is done, individual
+// scan/load errors are logged but don't stop the process.
+func (s *Storage) preloadCache(ctx context.Context) error {
+	start := time.Now()
+	var loaded int
+	switch s.cache().PreloadPolicy {
+	case models.PreloadNone:
+		return nil
+	case models.PreloadFrequent:
+		orderUids, err := s.frequentOrderUIDs(ctx)
+		if err != nil {
+			return err
+		}
+		loaded = s.batchPreload(ctx, orderUids, true)
+	case models.PreloadAll:
+		var err error
+		if loaded, err = s.preloadAll(ctx); err != nil {
+			return err
+		}
+	default:
+		orderUids, err := s.recentOrderUIDs(ctx)
+		if err != nil {
+			return err
+		}
+		loaded = s.batchPreload(ctx, orderUids, true)
+	}
+	metrics.CachePreloadDuration.Set(time.Since(start).Seconds())
+	if ctx.Err() != nil {
+		logger.Warn("preload stopped by the deadline", "loaded", loaded, logging.Duration("elapsed", time.Since(start)))
+		return nil
+	}
+	logger.Info("preload finished", "loaded", loaded, logging.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// recentOrderUIDs selects the most recent order UIDs to preload from PostgreSQL.
+// Both queries walk idx_orders_date_created_uid.
+func (s *Storage) recentOrderUIDs(ctx context.Context) (_ []string, err error) {
+	const op = "storage.preloadCache"
+	defer s.observeQuery(opPreload, time.Now(), &err)
+	var rows *sql.Rows
+	if window := s.cache().PreloadWindow; window > 0 {
+		rows, err = s.db.QueryContext(ctx, `SELECT o.order_uid FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL
+	WHERE o.date_created >= $1 ORDER BY o.date_created DESC LIMIT $2`,
+			time.Now().Add(-window), s.cacheLimit())
+	} else {
+		rows, err = s.db.QueryContext(ctx, `SELECT o.order_uid FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL
+	ORDER BY o.date_created DESC LIMIT $1`, s.cacheLimit())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return scanOrderUIDs(op, rows)
+}
+
+// frequentOrderUIDs returns the most read orders up to the cache limit and trims the read counters
+func (s *Storage) frequentOrderUIDs(ctx context.Context) ([]string, error) {
+	const op = "storage.preloadCache"
+	limit := int64(s.cacheLimit())
+	uids, err := s.redis.ZRevRange(ctx, hitsKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := s.redis.ZRemRangeByRank(ctx, hitsKey, 0, -hitsKeep*limit-1).Err(); err != nil {
+		logger.Warn("failed to trim read counters", "op", op, logging.Err(err))
+	}
+	return uids, nil
+}
+
+// countRead counts a read of the order for the frequent preload policy
+func (s *Storage) countRead(ctx context.Context, orderUID string) {
+	if s.cache().PreloadPolicy != models.PreloadFrequent {
+		return
+	}
+	if err := s.redis.ZIncrBy(ctx, hitsKey, 1, orderUID).Err(); err != nil {
+		logger.Warn("failed to count read of order", "order_uid", orderUID, logging.Err(err))
+	}
+}
+
+// preloadAll loads every stored order, paging through order_keys by its primary key
+func (s *Storage) preloadAll(ctx context.Context) (loaded int, err error) {
+	const op = "storage.preloadCache"
+	after := ""
+	for ctx.Err() == nil {
+		var uids []string
+		err = func() (err error) {
+			defer s.observeQuery(opPreload, time.Now(), &err)
+			rows, err := s.db.QueryContext(ctx, `SELECT order_uid FROM order_keys
+	WHERE deleted_at IS NULL AND order_uid > $1 ORDER BY order_uid LIMIT $2`, after, preloadPage)
+			if err != nil {
+				return fmt.Errorf("%s: %v", op, err)
+			}
+			uids, err = scanOrderUIDs(op, rows)
+			return err
+		}()
+		if err != nil {
+			return loaded, err
+		}
+		loaded += s.batchPreload(ctx, uids, false)
+		if len(uids) < preloadPage {
+			break
+		}
+		after = uids[len(uids)-1]
+		logger.Info("preload progress", "loaded", loaded)
+	}
+	return loaded, nil
+}
+
+func scanOrderUIDs(op string, rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	orderUids := make([]string, 0)
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			logger.Warn("failed to scan order uid", "op", op, logging.Err(err))
+			continue
+		}
+		orderUids = append(orderUids, uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return orderUids, nil
+}
+
+// batchPreload efficiently preloads multiple orders into Redis.
+// Features:
+// -Reads the orders from the database with concurrent workers, limited by a semaphore
+// (max redis.preload_concurrency goroutines)
+// -Writes them to Redis in pipelines of preloadChunk orders and trims the cache once at the end,
+// so 1000 orders take a handful of round trips
+// -Stops starting new reads when ctx is done
+// -Logs the progress after every pipeline if logProgress
+//
+// Errors are logged per-order or per-pipeline but don't stop the batch. It returns the number of cached orders.
+func (s *Storage) batchPreload(ctx context.Context, uids []string, logProgress bool) int {
+	size := s.cache().PreloadConcurrency
+	if size <= 0 {
+		size = defaultPreloadConcurrency
+	}
+	orders := make(chan *models.Order, size)
+	go func() {
+		defer close(orders)
+		sem := make(chan struct{}, size)
+		wg := &sync.WaitGroup{}
+		defer wg.Wait()
+		for _, uid := range uids {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(uid string) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				//select order from PostgreSQL
+				order, err := s.getFromDB(ctx, uid)
+				if err != nil {
+					logger.Warn("preload failed to read order", "order_uid", uid, logging.Err(err))
+					return
+				}
+				orders <- order
+			}(uid)
+		}
+	}()
+
+	loaded := 0
+	batch := make([]*models.Order, 0, preloadChunk)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		//save orders in redis
+		if err := s.cacheOrders(ctx, batch); err != nil {
+			logger.Warn("preload failed to cache orders", "orders", len(batch), logging.Err(err))
+		} else {
+			loaded += len(batch)
+		}
+		if logProgress {
+			logger.Info("preload progress", "loaded", loaded, "total", len(uids))
+		}
+		batch = batch[:0]
+	}
+	for order := range orders {
+		if batch = append(batch, order); len(batch) == preloadChunk {
+			flush()
+		}
+	}
+	flush()
+	if loaded > 0 {
+		if err := s.trimCache(ctx, s.accessScore()); err != nil {
+			logger.Warn("preload failed to trim the cache", logging.Err(err))
+		}
+	}
+	return loaded
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreloadCachePolicies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+
+	t.Run("none", func(t *testing.T) {
+		storage := &Storage{db: db, redis: rdb, cacheCfg: models.Redis{PreloadPolicy: models.PreloadNone}}
+		require.NoError(t, storage.preloadCache(context.Background()))
+	})
+
+	t.Run("frequent", func(t *testing.T) {
+		storage := &Storage{db: db, redis: rdb, cacheCfg: models.Redis{PreloadPolicy: models.PreloadFrequent, CacheLimit: 2}}
+		redisMock.ExpectZRevRange(hitsKey, 0, 1).SetVal([]string{"hot"})
+		redisMock.ExpectZRemRangeByRank(hitsKey, 0, -21).SetVal(0)
+		mock.ExpectQuery("SELECT.*FROM orders o").WithArgs("hot", false).WillReturnError(sql.ErrNoRows)
+
+		require.NoError(t, storage.preloadCache(context.Background()))
+	})
+
+	t.Run("all", func(t *testing.T) {
+		storage := &Storage{db: db, redis: rdb, cacheCfg: models.Redis{PreloadPolicy: models.PreloadAll}}
+		mock.ExpectQuery("SELECT order_uid FROM order_keys").WithArgs("", preloadPage).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("uid1"))
+		mock.ExpectQuery("SELECT.*FROM orders o").WithArgs("uid1", false).WillReturnError(sql.ErrNoRows)
+
+		require.NoError(t, storage.preloadCache(context.Background()))
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		storage := &Storage{db: db, redis: rdb, cacheCfg: models.Redis{PreloadPolicy: models.PreloadFrequent}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		redisMock.ExpectZRevRange(hitsKey, 0, defaultCacheLimit-1).SetVal([]string{"hot"})
+		redisMock.ExpectZRemRangeByRank(hitsKey, 0, -hitsKeep*defaultCacheLimit-1).SetVal(0)
+
+		// nothing is loaded after the deadline
+		require.NoError(t, storage.preloadCache(ctx))
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestCountRead(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	storage := &Storage{redis: rdb, cacheCfg: models.Redis{PreloadPolicy: models.PreloadFrequent}}
+
+	mock.ExpectZIncrBy(hitsKey, 1, "test123").SetVal(1)
+	storage.countRead(context.Background(), "test123")
+
+	// reads are counted only for the frequent policy
+	storage.cacheCfg.PreloadPolicy = models.PreloadRecent
+	storage.countRead(context.Background(), "test123")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheOrders(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	now := time.UnixMilli(1700000000000)
+	storage := &Storage{redis: rdb, now: func() time.Time { return now }, local: newLocalCache(10, time.Minute)}
+	orders := []*models.Order{{OrderUID: "uid1"}, {OrderUID: "uid2"}}
+	score := float64(now.UnixMilli())
+
+	// one pipeline writes the whole chunk
+	for _, order := range orders {
+		data, err := json.Marshal(order)
+		require.NoError(t, err)
+		data = append([]byte{headerMinorUnits}, data...)
+		mock.ExpectSet(order.OrderUID, data, defaultCacheTTL).SetVal("OK")
+	}
+	mock.ExpectZAdd(lruKey, &redis.Z{Score: score, Member: "uid1"}, &redis.Z{Score: score, Member: "uid2"}).SetVal(2)
+	require.NoError(t, storage.cacheOrders(context.Background(), orders))
+	require.NoError(t, mock.ExpectationsWereMet())
+	_, ok := storage.local.get("uid1")
+	require.False(t, ok)
+
+	// a failed pipeline keeps the chunk in the in-process cache
+	data, err := json.Marshal(orders[0])
+	require.NoError(t, err)
+	data = append([]byte{headerMinorUnits}, data...)
+	mock.ExpectSet("uid1", data, defaultCacheTTL).SetErr(errors.New("connection refused"))
+	require.Error(t, storage.cacheOrders(context.Background(), orders[:1]))
+	_, ok = storage.local.get("uid1")
+	require.True(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"errors"
+	"time"
+)
+
+// operation labels of the query metrics
+const (
+	opSaveOrder    = "save_order"
+	opUpdateOrder  = "update_order"
+	opGetOrder     = "get_order"
+	opPreload      = "preload"
+	opListOrders   = "list_orders"
+	opCountOrders  = "count_orders"
+	opOrderExists  = "order_exists"
+	opSearchOrders = "search_orders"
+	opSearchItems  = "search_items"
+	opOrderStatus  = "order_status"
+	opClaimOutbox  = "claim_outbox"
+	opCustomer     = "customer_orders"
+	opTopCustomers = "top_customers"
+	opRevenue      = "revenue"
+	opTopItems     = "top_items"
+)
+
+// observeQuery records the latency of the operation started at start and logs it if slow.
+// It is deferred with the address of the named error result: defer s.observeQuery(op, time.Now(), &err)
+func (s *Storage) observeQuery(op string, start time.Time, err *error) {
+	elapsed := time.Since(start)
+	result := "ok"
+	switch {
+	case *err == nil:
+	case errors.Is(*err, models.ErrNotFound):
+		result = "not_found"
+	case errors.Is(*err, ErrOrderExists):
+		result = "exists"
+	default:
+		result = "error"
+	}
+	metrics.DBQueryDuration.WithLabelValues(op, result).Observe(elapsed.Seconds())
+	if s.slowQuery > 0 && elapsed >= s.slowQuery {
+		logger.Warn("slow query", "op", op, logging.Duration("elapsed", elapsed), "result", result)
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/metrics"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func querySamples(t *testing.T, op, result string) uint64 {
+	var m dto.Metric
+	h := metrics.DBQueryDuration.WithLabelValues(op, result).(prometheus.Histogram)
+	require.NoError(t, h.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestObserveQuery(t *testing.T) {
+	storage := &Storage{slowQuery: time.Millisecond}
+	notFound := querySamples(t, opGetOrder, "not_found")
+	exists := querySamples(t, opSaveOrder, "exists")
+
+	err := fmt.Errorf("wrapped: %w", ErrOrderNotFound)
+	storage.observeQuery(opGetOrder, time.Now().Add(-time.Second), &err)
+	err = ErrOrderExists
+	storage.observeQuery(opSaveOrder, time.Now(), &err)
+
+	require.Equal(t, notFound+1, querySamples(t, opGetOrder, "not_found"))
+	require.Equal(t, exists+1, querySamples(t, opSaveOrder, "exists"))
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// insertRawOrder keeps the original payload of the order as sent within the caller's transaction,
+// replacing the payload of a replaced order
+func insertRawOrder(ctx context.Context, tx querier, orderUID string, raw models.RawPayload) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO orders_raw (order_uid, payload, schema_version) VALUES ($1, $2, $3)
+	ON CONFLICT (order_uid) DO UPDATE SET payload = EXCLUDED.payload, schema_version = EXCLUDED.schema_version,
+		received_at = now()`, orderUID, []byte(raw.Payload), raw.SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to insert raw order: %w", err)
+	}
+	return nil
+}
+
+// readRawOrder decodes the order from its original payload, ErrOrderNotFound if it has none
+// (e.g. saved before raw orders were enabled)
+func readRawOrder(ctx context.Context, tx querier, orderUID string, includeDeleted bool) (*models.Order, error) {
+	var payload []byte
+	var version int
+	var deletedAt *time.Time
+	err := tx.QueryRowContext(ctx, `SELECT r.payload, r.schema_version, k.deleted_at FROM orders_raw r
+	JOIN order_keys k ON k.order_uid = r.order_uid
+	WHERE r.order_uid = $1 AND ($2 OR k.deleted_at IS NULL)`, orderUID, includeDeleted).Scan(&payload, &version, &deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to get raw order: %v", err)
+	}
+	order, err := decodeRawOrder(models.RawPayload{Payload: payload, SchemaVersion: version})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw order: %v", err)
+	}
+	order.DeletedAt = deletedAt
+	return &order, nil
+}
+
+// decodeRawOrder decodes the order from a payload stored as sent, upgrading it to the current schema version
+func decodeRawOrder(raw models.RawPayload) (models.Order, error) {
+	var order models.Order
+	payload, err := models.UpgradePayload(raw.SchemaVersion, raw.Payload)
+	if err != nil {
+		return order, err
+	}
+	err = json.Unmarshal(payload, &order)
+	return order, err
+}
+
+// RawOrderPayload returns the original payload of the stored order as the producer sent it (JSONB keeps
+// the values, not the formatting) with its schema version: from orders_raw if it is kept there, otherwise
+// from the event log, the first received event with write_mode insert and the last one with upsert, as those
+// are projected; the last update event (UpdateOrder) wins over both.
+// ErrOrderNotFound for a deleted order or one without a payload (saved before the event log)
+func (s *Storage) RawOrderPayload(ctx context.Context, orderUID string) (models.RawPayload, models.RawSource, error) {
+	const op = "storage.RawOrderPayload"
+	var stored, received []byte
+	var storedVersion, receivedVersion sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT r.payload, r.schema_version, e.payload, e.schema_version FROM order_keys k
+	LEFT JOIN orders_raw r ON r.order_uid = k.order_uid
+	LEFT JOIN LATERAL (SELECT l.payload, l.schema_version FROM order_event_log l
+		WHERE l.order_uid = k.order_uid AND l.event_type IN ($2, $4)
+		ORDER BY CASE WHEN $3 OR l.event_type = $4 THEN -l.id ELSE l.id END LIMIT 1) e ON true
+	WHERE k.order_uid = $1 AND k.deleted_at IS NULL`,
+		orderUID, models.OrderEventReceived, s.writeMode == models.WriteUpsert, models.OrderEventUpdated).
+		Scan(&stored, &storedVersion, &received, &receivedVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RawPayload{}, "", fmt.Errorf("%s: %w", op, ErrOrderNotFound)
+		}
+		return models.RawPayload{}, "", fmt.Errorf("%s: %v", op, err)
+	}
+	switch {
+	case stored != nil:
+		return models.RawPayload{Payload: stored, SchemaVersion: int(storedVersion.Int64)}, models.RawFromOrders, nil
+	case received != nil:
+		return models.RawPayload{Payload: received, SchemaVersion: int(receivedVersion.Int64)}, models.RawFromEventLog, nil
+	}
+	return models.RawPayload{}, "", fmt.Errorf("%s: %w", op, ErrOrderNotFound)
+}
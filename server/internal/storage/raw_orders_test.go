@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveOrderRawPayload(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db, rawOrders: models.RawStore}
+
+	raw := models.RawPayload{Payload: []byte(`{"order_uid":"test123","unknown_field":1}`), SchemaVersion: 1}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders_raw").WithArgs("test123", []byte(raw.Payload), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_status_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, storage.SaveOrderRaw(context.Background(), models.Order{OrderUID: "test123"}, raw))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFromDBServesRawPayload(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db, rawOrders: models.RawServe}
+
+	t.Run("one query", func(t *testing.T) {
+		mock.ExpectQuery("SELECT r.payload, r.schema_version, k.deleted_at FROM orders_raw").WithArgs("test123", false).
+			WillReturnRows(sqlmock.NewRows([]string{"payload", "schema_version", "deleted_at"}).
+				AddRow([]byte(`{"order_uid":"test123","delivery":{"name":"Test User"},"payment":{"currency":"USD","amount":1817},
+					"items":[{"name":"a","price":453}]}`), 1, nil))
+
+		order, err := storage.getFromDB(context.Background(), "test123")
+		require.NoError(t, err)
+		require.Equal(t, "Test User", order.Delivery.Name)
+		require.Len(t, order.Items, 1)
+		// the payload is stored as sent and upgraded on read
+		require.Equal(t, models.NewMoney(181700, "USD"), order.Payment.Amount)
+		require.Equal(t, models.NewMoney(45300, "USD"), order.Items[0].Price)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no payload falls back to the tables", func(t *testing.T) {
+		mock.ExpectQuery("SELECT r.payload, r.schema_version, k.deleted_at FROM orders_raw").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT.*FROM orders").WillReturnError(sql.ErrNoRows)
+
+		_, err := storage.getFromDB(context.Background(), "test123")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRawOrderPayload(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db, writeMode: models.WriteUpsert}
+	columns := []string{"stored", "stored_version", "received", "received_version"}
+	query := "SELECT r.payload, r.schema_version, e.payload, e.schema_version FROM order_keys k"
+
+	mock.ExpectQuery(query).WithArgs("test123", models.OrderEventReceived, true, models.OrderEventUpdated).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow([]byte(`{"order_uid":"test123","extra":1}`), 2, []byte(`{"order_uid":"test123"}`), 1))
+	raw, source, err := storage.RawOrderPayload(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, models.RawFromOrders, source)
+	require.JSONEq(t, `{"order_uid":"test123","extra":1}`, string(raw.Payload))
+	require.Equal(t, 2, raw.SchemaVersion)
+
+	// without orders_raw the payload comes from the event log
+	mock.ExpectQuery(query).WithArgs("test123", models.OrderEventReceived, true, models.OrderEventUpdated).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, nil, []byte(`{"order_uid":"test123"}`), 1))
+	raw, source, err = storage.RawOrderPayload(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, models.RawFromEventLog, source)
+	require.JSONEq(t, `{"order_uid":"test123"}`, string(raw.Payload))
+	require.Equal(t, 1, raw.SchemaVersion)
+
+	mock.ExpectQuery(query).WithArgs("old", models.OrderEventReceived, true, models.OrderEventUpdated).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, nil, nil, nil))
+	_, _, err = storage.RawOrderPayload(context.Background(), "old")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+
+	mock.ExpectQuery(query).WithArgs("missing", models.OrderEventReceived, true, models.OrderEventUpdated).WillReturnError(sql.ErrNoRows)
+	_, _, err = storage.RawOrderPayload(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	replicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout  = 2 * time.Second
+)
+
+// replica is a read-only PostgreSQL server; reads skip it while its health check fails
+type replica struct {
+	name    string
+	db      *sql.DB
+	stmts   *stmtCache
+	healthy atomic.Bool
+}
+
+// replicaSet spreads order reads over the healthy replicas round-robin
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+}
+
+// newReplicaSet opens the replicas and starts their health checks; an unreachable replica
+// is kept and starts serving reads once it answers
+func newReplicaSet(dsns []string) (*replicaSet, error) {
+	if len(dsns) == 0 {
+		return nil, nil
+	}
+	rs := &replicaSet{stop: make(chan struct{})}
+	for i, dsn := range dsns {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			rs.Close()
+			return nil, fmt.Errorf("replica %d: %v", i+1, err)
+		}
+		r := &replica{name: fmt.Sprintf("replica-%d", i+1), db: db, stmts: newStmtCache(db)}
+		rs.replicas = append(rs.replicas, r)
+	}
+	rs.check()
+	go rs.watch()
+	return rs, nil
+}
+
+// pick returns the next healthy replica, nil if there is none
+func (rs *replicaSet) pick() *replica {
+	if rs == nil {
+		return nil
+	}
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (rs *replicaSet) watch() {
+	t := time.NewTicker(replicaCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-t.C:
+			rs.check()
+		}
+	}
+}
+
+func (rs *replicaSet) check() {
+	for _, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		r.setHealthy(err)
+	}
+}
+
+// setHealthy records the result of a check or a failed read, logging state changes
+func (r *replica) setHealthy(err error) {
+	if was := r.healthy.Swap(err == nil); was != (err == nil) {
+		if err != nil {
+			logger.Warn("replica is down, reads go to the primary", "replica", r.name, logging.Err(err))
+		} else {
+			logger.Info("replica is up, serving reads", "replica", r.name)
+		}
+	}
+}
+
+func (rs *replicaSet) Close() error {
+	if rs == nil {
+		return nil
+	}
+	close(rs.stop)
+	for _, r := range rs.replicas {
+		r.stmts.Close()
+		r.db.Close()
+	}
+	return nil
+}
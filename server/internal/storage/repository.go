@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+)
+
+// Repository is the order store behind the Kafka consumer and the order endpoints.
+// Storage (PostgreSQL with the Redis cache) implements it; another backend must return
+// ErrOrderExists for an already stored order_uid and errors wrapping models.ErrNotFound
+// for missing orders, the callers rely on both.
+type Repository interface {
+	SaveOrder(ctx context.Context, order models.Order) error
+	// SaveOrderRaw also keeps raw, the original order payload of the message (out of its envelope) with its
+	// schema version, if the backend supports it
+	SaveOrderRaw(ctx context.Context, order models.Order, raw models.RawPayload) error
+	// SaveOrderAt also stores the offset of the consumed message with the order and returns ErrOffsetApplied
+	// for a message at or before the stored offset of its partition; the offset of a duplicate order
+	// is stored too, before ErrOrderExists is returned
+	SaveOrderAt(ctx context.Context, order models.Order, raw models.RawPayload, at models.MessageOffset) error
+	// UpdateOrder replaces a stored order as a whole, ErrOrderNotFound if it isn't stored
+	UpdateOrder(ctx context.Context, order models.Order) error
+	SaveConsumerOffset(ctx context.Context, at models.MessageOffset) error
+	ConsumerOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+	ResetConsumerOffsets(ctx context.Context, group, topic string, next map[int]int64) error
+	GetOrder(ctx context.Context, orderUID string) (*models.Order, models.OrderSource, error)
+	ListOrders(ctx context.Context, f models.OrderFilter, limit int, after *models.OrderCursor) (*models.OrderPage, error)
+	CountOrders(ctx context.Context, f models.OrderFilter) (int64, error)
+	OrderExists(ctx context.Context, orderUID string) (bool, error)
+	SaveFailedMessage(ctx context.Context, m models.FailedMessage) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ Repository = (*Storage)(nil)
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/tracing"
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// Postgres aborts one of the conflicting transactions with these codes, rerunning it usually succeeds
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+
+	txRetryBackoff = 20 * time.Millisecond
+)
+
+// isRetryable reports whether the transaction was aborted by a serialization failure or deadlock
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+// retryTx runs fn, a whole write transaction, and reruns it up to s.txRetries times while
+// Postgres aborts it as a serialization failure or deadlock. The jittered backoff keeps
+// the conflicting writers from colliding again. The attempts run in one span named name.
+func (s *Storage) retryTx(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(semconv.DBSystemNamePostgreSQL))
+	defer func() { tracing.End(span, err) }()
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !isRetryable(err) || attempt >= s.txRetries {
+			return err
+		}
+		backoff := txRetryBackoff<<attempt + rand.N(txRetryBackoff)
+		logger.Warn("transaction aborted, retrying", logging.Err(err), "retry", attempt+1, "retries", s.txRetries, logging.Duration("backoff", backoff))
+		span.AddEvent("transaction aborted", trace.WithAttributes(attribute.Int("retry", attempt+1), attribute.String("error", err.Error())))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTx(t *testing.T) {
+	storage := &Storage{txRetries: 2}
+	deadlock := fmt.Errorf("failed to insert items: %w", &pq.Error{Code: deadlockDetected})
+
+	calls := 0
+	err := storage.retryTx(context.Background(), "test", func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return deadlock
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// retries are bounded
+	calls = 0
+	err = storage.retryTx(context.Background(), "test", func(context.Context) error {
+		calls++
+		return &pq.Error{Code: serializationFailure}
+	})
+	require.True(t, isRetryable(err))
+	require.Equal(t, 3, calls)
+
+	// other errors are returned at once
+	calls = 0
+	err = storage.retryTx(context.Background(), "test", func(context.Context) error {
+		calls++
+		return ErrOrderExists
+	})
+	require.ErrorIs(t, err, ErrOrderExists)
+	require.Equal(t, 1, calls)
+	require.False(t, isRetryable(errors.New("40001")))
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Revenue sums the payments of the orders matching q per period and currency (and provider with q.ByProvider),
+// oldest period first. The amounts are summed in PostgreSQL, the date range prunes the payments partitions
+// and idx_payments_revenue covers the grouped columns. Soft-deleted orders are left out; a healthy replica
+// serves the report if configured.
+func (s *Storage) Revenue(ctx context.Context, q models.RevenueQuery) (_ []models.RevenueRow, err error) {
+	const op = "storage.Revenue"
+	defer s.observeQuery(opRevenue, time.Now(), &err)
+	switch q.Period {
+	case models.PeriodDay, models.PeriodWeek, models.PeriodMonth:
+	default:
+		return nil, fmt.Errorf("%s: unknown period %q", op, q.Period)
+	}
+	groups := "p.currency"
+	if q.ByProvider {
+		groups += ", p.provider"
+	}
+	args := []any{q.Period}
+	var where []string
+	if !q.From.IsZero() {
+		args = append(args, q.From)
+		where = append(where, fmt.Sprintf("p.date_created >= $%d", len(args)))
+	}
+	if !q.To.IsZero() {
+		args = append(args, q.To)
+		where = append(where, fmt.Sprintf("p.date_created < $%d", len(args)))
+	}
+	query := `SELECT date_trunc($1, p.date_created AT TIME ZONE 'UTC') AS period, ` + groups + `, count(*), sum(p.amount)
+	FROM payments p
+	JOIN order_keys k ON k.order_uid = p.order_uid AND k.deleted_at IS NULL`
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, " AND ")
+	}
+	query += "\n\tGROUP BY period, " + groups + "\n\tORDER BY period, " + groups
+
+	if r := s.replicas.pick(); r != nil {
+		rows, err := revenue(ctx, r.db, query, args, q.ByProvider)
+		if err == nil {
+			return rows, nil
+		}
+		logger.Warn("replica read failed, using the primary", "op", op, "replica", r.name, logging.Err(err))
+	}
+	rows, err := revenue(ctx, s.db, query, args, q.ByProvider)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return rows, nil
+}
+
+func revenue(ctx context.Context, db *sql.DB, query string, args []any, byProvider bool) ([]models.RevenueRow, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := make([]models.RevenueRow, 0)
+	for rows.Next() {
+		var r models.RevenueRow
+		dest := []any{&r.Period, &r.Amount.Currency}
+		if byProvider {
+			dest = append(dest, &r.Provider)
+		}
+		if err := rows.Scan(append(dest, &r.Orders, &r.Amount.Amount)...); err != nil {
+			return nil, err
+		}
+		r.Period = r.Period.UTC()
+		report = append(report, r)
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevenue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mock.ExpectQuery("SELECT date_trunc\\(\\$1, p.date_created AT TIME ZONE 'UTC'\\) AS period, p.currency, p.provider, count\\(\\*\\), sum\\(p.amount\\)\\s+FROM payments p"+
+		".*WHERE p.date_created >= \\$2 AND p.date_created < \\$3\\s+GROUP BY period, p.currency, p.provider").
+		WithArgs(models.PeriodWeek, from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "currency", "provider", "count", "sum"}).
+			AddRow(from, "RUB", "wbpay", 3, 150000).
+			AddRow(from, "USD", "applepay", 1, 1817))
+	report, err := storage.Revenue(context.Background(), models.RevenueQuery{Period: models.PeriodWeek, ByProvider: true, From: from, To: to})
+	require.NoError(t, err)
+	require.Equal(t, []models.RevenueRow{
+		{Period: from, Provider: "wbpay", Orders: 3, Amount: models.NewMoney(150000, "RUB")},
+		{Period: from, Provider: "applepay", Orders: 1, Amount: models.NewMoney(1817, "USD")},
+	}, report)
+
+	// every currency is a group of its own, the amounts are never summed across them
+	mock.ExpectQuery("AS period, p.currency, count\\(\\*\\).*GROUP BY period, p.currency\\s+ORDER BY period, p.currency$").
+		WithArgs(models.PeriodDay).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "currency", "count", "sum"}).AddRow(from, "EUR", 2, 500))
+	report, err = storage.Revenue(context.Background(), models.RevenueQuery{Period: models.PeriodDay})
+	require.NoError(t, err)
+	require.Equal(t, []models.RevenueRow{{Period: from, Orders: 2, Amount: models.NewMoney(500, "EUR")}}, report)
+
+	_, err = storage.Revenue(context.Background(), models.RevenueQuery{Period: "year"})
+	require.ErrorContains(t, err, `unknown period "year"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
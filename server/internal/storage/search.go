@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// indexSearchQuery (re)builds the search documents of the orders from their stored delivery and items
+const indexSearchQuery = `INSERT INTO order_search (order_uid, document)
+	SELECT d.order_uid, to_tsvector('simple', concat_ws(' ', d.name, d.city, string_agg(i.brand || ' ' || i.name, ' ')))
+	FROM deliveries d
+	LEFT JOIN items i ON i.order_uid = d.order_uid AND i.date_created = d.date_created
+	WHERE d.order_uid = ANY($1)
+	GROUP BY d.order_uid, d.name, d.city
+	ON CONFLICT (order_uid) DO UPDATE SET document = EXCLUDED.document`
+
+// indexOrdersForSearch updates the search documents within the caller's transaction
+func indexOrdersForSearch(ctx context.Context, tx querier, orderUIDs []string) error {
+	if _, err := tx.ExecContext(ctx, indexSearchQuery, pq.Array(orderUIDs)); err != nil {
+		return fmt.Errorf("failed to index order for search: %w", err)
+	}
+	return nil
+}
+
+// SearchOrders finds orders by words of the customer name, city, brands and item names.
+// Every word matches as a prefix, so "nik mosc" finds Nike orders delivered to Moscow.
+// Soft-deleted orders are skipped.
+func (s *Storage) SearchOrders(ctx context.Context, text string, limit, offset int) (_ []models.OrderSearchHit, err error) {
+	const op = "storage.SearchOrders"
+	defer s.observeQuery(opSearchOrders, time.Now(), &err)
+	query := searchQuery(text)
+	if query == "" {
+		return []models.OrderSearchHit{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT s.order_uid, d.name, d.city, k.date_created, ts_rank(s.document, q) AS rank
+	FROM order_search s
+	JOIN order_keys k ON k.order_uid = s.order_uid AND k.deleted_at IS NULL
+	JOIN deliveries d ON d.order_uid = k.order_uid AND d.date_created = k.date_created,
+		to_tsquery('simple', $1) q
+	WHERE s.document @@ q
+	ORDER BY rank DESC, k.date_created DESC
+	LIMIT $2 OFFSET $3`, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+	hits := make([]models.OrderSearchHit, 0)
+	for rows.Next() {
+		var h models.OrderSearchHit
+		if err := rows.Scan(&h.OrderUID, &h.Name, &h.City, &h.DateCreated, &h.Rank); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return hits, nil
+}
+
+// searchQuery turns free text into a tsquery of prefix matches of all its words; characters
+// with a meaning in the tsquery syntax are dropped, so any input is a valid query
+func searchQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// SearchItems returns the items matching the brand and the nm_id of q with the UIDs of their orders, newest
+// orders first; idx_items_brand and idx_items_nm_id serve the filters. Soft-deleted orders are skipped.
+func (s *Storage) SearchItems(ctx context.Context, q models.ItemSearch, limit, offset int) (_ []models.ItemHit, err error) {
+	const op = "storage.SearchItems"
+	defer s.observeQuery(opSearchItems, time.Now(), &err)
+	var where []string
+	var args []any
+	if q.Brand != "" {
+		args = append(args, q.Brand)
+		where = append(where, fmt.Sprintf("lower(i.brand) = lower($%d)", len(args)))
+	}
+	if q.NmID != 0 {
+		args = append(args, q.NmID)
+		where = append(where, fmt.Sprintf("i.nm_id = $%d", len(args)))
+	}
+	if len(where) == 0 {
+		return nil, fmt.Errorf("%s: brand or nm_id is required", op)
+	}
+	args = append(args, limit, offset)
+	rows, err := s.db.QueryContext(ctx, `SELECT i.order_uid, i.date_created, i.chrt_id, i.track_number, i.price, i.rid, i.name,
+		i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+	FROM items i
+	JOIN order_keys k ON k.order_uid = i.order_uid AND k.deleted_at IS NULL
+	WHERE `+strings.Join(where, " AND ")+fmt.Sprintf(`
+	ORDER BY i.date_created DESC, i.order_uid, i.id
+	LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+	hits := make([]models.ItemHit, 0)
+	for rows.Next() {
+		var h models.ItemHit
+		err := rows.Scan(&h.OrderUID, &h.DateCreated, &h.ChrtID, &h.TrackNumber, &h.Price, &h.Rid, &h.Name,
+			&h.Sale, &h.Size, &h.TotalPrice, &h.NmID, &h.Brand, &h.Status)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return hits, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchQuery(t *testing.T) {
+	require.Equal(t, "nike:* & moscow:*", searchQuery("Nike, Moscow"))
+	require.Equal(t, "a:* & b:*", searchQuery("a & !b:*|"))
+	require.Equal(t, "москва:*", searchQuery("  Москва "))
+	require.Equal(t, "", searchQuery("&|!"))
+}
+
+func TestSearchOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	mock.ExpectQuery(`SELECT s.order_uid, d.name, d.city, k.date_created, ts_rank`).
+		WithArgs("nike:*", 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "name", "city", "date_created", "rank"}).
+			AddRow("test123", "Test User", "Moscow", time.Now(), 0.06))
+
+	hits, err := storage.SearchOrders(context.Background(), "Nike", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	require.Equal(t, "test123", hits[0].OrderUID)
+
+	// nothing to search for, no query
+	hits, err = storage.SearchOrders(context.Background(), "!!", 10, 0)
+	require.NoError(t, err)
+	require.Empty(t, hits)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM items i\s+JOIN order_keys k .*\s+WHERE lower\(i.brand\) = lower\(\$1\) AND i.nm_id = \$2\s+ORDER BY i.date_created DESC, i.order_uid, i.id\s+LIMIT \$3 OFFSET \$4`).
+		WithArgs("vivienne sabo", 2389212, 10, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "date_created", "chrt_id", "track_number", "price", "rid", "name",
+			"sale", "size", "total_price", "nm_id", "brand", "status"}).
+			AddRow("test123", at, 9934930, "WBILMTESTTRACK", 453, "ab4219087a764ae0btest", "Mascaras", 30, "0", 317, 2389212, "Vivienne Sabo", 202))
+
+	hits, err := storage.SearchItems(context.Background(), models.ItemSearch{Brand: "vivienne sabo", NmID: 2389212}, 10, 20)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	require.Equal(t, "test123", hits[0].OrderUID)
+	require.Equal(t, "Vivienne Sabo", hits[0].Brand)
+	require.Equal(t, int64(317), hits[0].TotalPrice.Amount)
+
+	_, err = storage.SearchItems(context.Background(), models.ItemSearch{}, 10, 0)
+	require.ErrorContains(t, err, "brand or nm_id is required")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// CopyOrders bulk-loads orders with COPY in one transaction, bypassing Kafka, the cache and the outbox;
+// the search documents are built from the copied rows. The orders are appended to the event log as well,
+// so a rebuild of the order tables keeps them.
+// It is meant for seeding: unlike SaveOrder it fails on an already stored order_uid.
+func (s *Storage) CopyOrders(ctx context.Context, orders []models.Order) error {
+	const op = "storage.CopyOrders"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	payloads := make(map[string][]byte, len(orders))
+	for _, o := range orders {
+		if payloads[o.OrderUID], err = json.Marshal(o); err != nil {
+			return fmt.Errorf("%s: failed to marshal order: %v", op, err)
+		}
+	}
+	err = copyRows(ctx, tx, pq.CopyIn("order_event_log", "order_uid", "event_type", "payload", "schema_version"),
+		orders, func(o models.Order) [][]any {
+			return [][]any{{o.OrderUID, models.OrderEventReceived, string(payloads[o.OrderUID]), models.CurrentSchemaVersion}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: order events: %v", op, err)
+	}
+
+	err = copyRows(ctx, tx, pq.CopyIn("order_keys", "order_uid", "date_created"),
+		orders, func(o models.Order) [][]any {
+			return [][]any{{o.OrderUID, o.DateCreated}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: order keys: %v", op, err)
+	}
+
+	err = copyRows(ctx, tx, pq.CopyIn("orders",
+		"order_uid", "track_number", "entry", "locale", "internal_signature",
+		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard"),
+		orders, func(o models.Order) [][]any {
+			return [][]any{{o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature,
+				o.CustomerID, o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: orders: %v", op, err)
+	}
+
+	err = copyRows(ctx, tx, pq.CopyIn("deliveries",
+		"order_uid", "date_created", "name", "phone", "zip", "city", "address", "region", "email"),
+		orders, func(o models.Order) [][]any {
+			d := o.Delivery
+			return [][]any{{o.OrderUID, o.DateCreated, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: deliveries: %v", op, err)
+	}
+
+	err = copyRows(ctx, tx, pq.CopyIn("payments",
+		"order_uid", "date_created", "transaction", "request_id", "currency", "provider",
+		"amount", "payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"),
+		orders, func(o models.Order) [][]any {
+			p := o.Payment
+			return [][]any{{o.OrderUID, o.DateCreated, p.Transaction, p.RequestID, p.Currency, p.Provider,
+				p.Amount, p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: payments: %v", op, err)
+	}
+
+	err = copyRows(ctx, tx, pq.CopyIn("items",
+		"order_uid", "date_created", "chrt_id", "track_number", "price", "rid", "name",
+		"sale", "size", "total_price", "nm_id", "brand", "status"),
+		orders, func(o models.Order) [][]any {
+			rows := make([][]any, 0, len(o.Items))
+			for _, i := range o.Items {
+				rows = append(rows, []any{o.OrderUID, o.DateCreated, i.ChrtID, i.TrackNumber, i.Price, i.Rid, i.Name,
+					i.Sale, i.Size, i.TotalPrice, i.NmID, i.Brand, i.Status})
+			}
+			return rows
+		})
+	if err != nil {
+		return fmt.Errorf("%s: items: %v", op, err)
+	}
+
+	// seeded orders get status tokens too, so the status page works for them
+	tokens := make(map[string]string, len(orders))
+	for _, o := range orders {
+		if tokens[o.OrderUID], err = newStatusToken(); err != nil {
+			return fmt.Errorf("%s: failed to generate status token: %v", op, err)
+		}
+	}
+	err = copyRows(ctx, tx, pq.CopyIn("order_status_tokens", "token", "order_uid"),
+		orders, func(o models.Order) [][]any {
+			return [][]any{{tokens[o.OrderUID], o.OrderUID}}
+		})
+	if err != nil {
+		return fmt.Errorf("%s: status tokens: %v", op, err)
+	}
+
+	uids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		uids = append(uids, o.OrderUID)
+	}
+	if _, err = tx.ExecContext(ctx, indexSearchQuery, pq.Array(uids)); err != nil {
+		return fmt.Errorf("%s: search index: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	s.addToBloom(ctx, uids...)
+	return nil
+}
+
+// copyRows streams the rows of every order into a COPY statement
+func copyRows(ctx context.Context, tx *sql.Tx, query string, orders []models.Order, rows func(models.Order) [][]any) error {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, o := range orders {
+		for _, row := range rows(o) {
+			if _, err := stmt.ExecContext(ctx, row...); err != nil {
+				return err
+			}
+		}
+	}
+	// the final Exec without arguments flushes the COPY buffer
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
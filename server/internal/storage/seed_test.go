@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	orders := []models.Order{
+		{OrderUID: "uid1", Items: []models.Item{{Name: "a"}, {Name: "b"}}},
+		{OrderUID: "uid2", Items: []models.Item{{Name: "c"}}},
+	}
+	// rows per table: events, order keys, orders, deliveries, payments, items, status tokens
+	tables := []struct {
+		name string
+		rows int
+	}{{"order_event_log", 2}, {"order_keys", 2}, {"orders", 2}, {"deliveries", 2}, {"payments", 2}, {"items", 3}, {"order_status_tokens", 2}}
+
+	mock.ExpectBegin()
+	for _, table := range tables {
+		prep := mock.ExpectPrepare(`COPY "` + table.name + `"`)
+		for i := 0; i < table.rows; i++ {
+			prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		// flush
+		prep.ExpectExec().WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("INSERT INTO order_search").WithArgs(`{"uid1","uid2"}`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	require.NoError(t, storage.CopyOrders(context.Background(), orders))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"fmt"
+)
+
+// SoftDeleteOrder marks the order as deleted: its rows are kept for audits, but reads and the status page
+// no longer find it and the cached copy is dropped. Deleting an already deleted order keeps the first deleted_at.
+func (s *Storage) SoftDeleteOrder(ctx context.Context, orderUID string) error {
+	const op = "storage.SoftDeleteOrder"
+	if err := s.setDeletedAt(ctx, orderUID, models.OrderEventDeleted, `UPDATE order_keys SET deleted_at = COALESCE(deleted_at, now()) WHERE order_uid = $1`); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.invalidateOrder(ctx, orderUID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// RestoreOrder clears the soft delete of the order
+func (s *Storage) RestoreOrder(ctx context.Context, orderUID string) error {
+	const op = "storage.RestoreOrder"
+	if err := s.setDeletedAt(ctx, orderUID, models.OrderEventRestored, `UPDATE order_keys SET deleted_at = NULL WHERE order_uid = $1`); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// every mutation goes through the same cache hook
+	if err := s.invalidateOrder(ctx, orderUID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// GetStoredOrder reads the order from PostgreSQL bypassing the cache; includeDeleted also returns
+// soft-deleted orders (with DeletedAt set)
+func (s *Storage) GetStoredOrder(ctx context.Context, orderUID string, includeDeleted bool) (*models.Order, error) {
+	return s.lookupOrder(ctx, orderUID, includeDeleted)
+}
+
+// setDeletedAt runs the update of deleted_at and appends its event to the order event log in one transaction
+func (s *Storage) setDeletedAt(ctx context.Context, orderUID, eventType, query string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, query, orderUID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrOrderNotFound
+	}
+	if err := appendOrderEvent(ctx, tx, orderUID, eventType, models.RawPayload{SchemaVersion: models.CurrentSchemaVersion}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeleteOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+	storage := &Storage{db: db, redis: rdb}
+
+	t.Run("deleted", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE order_keys SET deleted_at = COALESCE\(deleted_at, now\(\)\)`).WithArgs("test123").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// the change is recorded in the event log
+		mock.ExpectExec("INSERT INTO order_event_log").WithArgs("test123", "order_deleted", nil, models.CurrentSchemaVersion, nil, nil, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectTxPipeline()
+		redisMock.ExpectDel("test123").SetVal(1)
+		redisMock.ExpectZRem(lruKey, "test123").SetVal(1)
+		redisMock.ExpectTxPipelineExec()
+
+		require.NoError(t, storage.SoftDeleteOrder(context.Background(), "test123"))
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE order_keys SET deleted_at").WithArgs("missing").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, storage.SoftDeleteOrder(context.Background(), "missing"), ErrOrderNotFound)
+	})
+
+	t.Run("restored", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE order_keys SET deleted_at = NULL").WithArgs("test123").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO order_event_log").WithArgs("test123", "order_restored", nil, models.CurrentSchemaVersion, nil, nil, nil).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectTxPipeline()
+		redisMock.ExpectDel("test123").SetVal(1)
+		redisMock.ExpectZRem(lruKey, "test123").SetVal(1)
+		redisMock.ExpectTxPipelineExec()
+
+		require.NoError(t, storage.RestoreOrder(context.Background(), "test123"))
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxCachedStatements bounds the statement cache. The queries run through it have fixed texts (the items
+// of an order are inserted from arrays, see itemsInsertQuery), the bound only guards against a query built
+// per call, which is executed without preparing once the cache is full.
+const maxCachedStatements = 64
+
+// stmtCache prepares every query once on the pool. database/sql re-prepares a statement lazily on
+// each pool connection it runs on and reuses it there afterwards, including inside transactions.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get returns the prepared statement of query, nil if it can't be prepared or the cache is full
+func (c *stmtCache) get(ctx context.Context, query string) *sql.Stmt {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt
+	}
+	if len(c.stmts) >= maxCachedStatements {
+		return nil
+	}
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		logger.Warn("failed to prepare statement, running it unprepared", logging.Err(err))
+		return nil
+	}
+	c.stmts[query] = stmt
+	return stmt
+}
+
+func (c *stmtCache) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for query, stmt := range c.stmts {
+		stmt.Close()
+		delete(c.stmts, query)
+	}
+	return nil
+}
+
+// querier is the part of *sql.Tx used by the write and read paths
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// stmtTx runs the queries of a transaction through the statement cache
+type stmtTx struct {
+	*sql.Tx
+	cache *stmtCache
+}
+
+// withStatements wraps tx so that its queries use prepared statements of cache (prepared on the same pool)
+func withStatements(tx *sql.Tx, cache *stmtCache) querier {
+	if cache == nil {
+		return tx
+	}
+	return stmtTx{Tx: tx, cache: cache}
+}
+
+func (t stmtTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := t.cache.get(ctx, query); stmt != nil {
+		return t.Tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	}
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (t stmtTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := t.cache.get(ctx, query); stmt != nil {
+		return t.Tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+	}
+	return t.Tx.QueryContext(ctx, query, args...)
+}
+
+func (t stmtTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := t.cache.get(ctx, query); stmt != nil {
+		return t.Tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	}
+	return t.Tx.QueryRowContext(ctx, query, args...)
+}
+
+// poolStatements runs queries outside a transaction through the statement cache of the same pool
+func poolStatements(db *sql.DB, cache *stmtCache) querier {
+	return stmtDB{DB: db, cache: cache}
+}
+
+// stmtDB is stmtTx for queries run on the pool without a transaction
+type stmtDB struct {
+	*sql.DB
+	cache *stmtCache
+}
+
+func (d stmtDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := d.cache.get(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return d.DB.ExecContext(ctx, query, args...)
+}
+
+func (d stmtDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := d.cache.get(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return d.DB.QueryContext(ctx, query, args...)
+}
+
+func (d stmtDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := d.cache.get(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
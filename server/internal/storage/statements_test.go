@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStmtCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	cache := newStmtCache(db)
+	ctx := context.Background()
+
+	mock.ExpectPrepare("DELETE FROM items")
+	first := cache.get(ctx, "DELETE FROM items WHERE order_uid = $1")
+	require.NotNil(t, first)
+	require.Same(t, first, cache.get(ctx, "DELETE FROM items WHERE order_uid = $1"))
+
+	// a full cache runs new queries unprepared
+	for i := len(cache.stmts); i < maxCachedStatements; i++ {
+		query := fmt.Sprintf("SELECT %d", i)
+		mock.ExpectPrepare(query)
+		require.NotNil(t, cache.get(ctx, query))
+	}
+	require.Nil(t, cache.get(ctx, "SELECT 'one more'"))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	var disabled *stmtCache
+	require.Nil(t, disabled.get(ctx, "SELECT 1"))
+}
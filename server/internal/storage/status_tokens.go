@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// statusTokenBytes gives 16 base32 characters (80 random bits)
+const statusTokenBytes = 10
+
+// ErrStatusTokenNotFound is returned when no order has the requested status token
+var ErrStatusTokenNotFound = fmt.Errorf("status token %w", models.ErrNotFound)
+
+func newStatusToken() (string, error) {
+	buf := make([]byte, statusTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buf)), nil
+}
+
+// insertStatusToken generates the public status token of the order within the caller's transaction
+func insertStatusToken(ctx context.Context, tx querier, orderUID string) (string, error) {
+	token, err := newStatusToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate status token: %v", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO order_status_tokens (token, order_uid) VALUES ($1, $2)`, token, orderUID)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert status token: %w", err)
+	}
+	return token, nil
+}
+
+// existingStatusToken returns the token of an already stored order, creating one for orders saved before tokens existed
+func existingStatusToken(ctx context.Context, tx querier, orderUID string) (string, error) {
+	var token string
+	err := tx.QueryRowContext(ctx,
+		`SELECT token FROM order_status_tokens WHERE order_uid = $1`, orderUID).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return insertStatusToken(ctx, tx, orderUID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read status token: %w", err)
+	}
+	return token, nil
+}
+
+// GetOrderStatus returns the PII-light status view of the order with the status token
+func (s *Storage) GetOrderStatus(ctx context.Context, token string) (_ *models.OrderStatusView, err error) {
+	const op = "storage.GetOrderStatus"
+	defer s.observeQuery(opOrderStatus, time.Now(), &err)
+	var view models.OrderStatusView
+	var orderUID string
+	err = s.db.QueryRowContext(ctx, `SELECT
+		o.order_uid, o.track_number, o.delivery_service, o.date_created, p.amount, p.currency
+	FROM order_status_tokens t
+	JOIN order_keys k ON k.order_uid = t.order_uid AND k.deleted_at IS NULL
+	JOIN orders o ON o.order_uid = k.order_uid AND o.date_created = k.date_created
+	JOIN payments p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+	WHERE t.token = $1`, token,
+	).Scan(&orderUID, &view.TrackNumber, &view.DeliveryService, &view.DateCreated, &view.Amount, &view.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStatusTokenNotFound
+		}
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	view.AmountFormatted = models.NewMoney(view.Amount, view.Currency).String()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, status FROM items WHERE order_uid = $1 AND date_created = $2 ORDER BY id`,
+		orderUID, view.DateCreated)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+	view.Items = make([]models.ItemStatusView, 0)
+	for rows.Next() {
+		var item models.ItemStatusView
+		if err := rows.Scan(&item.Name, &item.Status); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		view.Items = append(view.Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return &view, nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStatusToken(t *testing.T) {
+	a, err := newStatusToken()
+	require.NoError(t, err)
+	b, err := newStatusToken()
+	require.NoError(t, err)
+	require.Len(t, a, 16)
+	require.NotEqual(t, a, b)
+}
+
+func TestGetOrderStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	created := time.Now()
+	mock.ExpectQuery("SELECT.*FROM order_status_tokens").WithArgs("tok").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "track_number", "delivery_service", "date_created", "amount", "currency"}).
+			AddRow("uid1", "WBIL12345678", "dhl", created, 1500, "USD"))
+	mock.ExpectQuery("SELECT name, status FROM items").WithArgs("uid1", created).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "status"}).AddRow("Mascaras", 202))
+
+	view, err := storage.GetOrderStatus(context.Background(), "tok")
+	require.NoError(t, err)
+	require.Equal(t, "dhl", view.DeliveryService)
+	require.Equal(t, []models.ItemStatusView{{Name: "Mascaras", Status: 202}}, view.Items)
+
+	mock.ExpectQuery("SELECT.*FROM order_status_tokens").WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetOrderStatus(context.Background(), "missing")
+	require.ErrorIs(t, err, models.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
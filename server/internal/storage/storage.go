@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"WB_LVL0/server/internal/logging"
 	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -11,23 +13,55 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"log"
-	"sync"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	migrationPath = "file://migrations"
-	//migrationPath = "file://server/migrations" -- local
-)
+var logger = logging.Component("storage")
 
+// defaultMigrationsPath is the migrations source when database.migrations_path is unset
+const defaultMigrationsPath = "file://migrations"
+
+// defaults of the cache settings left unset in models.Redis
 const (
-	cacheLimit = 1000
+	defaultCacheLimit         = 1000
+	defaultCacheTTL           = 72 * time.Hour
+	defaultPreloadConcurrency = 50
+	defaultPreloadTimeout     = 30 * time.Second
 )
 
+// ErrOrderExists is returned by SaveOrder when an order with the same order_uid is already stored
+var ErrOrderExists = errors.New("order already exists")
+
+// ErrOrderNotFound is returned when no order has the requested order_uid
+var ErrOrderNotFound = fmt.Errorf("order %w", models.ErrNotFound)
+
 type Storage struct {
-	db    *sql.DB
-	redis *redis.Client
+	db       *sql.DB
+	redis    *redis.Client
+	stats    *cacheStats
+	cacheCfg models.Redis
+	// reloaded is the cache config swapped in by ReloadCacheConfig, nil - cacheCfg
+	reloaded atomic.Pointer[models.Redis]
+	// writeMode is models.WriteInsert or models.WriteUpsert
+	writeMode string
+	// rawOrders is models.RawOff, models.RawStore or models.RawServe
+	rawOrders string
+	// statsMaterialized reads the customer analytics from the customer_stats view instead of aggregating the orders
+	statsMaterialized bool
+	stmts             *stmtCache
+	replicas          *replicaSet // nil - all reads go to the primary
+	// txRetries is how many times a write transaction aborted by a serialization failure or deadlock is rerun
+	txRetries int
+	// slowQuery is the latency above which queries are logged, 0 - off
+	slowQuery time.Duration
+	now       func() time.Time // clock of the LRU scores, nil - time.Now
+	local     *localCache      // nil - no in-process fallback of Redis
+	bloom     *bloomFilter     // nil - every read goes to the cache or Postgres
 }
 
 func initRedis(config models.Config) (*redis.Client, error) {
@@ -37,26 +71,21 @@ func initRedis(config models.Config) (*redis.Client, error) {
 		Password: config.RDBConf.RedisPassword,
 		DB:       config.RDBConf.RedisDB,
 	})
-	_, err := rdb.Ping(context.Background()).Result()
+	rdb.AddHook(redisTracing{addr: config.RDBConf.RedisAddress})
+	err := waitFor(context.Background(), "Redis", config.Connect, func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
 	if err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 	return rdb, nil
 }
 
-// run migrations for PostgreSQL
-func runMigrations(db *sql.DB) error {
+// run migrations for PostgreSQL from the golang-migrate source path
+func runMigrations(db *sql.DB, path string) error {
 	const op = "storage.migrations"
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
-	if err != nil {
-		return fmt.Errorf("%s: %v", op, err)
-	}
-	//init new Migrate struct
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationPath,
-		"postgres",
-		driver,
-	)
+	m, err := newMigrator(db, path)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
@@ -66,152 +95,296 @@ func runMigrations(db *sql.DB) error {
 		if err != migrate.ErrNoChange {
 			return fmt.Errorf("%s: %v", op, err)
 		}
-		log.Println("No migrations to apply.")
+		logger.Info("no migrations to apply")
 	} else {
-		log.Println("Database migrations applied successfully.")
+		logger.Info("database migrations applied")
 	}
 	return nil
 }
 
+// newMigrator returns the migrations of path applied to db
+func newMigrator(db *sql.DB, path string) (*migrate.Migrate, error) {
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithDatabaseInstance(path, "postgres", driver)
+}
+
 // New create new storage with Redis and Postgres
-func New(c models.Config) (*Storage, error) {
+func New(c models.Config) (_ *Storage, err error) {
 	const op = "storage.connection"
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", c.DBConf.Host, c.DBConf.Port, c.DBConf.User, c.DBConf.Password, c.DBConf.DBName)
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", op, err)
 	}
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
 	//attempting to reconnect to the database.
-	if err = waitForDB(db, 5, 1*time.Second); err != nil {
+	if err = waitFor(context.Background(), "DB", c.Connect, db.PingContext); err != nil {
 		return nil, fmt.Errorf("%s: %v", op, err)
 	}
 	//test connection
 	if err = db.Ping(); err != nil {
 		return nil, fmt.Errorf("%s: %v", op, err)
 	}
-	log.Println("Connection is ready")
+	logger.Info("connection is ready")
+	if err = c.RDBConf.ValidateReadStrategy(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.RDBConf.ValidatePreloadPolicy(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.RDBConf.ValidateCacheCodec(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.RDBConf.ValidateCacheCompression(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.RDBConf.ValidateCacheTTLJitter(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.RDBConf.ValidateBloom(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	bloom, err := newBloomFilter(c.RDBConf.BloomCapacity, c.RDBConf.BloomFPRate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.DBConf.ValidateWriteMode(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if err = c.DBConf.ValidateRawOrders(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
 	rdb, err := initRedis(c)
 	if err != nil {
 		return nil, fmt.Errorf("%s (initRedis): %v", op, err)
 	}
+	defer func() {
+		if err != nil {
+			rdb.Close()
+		}
+	}()
 	s := &Storage{
-		db:    db,
-		redis: rdb,
+		db:                db,
+		redis:             rdb,
+		stats:             newCacheStats(),
+		cacheCfg:          c.RDBConf,
+		writeMode:         c.DBConf.WriteMode,
+		rawOrders:         c.DBConf.RawOrders,
+		statsMaterialized: c.Stats.Materialized,
+		stmts:             newStmtCache(db),
+		txRetries:         c.DBConf.TxRetries,
+		slowQuery:         c.DBConf.SlowQueryThreshold,
+		local:             newLocalCache(c.RDBConf.LocalCacheSize, c.RDBConf.LocalCacheTTL),
+		bloom:             bloom,
 	}
 
 	//create tables in PostgreSQL
-	if err = runMigrations(db); err != nil {
-		return &Storage{}, fmt.Errorf("failed to make migrations: %v", err)
+	migrations := c.DBConf.MigrationsPath
+	if migrations == "" {
+		migrations = defaultMigrationsPath
+	}
+	if err = runMigrations(db, migrations); err != nil {
+		return nil, fmt.Errorf("failed to make migrations: %v", err)
+	}
+	// after the migrations, so a failed start leaves no health watch of the replicas running
+	if s.replicas, err = newReplicaSet(c.DBConf.ReplicaDSNs); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
 	}
-	log.Printf("\nmigraitions is success\n")
 
-	//loads the most recent order UIDs from the database (up to cacheLimit = 1000)
-	if err := s.preloadCache(); err != nil {
-		log.Printf("%s: %v", op, err)
+	//builds the bloom filter of stored orders in the background, reads go to Postgres until it is ready
+	if s.bloom != nil {
+		var ctx context.Context
+		ctx, s.bloom.cancel = context.WithCancel(context.Background())
+		go func() {
+			if err := s.buildBloom(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("failed to build the bloom filter", logging.Err(err))
+			}
+		}()
+	}
+
+	//warms up the cache (up to redis.cache_limit orders) within redis.preload_timeout
+	timeout := c.RDBConf.PreloadTimeout
+	if timeout <= 0 {
+		timeout = defaultPreloadTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.preloadCache(ctx); err != nil {
+		logger.Error("cache preload failed", logging.Err(err))
 	}
 	return s, nil
 }
 
-// waitForDB attempts to reconnect to the database.
-// This is necessary because when running in Docker,
-// the server might try to connect before the database is fully initialized.
-func waitForDB(db *sql.DB, attempts int, delay time.Duration) error {
-	for i := 0; i < attempts; i++ {
-		err := db.Ping()
-		if err == nil {
-			return nil
-		}
-		log.Printf("Waiting for DB... attempt %d/%d: %v", i+1, attempts, err)
-		time.Sleep(delay)
-	}
-	return fmt.Errorf("database is not reachable after %d attempts", attempts)
+// NewWithDB returns a storage that only writes orders into the open, migrated database db, without Redis
+// and the cache. Used by the offline tools
+func NewWithDB(db *sql.DB) *Storage {
+	return &Storage{db: db, stats: newCacheStats()}
 }
 
-// preloadCache loads the most recent order UIDs from the database (up to cacheLimit)
-// and initiates their preloading into Redis cache.
-// Note: Individual scan/load errors are logged but don't stop the process.
-func (s *Storage) preloadCache() error {
-	const op = "storage.preloadCache"
-	ctx := context.Background()
-	//select the most recent order UIDs from PostgreSQL
-	rows, err := s.db.QueryContext(ctx, `SELECT order_uid FROM orders ORDER BY date_created DESC LIMIT $1`, cacheLimit)
-	if err != nil {
-		return fmt.Errorf("%s: %v", op, err)
+// Ping checks that PostgreSQL is reachable
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// PingRedis checks that Redis is reachable
+func (s *Storage) PingRedis(ctx context.Context) error {
+	return s.redis.Ping(ctx).Err()
+}
+
+// Close closes the PostgreSQL pool and the Redis client
+func (s *Storage) Close() error {
+	const op = "storage.Close"
+	if s.bloom != nil && s.bloom.cancel != nil {
+		s.bloom.cancel()
 	}
-	orderUids := make([]string, 0)
-	for rows.Next() {
-		var uid string
-		if err := rows.Scan(&uid); err != nil {
-			log.Printf("%s: %v", op, err)
-			continue
-		}
-		orderUids = append(orderUids, uid)
+	s.stmts.Close()
+	s.replicas.Close()
+	dbErr := s.db.Close()
+	var redisErr error
+	if s.redis != nil {
+		redisErr = s.redis.Close()
 	}
-	if len(orderUids) > 0 {
-		s.batchPreload(orderUids)
+	if err := errors.Join(dbErr, redisErr); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
 	}
 	return nil
 }
 
-// batchPreload efficiently preloads multiple orders into Redis using concurrent workers.
-// Features:
-// -Limits concurrency using a semaphore (max 'size' goroutines)
-// -Uses wait group to ensure all preloads complete
-// -Each order:
-//  1. Fetches from database
-//  2. Saves to Redis with 2-second timeout
-//
-// Errors are logged per-order but don't stop the batch.
-func (s *Storage) batchPreload(uids []string) {
-	const size = 50
-	sem := make(chan struct{}, size)
-	wg := &sync.WaitGroup{}
-	for _, uid := range uids {
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(uid string) {
-			defer func() {
-				<-sem
-				wg.Done()
-			}()
-			//select order from PostgreSQL
-			order, err := s.getFromDB(uid)
-			if err != nil {
-				log.Printf("Preload get order error (UID: %s): %v", uid, err)
-			}
+// SaveOrder save order in PostgreSQL.
+// Returns ErrOrderExists if the order_uid is already stored, so redelivered messages can be skipped.
+func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
+	return s.SaveOrderRaw(ctx, order, models.RawPayload{})
+}
+
+// SaveOrderRaw is SaveOrder that also keeps raw, the original message payload as sent, in orders_raw
+// when database.raw_orders is enabled; a raw without payload is replaced by the JSON of the order
+func (s *Storage) SaveOrderRaw(ctx context.Context, order models.Order, raw models.RawPayload) error {
+	return s.saveOrderTx(ctx, order, raw, nil)
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			defer cancel()
+// SaveOrderAt is SaveOrderRaw of the order consumed at the offset at. The offset is stored in the transaction
+// of the order, so a redelivered message is skipped with ErrOffsetApplied and an order is never committed
+// without its offset or the other way round.
+func (s *Storage) SaveOrderAt(ctx context.Context, order models.Order, raw models.RawPayload, at models.MessageOffset) error {
+	return s.saveOrderTx(ctx, order, raw, &at)
+}
 
-			//save order in redis
-			if err := s.saveToRedis(ctx, order); err != nil {
-				log.Printf("(Preload) save order to redis error (UID: %s): %v", uid, err)
-			}
-		}(uid)
-	}
-	wg.Wait()
+func (s *Storage) saveOrderTx(ctx context.Context, order models.Order, raw models.RawPayload, at *models.MessageOffset) (err error) {
+	defer s.observeQuery(opSaveOrder, time.Now(), &err)
+	return s.retryTx(ctx, "storage.SaveOrder", func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttributes(tracing.OrderUID(order.OrderUID))
+		return s.saveOrder(ctx, order, raw, at)
+	})
 }
 
-// SaveOrder save order in PostgreSQL
-func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
-	tx, err := s.db.Begin()
+func (s *Storage) saveOrder(ctx context.Context, order models.Order, raw models.RawPayload, at *models.MessageOffset) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	q := withStatements(tx, s.stmts)
+	committed := false
 	defer func() {
-		if err != nil {
+		if err != nil && !committed {
 			tx.Rollback()
-			log.Printf("transaction rolled back: %v", err)
+			logger.Warn("transaction rolled back", logging.Err(err))
 		}
 	}()
 
-	// 1. Save main order
-	orderQuery := `INSERT INTO orders (
-		order_uid, track_number, entry, locale, internal_signature, 
-		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	// 0. Store the offset of the consumed message, a redelivered one stops here
+	if at != nil {
+		if err = storeOffset(ctx, q, *at); err != nil {
+			return err
+		}
+	}
+
+	// 1. Append the message to the event log, the order tables below are its projection
+	if raw.Payload == nil {
+		if raw, err = currentPayload(order); err != nil {
+			return err
+		}
+	}
+	if err = appendOrderEvent(ctx, q, order.OrderUID, models.OrderEventReceived, raw, at); err != nil {
+		return err
+	}
+
+	// 2. Project the order into the order tables
+	replaced, err := s.projectOrder(ctx, q, order, raw, s.writeMode == models.WriteUpsert)
+	if errors.Is(err, ErrOrderExists) {
+		// the stored order is kept, the event and the offset of the duplicate are committed
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		committed = true
+		return ErrOrderExists
+	}
+	if err != nil {
+		return err
+	}
+
+	// 3. Save status token for the public status page (a replaced order keeps its token)
+	var token string
+	if replaced {
+		token, err = existingStatusToken(ctx, q, order.OrderUID)
+	} else {
+		token, err = insertStatusToken(ctx, q, order.OrderUID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 4. Save outbox event in the same transaction (no dual write)
+	eventType := models.EventOrderSaved
+	if replaced {
+		eventType = models.EventOrderUpdated
+	}
+	event := models.OrderSavedEvent{Order: order, StatusToken: token}
+	if err = insertOutboxEvent(ctx, q, eventType, order.OrderUID, event); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+
+	if replaced {
+		// the cached copy is stale now, the next read repopulates it
+		if err := s.invalidateOrder(ctx, order.OrderUID); err != nil {
+			logger.Error("failed to invalidate replaced order", "order_uid", order.OrderUID, logging.Err(err))
+		}
+		logger.Info("order replaced", "order_uid", order.OrderUID)
+		return nil
+	}
+
+	s.addToBloom(ctx, order.OrderUID)
+	s.addCustomerOrder(ctx, order)
+	logger.Info("order saved", "order_uid", order.OrderUID)
+	return nil
+}
 
-	_, err = tx.ExecContext(ctx, orderQuery,
+// currentPayload is the payload of an order saved without the message it came in: its JSON
+func currentPayload(order models.Order) (models.RawPayload, error) {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return models.RawPayload{}, fmt.Errorf("failed to marshal raw order: %v", err)
+	}
+	return models.RawPayload{Payload: payload, SchemaVersion: models.CurrentSchemaVersion}, nil
+}
+
+// projectOrder writes the order into the order tables within the caller's transaction, raw is its payload.
+// An already stored order is replaced with upsert, otherwise ErrOrderExists is returned.
+func (s *Storage) projectOrder(ctx context.Context, tx querier, order models.Order, raw models.RawPayload, upsert bool) (replaced bool, err error) {
+	// 1. Save main order
+	orderArgs := []any{
 		order.OrderUID,
 		order.TrackNumber,
 		order.Entry,
@@ -223,18 +396,40 @@ func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
 		order.SmID,
 		order.DateCreated,
 		order.OofShard,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert order: %v", err)
+	}
+	if upsert {
+		if replaced, err = upsertOrderRow(ctx, tx, orderArgs); err != nil {
+			return false, err
+		}
+	} else {
+		// order_keys keeps order_uid unique across the partitions of orders
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, `INSERT INTO order_keys (order_uid, date_created) VALUES ($1, $2)
+	ON CONFLICT (order_uid) DO NOTHING`, order.OrderUID, order.DateCreated)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert order key: %w", err)
+		}
+		var inserted int64
+		inserted, err = res.RowsAffected()
+		if err != nil {
+			return false, fmt.Errorf("failed to insert order key: %w", err)
+		}
+		if inserted == 0 {
+			return false, ErrOrderExists
+		}
+	}
+	if _, err = tx.ExecContext(ctx, orderInsertQuery, orderArgs...); err != nil {
+		return false, fmt.Errorf("failed to insert order: %w", err)
 	}
 
 	// 2. Save deliveries
 	deliveryQuery := `INSERT INTO deliveries (
-		order_uid, name, phone, zip, city, address, region, email
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		order_uid, date_created, name, phone, zip, city, address, region, email
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
 	_, err = tx.ExecContext(ctx, deliveryQuery,
 		order.OrderUID,
+		order.DateCreated,
 		order.Delivery.Name,
 		order.Delivery.Phone,
 		order.Delivery.Zip,
@@ -244,17 +439,18 @@ func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
 		order.Delivery.Email,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert delivery: %v", err)
+		return false, fmt.Errorf("failed to insert delivery: %w", err)
 	}
 
 	// 3. Save payment
 	paymentQuery := `INSERT INTO payments (
-		order_uid, transaction, request_id, currency, provider, 
+		order_uid, date_created, transaction, request_id, currency, provider, 
 		amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
 	_, err = tx.ExecContext(ctx, paymentQuery,
 		order.OrderUID,
+		order.DateCreated,
 		order.Payment.Transaction,
 		order.Payment.RequestID,
 		order.Payment.Currency,
@@ -267,103 +463,232 @@ func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
 		order.Payment.CustomFee,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert payment: %v", err)
+		return false, fmt.Errorf("failed to insert payment: %w", err)
 	}
 
 	// 4. Save items
-	itemQuery := `INSERT INTO items (
-		order_uid, chrt_id, track_number, price, rid, name, 
-		sale, size, total_price, nm_id, brand, status
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
-
-	for _, item := range order.Items {
-		_, err = tx.ExecContext(ctx, itemQuery,
-			order.OrderUID,
-			item.ChrtID,
-			item.TrackNumber,
-			item.Price,
-			item.Rid,
-			item.Name,
-			item.Sale,
-			item.Size,
-			item.TotalPrice,
-			item.NmID,
-			item.Brand,
-			item.Status,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert item: %v", err)
-		}
+	if err = insertItems(ctx, tx, order.OrderUID, order.DateCreated, order.Items); err != nil {
+		return false, err
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	// 5. Index for full-text search
+	if err = indexOrdersForSearch(ctx, tx, []string{order.OrderUID}); err != nil {
+		return false, err
 	}
 
-	log.Printf("Order %s saved successfully", order.OrderUID)
-	return nil
+	// 6. Save the original payload
+	if s.rawOrders == models.RawStore || s.rawOrders == models.RawServe {
+		if err = insertRawOrder(ctx, tx, order.OrderUID, raw); err != nil {
+			return false, err
+		}
+	}
+	return replaced, nil
 }
 
-// get data from redis
-func (s *Storage) getFromCache(ctx context.Context, orderUID string) (*models.Order, error) {
-	val, err := s.redis.Get(ctx, orderUID).Result()
+// upsertOrderRow claims the order_uid in order_keys; for an existing order the stored rows are deleted
+// to be inserted again (a new date_created may move them to another partition), all under the row
+// lock taken by the upsert of order_keys
+func upsertOrderRow(ctx context.Context, tx querier, orderArgs []any) (replaced bool, err error) {
+	var inserted bool
+	err = tx.QueryRowContext(ctx, `INSERT INTO order_keys (order_uid, date_created) VALUES ($1, $2)
+	ON CONFLICT (order_uid) DO UPDATE SET date_created = EXCLUDED.date_created
+	RETURNING (xmax = 0)`, orderArgs[0], orderArgs[9]).Scan(&inserted)
 	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("not found in cache")
-		}
-		return nil, fmt.Errorf("redis get error: %v", err)
+		return false, fmt.Errorf("failed to upsert order key: %w", err)
+	}
+	if inserted {
+		return false, nil
+	}
+	// the delivery, payment and items go with the order (ON DELETE CASCADE, migration 000025)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE order_uid = $1`, orderArgs[0]); err != nil {
+		return false, fmt.Errorf("failed to replace order: %w", err)
 	}
+	return true, nil
+}
+
+// orderInsertQuery inserts the orders row, the partition is picked by date_created
+const orderInsertQuery = `INSERT INTO orders (
+		order_uid, track_number, entry, locale, internal_signature,
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+// itemsInsertQuery inserts all the items of an order from one array per column, so the query text
+// is the same for any number of items and is prepared once
+const itemsInsertQuery = `INSERT INTO items (
+		order_uid, date_created, chrt_id, track_number, price, rid, name,
+		sale, size, total_price, nm_id, brand, status
+	) SELECT $1, $2, * FROM unnest($3::bigint[], $4::text[], $5::bigint[], $6::text[], $7::text[],
+		$8::int[], $9::text[], $10::bigint[], $11::bigint[], $12::text[], $13::int[])`
 
-	var order models.Order
-	if err := json.Unmarshal([]byte(val), &order); err != nil {
-		return nil, fmt.Errorf("cache decode error: %v", err)
+// insertItems saves the items with one INSERT of itemsInsertQuery
+func insertItems(ctx context.Context, tx querier, orderUID string, created time.Time, items []models.Item) error {
+	if len(items) == 0 {
+		return nil
 	}
+	var (
+		chrtIDs, prices, sales, totalPrices, nmIDs, statuses []int64
+		tracks, rids, names, sizes, brands                   []string
+	)
+	for _, item := range items {
+		chrtIDs = append(chrtIDs, int64(item.ChrtID))
+		tracks = append(tracks, item.TrackNumber)
+		prices = append(prices, item.Price.Amount)
+		rids = append(rids, item.Rid)
+		names = append(names, item.Name)
+		sales = append(sales, int64(item.Sale))
+		sizes = append(sizes, item.Size)
+		totalPrices = append(totalPrices, item.TotalPrice.Amount)
+		nmIDs = append(nmIDs, int64(item.NmID))
+		brands = append(brands, item.Brand)
+		statuses = append(statuses, int64(item.Status))
+	}
+	_, err := tx.ExecContext(ctx, itemsInsertQuery, orderUID, created, pq.Array(chrtIDs), pq.Array(tracks),
+		pq.Array(prices), pq.Array(rids), pq.Array(names), pq.Array(sales), pq.Array(sizes), pq.Array(totalPrices),
+		pq.Array(nmIDs), pq.Array(brands), pq.Array(statuses))
+	if err != nil {
+		return fmt.Errorf("failed to insert items: %w", err)
+	}
+	return nil
+}
 
-	return &order, nil
+// GetOrder retrieves an order by its UID using the configured read strategy (cache-first by default)
+// and tells where it was read from. UIDs ruled out by the bloom filter are not found without reading
+// the cache or Postgres.
+func (s *Storage) GetOrder(ctx context.Context, orderUID string) (_ *models.Order, source models.OrderSource, err error) {
+	ctx, span := tracer.Start(ctx, "storage.GetOrder", trace.WithAttributes(tracing.OrderUID(orderUID),
+		attribute.String("read_strategy", s.cache().ReadStrategy)))
+	defer func() {
+		span.SetAttributes(attribute.String("order.source", string(source)))
+		tracing.End(span, err)
+	}()
+	if !s.mayExist(ctx, orderUID) {
+		return nil, "", ErrOrderNotFound
+	}
+	s.countRead(ctx, orderUID)
+	switch s.cache().ReadStrategy {
+	case models.ReadDBFirst:
+		return s.getOrderDBFirst(ctx, orderUID)
+	case models.ReadCacheOnly:
+		order, source, err := s.getFromCache(ctx, orderUID)
+		if err != nil {
+			return nil, "", fmt.Errorf("error of getting order from cache (cache-only mode): %v", err)
+		}
+		return order, source, nil
+	default:
+		return s.getOrderCacheFirst(ctx, orderUID)
+	}
 }
 
-// GetOrder retrieves an order by its UID using cache-first strategy:
+// getOrderCacheFirst:
 // 1. First attempts to fetch from Redis cache
 // 2. On cache miss, falls back to database
 // 3. On successful DB fetch, repopulates cache
-func (s *Storage) GetOrder(orderUID string) (*models.Order, error) {
-	cachedOrder, err := s.getFromCache(context.Background(), orderUID)
-	//the special message that the data is taken from the cache!
-	t1 := time.Now().UnixNano()
+func (s *Storage) getOrderCacheFirst(ctx context.Context, orderUID string) (*models.Order, models.OrderSource, error) {
+	cachedOrder, source, err := s.getFromCache(ctx, orderUID)
 	if err == nil {
-		log.Printf("-------------\nget from cache success\n---------------")
-		log.Println("time for get from CACHE: (ns): ", time.Now().UnixNano()-t1)
-		return cachedOrder, nil
+		return cachedOrder, source, nil
 	}
-	order, err := s.getFromDB(orderUID)
-	log.Printf("-------------\nget from DB success\n---------------")
-	log.Println("time for get from PostgreSQL: (ns): ", time.Now().UnixNano()-t1)
+	order, err := s.getFromDB(ctx, orderUID)
 	if err != nil {
-		return nil, fmt.Errorf("error of getting order from DB: %v", err)
+		return nil, "", fmt.Errorf("error of getting order from DB: %v", err)
 	}
-	if err = s.saveToRedis(context.Background(), order); err != nil {
-		return nil, fmt.Errorf("failed to save data in redis: %v", err)
+	s.stats.dbFallback(orderUID)
+	err = s.cacheOrder(ctx, order)
+	s.stats.repopulated(orderUID, err)
+	if err != nil {
+		// the order is read, a failure of caching it must not fail the request
+		logger.Warn("failed to cache order", "order_uid", orderUID, logging.Err(err))
 	}
-	return order, nil
+	return order, models.OrderFromDB, nil
 }
 
-// get data from PostgreSQL
-func (s *Storage) getFromDB(orderUID string) (*models.Order, error) {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+// getOrderDBFirst reads from PostgreSQL and refreshes the cache in the background.
+// The cache is used only if the database read fails (e.g. during a partial outage).
+func (s *Storage) getOrderDBFirst(ctx context.Context, orderUID string) (*models.Order, models.OrderSource, error) {
+	order, dbErr := s.getFromDB(ctx, orderUID)
+	if dbErr != nil {
+		cachedOrder, source, err := s.getFromCache(ctx, orderUID)
+		if err != nil {
+			return nil, "", fmt.Errorf("error of getting order from DB: %v (cache: %v)", dbErr, err)
+		}
+		return cachedOrder, source, nil
+	}
+	go func() {
+		// the refresh outlives the request
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if err := s.cacheOrder(ctx, order); err != nil {
+			logger.Warn("failed to refresh cached order (db-first)", "order_uid", orderUID, logging.Err(err))
+		}
+	}()
+	return order, models.OrderFromDB, nil
+}
+
+// get data from PostgreSQL: a healthy replica if configured, otherwise or on failure the primary.
+// Soft-deleted orders are not found.
+func (s *Storage) getFromDB(ctx context.Context, orderUID string) (*models.Order, error) {
+	return s.lookupOrder(ctx, orderUID, false)
+}
+
+func (s *Storage) lookupOrder(ctx context.Context, orderUID string, includeDeleted bool) (_ *models.Order, err error) {
+	ctx, span := tracer.Start(ctx, "postgres get order", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL, tracing.OrderUID(orderUID)))
+	defer func() { tracing.End(span, err) }()
+	defer s.observeQuery(opGetOrder, time.Now(), &err)
+	opts := readOptions{raw: s.rawOrders == models.RawServe, includeDeleted: includeDeleted}
+	if r := s.replicas.pick(); r != nil {
+		order, err := readOrder(ctx, r.db, r.stmts, orderUID, opts)
+		if err == nil {
+			return order, nil
+		}
+		// not found on a replica may be replication lag of a just saved order, the primary decides
+		if !errors.Is(err, models.ErrNotFound) {
+			logger.Warn("replica read failed, using the primary", "order_uid", orderUID, "replica", r.name, logging.Err(err))
+		}
 	}
-	defer tx.Rollback()
+	return readOrder(ctx, s.db, s.stmts, orderUID, opts)
+}
 
-	//1. receiving main order data
-	order := models.Order{OrderUID: orderUID}
-	orderQuery := `SELECT 
-		track_number, entry, locale, internal_signature, customer_id, 
-		delivery_service, shardkey, sm_id, date_created, oof_shard 
-	FROM orders WHERE order_uid = $1`
+// readOptions of readOrder: raw tries the original payload first, answering with one query;
+// includeDeleted also returns soft-deleted orders
+type readOptions struct {
+	raw            bool
+	includeDeleted bool
+}
+
+// readOrderQuery reads the order with its delivery and payment joined and the items aggregated to JSON;
+// the date_created of order_keys prunes the partitions of every table
+const readOrderQuery = `SELECT
+		o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+		o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, k.deleted_at,
+		d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+		p.transaction, p.request_id, p.currency, p.provider, p.amount,
+		p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee,
+		(SELECT json_agg(json_build_object(
+			'chrt_id', i.chrt_id, 'track_number', i.track_number, 'price', i.price, 'rid', i.rid,
+			'name', i.name, 'sale', i.sale, 'size', i.size, 'total_price', i.total_price,
+			'nm_id', i.nm_id, 'brand', i.brand, 'status', i.status) ORDER BY i.id)
+		FROM items i WHERE i.order_uid = o.order_uid AND i.date_created = o.date_created)
+	FROM orders o
+	JOIN order_keys k ON k.order_uid = o.order_uid AND k.date_created = o.date_created
+	JOIN deliveries d ON d.order_uid = o.order_uid AND d.date_created = o.date_created
+	JOIN payments p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+	WHERE o.order_uid = $1 AND ($2 OR k.deleted_at IS NULL)`
+
+// readOrder reads the order from the normalized tables with one query
+func readOrder(ctx context.Context, db *sql.DB, stmts *stmtCache, orderUID string, opts readOptions) (*models.Order, error) {
+	q := poolStatements(db, stmts)
+
+	if opts.raw {
+		order, err := readRawOrder(ctx, q, orderUID, opts.includeDeleted)
+		if !errors.Is(err, ErrOrderNotFound) {
+			return order, err
+		}
+	}
 
-	err = tx.QueryRow(orderQuery, orderUID).Scan(
+	order := models.Order{OrderUID: orderUID}
+	var items []byte
+	err := q.QueryRowContext(ctx, readOrderQuery, orderUID, opts.includeDeleted).Scan(
 		&order.TrackNumber,
 		&order.Entry,
 		&order.Locale,
@@ -374,141 +699,38 @@ func (s *Storage) getFromDB(orderUID string) (*models.Order, error) {
 		&order.SmID,
 		&order.DateCreated,
 		&order.OofShard,
+		&order.DeletedAt,
+		&order.Delivery.Name,
+		&order.Delivery.Phone,
+		&order.Delivery.Zip,
+		&order.Delivery.City,
+		&order.Delivery.Address,
+		&order.Delivery.Region,
+		&order.Delivery.Email,
+		&order.Payment.Transaction,
+		&order.Payment.RequestID,
+		&order.Payment.Currency,
+		&order.Payment.Provider,
+		&order.Payment.Amount,
+		&order.Payment.PaymentDt,
+		&order.Payment.Bank,
+		&order.Payment.DeliveryCost,
+		&order.Payment.GoodsTotal,
+		&order.Payment.CustomFee,
+		&items,
 	)
-
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("order not found")
+			return nil, ErrOrderNotFound
 		}
 		return nil, fmt.Errorf("failed to get order: %v", err)
 	}
-
-	// 2. receiving delivery data
-	delivery := models.Delivery{}
-	deliveryQuery := `SELECT 
-		name, phone, zip, city, address, region, email 
-	FROM deliveries WHERE order_uid = $1`
-
-	err = tx.QueryRow(deliveryQuery, orderUID).Scan(
-		&delivery.Name,
-		&delivery.Phone,
-		&delivery.Zip,
-		&delivery.City,
-		&delivery.Address,
-		&delivery.Region,
-		&delivery.Email,
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get delivery: %v", err)
-	}
-	order.Delivery = delivery
-
-	// 3. receiving payment data
-	payment := models.Payment{}
-	paymentQuery := `SELECT 
-		transaction, request_id, currency, provider, amount, 
-		payment_dt, bank, delivery_cost, goods_total, custom_fee 
-	FROM payments WHERE order_uid = $1`
-
-	err = tx.QueryRow(paymentQuery, orderUID).Scan(
-		&payment.Transaction,
-		&payment.RequestID,
-		&payment.Currency,
-		&payment.Provider,
-		&payment.Amount,
-		&payment.PaymentDt,
-		&payment.Bank,
-		&payment.DeliveryCost,
-		&payment.GoodsTotal,
-		&payment.CustomFee,
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get payment: %v", err)
-	}
-	order.Payment = payment
-
-	// 4. receiving items data
-	itemsQuery := `SELECT 
-		chrt_id, track_number, price, rid, name, sale, 
-		size, total_price, nm_id, brand, status 
-	FROM items WHERE order_uid = $1`
-
-	rows, err := tx.Query(itemsQuery, orderUID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get items: %v", err)
-	}
-	defer rows.Close()
-
-	var items []models.Item
-	for rows.Next() {
-		var item models.Item
-		err = rows.Scan(
-			&item.ChrtID,
-			&item.TrackNumber,
-			&item.Price,
-			&item.Rid,
-			&item.Name,
-			&item.Sale,
-			&item.Size,
-			&item.TotalPrice,
-			&item.NmID,
-			&item.Brand,
-			&item.Status,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan item: %v", err)
+	// no items aggregate to NULL
+	if items != nil {
+		if err := json.Unmarshal(items, &order.Items); err != nil {
+			return nil, fmt.Errorf("failed to decode items: %v", err)
 		}
-		items = append(items, item)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating items: %v", err)
 	}
-	order.Items = items
-
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
-	}
-
+	order.SetCurrency()
 	return &order, nil
 }
-
-// saveToRedis stores an order in Redis with two-phase caching:
-// 1. Primary storage: Order JSON stored as key-value with 72-hour TTL
-// 2. LRU tracking: Order UID added to "recently used" list for cache management
-//
-// Performs automatic cache maintenance:
-// - Trims "recently used" list when exceeding cacheLimit
-// - Removes associated order data when trimming
-func (s *Storage) saveToRedis(ctx context.Context, order *models.Order) error {
-	orderJSON, err := json.Marshal(order)
-	const Lkey = "recently used"
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
-	}
-	if err = s.redis.Set(ctx, order.OrderUID, orderJSON, 72*time.Hour).Err(); err != nil {
-		return fmt.Errorf("redis set error: %v", err)
-	}
-	if err = s.redis.LPush(ctx, Lkey, order.OrderUID).Err(); err != nil {
-		return fmt.Errorf("redis lpush error: %v", err)
-	}
-	length, err := s.redis.LLen(ctx, Lkey).Result()
-	if err != nil {
-		return fmt.Errorf("redis llen error: %v", err)
-	}
-	if length > cacheLimit {
-		olds, err := s.redis.LRange(ctx, Lkey, int64(cacheLimit), length-1).Result()
-		if err != nil {
-			return fmt.Errorf("redis lrange error: %v", err)
-		}
-		if err := s.redis.Del(ctx, olds...).Err(); err != nil {
-			return fmt.Errorf("redis del error: %v", err)
-		}
-		if err := s.redis.LTrim(ctx, Lkey, 0, int64(cacheLimit)-1).Err(); err != nil {
-			return fmt.Errorf("redis ltrim error: %v", err)
-		}
-	}
-	return nil
-}
@@ -1,54 +1,81 @@
 package storage
 
 import (
+	"WB_LVL0/server/internal/metrics"
 	"WB_LVL0/server/models"
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
 	"github.com/go-redis/redismock/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetFromCache(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	storage := &Storage{redis: rdb}
+	now := time.UnixMilli(1_700_000_000_000)
+	storage := &Storage{redis: rdb, now: func() time.Time { return now }}
+	score := float64(now.UnixMilli())
 
 	testOrder := models.Order{OrderUID: "test123"}
 
 	t.Run("success", func(t *testing.T) {
-		orderJSON := `{"order_uid":"test123"}`
+		orderJSON := "\x03" + `{"order_uid":"test123"}`
 		mock.ExpectGet("test123").SetVal(orderJSON)
+		// the hit refreshes the LRU score
+		mock.ExpectZAddXX(lruKey, &redis.Z{Score: score, Member: "test123"}).SetVal(0)
 
-		order, err := storage.getFromCache(context.Background(), "test123")
+		hits := testutil.ToFloat64(metrics.CacheHits.WithLabelValues("redis"))
+		order, _, err := storage.getFromCache(context.Background(), "test123")
 		require.NoError(t, err)
 		require.Equal(t, testOrder.OrderUID, order.OrderUID)
+		require.Equal(t, hits+1, testutil.ToFloat64(metrics.CacheHits.WithLabelValues("redis")))
 	})
 
 	t.Run("not found", func(t *testing.T) {
 		mock.ExpectGet("notfound").RedisNil()
 
-		_, err := storage.getFromCache(context.Background(), "notfound")
+		misses := testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("absent"))
+		_, _, err := storage.getFromCache(context.Background(), "notfound")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "not found in cache")
+		require.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("absent")))
 	})
 
 	t.Run("invalid data", func(t *testing.T) {
-		mock.ExpectGet("invalid").SetVal("invalid json")
+		mock.ExpectGet("invalid").SetVal("\x03invalid json")
 
-		_, err := storage.getFromCache(context.Background(), "invalid")
+		_, _, err := storage.getFromCache(context.Background(), "invalid")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "cache decode error")
 	})
+
+	t.Run("stale entry", func(t *testing.T) {
+		// cached in major units before the minor units header
+		mock.ExpectGet("stale").SetVal(`{"order_uid":"stale"}`)
+
+		misses := testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("stale"))
+		_, _, err := storage.getFromCache(context.Background(), "stale")
+		require.ErrorIs(t, err, errStaleCache)
+		require.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("stale")))
+	})
 }
 
 func TestSaveToRedis(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	storage := &Storage{redis: rdb}
+	now := time.UnixMilli(1_700_000_000_000)
+	storage := &Storage{redis: rdb, now: func() time.Time { return now }}
+	score := float64(now.UnixMilli())
+	expiryScore := func(ttl time.Duration) string {
+		return strconv.FormatInt(now.Add(-ttl).UnixMilli(), 10)
+	}
 
 	testOrder := models.Order{
 		OrderUID: "test123",
@@ -63,15 +90,14 @@ func TestSaveToRedis(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to marshal test order: %v", err)
 		}
-		return (jsonData)
+		return append([]byte{headerMinorUnits}, jsonData...)
 	}
 
 	t.Run("success", func(t *testing.T) {
 		expectedJSON := getExpectedJSON(&testOrder)
 
-		mock.ExpectSet("test123", expectedJSON, 72*time.Hour).SetVal("OK")
-		mock.ExpectLPush("recently used", "test123").SetVal(1)
-		mock.ExpectLLen("recently used").SetVal(1)
+		mock.ExpectEvalSha(saveScript.Hash(), []string{lruKey, "test123"},
+			expiryScore(72*time.Hour), defaultCacheLimit, expectedJSON, (72 * time.Hour).Milliseconds(), score).SetVal(int64(0))
 
 		err := storage.saveToRedis(context.Background(), &testOrder)
 		require.NoError(t, err)
@@ -81,82 +107,284 @@ func TestSaveToRedis(t *testing.T) {
 	t.Run("cache limit exceeded", func(t *testing.T) {
 		expectedJSON := getExpectedJSON(&testOrder)
 
-		mock.ExpectSet("test123", expectedJSON, 72*time.Hour).SetVal("OK")
-		mock.ExpectLPush("recently used", "test123").SetVal(1)
-		mock.ExpectLLen("recently used").SetVal(1001)
-		mock.ExpectLRange("recently used", 1000, 1000).SetVal([]string{"old1"})
-		mock.ExpectDel("old1").SetVal(1)
-		mock.ExpectLTrim("recently used", 0, 999).SetVal("OK")
+		mock.ExpectEvalSha(saveScript.Hash(), []string{lruKey, "test123"},
+			expiryScore(72*time.Hour), defaultCacheLimit, expectedJSON, (72 * time.Hour).Milliseconds(), score).SetVal(int64(1))
 
+		evictions := testutil.ToFloat64(metrics.CacheEvictions)
 		err := storage.saveToRedis(context.Background(), &testOrder)
 		require.NoError(t, err)
+		require.Equal(t, evictions+1, testutil.ToFloat64(metrics.CacheEvictions))
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
+	t.Run("configured limit and ttl", func(t *testing.T) {
+		storage := &Storage{redis: rdb, now: storage.now, cacheCfg: models.Redis{CacheLimit: 2, CacheTTL: time.Hour}}
+		expectedJSON := getExpectedJSON(&testOrder)
+
+		mock.ExpectEvalSha(saveScript.Hash(), []string{lruKey, "test123"},
+			expiryScore(time.Hour), 2, expectedJSON, time.Hour.Milliseconds(), score).SetVal(int64(2))
+
+		err := storage.saveToRedis(context.Background(), &testOrder)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("script not loaded", func(t *testing.T) {
+		expectedJSON := getExpectedJSON(&testOrder)
+		args := []interface{}{expiryScore(72 * time.Hour), defaultCacheLimit, expectedJSON, (72 * time.Hour).Milliseconds(), score}
+
+		// the script is sent once Redis reports it isn't cached
+		mock.ExpectEvalSha(saveScript.Hash(), []string{lruKey, "test123"}, args...).SetErr(errors.New("NOSCRIPT No matching script"))
+		mock.ExpectEval(saveLua, []string{lruKey, "test123"}, args...).SetVal(int64(0))
+
+		err := storage.saveToRedis(context.Background(), &testOrder)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestEntryTTL(t *testing.T) {
+	storage := &Storage{cacheCfg: models.Redis{CacheTTL: 10 * time.Hour, CacheTTLJitter: 10}}
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		ttl := storage.entryTTL()
+		require.GreaterOrEqual(t, ttl, 9*time.Hour)
+		require.LessOrEqual(t, ttl, 11*time.Hour)
+		seen[ttl] = true
+	}
+	require.Greater(t, len(seen), 1)
+	// the LRU tracking outlives every entry
+	require.Equal(t, 11*time.Hour, storage.maxEntryTTL())
+
+	require.Equal(t, defaultCacheTTL, (&Storage{}).entryTTL())
+}
+
+func TestReloadCacheConfig(t *testing.T) {
+	storage := &Storage{cacheCfg: models.Redis{CacheTTL: time.Hour, CacheLimit: 10}}
+	require.Equal(t, time.Hour, storage.cacheTTL())
+
+	require.NoError(t, storage.ReloadCacheConfig(models.Redis{CacheTTL: 2 * time.Hour, CacheLimit: 20, ReadStrategy: models.ReadDBFirst}))
+	require.Equal(t, 2*time.Hour, storage.cacheTTL())
+	require.Equal(t, 20, storage.cacheLimit())
+	require.Equal(t, models.ReadDBFirst, storage.cache().ReadStrategy)
+
+	// an invalid config leaves the current one in place
+	require.Error(t, storage.ReloadCacheConfig(models.Redis{ReadStrategy: "db-only"}))
+	require.Equal(t, 2*time.Hour, storage.cacheTTL())
 }
 
 func TestGetFromDB(t *testing.T) {
-	fmt.Println("wegergergeg;gme/\n\n\n\n\rhkrp[hr")
 	db, mock, err := sqlmock.New()
-
 	require.NoError(t, err)
-	fmt.Println("klmer;gme/\n\n\n\n\rhaegresrg")
 	defer db.Close()
 
 	storage := &Storage{db: db}
 
 	t.Run("success", func(t *testing.T) {
-		// Настройка моков для всех запросов
+		// the whole order comes in one row, items as a JSON array
 		orderRows := sqlmock.NewRows([]string{
 			"track_number", "entry", "locale", "internal_signature", "customer_id",
-			"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
-		}).AddRow(
-			"WBIL12345678", "WBIL", "en", "", "test_customer",
-			"meest", "1", 1, time.Now(), "1",
-		)
-
-		deliveryRows := sqlmock.NewRows([]string{
+			"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "deleted_at",
 			"name", "phone", "zip", "city", "address", "region", "email",
-		}).AddRow(
-			"Test User", "+1234567890", "12345", "Moscow", "Test Address", "Test Region", "test@example.com",
-		)
-
-		paymentRows := sqlmock.NewRows([]string{
 			"transaction", "request_id", "currency", "provider", "amount",
-			"payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee",
+			"payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee", "items",
 		}).AddRow(
+			"WBIL12345678", "WBIL", "en", "", "test_customer",
+			"meest", "1", 1, time.Now(), "1", nil,
+			"Test User", "+1234567890", "12345", "Moscow", "Test Address", "Test Region", "test@example.com",
 			"test123", "", "USD", "wbpay", 1000,
 			time.Now().Unix(), "sber", 500, 500, 0,
+			[]byte(`[{"chrt_id":1234567,"track_number":"WBIL12345678","price":100,"rid":"rid123","name":"Test Item",`+
+				`"sale":10,"size":"1","total_price":90,"nm_id":1234567,"brand":"Test Brand","status":200}]`),
 		)
 
-		itemRows := sqlmock.NewRows([]string{
-			"chrt_id", "track_number", "price", "rid", "name", "sale",
-			"size", "total_price", "nm_id", "brand", "status",
-		}).AddRow(
-			1234567, "WBIL12345678", 100, "rid123", "Test Item", 10,
-			"1", 90, 1234567, "Test Brand", 200,
-		)
-
-		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT.*FROM orders").WillReturnRows(orderRows)
-		mock.ExpectQuery("SELECT.*FROM deliveries").WillReturnRows(deliveryRows)
-		mock.ExpectQuery("SELECT.*FROM payments").WillReturnRows(paymentRows)
-		mock.ExpectQuery("SELECT.*FROM items").WillReturnRows(itemRows)
-		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT.*FROM orders o.*JOIN deliveries d.*JOIN payments p").
+			WithArgs("test123", false).
+			WillReturnRows(orderRows)
 
-		order, err := storage.getFromDB("test123")
+		order, err := storage.getFromDB(context.Background(), "test123")
 		require.NoError(t, err)
 		require.Equal(t, "test123", order.OrderUID)
 		require.Equal(t, "Test User", order.Delivery.Name)
 		require.Len(t, order.Items, 1)
+		require.Equal(t, "Test Brand", order.Items[0].Brand)
 	})
 
 	t.Run("order not found", func(t *testing.T) {
-		mock.ExpectBegin()
 		mock.ExpectQuery("SELECT.*FROM orders").WillReturnError(sql.ErrNoRows)
-		mock.ExpectRollback()
 
-		_, err := storage.getFromDB("notfound")
+		_, err := storage.getFromDB(context.Background(), "notfound")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "not found")
 	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFromDBReplicaFallback(t *testing.T) {
+	primary, primaryMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer primary.Close()
+	replicaDB, replicaMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer replicaDB.Close()
+
+	r := &replica{name: "replica-1", db: replicaDB}
+	r.healthy.Store(true)
+	storage := &Storage{db: primary, replicas: &replicaSet{replicas: []*replica{r}}}
+
+	// the order is not replicated yet
+	replicaMock.ExpectQuery("SELECT.*FROM orders").WillReturnError(sql.ErrNoRows)
+	primaryMock.ExpectQuery("SELECT.*FROM orders").WillReturnError(sql.ErrNoRows)
+
+	_, err = storage.getFromDB(context.Background(), "test123")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+	require.NoError(t, replicaMock.ExpectationsWereMet())
+	require.NoError(t, primaryMock.ExpectationsWereMet())
+
+	// an unhealthy replica is skipped
+	r.healthy.Store(false)
+	primaryMock.ExpectQuery("SELECT.*FROM orders").WillReturnError(sql.ErrNoRows)
+
+	_, err = storage.getFromDB(context.Background(), "test123")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+	require.NoError(t, primaryMock.ExpectationsWereMet())
+}
+
+func TestSaveOrderDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := &Storage{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the stored order is kept, the duplicate stays in the event log
+	mock.ExpectCommit()
+
+	err = storage.SaveOrder(context.Background(), models.Order{OrderUID: "test123"})
+	require.ErrorIs(t, err, ErrOrderExists)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveOrderItemsInOneInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := &Storage{db: db}
+	order := models.Order{OrderUID: "test123", Items: []models.Item{{Name: "a"}, {Name: "b"}, {Name: "c"}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO order_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO items .* SELECT \$1, \$2, \* FROM unnest\(.*\$13::int\[\]\)$`).
+		WithArgs("test123", sqlmock.AnyArg(), "{0,0,0}", `{"","",""}`, "{0,0,0}", `{"","",""}`, `{"a","b","c"}`,
+			"{0,0,0}", `{"","",""}`, "{0,0,0}", "{0,0,0}", `{"","",""}`, "{0,0,0}").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO order_search").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_status_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, storage.SaveOrder(context.Background(), order))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveOrderUpsertReplaces(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+
+	storage := &Storage{db: db, redis: rdb, writeMode: models.WriteUpsert}
+	order := models.Order{OrderUID: "test123", Items: []models.Item{{Name: "a"}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO order_event_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO order_keys .* ON CONFLICT \\(order_uid\\) DO UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectExec("DELETE FROM orders").WithArgs("test123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_search").WithArgs(`{"test123"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT token FROM order_status_tokens").WithArgs("test123").
+		WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("tok"))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs(models.EventOrderUpdated, "test123", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectTxPipeline()
+	redisMock.ExpectDel("test123").SetVal(1)
+	redisMock.ExpectZRem(lruKey, "test123").SetVal(1)
+	redisMock.ExpectTxPipelineExec()
+
+	require.NoError(t, storage.SaveOrder(context.Background(), order))
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestInsertItemsOneQuery(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	cache := newStmtCache(db)
+	q := poolStatements(db, cache)
+	created := time.Now()
+
+	// any number of items is inserted by the same prepared statement
+	mock.ExpectPrepare(itemsInsertQuery)
+	mock.ExpectExec(itemsInsertQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(itemsInsertQuery).WillReturnResult(sqlmock.NewResult(0, 2000))
+	require.NoError(t, insertItems(context.Background(), q, "uid", created, make([]models.Item, 1)))
+	require.NoError(t, insertItems(context.Background(), q, "uid", created, make([]models.Item, 2000)))
+	require.NoError(t, insertItems(context.Background(), q, "uid", created, nil))
+	require.Len(t, cache.stmts, 1)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreloadCacheWindow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("last orders", func(t *testing.T) {
+		storage := &Storage{db: db}
+		mock.ExpectQuery(`SELECT o.order_uid FROM orders o\s+JOIN order_keys k .* AND k.deleted_at IS NULL\s+ORDER BY o.date_created DESC LIMIT \$1`).
+			WithArgs(defaultCacheLimit).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+
+		require.NoError(t, storage.preloadCache(context.Background()))
+	})
+
+	t.Run("time window", func(t *testing.T) {
+		storage := &Storage{db: db, cacheCfg: models.Redis{PreloadWindow: 24 * time.Hour}}
+		mock.ExpectQuery(`SELECT o.order_uid FROM orders o\s+JOIN order_keys k .* AND k.deleted_at IS NULL\s+WHERE o.date_created >= \$1`).
+			WithArgs(sqlmock.AnyArg(), defaultCacheLimit).
+			WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+
+		require.NoError(t, storage.preloadCache(context.Background()))
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOrderCacheOnly(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	storage := &Storage{redis: rdb, cacheCfg: models.Redis{ReadStrategy: models.ReadCacheOnly}}
+
+	mock.ExpectGet("test123").SetVal("\x03" + `{"order_uid":"test123"}`)
+	order, _, err := storage.GetOrder(context.Background(), "test123")
+	require.NoError(t, err)
+	require.Equal(t, "test123", order.OrderUID)
+
+	// no database configured: a miss must not fall back to Postgres
+	mock.ExpectGet("missing").RedisNil()
+	_, _, err = storage.GetOrder(context.Background(), "missing")
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -3,6 +3,8 @@ package storage
 import (
 	"WB_LVL0/server/models"
 	"context"
+	"errors"
+	"github.com/golang-migrate/migrate/v4"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
@@ -16,12 +18,15 @@ func setupTestStorage(t *testing.T) *Storage {
 			User:     "test_user",
 			Password: "test_password",
 			DBName:   "test_db",
+			// the tests run in the package directory
+			MigrationsPath: "file://../../migrations",
 		},
 		RDBConf: models.Redis{
 			RedisAddress:  "localhost:6379",
 			RedisPassword: "",
 			RedisDB:       1,
 		},
+		Connect: models.ConnectCfg{Attempts: 5, InitialDelay: time.Second, MaxDelay: time.Second},
 	}
 
 	storage, err := New(cfg)
@@ -36,6 +41,14 @@ func setupTestStorage(t *testing.T) *Storage {
 	require.NoError(t, err)
 	_, err = storage.db.Exec("DELETE FROM orders")
 	require.NoError(t, err)
+	_, err = storage.db.Exec("DELETE FROM order_status_tokens")
+	require.NoError(t, err)
+	_, err = storage.db.Exec("DELETE FROM order_search")
+	require.NoError(t, err)
+	_, err = storage.db.Exec("DELETE FROM orders_raw")
+	require.NoError(t, err)
+	_, err = storage.db.Exec("DELETE FROM order_keys")
+	require.NoError(t, err)
 	storage.redis.FlushDB(context.Background())
 
 	return storage
@@ -68,23 +81,23 @@ func TestStorage_SaveAndGetOrder(t *testing.T) {
 			RequestID:    "",
 			Currency:     "USD",
 			Provider:     "wbpay",
-			Amount:       1000,
+			Amount:       models.NewMoney(1000, "USD"),
 			PaymentDt:    time.Now().Unix(),
 			Bank:         "sber",
-			DeliveryCost: 500,
-			GoodsTotal:   500,
-			CustomFee:    0,
+			DeliveryCost: models.NewMoney(500, "USD"),
+			GoodsTotal:   models.NewMoney(500, "USD"),
+			CustomFee:    models.NewMoney(0, "USD"),
 		},
 		Items: []models.Item{
 			{
 				ChrtID:      1234567,
 				TrackNumber: "WBIL12345678",
-				Price:       100,
+				Price:       models.NewMoney(100, "USD"),
 				Rid:         "rid123",
 				Name:        "Test Item",
 				Sale:        10,
 				Size:        "1",
-				TotalPrice:  90,
+				TotalPrice:  models.NewMoney(90, "USD"),
 				NmID:        1234567,
 				Brand:       "Test Brand",
 				Status:      200,
@@ -108,7 +121,7 @@ func TestStorage_SaveAndGetOrder(t *testing.T) {
 	})
 
 	t.Run("GetOrder from DB", func(t *testing.T) {
-		order, err := s.GetOrder(testOrder.OrderUID)
+		order, _, err := s.GetOrder(ctx, testOrder.OrderUID)
 		require.NoError(t, err)
 		require.Equal(t, testOrder.OrderUID, order.OrderUID)
 		require.Equal(t, testOrder.Delivery.Name, order.Delivery.Name)
@@ -117,17 +130,17 @@ func TestStorage_SaveAndGetOrder(t *testing.T) {
 
 	t.Run("GetOrder from Cache", func(t *testing.T) {
 		// 1st call GET must download to cache
-		_, err := s.GetOrder(testOrder.OrderUID)
+		_, _, err := s.GetOrder(ctx, testOrder.OrderUID)
 		require.NoError(t, err)
 
 		// 2nd call GET must get data from cache
-		order, err := s.GetOrder(testOrder.OrderUID)
+		order, _, err := s.GetOrder(ctx, testOrder.OrderUID)
 		require.NoError(t, err)
 		require.Equal(t, testOrder.OrderUID, order.OrderUID)
 	})
 
 	t.Run("GetOrder not found", func(t *testing.T) {
-		_, err := s.GetOrder("nonexistent")
+		_, _, err := s.GetOrder(ctx, "nonexistent")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "not found")
 	})
@@ -151,12 +164,126 @@ func TestStorage_PreloadCache(t *testing.T) {
 	}
 
 	// Check preload
-	err := s.preloadCache()
+	err := s.preloadCache(ctx)
 	require.NoError(t, err)
 
 	// Check that data was saved in cache
 	for _, uid := range []string{"order1", "order2", "order3"} {
-		_, err := s.getFromCache(ctx, uid)
+		_, _, err := s.getFromCache(ctx, uid)
+		require.NoError(t, err)
+	}
+}
+
+func TestStorage_UpsertReplacesOrder(t *testing.T) {
+	s := setupTestStorage(t)
+	defer cleanupTestStorage(t, s)
+	ctx := context.Background()
+
+	created := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	order := models.Order{OrderUID: "upsert1", DateCreated: created, Payment: models.Payment{Currency: "USD"},
+		Items: []models.Item{{ChrtID: 1, Name: "first"}, {ChrtID: 2, Name: "second"}}}
+	require.NoError(t, s.SaveOrder(ctx, order))
+
+	// insert mode keeps the stored order
+	require.ErrorIs(t, s.SaveOrder(ctx, order), ErrOrderExists)
+
+	// upsert takes the ON CONFLICT branch (xmax <> 0) and replaces the order, here moving it to another month
+	s.writeMode = models.WriteUpsert
+	order.DateCreated = time.Date(2024, 2, 3, 10, 0, 0, 0, time.UTC)
+	order.Items = []models.Item{{ChrtID: 3, Name: "third"}}
+	require.NoError(t, s.SaveOrder(ctx, order))
+
+	stored, err := s.getFromDB(ctx, "upsert1")
+	require.NoError(t, err)
+	require.True(t, order.DateCreated.Equal(stored.DateCreated))
+	require.Len(t, stored.Items, 1)
+	require.Equal(t, "third", stored.Items[0].Name)
+
+	var orders, items int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM orders WHERE order_uid = $1`, "upsert1").Scan(&orders))
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM items WHERE order_uid = $1`, "upsert1").Scan(&items))
+	require.Equal(t, 1, orders)
+	require.Equal(t, 1, items)
+
+	// a new order_uid takes the insert branch (xmax = 0) in upsert mode too
+	require.NoError(t, s.SaveOrder(ctx, models.Order{OrderUID: "upsert2", DateCreated: created}))
+	var keys int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM order_keys WHERE order_uid IN ('upsert1', 'upsert2')`).Scan(&keys))
+	require.Equal(t, 2, keys)
+}
+
+// TestStorage_PartitionMigration runs the partitioning migration 000007 down and up again over existing orders
+func TestStorage_PartitionMigration(t *testing.T) {
+	s := setupTestStorage(t)
+	defer cleanupTestStorage(t, s)
+	m, err := newMigrator(s.db, "file://../../migrations")
+	require.NoError(t, err)
+	// the schema is restored for the other tests whatever happens
+	defer func() { require.NoError(t, ignoreNoChange(m.Up())) }()
+
+	require.NoError(t, m.Migrate(6))
+	// orders of two months in the unpartitioned schema
+	for i, created := range []string{"2023-11-20T10:00:00Z", "2023-12-05T10:00:00Z"} {
+		uid := []string{"part1", "part2"}[i]
+		_, err = s.db.Exec(`INSERT INTO orders (order_uid, track_number, entry, locale, customer_id, delivery_service,
+			shardkey, sm_id, date_created, oof_shard) VALUES ($1, 'T', 'WBIL', 'en', 'c', 'meest', '1', 1, $2, '1')`, uid, created)
+		require.NoError(t, err)
+		_, err = s.db.Exec(`INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
+			VALUES ($1, 'n', 'p', 'z', 'c', 'a', 'r', 'e')`, uid)
+		require.NoError(t, err)
+		_, err = s.db.Exec(`INSERT INTO payments (order_uid, transaction, currency, provider, amount, payment_dt, bank,
+			delivery_cost, goods_total, custom_fee) VALUES ($1, $1, 'USD', 'wbpay', 1817, 1, 'alpha', 1500, 317, 0)`, uid)
+		require.NoError(t, err)
+		_, err = s.db.Exec(`INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size,
+			total_price, nm_id, brand, status) VALUES ($1, 1, 'T', 453, 'r', 'n', 30, '0', 317, 1, 'b', 202),
+			($1, 2, 'T', 453, 'r', 'n', 30, '0', 317, 1, 'b', 202)`, uid)
 		require.NoError(t, err)
+		_, err = s.db.Exec(`INSERT INTO order_status_tokens (order_uid, token) VALUES ($1, $1)`, uid)
+		require.NoError(t, err)
+	}
+	var maxID int64
+	require.NoError(t, s.db.QueryRow(`SELECT max(id) FROM items`).Scan(&maxID))
+
+	require.NoError(t, m.Migrate(7))
+	for _, partition := range []string{"orders_202311", "items_202312", "payments_202311", "deliveries_202312"} {
+		var exists bool
+		require.NoError(t, s.db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, partition).Scan(&exists))
+		require.True(t, exists, partition)
+	}
+	counts := func() (orders, keys, items int) {
+		require.NoError(t, s.db.QueryRow(`SELECT (SELECT count(*) FROM orders), (SELECT count(*) FROM order_keys),
+			(SELECT count(*) FROM items)`).Scan(&orders, &keys, &items))
+		return
+	}
+	orders, keys, items := counts()
+	require.Equal(t, []int{2, 2, 4}, []int{orders, keys, items})
+	var itemsIn202311 int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM items_202311 WHERE order_uid = 'part1'`).Scan(&itemsIn202311))
+	require.Equal(t, 2, itemsIn202311)
+	// the item ids are kept and the sequence continues after them
+	var nextID int64
+	require.NoError(t, s.db.QueryRow(`SELECT nextval('items_id_seq')`).Scan(&nextID))
+	require.Greater(t, nextID, maxID)
+
+	// and back, the rows return to the unpartitioned tables
+	require.NoError(t, m.Migrate(6))
+	var rows int
+	require.NoError(t, s.db.QueryRow(`SELECT (SELECT count(*) FROM orders) + (SELECT count(*) FROM deliveries) +
+		(SELECT count(*) FROM payments) + (SELECT count(*) FROM items)`).Scan(&rows))
+	require.Equal(t, 10, rows)
+
+	require.NoError(t, m.Up())
+	orders, keys, items = counts()
+	require.Equal(t, []int{2, 2, 4}, []int{orders, keys, items})
+	// the amounts were converted to minor units on the way up (000026)
+	var amount int64
+	require.NoError(t, s.db.QueryRow(`SELECT amount FROM payments WHERE order_uid = 'part1'`).Scan(&amount))
+	require.Equal(t, int64(181700), amount)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
 	}
+	return err
 }
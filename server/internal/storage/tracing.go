@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"WB_LVL0/server/tracing"
+	"context"
+	"github.com/go-redis/redis/v8"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("storage")
+
+// redisTracing is the hook of the Redis client wrapping every command and pipeline in a client span
+type redisTracing struct {
+	addr string
+}
+
+func (h redisTracing) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = tracer.Start(ctx, "redis "+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameRedis, semconv.DBOperationName(cmd.Name()), semconv.ServerAddress(h.addr)))
+	return ctx, nil
+}
+
+func (h redisTracing) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (h redisTracing) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = tracer.Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameRedis, semconv.DBOperationBatchSize(len(cmds)), semconv.ServerAddress(h.addr)))
+	return ctx, nil
+}
+
+func (h redisTracing) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	endRedisSpan(ctx, err)
+	return nil
+}
+
+// endRedisSpan ends the span started by the hook, a missing key is a regular reply
+func endRedisSpan(ctx context.Context, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	tracing.End(trace.SpanFromContext(ctx), err)
+}
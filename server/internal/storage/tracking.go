@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+func shipmentKey(provider, trackNumber string) string {
+	return "tracking:" + provider + ":" + trackNumber
+}
+
+// CachedShipment returns the cached tracking status of the shipment, nil if it isn't cached
+func (s *Storage) CachedShipment(ctx context.Context, provider, trackNumber string) (*models.Shipment, error) {
+	const op = "storage.CachedShipment"
+	val, err := s.redis.Get(ctx, shipmentKey(provider, trackNumber)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	var shipment models.Shipment
+	if err := json.Unmarshal(val, &shipment); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return &shipment, nil
+}
+
+// CacheShipment keeps the tracking status of the shipment for ttl
+func (s *Storage) CacheShipment(ctx context.Context, shipment *models.Shipment, ttl time.Duration) error {
+	const op = "storage.CacheShipment"
+	val, err := json.Marshal(shipment)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if err := s.redis.Set(ctx, shipmentKey(shipment.Provider, shipment.TrackNumber), val, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
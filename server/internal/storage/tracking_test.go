@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShipmentCache(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	storage := &Storage{redis: rdb}
+	shipment := &models.Shipment{TrackNumber: "WBILMTESTTRACK", Provider: "dhl", Status: models.ShipmentInTransit,
+		FetchedAt: time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC)}
+	val, err := json.Marshal(shipment)
+	require.NoError(t, err)
+
+	mock.ExpectGet("tracking:dhl:WBILMTESTTRACK").RedisNil()
+	cached, err := storage.CachedShipment(context.Background(), "dhl", "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.Nil(t, cached)
+
+	mock.ExpectSet("tracking:dhl:WBILMTESTTRACK", val, 10*time.Minute).SetVal("OK")
+	require.NoError(t, storage.CacheShipment(context.Background(), shipment, 10*time.Minute))
+
+	mock.ExpectGet("tracking:dhl:WBILMTESTTRACK").SetVal(string(val))
+	cached, err = storage.CachedShipment(context.Background(), "dhl", "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.Equal(t, shipment, cached)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// UpdateOrder replaces the stored order with order as a whole in one transaction: the orders row is written
+// again and the delivery, payment and items are deleted and inserted anew, whatever the write mode. The order
+// keeps its status token; the change is appended to the event log as order_updated and emitted as the
+// order_updated outbox event. ErrOrderNotFound if the order isn't stored or is deleted.
+func (s *Storage) UpdateOrder(ctx context.Context, order models.Order) (err error) {
+	const op = "storage.UpdateOrder"
+	defer s.observeQuery(opUpdateOrder, time.Now(), &err)
+	var customerID string
+	err = s.retryTx(ctx, op, func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttributes(tracing.OrderUID(order.OrderUID))
+		var err error
+		customerID, err = s.updateOrder(ctx, order)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	// the cached copy is stale now, the next read repopulates it
+	if err := s.invalidateOrder(ctx, order.OrderUID); err != nil {
+		logger.Error("failed to invalidate updated order", "order_uid", order.OrderUID, logging.Err(err))
+	}
+	if customerID != "" && customerID != order.CustomerID && s.cache().CustomerOrdersLimit > 0 {
+		// the order moved from customerID, invalidateOrder dropped the cached orders of the new customer only
+		if err := s.redis.Del(ctx, customerOrdersKey(customerID), customerSummariesKey(customerID)).Err(); err != nil {
+			logger.Error("failed to drop cached orders of customer", "customer_id", customerID, logging.Err(err))
+		}
+	}
+	logger.Info("order updated", "order_uid", order.OrderUID)
+	return nil
+}
+
+// updateOrder replaces the order within a transaction and returns the customer it belonged to
+func (s *Storage) updateOrder(ctx context.Context, order models.Order) (customerID string, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	q := withStatements(tx, s.stmts)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 1. Lock the stored order against concurrent saves, updates and deletes
+	var deleted bool
+	var stored sql.NullString
+	err = q.QueryRowContext(ctx, `SELECT k.deleted_at IS NOT NULL, o.customer_id FROM order_keys k
+	LEFT JOIN orders o ON o.order_uid = k.order_uid
+	WHERE k.order_uid = $1 FOR UPDATE OF k`, order.OrderUID).Scan(&deleted, &stored)
+	if errors.Is(err, sql.ErrNoRows) || deleted {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	// 2. Append the update to the event log, the order tables below are its projection
+	raw, err := currentPayload(order)
+	if err != nil {
+		return "", err
+	}
+	if err = appendOrderEvent(ctx, q, order.OrderUID, models.OrderEventUpdated, raw, nil); err != nil {
+		return "", err
+	}
+
+	// 3. Replace the order rows: the upsert deletes the stored ones and inserts the new
+	if _, err = s.projectOrder(ctx, q, order, raw, true); err != nil {
+		return "", err
+	}
+
+	// 4. Emit the update with the token of the order
+	token, err := existingStatusToken(ctx, q, order.OrderUID)
+	if err != nil {
+		return "", err
+	}
+	event := models.OrderSavedEvent{Order: order, StatusToken: token}
+	if err = insertOutboxEvent(ctx, q, models.EventOrderUpdated, order.OrderUID, event); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stored.String, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rdb, redisMock := redismock.NewClientMock()
+
+	// the insert write mode doesn't matter, the order is replaced
+	storage := &Storage{db: db, redis: rdb, writeMode: models.WriteInsert}
+	order := models.Order{OrderUID: "test123", CustomerID: "c1", Items: []models.Item{{Name: "a"}, {Name: "b"}}}
+
+	t.Run("replaced", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT k.deleted_at IS NOT NULL, o.customer_id FROM order_keys k .* FOR UPDATE OF k`).
+			WithArgs("test123").WillReturnRows(sqlmock.NewRows([]string{"deleted", "customer_id"}).AddRow(false, "c1"))
+		mock.ExpectExec("INSERT INTO order_event_log").WithArgs("test123", models.OrderEventUpdated, sqlmock.AnyArg(), models.CurrentSchemaVersion, nil, nil, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("INSERT INTO order_keys .* ON CONFLICT \\(order_uid\\) DO UPDATE").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+		mock.ExpectExec("DELETE FROM orders").WithArgs("test123").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("INSERT INTO order_search").WithArgs(`{"test123"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT token FROM order_status_tokens").WithArgs("test123").
+			WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("tok"))
+		mock.ExpectExec("INSERT INTO outbox").WithArgs(models.EventOrderUpdated, "test123", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		redisMock.ExpectTxPipeline()
+		redisMock.ExpectDel("test123").SetVal(1)
+		redisMock.ExpectZRem(lruKey, "test123").SetVal(1)
+		redisMock.ExpectTxPipelineExec()
+
+		require.NoError(t, storage.UpdateOrder(context.Background(), order))
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT k.deleted_at IS NOT NULL").WithArgs("test123").WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, storage.UpdateOrder(context.Background(), order), ErrOrderNotFound)
+	})
+
+	t.Run("deleted order", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT k.deleted_at IS NOT NULL").WithArgs("test123").
+			WillReturnRows(sqlmock.NewRows([]string{"deleted", "customer_id"}).AddRow(true, "c1"))
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, storage.UpdateOrder(context.Background(), order), ErrOrderNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
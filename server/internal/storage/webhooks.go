@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// webhookSecretBytes is the length of generated signing secrets (256 bits)
+const webhookSecretBytes = 32
+
+var (
+	// ErrWebhookNotFound is returned when there is no webhook subscription with the requested id
+	ErrWebhookNotFound = fmt.Errorf("webhook subscription %w", models.ErrNotFound)
+	// ErrWebhookDeliveryNotFound is returned when there is no dead delivery with the requested id
+	ErrWebhookDeliveryNotFound = fmt.Errorf("dead webhook delivery %w", models.ErrNotFound)
+)
+
+// CreateWebhook stores the subscription; a signing secret is generated if it has none.
+// The returned subscription carries the secret.
+func (s *Storage) CreateWebhook(ctx context.Context, sub models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	const op = "storage.CreateWebhook"
+	if sub.Secret == "" {
+		buf := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("%s: failed to generate secret: %v", op, err)
+		}
+		sub.Secret = "whsec_" + hex.EncodeToString(buf)
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_subscriptions (url, event_types, secret) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		sub.URL, pq.Array(sub.EventTypes), sub.Secret,
+	).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return &sub, nil
+}
+
+// ListWebhooks returns the subscriptions without their secrets, newest first
+func (s *Storage) ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	const op = "storage.ListWebhooks"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, url, event_types, created_at FROM webhook_subscriptions ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	subs := make([]models.WebhookSubscription, 0)
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		subs = append(subs, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return subs, nil
+}
+
+// DeleteWebhook removes the subscription together with its deliveries
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64) error {
+	const op = "storage.DeleteWebhook"
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery of the outbox event for every subscription
+// to its type and returns their number. Enqueueing an event again creates no duplicates.
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, event models.OutboxEvent) (int64, error) {
+	const op = "storage.EnqueueWebhookDeliveries"
+	res, err := s.db.ExecContext(ctx, `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type)
+	SELECT id, $1::bigint, $2::text FROM webhook_subscriptions WHERE cardinality(event_types) = 0 OR $2 = ANY(event_types)
+	ON CONFLICT (subscription_id, event_id) DO NOTHING`, event.ID, event.EventType)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	return n, nil
+}
+
+// ClaimWebhookDeliveries leases the due pending deliveries with their subscription and event: they are
+// hidden from the dispatchers of other instances for the lease, so a crashed dispatcher's claims are
+// retried after it.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	const op = "storage.ClaimWebhookDeliveries"
+	query := `WITH claimed AS (
+		UPDATE webhook_deliveries SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, subscription_id, event_id, event_type, attempts, created_at
+	)
+	SELECT c.id, c.subscription_id, c.event_id, c.event_type, c.attempts, c.created_at,
+		w.url, w.secret, o.aggregate_id, o.payload, o.created_at
+	FROM claimed c
+	JOIN webhook_subscriptions w ON w.id = c.subscription_id
+	JOIN outbox o ON o.id = c.event_id
+	ORDER BY c.event_id`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d := models.WebhookDelivery{Status: models.WebhookPending}
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Attempts, &d.CreatedAt,
+			&d.URL, &d.Secret, &d.Event.AggregateID, &payload, &d.Event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		d.Event.ID = d.EventID
+		d.Event.EventType = d.EventType
+		d.Event.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records the successful attempt of the delivery
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, id int64, statusCode int) error {
+	const op = "storage.MarkWebhookDelivered"
+	_, err := s.db.ExecContext(ctx, `UPDATE webhook_deliveries
+	SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now()
+	WHERE id = $1`, id, statusCode)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// MarkWebhookFailed records the failed attempt of the delivery: it is retried at next,
+// or becomes dead if dead is set. statusCode is 0 when no response was received.
+func (s *Storage) MarkWebhookFailed(ctx context.Context, id int64, statusCode int, reason string, next time.Time, dead bool) error {
+	const op = "storage.MarkWebhookFailed"
+	status := models.WebhookPending
+	if dead {
+		status = models.WebhookDead
+	}
+	code := sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}
+	_, err := s.db.ExecContext(ctx, `UPDATE webhook_deliveries
+	SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4, next_attempt_at = $5
+	WHERE id = $1`, id, status, code, reason, next)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a subscription matching the filter, newest first
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, f models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	const op = "storage.ListWebhookDeliveries"
+	rows, err := s.db.QueryContext(ctx, `SELECT id, subscription_id, event_id, event_type, status, attempts,
+		last_status_code, last_error, next_attempt_at, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE subscription_id = $1 AND ($2::text = '' OR status = $2)
+	ORDER BY id DESC LIMIT $3 OFFSET $4`, f.SubscriptionID, f.Status, f.Limit, f.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var code sql.NullInt64
+		var reason sql.NullString
+		var deliveredAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&code, &reason, &d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		d.LastStatusCode = int(code.Int64)
+		d.LastError = reason.String
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery returns a dead delivery to the queue with a fresh set of attempts
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	const op = "storage.RetryWebhookDelivery"
+	res, err := s.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now()
+	WHERE id = $1 AND status = 'dead'`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
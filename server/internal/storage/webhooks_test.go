@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := &Storage{db: db}
+
+	t.Run("create generates the secret", func(t *testing.T) {
+		mock.ExpectQuery("INSERT INTO webhook_subscriptions").
+			WithArgs("https://partner.example/hook", `{"order_saved"}`, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+		sub, err := storage.CreateWebhook(context.Background(),
+			models.WebhookSubscription{URL: "https://partner.example/hook", EventTypes: []string{models.EventOrderSaved}})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), sub.ID)
+		require.True(t, strings.HasPrefix(sub.Secret, "whsec_"))
+		require.Len(t, sub.Secret, len("whsec_")+2*webhookSecretBytes)
+	})
+
+	t.Run("enqueue", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO webhook_deliveries .* ON CONFLICT \\(subscription_id, event_id\\) DO NOTHING").
+			WithArgs(int64(7), models.EventOrderSaved).WillReturnResult(sqlmock.NewResult(0, 2))
+
+		n, err := storage.EnqueueWebhookDeliveries(context.Background(), models.OutboxEvent{ID: 7, EventType: models.EventOrderSaved})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+	})
+
+	t.Run("retry of a delivery that is not dead", func(t *testing.T) {
+		mock.ExpectExec("UPDATE webhook_deliveries SET status = 'pending'").WithArgs(int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.ErrorIs(t, storage.RetryWebhookDelivery(context.Background(), 5), models.ErrNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,67 @@
+package tracking
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// NewProvider returns the tracking client of the delivery service
+func NewProvider(name string) (Provider, error) {
+	switch name {
+	case "dhl":
+		return &stubProvider{name: name, now: time.Now, steps: []stubStep{
+			{models.ShipmentAccepted, "Leipzig Hub", "The shipment has been picked up"},
+			{models.ShipmentInTransit, "Frankfurt Sort Center", "The shipment has been processed in the parcel center"},
+			{models.ShipmentOutForDelivery, "Local delivery station", "The shipment has been loaded onto the delivery vehicle"},
+			{models.ShipmentDelivered, "Recipient", "The shipment has been delivered"},
+		}}, nil
+	case "russianpost":
+		return &stubProvider{name: name, now: time.Now, steps: []stubStep{
+			{models.ShipmentAccepted, "Москва ЦСП", "Приём"},
+			{models.ShipmentInTransit, "Москва МСЦ", "Обработка: покинуло сортировочный центр"},
+			{models.ShipmentOutForDelivery, "Отделение связи", "Прибыло в место вручения"},
+			{models.ShipmentDelivered, "Отделение связи", "Вручение адресату"},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unknown tracking provider %q (expected dhl or russianpost)", name)
+	}
+}
+
+type stubStep struct {
+	status      string
+	location    string
+	description string
+}
+
+// stubProvider stands in for the API of a delivery service until its client is implemented: it derives
+// a stable history from the track number (a step a day, the last one within the hour), so the endpoint
+// and its caching and rate limiting work end to end
+type stubProvider struct {
+	name  string
+	steps []stubStep
+	now   func() time.Time
+}
+
+func (p *stubProvider) Name() string { return p.name }
+
+func (p *stubProvider) Track(_ context.Context, trackNumber string) (*models.Shipment, error) {
+	h := fnv.New32a()
+	h.Write([]byte(trackNumber))
+	reached := int(h.Sum32() % uint32(len(p.steps)))
+	last := p.now().UTC().Truncate(time.Hour)
+
+	shipment := &models.Shipment{TrackNumber: trackNumber, Provider: p.name}
+	for i, step := range p.steps[:reached+1] {
+		shipment.Events = append(shipment.Events, models.ShipmentEvent{
+			Time:        last.Add(-time.Duration(reached-i) * 24 * time.Hour),
+			Status:      step.status,
+			Location:    step.location,
+			Description: step.description,
+		})
+		shipment.Status = step.status
+	}
+	return shipment, nil
+}
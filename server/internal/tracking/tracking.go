@@ -0,0 +1,126 @@
+package tracking
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+var logger = logging.Component("tracking")
+
+// ErrNoProvider is returned for the orders of delivery services without a tracking provider
+var ErrNoProvider = errors.New("delivery service is not tracked")
+
+// RateLimitedError is returned when a request to the provider would wait for its rate limit longer than the timeout
+type RateLimitedError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit of %s is exceeded, retry after %v", e.Provider, e.RetryAfter)
+}
+
+// Provider fetches the shipment status from the API of a delivery service
+type Provider interface {
+	Name() string
+	Track(ctx context.Context, trackNumber string) (*models.Shipment, error)
+}
+
+// Cache keeps the fetched shipment statuses, so repeated requests don't reach the providers
+type Cache interface {
+	CachedShipment(ctx context.Context, provider, trackNumber string) (*models.Shipment, error)
+	CacheShipment(ctx context.Context, shipment *models.Shipment, ttl time.Duration) error
+}
+
+type limitedProvider struct {
+	Provider
+	limiter *rate.Limiter
+}
+
+// Tracker returns the shipment statuses of orders from the provider of their delivery service.
+// Statuses are cached for cfg.CacheTTL and requests to every provider are limited to cfg.RateLimit per second.
+type Tracker struct {
+	cache     Cache
+	cfg       models.TrackingCfg
+	providers map[string]limitedProvider
+	now       func() time.Time
+}
+
+// New creates the tracker of the providers in cfg, nil if tracking is disabled
+func New(cache Cache, cfg models.TrackingCfg) (*Tracker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	t := &Tracker{cache: cache, cfg: cfg, providers: make(map[string]limitedProvider, len(cfg.Providers)), now: time.Now}
+	for _, name := range cfg.Providers {
+		p, err := NewProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		t.providers[name] = limitedProvider{Provider: p, limiter: rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.Burst)}
+	}
+	return t, nil
+}
+
+// Track returns the status of the shipment at the delivery service; cached is set if it was served from the cache
+func (t *Tracker) Track(ctx context.Context, deliveryService, trackNumber string) (shipment *models.Shipment, cached bool, err error) {
+	p, ok := t.providers[deliveryService]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrNoProvider, deliveryService)
+	}
+	shipment, err = t.cache.CachedShipment(ctx, p.Name(), trackNumber)
+	if err != nil {
+		// the provider is asked instead
+		logger.Warn("failed to read cached shipment", "provider", p.Name(), "track_number", trackNumber, logging.Err(err))
+	}
+	if shipment != nil {
+		metrics.TrackingRequests.WithLabelValues(p.Name(), "cache").Inc()
+		return shipment, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+	if err := t.wait(ctx, p); err != nil {
+		return nil, false, err
+	}
+	shipment, err = p.Track(ctx, trackNumber)
+	if err != nil {
+		metrics.TrackingRequests.WithLabelValues(p.Name(), "error").Inc()
+		return nil, false, fmt.Errorf("tracking %s: %w", p.Name(), err)
+	}
+	metrics.TrackingRequests.WithLabelValues(p.Name(), "fetched").Inc()
+	shipment.FetchedAt = t.now()
+	if err := t.cache.CacheShipment(ctx, shipment, t.cfg.CacheTTL); err != nil {
+		logger.Warn("failed to cache shipment", "provider", p.Name(), "track_number", trackNumber, logging.Err(err))
+	}
+	return shipment, false, nil
+}
+
+// wait takes a token of the provider's rate limit, rejecting the request if the token comes later than the timeout
+func (t *Tracker) wait(ctx context.Context, p limitedProvider) error {
+	r := p.limiter.Reserve()
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if delay > t.cfg.Timeout {
+		r.Cancel()
+		metrics.TrackingRequests.WithLabelValues(p.Name(), "rate_limited").Inc()
+		return &RateLimitedError{Provider: p.Name(), RetryAfter: delay}
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
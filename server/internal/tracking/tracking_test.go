@@ -0,0 +1,80 @@
+package tracking
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mapCache map[string]*models.Shipment
+
+func (c mapCache) CachedShipment(_ context.Context, provider, trackNumber string) (*models.Shipment, error) {
+	return c[provider+":"+trackNumber], nil
+}
+
+func (c mapCache) CacheShipment(_ context.Context, shipment *models.Shipment, _ time.Duration) error {
+	c[shipment.Provider+":"+shipment.TrackNumber] = shipment
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	cache := mapCache{}
+	tracker, err := New(cache, models.TrackingCfg{Enabled: true, Providers: []string{"dhl", "russianpost"},
+		CacheTTL: time.Minute, RateLimit: 0.1, Burst: 1, Timeout: time.Second})
+	require.NoError(t, err)
+
+	shipment, cached, err := tracker.Track(context.Background(), "dhl", "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.False(t, cached)
+	require.Equal(t, "dhl", shipment.Provider)
+	require.Same(t, shipment, cache["dhl:WBILMTESTTRACK"])
+
+	// served from the cache without taking the rate limit
+	again, cached, err := tracker.Track(context.Background(), "dhl", "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.True(t, cached)
+	require.Same(t, shipment, again)
+
+	// the next token of dhl comes in 10s, beyond the timeout; the limits are per provider
+	_, _, err = tracker.Track(context.Background(), "dhl", "WBILMOTHERTRACK")
+	var limited *RateLimitedError
+	require.ErrorAs(t, err, &limited)
+	require.Equal(t, "dhl", limited.Provider)
+	require.InDelta(t, 10*time.Second, limited.RetryAfter, float64(time.Second))
+	_, _, err = tracker.Track(context.Background(), "russianpost", "WBILMOTHERTRACK")
+	require.NoError(t, err)
+
+	_, _, err = tracker.Track(context.Background(), "meest", "WBILMTESTTRACK")
+	require.ErrorIs(t, err, ErrNoProvider)
+}
+
+func TestStubProvider(t *testing.T) {
+	now := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	p, err := NewProvider("russianpost")
+	require.NoError(t, err)
+	p.(*stubProvider).now = func() time.Time { return now }
+
+	shipment, err := p.Track(context.Background(), "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.NotEmpty(t, shipment.Events)
+	// the history is stable and ends with the current status within the hour
+	last := shipment.Events[len(shipment.Events)-1]
+	require.Equal(t, shipment.Status, last.Status)
+	require.Equal(t, now.Truncate(time.Hour), last.Time)
+	require.Equal(t, models.ShipmentAccepted, shipment.Events[0].Status)
+	again, err := p.Track(context.Background(), "WBILMTESTTRACK")
+	require.NoError(t, err)
+	require.Equal(t, shipment, again)
+
+	_, err = NewProvider("meest")
+	require.Error(t, err)
+}
+
+func TestNewDisabled(t *testing.T) {
+	tracker, err := New(mapCache{}, models.TrackingCfg{})
+	require.NoError(t, err)
+	require.Nil(t, tracker)
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Headers of the requests to subscribers
+const (
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEventID   = "X-Event-Id"
+	HeaderEventType = "X-Event-Type"
+	// HeaderSignature is "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>" with the subscription secret>"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxErrorBody bounds the part of an error response kept as the reason of the failed attempt
+const maxErrorBody = 256
+
+var logger = logging.Component("webhook")
+
+// Store is interface of the webhook subscriptions and deliveries tables
+type Store interface {
+	EnqueueWebhookDeliveries(ctx context.Context, event models.OutboxEvent) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id int64, statusCode int) error
+	MarkWebhookFailed(ctx context.Context, id int64, statusCode int, reason string, next time.Time, dead bool) error
+}
+
+// Dispatcher sends the pending deliveries to the subscribers. A delivery is signed with the secret
+// of its subscription; failed ones are retried with exponential backoff until they run out of attempts
+// and become dead. Dispatchers of several service instances share the deliveries by leasing them.
+type Dispatcher struct {
+	store  Store
+	cfg    models.WebhookCfg
+	client *http.Client
+	now    func() time.Time
+	errs   health.LastError // last failed poll of the deliveries
+}
+
+// NewDispatcher creates the dispatcher of cfg, nil if webhooks are disabled
+func NewDispatcher(store Store, cfg models.WebhookCfg) *Dispatcher {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Dispatcher{store: store, cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}, now: time.Now}
+}
+
+// Run sends the due deliveries every poll interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := d.dispatchBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("webhook dispatch failed", logging.Err(err))
+		}
+		d.errs.Set(err)
+	}
+}
+
+func (d *Dispatcher) dispatchBatch(ctx context.Context) error {
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.cfg.BatchSize, d.cfg.Lease)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if err := d.dispatch(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch makes one attempt of the delivery and records its outcome
+func (d *Dispatcher) dispatch(ctx context.Context, delivery models.WebhookDelivery) error {
+	statusCode, err := d.send(ctx, delivery)
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+		return d.store.MarkWebhookDelivered(ctx, delivery.ID, statusCode)
+	}
+	if ctx.Err() != nil {
+		// shutdown: the lease expires and the attempt is made again
+		return ctx.Err()
+	}
+	attempt := delivery.Attempts + 1
+	dead := attempt >= d.cfg.MaxAttempts
+	next := d.now().Add(d.backoff(attempt))
+	if dead {
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		logger.Error("webhook delivery is dead", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID,
+			"event_id", delivery.EventID, "attempts", attempt, logging.Err(err))
+	} else {
+		metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+		logger.Warn("webhook delivery failed", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID,
+			"event_id", delivery.EventID, "attempt", attempt, "next_attempt_at", next, logging.Err(err))
+	}
+	return d.store.MarkWebhookFailed(ctx, delivery.ID, statusCode, err.Error(), next, dead)
+}
+
+// send posts the event to the subscriber, any 2xx response is a success
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderEventID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, d.now(), body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the delay after the failed attempt: InitialBackoff doubling with every attempt up to MaxBackoff
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+// Health is degraded while the last poll of the deliveries failed
+func (d *Dispatcher) Health(context.Context) health.Result {
+	return d.errs.Result()
+}
+
+// Sign returns the signature header of body sent at t. Subscribers recompute the HMAC over
+// "<t>.<body>" with their secret and reject stale timestamps to prevent replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fanout is the outbox destination turning the order events into deliveries of the subscriptions to them
+type Fanout struct {
+	store Store
+}
+
+func NewFanout(store Store) *Fanout {
+	return &Fanout{store: store}
+}
+
+func (f *Fanout) Name() string { return models.WebhookDestination }
+
+func (f *Fanout) Accepts(event models.OutboxEvent) bool {
+	return slices.Contains(models.WebhookEventTypes, event.EventType)
+}
+
+func (f *Fanout) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	n, err := f.store.EnqueueWebhookDeliveries(ctx, event)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logger.Debug("webhook deliveries enqueued", "event_id", event.ID, "deliveries", n)
+	}
+	return nil
+}
+
+func (f *Fanout) Close() error { return nil }
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type attempt struct {
+	id         int64
+	statusCode int
+	next       time.Time
+	dead       bool
+}
+
+type stubStore struct {
+	Store
+	deliveries []models.WebhookDelivery
+	delivered  []attempt
+	failed     []attempt
+}
+
+func (s *stubStore) ClaimWebhookDeliveries(context.Context, int, time.Duration) ([]models.WebhookDelivery, error) {
+	claimed := s.deliveries
+	s.deliveries = nil
+	return claimed, nil
+}
+
+func (s *stubStore) MarkWebhookDelivered(_ context.Context, id int64, statusCode int) error {
+	s.delivered = append(s.delivered, attempt{id: id, statusCode: statusCode})
+	return nil
+}
+
+func (s *stubStore) MarkWebhookFailed(_ context.Context, id int64, statusCode int, _ string, next time.Time, dead bool) error {
+	s.failed = append(s.failed, attempt{id: id, statusCode: statusCode, next: next, dead: dead})
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var signatures []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// the subscriber verifies the signature with its secret
+		mac := hmac.New(sha256.New, []byte("whsec_test"))
+		mac.Write([]byte("1704067200." + string(body)))
+		require.Equal(t, "t=1704067200,v1="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(HeaderSignature))
+		require.Equal(t, models.EventOrderSaved, r.Header.Get(HeaderEventType))
+		signatures = append(signatures, r.Header.Get(HeaderSignature))
+		if strings.HasSuffix(r.URL.Path, "/down") {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	delivery := func(id int64, path string, attempts int) models.WebhookDelivery {
+		return models.WebhookDelivery{ID: id, EventID: 7, EventType: models.EventOrderSaved, Attempts: attempts,
+			URL: srv.URL + path, Secret: "whsec_test",
+			Event: models.OutboxEvent{ID: 7, EventType: models.EventOrderSaved, Payload: []byte(`{"order_uid":"test123"}`)}}
+	}
+	store := &stubStore{deliveries: []models.WebhookDelivery{
+		delivery(1, "/ok", 0),
+		delivery(2, "/down", 2),
+		delivery(3, "/down", 4),
+	}}
+	d := NewDispatcher(store, models.WebhookCfg{Enabled: true, BatchSize: 10, Timeout: time.Second, MaxAttempts: 5,
+		InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+	d.now = func() time.Time { return now }
+
+	require.NoError(t, d.dispatchBatch(context.Background()))
+	require.Len(t, signatures, 3)
+	require.Equal(t, []attempt{{id: 1, statusCode: http.StatusNoContent}}, store.delivered)
+	// the third attempt waits 40s, the fifth is the last one
+	require.Equal(t, []attempt{
+		{id: 2, statusCode: http.StatusServiceUnavailable, next: now.Add(40 * time.Second)},
+		{id: 3, statusCode: http.StatusServiceUnavailable, next: now.Add(time.Minute), dead: true},
+	}, store.failed)
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: models.WebhookCfg{InitialBackoff: 10 * time.Second, MaxBackoff: time.Hour}}
+	require.Equal(t, 10*time.Second, d.backoff(1))
+	require.Equal(t, 20*time.Second, d.backoff(2))
+	require.Equal(t, 80*time.Second, d.backoff(4))
+	require.Equal(t, time.Hour, d.backoff(20))
+}
+
+func TestNewDispatcherDisabled(t *testing.T) {
+	d := NewDispatcher(&stubStore{}, models.WebhookCfg{})
+	require.Nil(t, d)
+	// a disabled dispatcher returns at once
+	d.Run(context.Background())
+}
@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+// backlogInterval is how often the backlog of the group is measured
+const backlogInterval = 15 * time.Second
+
+// ErrBacklogUnknown is returned by Backlog until the backlog has been measured
+var ErrBacklogUnknown = errors.New("consumer backlog is not measured yet")
+
+// backlogTracker keeps the last measurement of the group backlog and smooths the commit rate between them
+type backlogTracker struct {
+	mu       sync.Mutex
+	last     models.ConsumerBacklog
+	err      error
+	position int64 // sum of the committed offsets at the last measurement
+	rated    bool  // a rate has been measured, later ones are averaged with it
+}
+
+// update records a measurement: behind is the backlog and position the sum of the committed offsets
+func (t *backlogTracker) update(now time.Time, behind, position int64, partitions int) models.ConsumerBacklog {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := models.ConsumerBacklog{MessagesBehind: behind, Partitions: partitions, MeasuredAt: now}
+	if elapsed := now.Sub(t.last.MeasuredAt).Seconds(); !t.last.MeasuredAt.IsZero() && elapsed > 0 {
+		// offsets moved back by a seek don't tell the rate, keep the previous one
+		b.ConsumeRate = t.last.ConsumeRate
+		if committed := position - t.position; committed >= 0 {
+			rate := float64(committed) / elapsed
+			if t.rated {
+				rate = (rate + t.last.ConsumeRate) / 2
+			}
+			b.ConsumeRate, t.rated = rate, true
+		}
+	}
+	switch {
+	case behind == 0:
+		drain := 0.0
+		b.EstimatedDrainSeconds = &drain
+	case b.ConsumeRate > 0:
+		drain := float64(behind) / b.ConsumeRate
+		b.EstimatedDrainSeconds = &drain
+	}
+	t.last, t.err, t.position = b, nil, position
+	return b
+}
+
+func (t *backlogTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// Backlog returns the last measured backlog of the consumer group, with the error of the last
+// measurement if it failed; ErrBacklogUnknown before the first one
+func (c *Consumer) Backlog() (models.ConsumerBacklog, error) {
+	c.backlog.mu.Lock()
+	defer c.backlog.mu.Unlock()
+	if c.backlog.last.MeasuredAt.IsZero() {
+		if c.backlog.err != nil {
+			return models.ConsumerBacklog{}, fmt.Errorf("%w: %w", ErrBacklogUnknown, c.backlog.err)
+		}
+		return models.ConsumerBacklog{}, ErrBacklogUnknown
+	}
+	return c.backlog.last, c.backlog.err
+}
+
+// watchBacklog measures the backlog of the group every backlogInterval and exports it as metrics
+func (c *Consumer) watchBacklog(ctx context.Context) {
+	client := &kafka.Client{Addr: kafka.TCP(c.cfg.Brokers...), Timeout: 10 * time.Second}
+	ticker := time.NewTicker(backlogInterval)
+	defer ticker.Stop()
+	for {
+		behind, position, partitions, err := measureBacklog(ctx, client, c.cfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("failed to measure consumer backlog", logging.Err(err))
+			c.backlog.fail(err)
+		} else {
+			b := c.backlog.update(time.Now(), behind, position, partitions)
+			metrics.ConsumerMessagesBehind.Set(float64(b.MessagesBehind))
+			metrics.ConsumerConsumeRate.Set(b.ConsumeRate)
+			drain := -1.0
+			if b.EstimatedDrainSeconds != nil {
+				drain = *b.EstimatedDrainSeconds
+			}
+			metrics.ConsumerEstimatedDrain.Set(drain)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// measureBacklog returns the messages of the topic behind the committed offsets of the group and the sum of
+// those offsets; a partition without a committed offset is read from its first message
+func measureBacklog(ctx context.Context, client *kafka.Client, cfg models.KafkaCfg) (behind, position int64, partitions int, err error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("metadata: %w", err)
+	}
+	if len(meta.Topics) == 0 || meta.Topics[0].Error != nil {
+		return 0, 0, 0, fmt.Errorf("topic %s not found", cfg.Topic)
+	}
+	ids := make([]int, 0, len(meta.Topics[0].Partitions))
+	requests := make([]kafka.OffsetRequest, 0, 2*len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		ids = append(ids, p.ID)
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	ends, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{cfg.Topic: requests},
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("list offsets: %w", err)
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: cfg.GroupID,
+		Topics:  map[string][]int{cfg.Topic: ids},
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("offset fetch: %w", err)
+	}
+	if committed.Error != nil {
+		return 0, 0, 0, fmt.Errorf("offset fetch: %w", committed.Error)
+	}
+	offsets := make(map[int]int64, len(ids))
+	for _, p := range committed.Topics[cfg.Topic] {
+		if p.Error != nil {
+			return 0, 0, 0, fmt.Errorf("offset fetch of partition %d: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p.CommittedOffset
+	}
+	for _, p := range ends.Topics[cfg.Topic] {
+		if p.Error != nil {
+			return 0, 0, 0, fmt.Errorf("list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		b, pos := partitionBacklog(p.FirstOffset, p.LastOffset, offsets[p.Partition])
+		behind += b
+		position += pos
+	}
+	return behind, position, len(ids), nil
+}
+
+// partitionBacklog returns the messages between the committed offset (the next one to read, below 0 - none
+// committed) and the end of the partition, and the position the group is at
+func partitionBacklog(first, last, committed int64) (behind, position int64) {
+	position = committed
+	if position < first {
+		position = first
+	}
+	if last > position {
+		behind = last - position
+	}
+	return behind, position
+}
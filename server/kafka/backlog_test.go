@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionBacklog(t *testing.T) {
+	behind, position := partitionBacklog(0, 100, 40)
+	require.Equal(t, int64(60), behind)
+	require.Equal(t, int64(40), position)
+
+	// nothing committed, the group reads from the first message still retained
+	behind, position = partitionBacklog(30, 100, -1)
+	require.Equal(t, int64(70), behind)
+	require.Equal(t, int64(30), position)
+
+	behind, _ = partitionBacklog(0, 100, 100)
+	require.Zero(t, behind)
+}
+
+func TestBacklogTracker(t *testing.T) {
+	var tr backlogTracker
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// the rate is unknown after the first measurement
+	b := tr.update(at, 600, 1000, 3)
+	require.Zero(t, b.ConsumeRate)
+	require.Nil(t, b.EstimatedDrainSeconds)
+	require.Equal(t, 3, b.Partitions)
+
+	// 200 messages committed in 10s
+	b = tr.update(at.Add(10*time.Second), 500, 1200, 3)
+	require.Equal(t, 20.0, b.ConsumeRate)
+	require.Equal(t, 25.0, *b.EstimatedDrainSeconds)
+
+	// the rate is averaged with the previous one
+	b = tr.update(at.Add(20*time.Second), 400, 1300, 3)
+	require.Equal(t, 15.0, b.ConsumeRate)
+
+	// a seek back keeps the previous rate
+	b = tr.update(at.Add(30*time.Second), 900, 800, 3)
+	require.Equal(t, 15.0, b.ConsumeRate)
+	require.Equal(t, 60.0, *b.EstimatedDrainSeconds)
+
+	b = tr.update(at.Add(40*time.Second), 0, 1700, 3)
+	require.Equal(t, 0.0, *b.EstimatedDrainSeconds)
+}
@@ -1,137 +1,279 @@
 package kafka
 
 import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/ingest"
+	"WB_LVL0/server/internal/logging"
 	"WB_LVL0/server/internal/storage"
 	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/segmentio/kafka-go"
-	"log"
-	"math"
-	"math/rand"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 )
 
-const (
-	//kafkaBroker  = "localhost:9092" -- local
-
-	kafkaBroker     = "kafka:9092"
-	kafkaTopic      = "orders"
-	kafkaDlqTopic   = "orders_dlq"
-	kafkaGroupID    = "order-consumers"
-	maxRetryAttempt = 5
-	initialBackoff  = 100 * time.Millisecond
-	maxBackoff      = 5 * time.Second
+var (
+	logger = logging.Component("kafka")
+	tracer = tracing.Tracer("kafka")
 )
 
-func NewReader() *kafka.Reader {
+// NewReader creates a reader of the orders topic in the consumer group of cfg
+func NewReader(cfg models.KafkaCfg) *kafka.Reader {
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     []string{kafkaBroker},
-		Topic:       kafkaTopic,
-		GroupID:     kafkaGroupID,
+		Brokers:     cfg.Brokers,
+		Topic:       cfg.Topic,
+		GroupID:     cfg.GroupID,
 		MinBytes:    10e3, // 10KB
 		MaxBytes:    10e6, // 10MB
 		StartOffset: kafka.FirstOffset,
-		Logger: kafka.LoggerFunc(func(s string, args ...interface{}) {
-			log.Printf("[KAFKA-CONSUMER] "+s, args...)
-		}),
-		ErrorLogger: kafka.LoggerFunc(func(s string, args ...interface{}) {
-			log.Printf("[KAFKA-CONSUMER-ERROR] "+s, args...)
-		}),
+		Logger:      kafkaLogger(slog.LevelDebug, "reader"),
+		ErrorLogger: kafkaLogger(slog.LevelError, "reader"),
 	})
 	return reader
 }
 
-func NewDLQWriter() *kafka.Writer {
+// NewDLQWriter creates a writer of the dead letter topic of cfg
+func NewDLQWriter(cfg models.KafkaCfg) *kafka.Writer {
 	return &kafka.Writer{
-		Addr:         kafka.TCP(kafkaBroker),
-		Topic:        kafkaDlqTopic,
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.DLQTopic,
 		Balancer:     &kafka.Hash{},
+		Compression:  compression(cfg.Compression),
 		MaxAttempts:  3,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
-		Logger: kafka.LoggerFunc(func(s string, args ...interface{}) {
-			log.Printf("[KAFKA-DLQ] "+s, args...)
-		}),
-		ErrorLogger: kafka.LoggerFunc(func(s string, args ...interface{}) {
-			log.Printf("[KAFKA-DLQ-ERROR] "+s, args...)
-		}),
+		Logger:       kafkaLogger(slog.LevelDebug, "dlq"),
+		ErrorLogger:  kafkaLogger(slog.LevelError, "dlq"),
+	}
+}
+
+// compression returns the codec named by cfg, the config validation rejects unknown names
+func compression(codec string) kafka.Compression {
+	var c kafka.Compression
+	if err := c.UnmarshalText([]byte(codec)); err != nil {
+		return 0
+	}
+	return c
+}
+
+// kafkaLogger passes the messages of a kafka-go client to the kafka logger at level
+func kafkaLogger(level slog.Level, client string) kafka.Logger {
+	return kafka.LoggerFunc(func(s string, args ...interface{}) {
+		// the reader logs every fetch, don't format what isn't logged
+		if ctx := context.Background(); logger.Enabled(ctx, level) {
+			logger.Log(ctx, level, fmt.Sprintf(s, args...), "client", client)
+		}
+	})
+}
+
+// Consumer reads orders from Kafka and processes them with the ingest pipeline, failed messages go to the DLQ topic
+type Consumer struct {
+	cfg      models.KafkaCfg
+	db       storage.Repository
+	pipeline *ingest.Pipeline
+	dlq      *kafka.Writer
+	redrive  *kafka.Writer    // publishes quarantined messages again, see Redrive
+	errs     health.LastError // last read or processing error
+
+	progress health.Progress
+	backlog  backlogTracker
+
+	mu      sync.Mutex
+	reader  *kafka.Reader
+	pending *seekCommand
+}
+
+// NewConsumer creates consumer of the orders topic saving into db. Saved orders are published to hub.
+func NewConsumer(db storage.Repository, hub *broadcast.Hub, cfg models.KafkaCfg) *Consumer {
+	return &Consumer{
+		cfg:      cfg,
+		db:       db,
+		pipeline: ingest.New(db, hub, logger),
+		redrive:  newRedriveWriter(cfg),
 	}
 }
 
-// ReadMSG listens for Kafka messages and processes them with retry and DLQ
-func ReadMSG(db *storage.Storage, reader *kafka.Reader) {
-	dlqWriter := NewDLQWriter()
-	defer dlqWriter.Close()
+func (c *Consumer) currentReader() *kafka.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reader
+}
+
+// Run listens for Kafka messages and processes them with retry and DLQ. The group starts from the offsets
+// stored in Postgres, a message is committed to Kafka after it is processed.
+// It returns (closing the reader) when ctx is cancelled.
+func (c *Consumer) Run(ctx context.Context) {
+	c.dlq = NewDLQWriter(c.cfg)
+	defer c.dlq.Close()
+	// redrives come through the HTTP server, which is shut down first
+	defer c.redrive.Close()
+	// the reader joins the group at once, the group offsets can only be moved before that
+	if c.cfg.DeliverySemantics == models.DeliveryExactlyOnce {
+		c.restoreOffsets(ctx)
+	}
+	c.mu.Lock()
+	c.reader = NewReader(c.cfg)
+	c.mu.Unlock()
+	defer func() {
+		if err := c.currentReader().Close(); err != nil {
+			logger.Error("failed to close kafka reader", logging.Err(err))
+		}
+	}()
+
+	tracker := newPartitionTracker()
+	go watchReader(ctx, c.currentReader, tracker, &c.progress)
+	go c.watchBacklog(ctx)
 
 	for {
-		msg, err := reader.ReadMessage(context.Background())
+		// don't pull new messages while the database is down
+		if err := c.pipeline.WaitAvailable(ctx); err != nil {
+			return
+		}
+		msg, err := c.currentReader().FetchMessage(ctx)
 		if err != nil {
-			log.Printf("Failed to read message: %v", err)
+			if ctx.Err() != nil {
+				return
+			}
+			// the reader was closed to move the group offsets
+			if c.applyPendingSeek(ctx) {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			logger.Error("failed to read message", logging.Err(err))
+			c.errs.Set(err)
+			c.progress.Failed(err)
 			continue
 		}
+		c.progress.Fetched()
+		tracker.observe(msg)
+		// at most once: the message is committed before it is processed, a crash meanwhile loses it
+		if c.cfg.DeliverySemantics == models.DeliveryAtMostOnce {
+			c.commit(ctx, msg)
+		}
 
-		if err := processWithRetry(db, dlqWriter, msg); err != nil {
-			log.Printf("Failed to process message after retries, moved to DLQ: %v", err)
+		msgCtx, span := startProcessSpan(ctx, msg)
+		err = c.pipeline.Process(msgCtx, c.message(msg), settler{c: c, msg: msg})
+		tracing.End(span, err)
+		// not processed, the next consumer of the partition gets it again
+		if errors.Is(err, ingest.ErrStopped) {
+			return
+		}
+		if err != nil {
+			logger.Error("failed to process message after retries, moved to DLQ", logging.Err(err))
+		}
+		c.errs.Set(err)
+		if c.cfg.DeliverySemantics != models.DeliveryAtMostOnce {
+			c.commit(ctx, msg)
 		}
 	}
 }
 
-func processWithRetry(db *storage.Storage, dlqWriter *kafka.Writer, msg kafka.Message) error {
-	var lastErr error
+// startProcessSpan starts the span of processing msg, continuing the trace of its publisher
+func startProcessSpan(ctx context.Context, msg kafka.Message) (context.Context, trace.Span) {
+	return tracer.Start(tracing.Extract(ctx, msg), "process "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaOffset(int(msg.Offset)),
+		))
+}
 
-	for attempt := 0; attempt < maxRetryAttempt; attempt++ {
-		if attempt > 0 {
-			backoff := calculateBackoff(attempt)
-			log.Printf("Retry attempt %d/%d after %v for message offset=%d",
-				attempt, maxRetryAttempt, backoff, msg.Offset)
-			time.Sleep(backoff)
-		}
+// Progress tracks the messages fetched and committed and the failed fetches and commits
+func (c *Consumer) Progress() *health.Progress { return &c.progress }
 
-		err := processMessage(db, msg)
-		if err == nil {
-			return nil // Success
-		}
-
-		lastErr = err
-		log.Printf("Attempt %d/%d failed: %v", attempt+1, maxRetryAttempt, err)
+// Health is down while the database circuit is open and degraded after a failed read or a message sent to the DLQ
+func (c *Consumer) Health(context.Context) health.Result {
+	res := c.errs.Result()
+	if c.pipeline.Paused() {
+		res.Status = health.StatusDown
+	}
+	return res
+}
 
-		// Don't retry for validation errors
-		if _, ok := err.(*models.ValidationError); ok {
-			break
-		}
+// message is msg for the ingest pipeline, with its offset for exactly once
+func (c *Consumer) message(msg kafka.Message) ingest.Message {
+	m := ingest.Message{
+		Topic:       msg.Topic,
+		Partition:   msg.Partition,
+		Offset:      msg.Offset,
+		Key:         string(msg.Key),
+		Value:       msg.Value,
+		AutoRetries: ingest.ParseAutoRetries(header(msg.Headers, models.HeaderAutoRetries)),
+		LogAttrs:    []any{"partition", msg.Partition, "offset", msg.Offset},
 	}
-	// All retries failed, send to DLQ
-	if err := sendToDLQ(dlqWriter, msg, lastErr); err != nil {
-		return fmt.Errorf("failed to send to DLQ: %w (original error: %v)", err, lastErr)
+	if c.cfg.DeliverySemantics == models.DeliveryExactlyOnce {
+		at := c.offsetOf(msg)
+		m.At = &at
 	}
+	return m
+}
 
-	return lastErr
+// settler settles msg for the ingest pipeline. Kafka has no acks: the message is committed by Run
+// unless the consumer was stopped, a failed one is sent to the DLQ topic first.
+type settler struct {
+	c   *Consumer
+	msg kafka.Message
 }
 
-func calculateBackoff(attempt int) time.Duration {
-	// Exponential backoff with jitter
-	backoff := float64(initialBackoff) * math.Pow(2, float64(attempt))
-	if backoff > float64(maxBackoff) {
-		backoff = float64(maxBackoff)
-	}
+func (s settler) Ack() error { return nil }
+
+func (s settler) Requeue() error { return nil }
 
-	// Add jitter to avoid thundering herd
-	jitter := rand.Float64() * (backoff * 0.2) // ±20% jitter
-	backoff = backoff - (backoff * 0.1) + jitter
+func (s settler) DeadLetter(ctx context.Context, processingErr error) error {
+	if err := sendToDLQ(ctx, s.c.dlq, s.msg, processingErr); err != nil {
+		return err
+	}
+	// the message is done with, a redelivery must not reach the DLQ again
+	if s.c.cfg.DeliverySemantics == models.DeliveryExactlyOnce {
+		s.c.storeOffset(s.msg)
+	}
+	return nil
+}
 
-	return time.Duration(backoff)
+// header returns the value of the header key, empty if the message has none
+func header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
 }
 
-func sendToDLQ(writer *kafka.Writer, msg kafka.Message, processingErr error) error {
+// sendToDLQ publishes the failed message with the trace context of ctx, so its replay continues the trace.
+// An invalid order carries the list of its invalid fields; an oversized one is sent without its value,
+// which could exceed the message size of the broker, the quarantine keeps it.
+func sendToDLQ(ctx context.Context, writer *kafka.Writer, msg kafka.Message, processingErr error) error {
+	var violations models.ValidationErrors
+	errors.As(processingErr, &violations)
+	var tooLarge *models.TooLargeError
+	if errors.As(processingErr, &tooLarge) && tooLarge.What == "message" {
+		msg.Value = nil
+	}
 	dlqMessage := struct {
 		OriginalMessage kafka.Message
 		Error           string
+		Violations      models.ValidationErrors `json:",omitempty"`
 		Timestamp       time.Time
 	}{
 		OriginalMessage: msg,
 		Error:           processingErr.Error(),
+		Violations:      violations,
 		Timestamp:       time.Now(),
 	}
 
@@ -140,43 +282,13 @@ func sendToDLQ(writer *kafka.Writer, msg kafka.Message, processingErr error) err
 		return fmt.Errorf("failed to marshal DLQ message: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
 	defer cancel()
 
-	return writer.WriteMessages(ctx, kafka.Message{
+	dlqMsg := kafka.Message{
 		Key:   msg.Key,
 		Value: dlqData,
-	})
-}
-
-func processMessage(db *storage.Storage, msg kafka.Message) error {
-	startTime := time.Now()
-	log.Printf("Processing message: offset=%d partition=%d", msg.Offset, msg.Partition)
-
-	var order models.Order
-	if err := json.Unmarshal(msg.Value, &order); err != nil {
-		return fmt.Errorf("failed to unmarshal order: %w", err)
 	}
-
-	// validate data
-	if err := order.Validate(); err != nil {
-		return fmt.Errorf("invalid order data: %w", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// save to PostgreSQL and redis
-	if err := db.SaveOrder(ctx, order); err != nil {
-		return fmt.Errorf("failed to save order: %w", err)
-	}
-
-	log.Printf(
-		"Order processed successfully: order_uid=%s items=%d time=%v",
-		order.OrderUID,
-		len(order.Items),
-		time.Since(startTime),
-	)
-
-	return nil
+	tracing.Inject(ctx, &dlqMsg)
+	return writer.WriteMessages(ctx, dlqMsg)
 }
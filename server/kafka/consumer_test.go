@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+type stubRepo struct {
+	storage.Repository
+}
+
+func (stubRepo) Ping(context.Context) error { return nil }
+
+func TestMessageDeliverySemantics(t *testing.T) {
+	msg := kafka.Message{Topic: "orders", Partition: 2, Offset: 41, Key: []byte("k"),
+		Headers: []kafka.Header{{Key: models.HeaderAutoRetries, Value: []byte("3")}}}
+
+	// exactly once stores the offset with the order
+	c := NewConsumer(stubRepo{}, broadcast.NewHub(), models.KafkaCfg{GroupID: "g", DeliverySemantics: models.DeliveryExactlyOnce})
+	m := c.message(msg)
+	require.Equal(t, &models.MessageOffset{Group: "g", Topic: "orders", Partition: 2, Offset: 41}, m.At)
+	require.Equal(t, "k", m.Key)
+	require.Equal(t, 3, m.AutoRetries)
+
+	for _, semantics := range []string{models.DeliveryAtLeastOnce, models.DeliveryAtMostOnce} {
+		c = NewConsumer(stubRepo{}, broadcast.NewHub(), models.KafkaCfg{GroupID: "g", DeliverySemantics: semantics})
+		require.Nil(t, c.message(msg).At, semantics)
+	}
+}
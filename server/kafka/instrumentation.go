@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/metrics"
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const statsInterval = 10 * time.Second
+
+// partitionTracker remembers which partitions messages came from.
+// kafka-go doesn't expose the group assignment of a reader, so partitions
+// the consumer actually reads from are the best available approximation.
+type partitionTracker struct {
+	mu       sync.Mutex
+	interval map[int]int64 // partitions seen since the last stats poll
+	assigned []int         // partitions seen during the last stats interval
+}
+
+func newPartitionTracker() *partitionTracker {
+	return &partitionTracker{interval: make(map[int]int64)}
+}
+
+func (t *partitionTracker) observe(msg kafka.Message) {
+	metrics.ConsumerPartitionOffset.WithLabelValues(strconv.Itoa(msg.Partition)).Set(float64(msg.Offset))
+	t.mu.Lock()
+	t.interval[msg.Partition] = msg.Offset
+	t.mu.Unlock()
+}
+
+// rotate closes the current interval and reports whether the set of consumed partitions changed
+func (t *partitionTracker) rotate() (partitions []int, changed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	partitions = make([]int, 0, len(t.interval))
+	for p := range t.interval {
+		partitions = append(partitions, p)
+	}
+	slices.Sort(partitions)
+	t.interval = make(map[int]int64)
+	// an idle interval doesn't mean the partitions were revoked
+	if len(partitions) == 0 {
+		return t.assigned, false
+	}
+	changed = !slices.Equal(partitions, t.assigned)
+	t.assigned = partitions
+	return partitions, changed
+}
+
+// watchReader periodically polls reader stats (kafka-go returns deltas since the previous call),
+// exports them as metrics, logs rebalances, fetch errors and partition changes and records the fetch
+// errors (or successful fetches) in progress.
+func watchReader(ctx context.Context, reader func() *kafka.Reader, tracker *partitionTracker, progress *health.Progress) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r := reader()
+		stats := r.Stats()
+		metrics.ConsumerRebalances.Add(float64(stats.Rebalances))
+		metrics.ConsumerFetchErrors.Add(float64(stats.Errors))
+		metrics.ConsumerFetchTimeouts.Add(float64(stats.Timeouts))
+		metrics.ConsumerLag.Set(float64(stats.Lag))
+
+		partitions, changed := tracker.rotate()
+		metrics.ConsumerActivePartitions.Set(float64(len(partitions)))
+
+		if stats.Rebalances > 0 {
+			logger.Info("consumer group rebalanced", "group", r.Config().GroupID, "rebalances", stats.Rebalances,
+				"partitions", partitions, "topic", stats.Topic)
+		} else if changed {
+			logger.Info("consumed partitions changed", "partitions", partitions)
+		}
+		// the reader retries failed fetches by itself, FetchMessage just keeps waiting
+		if stats.Errors > 0 {
+			logger.Warn("fetch errors", "errors", stats.Errors, logging.Duration("interval", statsInterval))
+			progress.Failed(fmt.Errorf("%d fetch errors in %s", stats.Errors, statsInterval))
+		} else if stats.Fetches > 0 {
+			progress.Recovered()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// offsetOf is the position of msg stored with its order
+func (c *Consumer) offsetOf(msg kafka.Message) models.MessageOffset {
+	return models.MessageOffset{Group: c.cfg.GroupID, Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+}
+
+// storeOffset stores the offset of a message processed without saving an order
+func (c *Consumer) storeOffset(msg kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.db.SaveConsumerOffset(ctx, c.offsetOf(msg)); err != nil {
+		logger.Error("failed to store consumer offset", "partition", msg.Partition, "offset", msg.Offset, logging.Err(err))
+	}
+}
+
+// commit commits msg to the group. With exactly once the stored offsets are authoritative, the group offsets
+// only spare redeliveries; otherwise a message not committed is redelivered and its order skipped by order_uid.
+// Either way a failed commit is just logged.
+func (c *Consumer) commit(ctx context.Context, msg kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	err := c.currentReader().CommitMessages(ctx, msg)
+	if err != nil {
+		logger.Warn("failed to commit message", "partition", msg.Partition, "offset", msg.Offset, logging.Err(err))
+	}
+	c.progress.Committed(err)
+}
+
+// restoreOffsets moves the group offsets to the ones stored in Postgres, so the group resumes right after
+// the last processed message of every partition. Kafka accepts the commit only while the group has no active
+// members; when other replicas are running it fails and consumption resumes from the committed offsets,
+// the stored offsets still skip what was processed already.
+func (c *Consumer) restoreOffsets(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	stored, err := c.db.ConsumerOffsets(ctx, c.cfg.GroupID, c.cfg.Topic)
+	if err != nil {
+		logger.Error("failed to read stored consumer offsets", logging.Err(err))
+		return
+	}
+	if len(stored) == 0 {
+		return
+	}
+	next := make(map[int]int64, len(stored))
+	for partition, offset := range stored {
+		next[partition] = offset + 1
+	}
+	if _, err = commitGroupOffsets(ctx, c.cfg, models.SeekRequest{Offsets: next}); err != nil {
+		logger.Warn("failed to move the group to the stored offsets", "offsets", next, logging.Err(err))
+		return
+	}
+	logger.Info("group offsets restored from storage", "group", c.cfg.GroupID, "offsets", next)
+}
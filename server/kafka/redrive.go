@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// newRedriveWriter creates a writer publishing quarantined messages back to their topics
+func newRedriveWriter(cfg models.KafkaCfg) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		Compression:  compression(cfg.Compression),
+		MaxAttempts:  3,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		Logger:       kafkaLogger(slog.LevelDebug, "redrive"),
+		ErrorLogger:  kafkaLogger(slog.LevelError, "redrive"),
+	}
+}
+
+// Redrive publishes a quarantined message again to the topic it was read from, with its key,
+// so the consumer processes it once more. A message failing again is quarantined anew, with the number
+// of its automatic redrives.
+func (c *Consumer) Redrive(ctx context.Context, m models.FailedMessage) error {
+	msg := kafka.Message{
+		Topic: m.Topic,
+		Key:   []byte(m.Key),
+		Value: []byte(m.Payload),
+	}
+	if m.AutoRetries > 0 {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: models.HeaderAutoRetries, Value: []byte(strconv.Itoa(m.AutoRetries))})
+	}
+	tracing.Inject(ctx, &msg)
+	if err := c.redrive.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("failed to redrive message %d to %s: %w", m.ID, m.Topic, err)
+	}
+	logger.Info("failed message redriven", "id", m.ID, "topic", m.Topic, "partition", m.Partition, "offset", m.Offset)
+	return nil
+}
@@ -0,0 +1,162 @@
+package kafka
+
+import (
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+var (
+	// ErrSeekInProgress is returned when another seek hasn't been applied yet
+	ErrSeekInProgress = errors.New("another seek is in progress")
+	// ErrConsumerNotStarted is returned by a seek before the consumer joined the group
+	ErrConsumerNotStarted = errors.New("consumer is not started yet")
+)
+
+type seekCommand struct {
+	req  models.SeekRequest
+	done chan seekResult
+}
+
+type seekResult struct {
+	offsets map[int]int64
+	err     error
+}
+
+// Seek moves the committed offsets of the consumer group to a timestamp or to explicit
+// per-partition offsets, so a window of messages is reprocessed.
+// The reader is closed (this instance leaves the group), the offsets are committed and
+// consumption resumes from them. Kafka accepts such commits only while the group has no
+// other active members, so other consumer replicas must be stopped first.
+func (c *Consumer) Seek(ctx context.Context, req models.SeekRequest) (map[int]int64, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	cmd := &seekCommand{req: req, done: make(chan seekResult, 1)}
+	c.mu.Lock()
+	if c.pending != nil {
+		c.mu.Unlock()
+		return nil, ErrSeekInProgress
+	}
+	reader := c.reader
+	if reader == nil {
+		c.mu.Unlock()
+		return nil, ErrConsumerNotStarted
+	}
+	c.pending = cmd
+	c.mu.Unlock()
+
+	// unblocks ReadMessage in Run, which then applies the command
+	if err := reader.Close(); err != nil {
+		logger.Error("failed to close kafka reader for seek", logging.Err(err))
+	}
+	select {
+	case res := <-cmd.done:
+		return res.offsets, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// applyPendingSeek commits the offsets of a pending seek and reopens the reader.
+// It reports whether there was a pending seek.
+func (c *Consumer) applyPendingSeek(ctx context.Context) bool {
+	c.mu.Lock()
+	cmd := c.pending
+	c.mu.Unlock()
+	if cmd == nil {
+		return false
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	offsets, err := commitGroupOffsets(opCtx, c.cfg, cmd.req)
+	// the stored offsets would skip the messages before them as redelivered
+	if err == nil {
+		if err = c.db.ResetConsumerOffsets(opCtx, c.cfg.GroupID, c.cfg.Topic, offsets); err != nil {
+			err = fmt.Errorf("reset stored offsets: %w", err)
+		}
+	}
+	cancel()
+	if err != nil {
+		logger.Error("seek failed", logging.Err(err))
+	} else {
+		logger.Info("group offsets moved", "group", c.cfg.GroupID, "offsets", offsets)
+	}
+
+	c.mu.Lock()
+	c.reader = NewReader(c.cfg)
+	c.pending = nil
+	c.mu.Unlock()
+	cmd.done <- seekResult{offsets: offsets, err: err}
+	return true
+}
+
+// commitGroupOffsets resolves the requested position of every partition and commits it for the group
+func commitGroupOffsets(ctx context.Context, cfg models.KafkaCfg, req models.SeekRequest) (map[int]int64, error) {
+	client := &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: 10 * time.Second}
+
+	offsets := req.Offsets
+	if req.Timestamp != nil {
+		var err error
+		if offsets, err = offsetsAt(ctx, client, cfg.Topic, *req.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offset})
+	}
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      cfg.GroupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{cfg.Topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("offset commit: %w", err)
+	}
+	for _, p := range resp.Topics[cfg.Topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("offset commit of partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return offsets, nil
+}
+
+// offsetsAt returns the first offset at or after ts for every partition of the topic
+func offsetsAt(ctx context.Context, client *kafka.Client, topic string, ts time.Time) (map[int]int64, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	if len(meta.Topics) == 0 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	requests := make([]kafka.OffsetRequest, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		requests = append(requests, kafka.TimeOffsetOf(p.ID, ts))
+	}
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets: %w", err)
+	}
+	offsets := make(map[int]int64)
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		offset := p.FirstOffset
+		// no message at or after ts: start from the end of the partition
+		if offset < 0 {
+			offset = p.LastOffset
+		}
+		offsets[p.Partition] = offset
+	}
+	return offsets, nil
+}
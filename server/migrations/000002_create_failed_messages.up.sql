@@ -0,0 +1,16 @@
+-- Карантин сообщений, которые не удалось обработать (дублирует Kafka DLQ)
+CREATE TABLE IF NOT EXISTS failed_messages (
+    id              BIGSERIAL PRIMARY KEY,
+    topic           VARCHAR(255) NOT NULL,
+    kafka_partition INTEGER NOT NULL,
+    kafka_offset    BIGINT NOT NULL,
+    message_key     TEXT DEFAULT '',
+    payload         BYTEA NOT NULL,
+    error           TEXT NOT NULL,
+    attempts        INTEGER NOT NULL,
+    first_failed_at TIMESTAMPTZ NOT NULL,
+    last_failed_at  TIMESTAMPTZ NOT NULL,
+    UNIQUE (topic, kafka_partition, kafka_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_failed_messages_last_failed_at ON failed_messages(last_failed_at DESC);
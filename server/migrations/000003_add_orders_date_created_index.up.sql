@@ -0,0 +1,2 @@
+-- Покрывающий индекс для выборки последних заказов при прогреве кеша (index-only scan без сортировки)
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created DESC) INCLUDE (order_uid);
@@ -0,0 +1,10 @@
+-- API ключи для /admin (хранится только sha256 хеш секрета)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,
+    prefix      VARCHAR(16) NOT NULL,
+    secret_hash CHAR(64) NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at  TIMESTAMPTZ,
+    rotated_to  BIGINT REFERENCES api_keys(id)
+);
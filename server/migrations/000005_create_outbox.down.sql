@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outbox_deliveries;
+DROP TABLE IF EXISTS outbox;
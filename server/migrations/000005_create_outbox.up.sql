@@ -0,0 +1,19 @@
+-- Outbox: события пишутся в одной транзакции с заказом, relay доставляет их во внешние системы
+CREATE TABLE IF NOT EXISTS outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    event_type   VARCHAR(50) NOT NULL,
+    aggregate_id VARCHAR(50) NOT NULL,
+    payload      JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
+
+-- Доставки события по каждому назначению (чтобы при ошибке одного назначения не дублировать остальные)
+CREATE TABLE IF NOT EXISTS outbox_deliveries (
+    event_id     BIGINT NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+    destination  VARCHAR(100) NOT NULL,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (event_id, destination)
+);
@@ -0,0 +1,6 @@
+-- Короткие токены для публичной страницы статуса заказа (без персональных данных)
+CREATE TABLE IF NOT EXISTS order_status_tokens (
+    token      VARCHAR(16) PRIMARY KEY,
+    order_uid  VARCHAR(50) NOT NULL UNIQUE REFERENCES orders(order_uid),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,95 @@
+BEGIN;
+
+CREATE TABLE orders_unpartitioned (
+    order_uid          VARCHAR(50) PRIMARY KEY,
+    track_number       VARCHAR(50) NOT NULL,
+    entry              VARCHAR(10) NOT NULL,
+    locale             VARCHAR(10) NOT NULL,
+    internal_signature VARCHAR(50) DEFAULT '',
+    customer_id        VARCHAR(50) NOT NULL,
+    delivery_service   VARCHAR(50) NOT NULL,
+    shardkey           VARCHAR(10) NOT NULL,
+    sm_id              INTEGER NOT NULL,
+    date_created       TIMESTAMPTZ NOT NULL,
+    oof_shard          VARCHAR(10) NOT NULL
+);
+INSERT INTO orders_unpartitioned SELECT order_uid, track_number, entry, locale, internal_signature,
+    customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+FROM orders;
+
+CREATE TABLE deliveries_unpartitioned (
+    order_uid VARCHAR(50) PRIMARY KEY REFERENCES orders_unpartitioned(order_uid),
+    name      VARCHAR(100) NOT NULL,
+    phone     VARCHAR(20) NOT NULL,
+    zip       VARCHAR(20) NOT NULL,
+    city      VARCHAR(100) NOT NULL,
+    address   VARCHAR(200) NOT NULL,
+    region    VARCHAR(100) NOT NULL,
+    email     VARCHAR(100) NOT NULL
+);
+INSERT INTO deliveries_unpartitioned SELECT order_uid, name, phone, zip, city, address, region, email
+FROM deliveries;
+
+CREATE TABLE payments_unpartitioned (
+    order_uid     VARCHAR(50) PRIMARY KEY REFERENCES orders_unpartitioned(order_uid),
+    transaction   VARCHAR(50) NOT NULL,
+    request_id    VARCHAR(50) DEFAULT '',
+    currency      VARCHAR(10) NOT NULL,
+    provider      VARCHAR(50) NOT NULL,
+    amount        INTEGER NOT NULL,
+    payment_dt    BIGINT NOT NULL,
+    bank          VARCHAR(50) NOT NULL,
+    delivery_cost INTEGER NOT NULL,
+    goods_total   INTEGER NOT NULL,
+    custom_fee    INTEGER NOT NULL
+);
+INSERT INTO payments_unpartitioned SELECT order_uid, transaction, request_id, currency, provider,
+    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+FROM payments;
+
+CREATE TABLE items_unpartitioned (
+    id           SERIAL,
+    order_uid    VARCHAR(50) REFERENCES orders_unpartitioned(order_uid),
+    chrt_id      BIGINT NOT NULL,
+    track_number VARCHAR(50) NOT NULL,
+    price        INTEGER NOT NULL,
+    rid          VARCHAR(50) NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    sale         INTEGER NOT NULL,
+    size         VARCHAR(10) NOT NULL,
+    total_price  INTEGER NOT NULL,
+    nm_id        BIGINT NOT NULL,
+    brand        VARCHAR(100) NOT NULL,
+    status       INTEGER NOT NULL
+);
+INSERT INTO items_unpartitioned SELECT id, order_uid, chrt_id, track_number, price, rid, name,
+    sale, size, total_price, nm_id, brand, status
+FROM items;
+
+ALTER TABLE order_status_tokens DROP CONSTRAINT order_status_tokens_order_uid_fkey;
+
+DROP FUNCTION IF EXISTS create_order_partitions(DATE);
+DROP TABLE items;
+DROP TABLE payments;
+DROP TABLE deliveries;
+DROP TABLE orders;
+DROP TABLE order_keys;
+
+ALTER TABLE orders_unpartitioned RENAME TO orders;
+ALTER TABLE deliveries_unpartitioned RENAME TO deliveries;
+ALTER TABLE payments_unpartitioned RENAME TO payments;
+ALTER TABLE items_unpartitioned RENAME TO items;
+ALTER INDEX orders_unpartitioned_pkey RENAME TO orders_pkey;
+ALTER INDEX deliveries_unpartitioned_pkey RENAME TO deliveries_pkey;
+ALTER INDEX payments_unpartitioned_pkey RENAME TO payments_pkey;
+ALTER SEQUENCE items_unpartitioned_id_seq RENAME TO items_id_seq;
+ALTER TABLE items ADD PRIMARY KEY (id);
+SELECT setval('items_id_seq', COALESCE((SELECT max(id) FROM items), 0) + 1, false);
+
+CREATE INDEX idx_items_order_uid ON items(order_uid);
+CREATE INDEX idx_orders_date_created ON orders(date_created DESC) INCLUDE (order_uid);
+
+ALTER TABLE order_status_tokens ADD CONSTRAINT order_status_tokens_order_uid_fkey
+    FOREIGN KEY (order_uid) REFERENCES orders(order_uid);
+
+COMMIT;
@@ -0,0 +1,164 @@
+-- Секционирование заказов и дочерних таблиц по месяцам date_created.
+-- Уникальный ключ секционированной таблицы обязан включать date_created, поэтому уникальность
+-- order_uid держит несекционированная таблица order_keys (она же хранит дату, т.е. секцию заказа).
+BEGIN;
+
+CREATE TABLE order_keys (
+    order_uid    VARCHAR(50) PRIMARY KEY,
+    date_created TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO order_keys (order_uid, date_created) SELECT order_uid, date_created FROM orders;
+
+ALTER TABLE order_status_tokens DROP CONSTRAINT order_status_tokens_order_uid_fkey;
+ALTER TABLE order_status_tokens ADD CONSTRAINT order_status_tokens_order_uid_fkey
+    FOREIGN KEY (order_uid) REFERENCES order_keys(order_uid);
+
+-- Старые таблицы переименовываются вместе с индексами, чтобы освободить имена
+ALTER TABLE items RENAME TO items_unpartitioned;
+ALTER TABLE payments RENAME TO payments_unpartitioned;
+ALTER TABLE deliveries RENAME TO deliveries_unpartitioned;
+ALTER TABLE orders RENAME TO orders_unpartitioned;
+ALTER INDEX items_pkey RENAME TO items_unpartitioned_pkey;
+ALTER INDEX payments_pkey RENAME TO payments_unpartitioned_pkey;
+ALTER INDEX deliveries_pkey RENAME TO deliveries_unpartitioned_pkey;
+ALTER INDEX orders_pkey RENAME TO orders_unpartitioned_pkey;
+ALTER SEQUENCE items_id_seq RENAME TO items_unpartitioned_id_seq;
+DROP INDEX idx_items_order_uid;
+DROP INDEX idx_orders_date_created;
+
+CREATE TABLE orders (
+    order_uid          VARCHAR(50) NOT NULL,
+    track_number       VARCHAR(50) NOT NULL,
+    entry              VARCHAR(10) NOT NULL,
+    locale             VARCHAR(10) NOT NULL,
+    internal_signature VARCHAR(50) DEFAULT '',
+    customer_id        VARCHAR(50) NOT NULL,
+    delivery_service   VARCHAR(50) NOT NULL,
+    shardkey           VARCHAR(10) NOT NULL,
+    sm_id              INTEGER NOT NULL,
+    date_created       TIMESTAMPTZ NOT NULL,
+    oof_shard          VARCHAR(10) NOT NULL,
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE deliveries (
+    order_uid    VARCHAR(50) NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    phone        VARCHAR(20) NOT NULL,
+    zip          VARCHAR(20) NOT NULL,
+    city         VARCHAR(100) NOT NULL,
+    address      VARCHAR(200) NOT NULL,
+    region       VARCHAR(100) NOT NULL,
+    email        VARCHAR(100) NOT NULL,
+    PRIMARY KEY (order_uid, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE payments (
+    order_uid     VARCHAR(50) NOT NULL,
+    date_created  TIMESTAMPTZ NOT NULL,
+    transaction   VARCHAR(50) NOT NULL,
+    request_id    VARCHAR(50) DEFAULT '',
+    currency      VARCHAR(10) NOT NULL,
+    provider      VARCHAR(50) NOT NULL,
+    amount        INTEGER NOT NULL,
+    payment_dt    BIGINT NOT NULL,
+    bank          VARCHAR(50) NOT NULL,
+    delivery_cost INTEGER NOT NULL,
+    goods_total   INTEGER NOT NULL,
+    custom_fee    INTEGER NOT NULL,
+    PRIMARY KEY (order_uid, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE items (
+    id           BIGSERIAL,
+    order_uid    VARCHAR(50) NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    chrt_id      BIGINT NOT NULL,
+    track_number VARCHAR(50) NOT NULL,
+    price        INTEGER NOT NULL,
+    rid          VARCHAR(50) NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    sale         INTEGER NOT NULL,
+    size         VARCHAR(10) NOT NULL,
+    total_price  INTEGER NOT NULL,
+    nm_id        BIGINT NOT NULL,
+    brand        VARCHAR(100) NOT NULL,
+    status       INTEGER NOT NULL,
+    PRIMARY KEY (id, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+-- Покрывающий индекс для прогрева кеша, создаётся в каждой секции
+CREATE INDEX idx_orders_date_created ON orders(date_created DESC) INCLUDE (order_uid);
+CREATE INDEX idx_items_order_uid ON items(order_uid, date_created);
+
+-- Секции по умолчанию принимают заказы с датой вне созданных месяцев
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+CREATE TABLE deliveries_default PARTITION OF deliveries DEFAULT;
+CREATE TABLE payments_default PARTITION OF payments DEFAULT;
+CREATE TABLE items_default PARTITION OF items DEFAULT;
+
+-- Создаёт секции месяца во всех таблицах заказа (идемпотентно). Строки месяца, уже попавшие
+-- в секции по умолчанию, переносятся в новые секции: сначала удаляются дочерние строки, затем заказы,
+-- а вставляются обратно в обратном порядке, чтобы не нарушить внешние ключи.
+CREATE OR REPLACE FUNCTION create_order_partitions(month DATE) RETURNS void AS $$
+DECLARE
+    from_ts TIMESTAMPTZ := date_trunc('month', month);
+    to_ts   TIMESTAMPTZ := date_trunc('month', month) + INTERVAL '1 month';
+    suffix  TEXT := to_char(month, 'YYYYMM');
+    tbl     TEXT;
+BEGIN
+    IF to_regclass('orders_' || suffix) IS NOT NULL THEN
+        RETURN;
+    END IF;
+    FOREACH tbl IN ARRAY ARRAY['items', 'payments', 'deliveries', 'orders'] LOOP
+        EXECUTE format('DROP TABLE IF EXISTS pg_temp.%I', 'moved_' || tbl);
+        EXECUTE format('CREATE TEMP TABLE %I ON COMMIT DROP AS SELECT * FROM %I WHERE date_created >= $1 AND date_created < $2',
+            'moved_' || tbl, tbl || '_default') USING from_ts, to_ts;
+        EXECUTE format('DELETE FROM %I WHERE date_created >= $1 AND date_created < $2', tbl || '_default')
+            USING from_ts, to_ts;
+    END LOOP;
+    FOREACH tbl IN ARRAY ARRAY['orders', 'deliveries', 'payments', 'items'] LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+            tbl || '_' || suffix, tbl, from_ts, to_ts);
+        EXECUTE format('INSERT INTO %I SELECT * FROM %I', tbl, 'moved_' || tbl);
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Секции для уже сохранённых заказов и текущего месяца
+SELECT create_order_partitions(m::date)
+FROM generate_series(
+    date_trunc('month', LEAST(COALESCE((SELECT min(date_created) FROM orders_unpartitioned), now()), now())),
+    date_trunc('month', GREATEST(COALESCE((SELECT max(date_created) FROM orders_unpartitioned), now()), now())),
+    INTERVAL '1 month'
+) AS m;
+
+INSERT INTO orders SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard
+FROM orders_unpartitioned;
+
+INSERT INTO deliveries SELECT d.order_uid, o.date_created, d.name, d.phone, d.zip, d.city,
+    d.address, d.region, d.email
+FROM deliveries_unpartitioned d JOIN orders_unpartitioned o ON o.order_uid = d.order_uid;
+
+INSERT INTO payments SELECT p.order_uid, o.date_created, p.transaction, p.request_id, p.currency,
+    p.provider, p.amount, p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+FROM payments_unpartitioned p JOIN orders_unpartitioned o ON o.order_uid = p.order_uid;
+
+INSERT INTO items SELECT i.id, i.order_uid, o.date_created, i.chrt_id, i.track_number, i.price,
+    i.rid, i.name, i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+FROM items_unpartitioned i JOIN orders_unpartitioned o ON o.order_uid = i.order_uid;
+
+SELECT setval('items_id_seq', COALESCE((SELECT max(id) FROM items), 0) + 1, false);
+
+DROP TABLE items_unpartitioned;
+DROP TABLE payments_unpartitioned;
+DROP TABLE deliveries_unpartitioned;
+DROP TABLE orders_unpartitioned;
+
+COMMIT;
@@ -0,0 +1,6 @@
+-- Исходные сообщения заказов (database.raw_orders): сохраняют неизвестные поля и позволяют читать заказ одним запросом
+CREATE TABLE IF NOT EXISTS orders_raw (
+    order_uid   VARCHAR(50) PRIMARY KEY REFERENCES order_keys(order_uid),
+    payload     JSONB NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
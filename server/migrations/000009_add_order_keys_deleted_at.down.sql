@@ -0,0 +1 @@
+ALTER TABLE order_keys DROP COLUMN IF EXISTS deleted_at;
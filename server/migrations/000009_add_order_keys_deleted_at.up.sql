@@ -0,0 +1,3 @@
+-- Мягкое удаление заказа: строки остаются для аудита, чтение по умолчанию их не возвращает.
+-- Флаг хранится в order_keys (одна строка на заказ), через неё проходят все чтения заказа.
+ALTER TABLE order_keys ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
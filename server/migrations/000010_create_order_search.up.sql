@@ -0,0 +1,15 @@
+-- Полнотекстовый поиск заказов: имя получателя, город, бренды и названия товаров.
+-- Конфигурация simple: без стемминга, подходит для имён, брендов и смешанных языков.
+CREATE TABLE IF NOT EXISTS order_search (
+    order_uid VARCHAR(50) PRIMARY KEY REFERENCES order_keys(order_uid),
+    document  TSVECTOR NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_search_document ON order_search USING GIN (document);
+
+INSERT INTO order_search (order_uid, document)
+SELECT d.order_uid, to_tsvector('simple', concat_ws(' ', d.name, d.city, string_agg(i.brand || ' ' || i.name, ' ')))
+FROM deliveries d
+LEFT JOIN items i ON i.order_uid = d.order_uid AND i.date_created = d.date_created
+GROUP BY d.order_uid, d.name, d.city
+ON CONFLICT (order_uid) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_orders_date_created_uid;
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created DESC) INCLUDE (order_uid);
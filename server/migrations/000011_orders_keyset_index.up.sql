@@ -0,0 +1,3 @@
+-- Ключ (date_created, order_uid) для курсорной пагинации списка заказов; прогрев кеша читает тот же индекс
+DROP INDEX IF EXISTS idx_orders_date_created;
+CREATE INDEX IF NOT EXISTS idx_orders_date_created_uid ON orders(date_created DESC, order_uid DESC);
@@ -0,0 +1,2 @@
+-- Аренда пачки событий relay-ем: несколько экземпляров сервиса не публикуют одно событие одновременно
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
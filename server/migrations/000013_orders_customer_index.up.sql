@@ -0,0 +1,2 @@
+-- История заказов клиента, из неё восстанавливается кеш последних заказов клиента в Redis
+CREATE INDEX IF NOT EXISTS idx_orders_customer ON orders(customer_id, date_created DESC, order_uid DESC);
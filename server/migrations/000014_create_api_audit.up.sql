@@ -0,0 +1,16 @@
+-- Журнал доступа к заказам через API: кто (префикс API-ключа, bootstrap или anonymous) читал или менял какой заказ
+CREATE TABLE IF NOT EXISTS api_audit (
+    id          BIGSERIAL PRIMARY KEY,
+    subject     VARCHAR(100) NOT NULL,
+    method      VARCHAR(10) NOT NULL,
+    endpoint    VARCHAR(200) NOT NULL,
+    order_uid   VARCHAR(50) NOT NULL,
+    status      INT NOT NULL,
+    client_ip   VARCHAR(64) NOT NULL,
+    request_id  VARCHAR(128) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_audit_order_uid ON api_audit(order_uid, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_api_audit_subject ON api_audit(subject, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_api_audit_created_at ON api_audit(created_at DESC);
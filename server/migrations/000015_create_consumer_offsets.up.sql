@@ -0,0 +1,10 @@
+-- Последний обработанный offset каждой партиции для группы consumer-ов. Пишется в одной транзакции с заказом,
+-- поэтому повторно доставленные сообщения отбрасываются, а при старте группа переводится на сохранённые offset-ы
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+    group_id        VARCHAR(255) NOT NULL,
+    topic           VARCHAR(255) NOT NULL,
+    kafka_partition INTEGER NOT NULL,
+    kafka_offset    BIGINT NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, topic, kafka_partition)
+);
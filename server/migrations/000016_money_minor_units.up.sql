@@ -0,0 +1,11 @@
+-- Суммы хранятся в минимальных единицах валюты платежа (центы, копейки); BIGINT, чтобы крупные суммы
+-- не переполняли INTEGER. Изменение типа переписывает таблицы
+ALTER TABLE payments
+    ALTER COLUMN amount TYPE BIGINT,
+    ALTER COLUMN delivery_cost TYPE BIGINT,
+    ALTER COLUMN goods_total TYPE BIGINT,
+    ALTER COLUMN custom_fee TYPE BIGINT;
+
+ALTER TABLE items
+    ALTER COLUMN price TYPE BIGINT,
+    ALTER COLUMN total_price TYPE BIGINT;
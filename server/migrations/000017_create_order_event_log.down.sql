@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_event_log;
+DROP FUNCTION IF EXISTS order_event_log_immutable();
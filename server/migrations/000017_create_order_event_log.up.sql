@@ -0,0 +1,58 @@
+-- Журнал событий заказов: каждое входящее сообщение (включая дубликаты и замены) и изменения администратором.
+-- Таблицы заказов являются проекцией журнала и пересобираются из него командой cmd/rebuild
+CREATE TABLE IF NOT EXISTS order_event_log (
+    id              BIGSERIAL PRIMARY KEY,
+    order_uid       VARCHAR(50) NOT NULL,
+    event_type      VARCHAR(50) NOT NULL,
+    payload         JSONB,
+    topic           VARCHAR(255),
+    kafka_partition INTEGER,
+    kafka_offset    BIGINT,
+    received_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_event_log_order_uid ON order_event_log (order_uid, id);
+
+-- Журнал неизменяем: изменение и удаление событий запрещены
+CREATE OR REPLACE FUNCTION order_event_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_event_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_event_log_immutable
+    BEFORE UPDATE OR DELETE ON order_event_log
+    FOR EACH ROW EXECUTE FUNCTION order_event_log_immutable();
+
+-- Уже сохранённые заказы переносятся в журнал: исходное сообщение из orders_raw, иначе заказ, собранный из таблиц
+INSERT INTO order_event_log (order_uid, event_type, payload, received_at)
+SELECT o.order_uid, 'order_received', COALESCE(r.payload, jsonb_build_object(
+    'order_uid', o.order_uid,
+    'track_number', o.track_number,
+    'entry', o.entry,
+    'delivery', (SELECT jsonb_build_object('name', d.name, 'phone', d.phone, 'zip', d.zip, 'city', d.city,
+        'address', d.address, 'region', d.region, 'email', d.email)
+        FROM deliveries d WHERE d.order_uid = o.order_uid),
+    'payment', (SELECT jsonb_build_object('transaction', p.transaction, 'request_id', p.request_id,
+        'currency', p.currency, 'provider', p.provider, 'amount', p.amount, 'payment_dt', p.payment_dt,
+        'bank', p.bank, 'delivery_cost', p.delivery_cost, 'goods_total', p.goods_total, 'custom_fee', p.custom_fee)
+        FROM payments p WHERE p.order_uid = o.order_uid),
+    'items', COALESCE((SELECT jsonb_agg(jsonb_build_object('chrt_id', i.chrt_id, 'track_number', i.track_number,
+        'price', i.price, 'rid', i.rid, 'name', i.name, 'sale', i.sale, 'size', i.size, 'total_price', i.total_price,
+        'nm_id', i.nm_id, 'brand', i.brand, 'status', i.status) ORDER BY i.id)
+        FROM items i WHERE i.order_uid = o.order_uid), '[]'::jsonb),
+    'locale', o.locale,
+    'internal_signature', o.internal_signature,
+    'customer_id', o.customer_id,
+    'delivery_service', o.delivery_service,
+    'shardkey', o.shardkey,
+    'sm_id', o.sm_id,
+    'date_created', o.date_created,
+    'oof_shard', o.oof_shard
+)), COALESCE(r.received_at, o.date_created)
+FROM orders o
+LEFT JOIN orders_raw r ON r.order_uid = o.order_uid
+ORDER BY o.date_created, o.order_uid;
+
+INSERT INTO order_event_log (order_uid, event_type, received_at)
+SELECT order_uid, 'order_deleted', deleted_at FROM order_keys WHERE deleted_at IS NOT NULL ORDER BY deleted_at;
@@ -0,0 +1,26 @@
+-- Подписки партнёров на события заказов: URL, типы событий (пустой список - все) и секрет подписи HMAC
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id          BIGSERIAL PRIMARY KEY,
+    url         TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    secret      VARCHAR(100) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Доставки событий outbox по подпискам: pending - ждёт попытки в next_attempt_at, delivered, dead - исчерпаны попытки
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    subscription_id  BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id         BIGINT NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+    event_type       VARCHAR(50) NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_status_code INTEGER,
+    last_error       TEXT,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at     TIMESTAMPTZ,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
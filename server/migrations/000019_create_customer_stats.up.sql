@@ -0,0 +1,16 @@
+-- Итоги заказов клиентов по валютам для аналитики (stats.materialized); обновляется фоном через
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY, для которого нужен уникальный индекс
+CREATE MATERIALIZED VIEW IF NOT EXISTS customer_stats AS
+SELECT o.customer_id,
+       p.currency,
+       count(*)            AS orders,
+       sum(p.amount)       AS amount,
+       max(o.date_created) AS last_order_at
+FROM orders o
+JOIN order_keys k ON k.order_uid = o.order_uid AND k.deleted_at IS NULL
+JOIN payments p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+GROUP BY o.customer_id, p.currency;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customer_stats_customer_currency ON customer_stats(customer_id, currency);
+CREATE INDEX IF NOT EXISTS idx_customer_stats_currency_amount ON customer_stats(currency, amount DESC);
+CREATE INDEX IF NOT EXISTS idx_customer_stats_currency_orders ON customer_stats(currency, orders DESC);
@@ -0,0 +1,3 @@
+-- Отчёт о выручке (/stats/revenue) группирует платежи по периоду, валюте и платёжной системе в диапазоне дат;
+-- индекс на секционированной таблице создаётся во всех секциях, включая будущие
+CREATE INDEX IF NOT EXISTS idx_payments_revenue ON payments(date_created, currency, provider) INCLUDE (amount);
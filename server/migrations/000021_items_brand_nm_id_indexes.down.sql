@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_items_nm_id;
+DROP INDEX IF EXISTS idx_items_brand;
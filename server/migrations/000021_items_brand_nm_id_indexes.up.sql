@@ -0,0 +1,3 @@
+-- Поиск товаров (/items/search) по бренду без учёта регистра и по артикулу, от новых заказов к старым
+CREATE INDEX IF NOT EXISTS idx_items_brand ON items(lower(brand), date_created DESC);
+CREATE INDEX IF NOT EXISTS idx_items_nm_id ON items(nm_id, date_created DESC);
@@ -0,0 +1,2 @@
+-- Продажи товаров за период (/stats/items/top): диапазон дат отсекает секции, индекс покрывает группировку по артикулу
+CREATE INDEX IF NOT EXISTS idx_items_sales ON items(date_created, nm_id) INCLUDE (total_price);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_failed_messages_retry;
+ALTER TABLE failed_messages
+    DROP COLUMN IF EXISTS next_retry_at,
+    DROP COLUMN IF EXISTS auto_retries,
+    DROP COLUMN IF EXISTS transient;
@@ -0,0 +1,8 @@
+-- Автоматический redrive сообщений карантина с временной ошибкой (dlq_retry): счётчик redrive-ов и аренда
+-- next_retry_at, пока redrive выполняется или после его неудачи
+ALTER TABLE failed_messages
+    ADD COLUMN IF NOT EXISTS transient     BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS auto_retries  INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_retry_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_failed_messages_retry ON failed_messages(last_failed_at) WHERE transient;
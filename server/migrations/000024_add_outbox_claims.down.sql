@@ -0,0 +1,3 @@
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS first_claimed_at,
+    DROP COLUMN IF EXISTS claims;
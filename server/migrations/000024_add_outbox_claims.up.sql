@@ -0,0 +1,4 @@
+-- Повторно забранные события: relay проверяет, не опубликовал ли их уже упавший relay, начиная с первой аренды
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS claims           INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS first_claimed_at TIMESTAMPTZ;
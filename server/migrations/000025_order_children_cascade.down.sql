@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE deliveries DROP CONSTRAINT IF EXISTS deliveries_order_uid_date_created_fkey;
+ALTER TABLE deliveries ADD CONSTRAINT deliveries_order_uid_date_created_fkey
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created);
+
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_order_uid_date_created_fkey;
+ALTER TABLE payments ADD CONSTRAINT payments_order_uid_date_created_fkey
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created);
+
+ALTER TABLE items DROP CONSTRAINT IF EXISTS items_order_uid_date_created_fkey;
+ALTER TABLE items ADD CONSTRAINT items_order_uid_date_created_fkey
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders(order_uid, date_created);
+
+COMMIT;
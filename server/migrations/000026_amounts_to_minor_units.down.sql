@@ -0,0 +1,43 @@
+-- Откат переводит суммы обратно в основные единицы валюты платежа, дробная часть отбрасывается.
+-- Сообщения версии 2, полученные после миграции, хранятся с суммами в минимальных единицах, а журнал
+-- неизменяем, поэтому при их наличии откат невозможен
+BEGIN;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM order_event_log WHERE schema_version > 1 AND payload IS NOT NULL)
+        OR EXISTS (SELECT 1 FROM orders_raw WHERE schema_version > 1) THEN
+        RAISE EXCEPTION 'order messages of schema version 2 are stored, amounts can not be rolled back to major units';
+    END IF;
+END
+$$;
+
+CREATE FUNCTION amounts_scale(currency TEXT) RETURNS NUMERIC AS $$
+    SELECT CASE
+        WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND',
+            'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+        WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+        ELSE 100
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+UPDATE payments SET
+    amount = trunc(amount / amounts_scale(currency)),
+    delivery_cost = trunc(delivery_cost / amounts_scale(currency)),
+    goods_total = trunc(goods_total / amounts_scale(currency)),
+    custom_fee = trunc(custom_fee / amounts_scale(currency));
+
+UPDATE items i SET
+    price = trunc(i.price / amounts_scale(p.currency)),
+    total_price = trunc(i.total_price / amounts_scale(p.currency))
+FROM payments p
+WHERE p.order_uid = i.order_uid AND p.date_created = i.date_created;
+
+DROP FUNCTION amounts_scale(TEXT);
+
+ALTER TABLE order_event_log DROP COLUMN schema_version;
+ALTER TABLE orders_raw DROP COLUMN schema_version;
+
+REFRESH MATERIALIZED VIEW customer_stats;
+
+COMMIT;
@@ -0,0 +1,39 @@
+-- Суммы, сохранённые до перехода на минимальные единицы (000016 только расширила столбцы), переводятся
+-- из основных единиц валюты платежа: ×100, для валют без дробной части ×1, с тремя знаками ×1000.
+-- Исходные сообщения в orders_raw и журнале событий не переписываются: они хранятся как отправлены
+-- с версией схемы schema_version и переводятся в текущую версию при чтении и пересборке таблиц
+BEGIN;
+
+CREATE FUNCTION amounts_scale(currency TEXT) RETURNS NUMERIC AS $$
+    SELECT CASE
+        WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND',
+            'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+        WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+        ELSE 100
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+UPDATE payments SET
+    amount = amount * amounts_scale(currency),
+    delivery_cost = delivery_cost * amounts_scale(currency),
+    goods_total = goods_total * amounts_scale(currency),
+    custom_fee = custom_fee * amounts_scale(currency);
+
+UPDATE items i SET
+    price = i.price * amounts_scale(p.currency),
+    total_price = i.total_price * amounts_scale(p.currency)
+FROM payments p
+WHERE p.order_uid = i.order_uid AND p.date_created = i.date_created;
+
+DROP FUNCTION amounts_scale(TEXT);
+
+-- сохранённые ранее сообщения - версии 1 (суммы в основных единицах); значение по умолчанию заполняет
+-- существующие строки без UPDATE, триггер неизменяемости журнала не затрагивается
+ALTER TABLE orders_raw ADD COLUMN schema_version SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE orders_raw ALTER COLUMN schema_version DROP DEFAULT;
+ALTER TABLE order_event_log ADD COLUMN schema_version SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE order_event_log ALTER COLUMN schema_version DROP DEFAULT;
+
+REFRESH MATERIALIZED VIEW customer_stats;
+
+COMMIT;
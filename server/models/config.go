@@ -0,0 +1,621 @@
+package models
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultConfigPath is the config file used when neither -config nor CONFIG_PATH is set; the file is optional
+const DefaultConfigPath = "config.yaml"
+
+// Sources of the resolved settings
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceYAML    = "yaml"
+	SourceDefault = "default"
+	// SourceFile is a secret read from the file named by <ENV>_FILE
+	SourceFile = "file"
+	// SourceVault is a secret read from HashiCorp Vault by a vault:<path>#<key> reference
+	SourceVault = "vault"
+)
+
+// Load resolves the server config with the precedence flag > env > yaml > default.
+// Secret settings may also come from files or Vault, see readSecretFile and resolveVaultSecrets.
+// Every scalar setting has a flag named after its yaml path, e.g. -redis.cache_ttl=1h
+// or -database.host=db; -config (env CONFIG_PATH) selects the file. Lists take comma-separated
+// values (their env separator if set); outbox destinations are configured in the file only.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", configPathEnv(), "YAML config file (env CONFIG_PATH)")
+	// flags are applied after the file and env are read, so they are only recorded while parsing
+	type assignment struct {
+		key, value, sep string
+		secret          bool
+	}
+	var flags []assignment
+	walkConfig(reflect.ValueOf(&Config{}).Elem(), "", func(key string, f reflect.StructField, _ reflect.Value) {
+		usage := "config " + key
+		if env := f.Tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+		fs.Func(key, usage, func(value string) error {
+			flags = append(flags, assignment{key, value, listSeparator(f), f.Tag.Get("secret") == "true"})
+			return nil
+		})
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := false
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	explicit = explicit || os.Getenv("CONFIG_PATH") != ""
+
+	cfg := &Config{sources: make(map[string]string), args: slices.Clone(args)}
+	fileKeys, err := readConfigFile(*path, explicit, cfg)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]reflect.Value)
+	var secretErr error
+	walkConfig(reflect.ValueOf(cfg).Elem(), "", func(key string, f reflect.StructField, v reflect.Value) {
+		values[key] = v
+		cfg.sources[key] = SourceDefault
+		if _, ok := fileKeys[key]; ok {
+			cfg.sources[key] = SourceYAML
+		}
+		env := f.Tag.Get("env")
+		if env == "" {
+			return
+		}
+		if _, ok := os.LookupEnv(env); ok {
+			cfg.sources[key] = SourceEnv
+		}
+		if f.Tag.Get("secret") != "true" || secretErr != nil {
+			return
+		}
+		value, ok, err := readSecretFile(env)
+		if err == nil && ok {
+			err = setValue(v, value, listSeparator(f))
+		}
+		if err != nil {
+			secretErr = fmt.Errorf("invalid %s: %v", key, err)
+		} else if ok {
+			cfg.sources[key] = SourceFile
+		}
+	})
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	for _, a := range flags {
+		if err := setValue(values[a.key], a.value, a.sep); err != nil {
+			value := fmt.Sprintf("%q", a.value)
+			if a.secret {
+				value = "[redacted]"
+			}
+			return nil, fmt.Errorf("invalid value %s for flag -%s: %v", value, a.key, err)
+		}
+		cfg.sources[a.key] = SourceFlag
+	}
+	if err := resolveVaultSecrets(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// listSeparator splits list values of flags and secret files, the env separator of the setting if set
+func listSeparator(f reflect.StructField) string {
+	if sep := f.Tag.Get("env-separator"); sep != "" {
+		return sep
+	}
+	return ","
+}
+
+func configPathEnv() string {
+	if env := os.Getenv("CONFIG_PATH"); env != "" {
+		return env
+	}
+	return DefaultConfigPath
+}
+
+// readConfigFile reads the file overlaid by the file of the APP_ENV profile with env overrides
+// and returns the yaml paths they set; a missing default file means environment and defaults only
+func readConfigFile(path string, explicit bool, cfg any) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	err := readYAML(path, cfg, keys)
+	if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		return nil, fmt.Errorf("can't read config %s: %v", path, err)
+	}
+	if env := os.Getenv("APP_ENV"); env != "" {
+		profile := ProfilePath(path, env)
+		if err := readYAML(profile, cfg, keys); err != nil {
+			return nil, fmt.Errorf("can't read config %s of profile %s: %v", profile, env, err)
+		}
+	}
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment: %v", err)
+	}
+	return keys, nil
+}
+
+// ReadConfig reads the config file at path into cfg like Load does, overlaid by the file of the APP_ENV profile
+// and with env overrides, for configs of other binaries; a missing file is an error only if explicit
+func ReadConfig(path string, explicit bool, cfg any) error {
+	_, err := readConfigFile(path, explicit, cfg)
+	return err
+}
+
+// ProfilePath is the config file of the profile env next to path: config.yaml of APP_ENV=local is config.local.yaml.
+// It holds only the settings differing from path, lists replace the lists of path.
+func ProfilePath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// readYAML decodes the file into cfg over the values already set and adds the yaml paths it sets to keys
+func readYAML(path string, cfg any, keys map[string]struct{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	collectKeys(tree, "", keys)
+	return nil
+}
+
+func collectKeys(tree map[string]any, prefix string, keys map[string]struct{}) {
+	for k, v := range tree {
+		keys[prefix+k] = struct{}{}
+		if sub, ok := v.(map[string]any); ok {
+			collectKeys(sub, prefix+k+".", keys)
+		}
+	}
+}
+
+// walkConfig calls fn for every scalar setting (and list of scalars) of the config struct v by its yaml path
+func walkConfig(v reflect.Value, prefix string, fn func(key string, f reflect.StructField, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			walkConfig(fv, prefix+name+".", fn)
+		case f.Type.Kind() == reflect.Map, f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+			// structured settings are read from the file only
+		default:
+			fn(prefix+name, f, fv)
+		}
+	}
+}
+
+func setValue(v reflect.Value, s, sep string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(s, sep)
+		list := reflect.MakeSlice(v.Type(), 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			el := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(el, p, sep); err != nil {
+				return err
+			}
+			list = reflect.Append(list, el)
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// Source tells where the setting at the yaml path came from: flag, env, file, vault, yaml or default ("" if not loaded by Load)
+func (c Config) Source(key string) string {
+	return c.sources[key]
+}
+
+// Dump lists the resolved settings one per line with their sources, secrets redacted
+func (c Config) Dump() string {
+	var b strings.Builder
+	walkConfig(reflect.ValueOf(&c).Elem(), "", func(key string, f reflect.StructField, v reflect.Value) {
+		value := fmt.Sprint(v.Interface())
+		if f.Tag.Get("secret") == "true" && !v.IsZero() {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&b, "%s = %s", key, value)
+		if src := c.sources[key]; src != "" {
+			fmt.Fprintf(&b, " (%s)", src)
+		}
+		b.WriteByte('\n')
+	})
+	fmt.Fprintf(&b, "outbox.destinations = %d configured\n", len(c.Outbox.Destinations))
+	fmt.Fprintf(&b, "notify.notifiers = %d configured\n", len(c.Notify.Notifiers))
+	fmt.Fprintf(&b, "notify.rules = %d configured\n", len(c.Notify.Rules))
+	return b.String()
+}
+
+// Reload resolves the config again from the same flags, environment and file
+func (c Config) Reload() (*Config, error) {
+	if c.sources == nil {
+		return nil, errors.New("config was not loaded by Load")
+	}
+	return Load(c.args)
+}
+
+// ApplyReloadable copies the changed settings tagged reload:"true" from next and returns their yaml paths
+// in applied; the other changed settings are only listed in restart, they take effect after a restart
+func (c *Config) ApplyReloadable(next Config) (applied, restart []string) {
+	values := make(map[string]reflect.Value)
+	walkConfig(reflect.ValueOf(&next).Elem(), "", func(key string, _ reflect.StructField, v reflect.Value) {
+		values[key] = v
+	})
+	sources := maps.Clone(c.sources)
+	walkConfig(reflect.ValueOf(c).Elem(), "", func(key string, f reflect.StructField, v reflect.Value) {
+		nv := values[key]
+		if reflect.DeepEqual(v.Interface(), nv.Interface()) {
+			return
+		}
+		if f.Tag.Get("reload") != "true" {
+			restart = append(restart, key)
+			return
+		}
+		v.Set(nv)
+		applied = append(applied, key)
+		if sources != nil {
+			sources[key] = next.sources[key]
+		}
+	})
+	if !reflect.DeepEqual(c.Outbox.Destinations, next.Outbox.Destinations) {
+		restart = append(restart, "outbox.destinations")
+	}
+	if !reflect.DeepEqual(c.Notify.Notifiers, next.Notify.Notifiers) {
+		restart = append(restart, "notify.notifiers")
+	}
+	if !reflect.DeepEqual(c.Notify.Rules, next.Notify.Rules) {
+		restart = append(restart, "notify.rules")
+	}
+	c.sources = sources
+	return applied, restart
+}
+
+// Validate checks the resolved config: required settings, addresses and ports, durations and the known modes.
+// It reports all problems at once, each as a ValidationError of the setting's yaml path.
+func (c Config) Validate() error {
+	var v configCheck
+	v.required("server.hostGateway", c.ServConf.Host)
+	v.address("server.hostGateway", c.ServConf.Host)
+	v.positive("server.timeout", c.ServConf.Timeout)
+	v.positive("server.shutdown_timeout", c.ServConf.ShutdownTimeout)
+	v.positive("server.drain_timeout", c.ServConf.DrainTimeout)
+	if c.ServConf.DrainTimeout > c.ServConf.ShutdownTimeout {
+		v.add("server.drain_timeout", "must not exceed server.shutdown_timeout (%v)", c.ServConf.ShutdownTimeout)
+	}
+	v.required("server.static_dir", c.ServConf.StaticDir)
+
+	v.required("database.host", c.DBConf.Host)
+	v.port("database.port", c.DBConf.Port)
+	v.required("database.user", c.DBConf.User)
+	v.required("database.dbname", c.DBConf.DBName)
+	v.required("database.migrations_path", c.DBConf.MigrationsPath)
+	v.check("database.write_mode", c.DBConf.ValidateWriteMode())
+	v.check("database.raw_orders", c.DBConf.ValidateRawOrders())
+	v.atLeast("database.partitions_ahead", c.DBConf.PartitionsAhead, 0)
+	v.positive("database.partition_check_interval", c.DBConf.PartitionCheckInterval)
+	v.atLeast("database.tx_retries", c.DBConf.TxRetries, 0)
+	v.notNegative("database.slow_query_threshold", c.DBConf.SlowQueryThreshold)
+
+	v.required("redis.redis_address", c.RDBConf.RedisAddress)
+	v.address("redis.redis_address", c.RDBConf.RedisAddress)
+	v.atLeast("redis.redis_db", c.RDBConf.RedisDB, 0)
+	v.check("redis.preload_policy", c.RDBConf.ValidatePreloadPolicy())
+	v.notNegative("redis.preload_window", c.RDBConf.PreloadWindow)
+	v.notNegative("redis.preload_timeout", c.RDBConf.PreloadTimeout)
+	v.atLeast("redis.preload_concurrency", c.RDBConf.PreloadConcurrency, 0)
+	v.check("redis.read_strategy", c.RDBConf.ValidateReadStrategy())
+	v.atLeast("redis.cache_limit", c.RDBConf.CacheLimit, 0)
+	v.notNegative("redis.cache_ttl", c.RDBConf.CacheTTL)
+	v.check("redis.cache_ttl_jitter", c.RDBConf.ValidateCacheTTLJitter())
+	v.check("redis.cache_codec", c.RDBConf.ValidateCacheCodec())
+	v.check("redis.cache_compression", c.RDBConf.ValidateCacheCompression())
+	v.atLeast("redis.cache_compress_threshold", c.RDBConf.CacheCompressThreshold, 0)
+	v.atLeast("redis.local_cache_size", c.RDBConf.LocalCacheSize, 0)
+	if c.RDBConf.LocalCacheSize > 0 {
+		v.positive("redis.local_cache_ttl", c.RDBConf.LocalCacheTTL)
+	}
+	v.atLeast("redis.customer_orders_limit", c.RDBConf.CustomerOrdersLimit, 0)
+	v.check("redis.bloom_capacity", c.RDBConf.ValidateBloom())
+
+	v.notNegative("auth.key_cache_ttl", c.AuthConf.KeyCacheTTL)
+	v.atLeast("validation.max_message_bytes", c.Validation.MaxMessageBytes, 0)
+	v.atLeast("validation.max_items", c.Validation.MaxItems, 0)
+	if !slices.Contains(UnknownFieldsModes, c.Validation.UnknownFields) {
+		v.add("validation.unknown_fields", "unknown mode %q (expected one of %s)",
+			c.Validation.UnknownFields, strings.Join(UnknownFieldsModes, ", "))
+	}
+
+	switch c.Transport {
+	case TransportKafka:
+		if len(c.Kafka.Brokers) == 0 {
+			v.add("kafka.brokers", "is required")
+		}
+		for _, broker := range c.Kafka.Brokers {
+			v.address("kafka.brokers", broker)
+		}
+		v.required("kafka.topic", c.Kafka.Topic)
+		v.required("kafka.dlq_topic", c.Kafka.DLQTopic)
+		v.required("kafka.group_id", c.Kafka.GroupID)
+		v.check("kafka.compression", ValidateCompression(c.Kafka.Compression))
+		if !slices.Contains(DeliverySemantics, c.Kafka.DeliverySemantics) {
+			v.add("kafka.delivery_semantics", "unknown delivery semantics %q (expected one of %s)",
+				c.Kafka.DeliverySemantics, strings.Join(DeliverySemantics, ", "))
+		}
+	case TransportRabbitMQ:
+		v.required("rabbitmq.url", c.RabbitMQ.URL)
+		v.required("rabbitmq.exchange", c.RabbitMQ.Exchange)
+		v.required("rabbitmq.queue", c.RabbitMQ.Queue)
+		v.required("rabbitmq.dlx", c.RabbitMQ.DLX)
+		v.required("rabbitmq.dlq", c.RabbitMQ.DLQ)
+		v.atLeast("rabbitmq.prefetch", c.RabbitMQ.Prefetch, 1)
+	default:
+		v.add("transport", "unknown transport %q (expected %s or %s)", c.Transport, TransportKafka, TransportRabbitMQ)
+	}
+
+	if c.Audit.Enabled {
+		v.atLeast("audit.queue_size", c.Audit.QueueSize, 1)
+		v.atLeast("audit.batch_size", c.Audit.BatchSize, 1)
+		v.positive("audit.flush_interval", c.Audit.FlushInterval)
+	}
+
+	if c.Webhooks.Enabled {
+		v.positive("webhooks.poll_interval", c.Webhooks.PollInterval)
+		v.atLeast("webhooks.batch_size", c.Webhooks.BatchSize, 1)
+		v.positive("webhooks.lease", c.Webhooks.Lease)
+		v.positive("webhooks.timeout", c.Webhooks.Timeout)
+		if c.Webhooks.Lease <= c.Webhooks.Timeout {
+			v.add("webhooks.lease", "must be above webhooks.timeout (%v)", c.Webhooks.Timeout)
+		}
+		v.atLeast("webhooks.max_attempts", c.Webhooks.MaxAttempts, 1)
+		v.positive("webhooks.initial_backoff", c.Webhooks.InitialBackoff)
+		if c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+			v.add("webhooks.max_backoff", "must not be below webhooks.initial_backoff (%v)", c.Webhooks.InitialBackoff)
+		}
+	}
+
+	v.positive("outbox.poll_interval", c.Outbox.PollInterval)
+	v.atLeast("outbox.batch_size", c.Outbox.BatchSize, 1)
+	v.positive("outbox.lease", c.Outbox.Lease)
+	for i, d := range c.Outbox.Destinations {
+		field := fmt.Sprintf("outbox.destinations[%d]", i)
+		v.required(field+".name", d.Name)
+		if d.Name == WebhookDestination {
+			v.add(field+".name", "%q is reserved for the webhook subscriptions", d.Name)
+		}
+		if d.Name == NotifyDestination || strings.HasPrefix(d.Name, NotifyDestination+":") {
+			v.add(field+".name", "%q is reserved for the notification rules", d.Name)
+		}
+		v.required(field+".type", d.Type)
+		v.required(field+".address", d.Address)
+		v.check(field+".compression", ValidateCompression(d.Compression))
+	}
+
+	if c.Tracking.Enabled {
+		for _, name := range c.Tracking.Providers {
+			if !slices.Contains(TrackingProviders, name) {
+				v.add("tracking.providers", "unknown provider %q (expected dhl or russianpost)", name)
+			}
+		}
+		v.positive("tracking.cache_ttl", c.Tracking.CacheTTL)
+		if c.Tracking.RateLimit <= 0 {
+			v.add("tracking.rate_limit", "must be positive, got %v", c.Tracking.RateLimit)
+		}
+		v.atLeast("tracking.burst", c.Tracking.Burst, 1)
+		v.positive("tracking.timeout", c.Tracking.Timeout)
+	}
+
+	if c.Stats.Materialized {
+		v.positive("stats.refresh_interval", c.Stats.RefreshInterval)
+	}
+
+	v.positive("health.consumer_stuck_after", c.Health.ConsumerStuckAfter)
+	if c.DLQRetry.Enabled {
+		v.positive("dlq_retry.interval", c.DLQRetry.Interval)
+		v.atLeast("dlq_retry.max_attempts", c.DLQRetry.MaxAttempts, 1)
+		v.positive("dlq_retry.initial_delay", c.DLQRetry.InitialDelay)
+		if c.DLQRetry.MaxDelay < c.DLQRetry.InitialDelay {
+			v.add("dlq_retry.max_delay", "must not be below dlq_retry.initial_delay (%v)", c.DLQRetry.InitialDelay)
+		}
+		v.atLeast("dlq_retry.batch_size", c.DLQRetry.BatchSize, 1)
+	}
+
+	if c.Notify.Enabled {
+		c.Notify.validate(&v)
+	}
+
+	v.check("log.level", c.Log.ValidateLevel())
+	if r := c.Log.Access.SampleRatio; r < 0 || r > 1 {
+		v.add("log.access.sample_ratio", "must be within 0..1, got %v", r)
+	}
+	v.notNegative("log.access.slow", c.Log.Access.Slow)
+
+	if c.Tracing.Enabled {
+		v.required("tracing.endpoint", c.Tracing.Endpoint)
+		v.address("tracing.endpoint", c.Tracing.Endpoint)
+	}
+	if r := c.Tracing.SampleRatio; r < 0 || r > 1 {
+		v.add("tracing.sample_ratio", "must be within 0..1, got %v", r)
+	}
+
+	v.atLeast("connect.attempts", c.Connect.Attempts, 1)
+	v.positive("connect.initial_delay", c.Connect.InitialDelay)
+	v.positive("connect.max_delay", c.Connect.MaxDelay)
+	if c.Connect.MaxDelay < c.Connect.InitialDelay {
+		v.add("connect.max_delay", "must not be below connect.initial_delay (%v)", c.Connect.InitialDelay)
+	}
+	return errors.Join(v...)
+}
+
+func (n NotifyCfg) validate(v *configCheck) {
+	v.positive("notify.check_interval", n.CheckInterval)
+	names := make(map[string]bool, len(n.Notifiers))
+	for i, nc := range n.Notifiers {
+		field := fmt.Sprintf("notify.notifiers[%d]", i)
+		v.required(field+".name", nc.Name)
+		if names[nc.Name] {
+			v.add(field+".name", "duplicate notifier %q", nc.Name)
+		}
+		names[nc.Name] = true
+		switch nc.Type {
+		case "email":
+			v.required(field+".smtp_address", nc.SMTPAddress)
+			v.address(field+".smtp_address", nc.SMTPAddress)
+			v.required(field+".from", nc.From)
+			if len(nc.To) == 0 {
+				v.add(field+".to", "is required")
+			}
+		case "telegram":
+			v.required(field+".bot_token", nc.BotToken)
+			v.required(field+".chat_id", nc.ChatID)
+		case "slack":
+			v.required(field+".webhook_url", nc.WebhookURL)
+		default:
+			v.add(field+".type", "must be email, telegram or slack, got %q", nc.Type)
+		}
+	}
+	for i, r := range n.Rules {
+		field := fmt.Sprintf("notify.rules[%d]", i)
+		v.required(field+".name", r.Name)
+		switch r.Type {
+		case RuleOrderAmount:
+		case RuleDLQGrowth:
+			v.positive(field+".window", r.Window)
+		default:
+			v.add(field+".type", "must be %s or %s, got %q", RuleOrderAmount, RuleDLQGrowth, r.Type)
+		}
+		if r.Threshold <= 0 {
+			v.add(field+".threshold", "must be positive, got %d", r.Threshold)
+		}
+		if len(r.Notifiers) == 0 {
+			v.add(field+".notifiers", "is required")
+		}
+		for _, name := range r.Notifiers {
+			if !names[name] {
+				v.add(field+".notifiers", "unknown notifier %q", name)
+			}
+		}
+	}
+}
+
+// configCheck collects the problems of a config
+type configCheck []error
+
+func (v *configCheck) add(field, format string, args ...any) {
+	*v = append(*v, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *configCheck) check(field string, err error) {
+	if err != nil {
+		v.add(field, "%v", err)
+	}
+}
+
+func (v *configCheck) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	}
+}
+
+// address checks a host:port address, the host may be empty (all interfaces)
+func (v *configCheck) address(field, value string) {
+	if value == "" {
+		return
+	}
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.add(field, "must be host:port, got %q", value)
+		return
+	}
+	v.port(field, port)
+}
+
+func (v *configCheck) port(field, value string) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 65535 {
+		v.add(field, "port must be a number in [1, 65535], got %q", value)
+	}
+}
+
+func (v *configCheck) positive(field string, d time.Duration) {
+	if d <= 0 {
+		v.add(field, "must be positive, got %v", d)
+	}
+}
+
+func (v *configCheck) notNegative(field string, d time.Duration) {
+	if d < 0 {
+		v.add(field, "must not be negative, got %v", d)
+	}
+}
+
+func (v *configCheck) atLeast(field string, n, least int) {
+	if n < least {
+		v.add(field, "must be at least %d, got %d", least, n)
+	}
+}
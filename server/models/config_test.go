@@ -0,0 +1,184 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+database:
+  host: yaml-db
+  port: "5433"
+  password: secret
+redis:
+  redis_address: yaml-redis:6379
+  cache_ttl: 1h
+`), 0o600))
+	t.Setenv("DB_PORT", "6543")
+	t.Setenv("REDIS_CACHE_TTL", "2h")
+
+	cfg, err := Load([]string{"-config", path, "-redis.cache_ttl=3h", "-database.replica_dsns", "host=r1;host=r2"})
+	require.NoError(t, err)
+
+	require.Equal(t, "yaml-db", cfg.DBConf.Host)
+	require.Equal(t, SourceYAML, cfg.Source("database.host"))
+	require.Equal(t, "6543", cfg.DBConf.Port)
+	require.Equal(t, SourceEnv, cfg.Source("database.port"))
+	require.Equal(t, 3*time.Hour, cfg.RDBConf.CacheTTL)
+	require.Equal(t, SourceFlag, cfg.Source("redis.cache_ttl"))
+	require.Equal(t, []string{"host=r1", "host=r2"}, cfg.DBConf.ReplicaDSNs)
+	require.Equal(t, 1000, cfg.RDBConf.CacheLimit)
+	require.Equal(t, SourceDefault, cfg.Source("redis.cache_limit"))
+
+	dump := cfg.Dump()
+	require.Contains(t, dump, "redis.cache_ttl = 3h0m0s (flag)\n")
+	require.Contains(t, dump, "database.password = [redacted] (yaml)\n")
+	require.False(t, strings.Contains(dump, "secret"))
+
+	_, err = Load([]string{"-config", path, "-redis.cache_limit=many"})
+	require.Error(t, err)
+	_, err = Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	require.Error(t, err)
+}
+
+func TestReloadApplyReloadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("redis:\n  cache_ttl: 1h\n"), 0o600))
+	cfg, err := Load([]string{"-config", path, "-redis.cache_limit=10"})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("redis:\n  cache_ttl: 2h\n  redis_db: 3\n"), 0o600))
+	next, err := cfg.Reload()
+	require.NoError(t, err)
+	require.Equal(t, 10, next.RDBConf.CacheLimit)
+
+	live := *cfg
+	applied, restart := live.ApplyReloadable(*next)
+	require.Equal(t, []string{"redis.cache_ttl"}, applied)
+	require.Equal(t, []string{"redis.redis_db"}, restart)
+	require.Equal(t, 2*time.Hour, live.RDBConf.CacheTTL)
+	require.Equal(t, 0, live.RDBConf.RedisDB)
+	require.Equal(t, SourceDefault, live.Source("redis.redis_db"))
+	// the config reloaded from keeps its settings
+	require.Equal(t, time.Hour, cfg.RDBConf.CacheTTL)
+
+	_, err = Config{}.Reload()
+	require.Error(t, err)
+}
+
+func TestLoadSecrets(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/secret/data/wb" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"redis_password": "from-vault"}, "metadata": {"version": 1}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_password")
+	require.NoError(t, os.WriteFile(secret, []byte("from-file\n"), 0o600))
+	t.Setenv("DB_PASSWORD_FILE", secret)
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("redis:\n  redis_password: vault:secret/data/wb#redis_password\n"), 0o600))
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	require.Equal(t, "from-file", cfg.DBConf.Password)
+	require.Equal(t, SourceFile, cfg.Source("database.password"))
+	require.Equal(t, "from-vault", cfg.RDBConf.RedisPassword)
+	require.Equal(t, SourceVault, cfg.Source("redis.redis_password"))
+	dump := cfg.Dump()
+	require.Contains(t, dump, "database.password = [redacted] (file)\n")
+	require.NotContains(t, dump, "from-")
+
+	_, err = Load([]string{"-config", path, "-redis.redis_password=vault:secret/data/wb#missing"})
+	require.Error(t, err)
+	t.Setenv("DB_PASSWORD", "plain")
+	_, err = Load([]string{"-config", path})
+	require.ErrorContains(t, err, "both DB_PASSWORD and DB_PASSWORD_FILE are set")
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg, err := Load([]string{"-config", "../../config.yaml"})
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	cfg.DBConf.Host = ""
+	cfg.DBConf.Port = "54x32"
+	cfg.RDBConf.RedisAddress = "redis"
+	cfg.ServConf.Timeout = 0
+	cfg.ServConf.DrainTimeout = cfg.ServConf.ShutdownTimeout * 2
+	cfg.Connect.MaxDelay = cfg.Connect.InitialDelay / 2
+	cfg.RDBConf.ReadStrategy = "db-only"
+	cfg.Tracing.Enabled = true
+	cfg.Tracing.Endpoint = "http://collector:4318"
+	cfg.Tracing.SampleRatio = 1.5
+	cfg.Stats.RefreshInterval = 0
+	cfg.Kafka.Compression = "brotli"
+	cfg.Kafka.DeliverySemantics = "exactly-once"
+	cfg.Validation.MaxItems = -1
+	cfg.Validation.UnknownFields = "drop"
+	cfg.DLQRetry.MaxDelay = time.Second
+	cfg.Notify.Enabled = true
+	cfg.Notify.Notifiers = []NotifierCfg{{Name: "ops", Type: "telegram", BotToken: "token"}}
+	cfg.Notify.Rules = []NotifyRuleCfg{{Name: "dlq", Type: RuleDLQGrowth, Threshold: 10, Notifiers: []string{"oncall"}}}
+	err = cfg.Validate()
+	require.Error(t, err)
+	// every problem is reported at once
+	for _, field := range []string{"database.host", "database.port", "redis.redis_address", "server.timeout", "server.drain_timeout", "connect.max_delay", "redis.read_strategy",
+		"tracing.endpoint", "tracing.sample_ratio", "stats.refresh_interval", "kafka.compression", "kafka.delivery_semantics", "validation.max_items", "validation.unknown_fields", "dlq_retry.max_delay", "notify.notifiers[0].chat_id", "notify.rules[0].window", "notify.rules[0].notifiers"} {
+		require.Contains(t, err.Error(), "validation error: "+field+" - ")
+	}
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	cfg, err = Load([]string{"-config", "../../config.yaml"})
+	require.NoError(t, err)
+	cfg.Transport = TransportRabbitMQ
+	cfg.RabbitMQ.DLQ = ""
+	cfg.RabbitMQ.Prefetch = 0
+	err = cfg.Validate()
+	require.ErrorContains(t, err, "validation error: rabbitmq.dlq - ")
+	require.ErrorContains(t, err, "validation error: rabbitmq.prefetch - ")
+	cfg.Transport = "sqs"
+	require.ErrorContains(t, cfg.Validate(), "validation error: transport - ")
+
+	// a zero budget would skip every shutdown step
+	cfg, err = Load([]string{"-config", "../../config.yaml"})
+	require.NoError(t, err)
+	cfg.ServConf.ShutdownTimeout = 0
+	require.ErrorContains(t, cfg.Validate(), "validation error: server.shutdown_timeout - must be positive")
+}
+
+func TestLoadProfile(t *testing.T) {
+	t.Setenv("APP_ENV", "local")
+	t.Setenv("KAFKA_TOPIC", "orders_test")
+	cfg, err := Load([]string{"-config", "../../config.yaml"})
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	// the profile overrides the base file, env overrides both
+	require.Equal(t, "localhost", cfg.DBConf.Host)
+	require.Equal(t, SourceYAML, cfg.Source("database.host"))
+	require.Equal(t, []string{"localhost:9092"}, cfg.Kafka.Brokers)
+	require.Equal(t, "orders_test", cfg.Kafka.Topic)
+	require.Equal(t, "postgres", cfg.DBConf.User)
+	require.Len(t, cfg.Outbox.Destinations, 1)
+	require.Equal(t, "localhost:9092", cfg.Outbox.Destinations[0].Address)
+
+	t.Setenv("APP_ENV", "staging")
+	_, err = Load([]string{"-config", "../../config.yaml"})
+	require.ErrorContains(t, err, "config.staging.yaml")
+}
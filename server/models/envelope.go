@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CurrentSchemaVersion is the version of the order payload the producer wraps into an Envelope and the
+// version every payload is decoded to. Version 1 carries the amounts in whole major units of the payment
+// currency (1817 USD), version 2 in minor units (181700 for 1817.00 USD, see Money).
+const CurrentSchemaVersion = 2
+
+// SchemaVersionBare is the version reported for a message without an envelope: the bare order sent by
+// producers predating it, the same shape as version 1
+const SchemaVersionBare = 0
+
+// Envelope wraps an order message with the version of its payload, so that the Order schema can evolve
+// while older producers still send the previous versions
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// payloadDecoders upgrade the payload of each supported version to CurrentSchemaVersion. A new version of
+// the schema adds its decoder here and rewrites the decoders of the previous versions to produce it.
+var payloadDecoders = map[int]func(payload json.RawMessage) (json.RawMessage, error){
+	SchemaVersionBare: majorToMinorUnits,
+	1:                 majorToMinorUnits,
+	2:                 sameAsCurrent,
+}
+
+func sameAsCurrent(payload json.RawMessage) (json.RawMessage, error) {
+	return payload, nil
+}
+
+// majorToMinorUnits upgrades the amounts of a payload of version 1 to minor units of the payment currency;
+// an amount overflowing int64 is reported as ValidationErrors
+func majorToMinorUnits(payload json.RawMessage) (json.RawMessage, error) {
+	return scaleAmounts(payload, func(amount, scale int64) (int64, bool) {
+		if amount > math.MaxInt64/scale || amount < math.MinInt64/scale {
+			return 0, false
+		}
+		return amount * scale, true
+	})
+}
+
+// LegacyPayload returns the payload of CurrentSchemaVersion with its amounts in whole major units, the bare
+// order of the producers predating the envelope; the fractions of the amounts are dropped
+func LegacyPayload(payload []byte) ([]byte, error) {
+	return scaleAmounts(payload, func(amount, scale int64) (int64, bool) {
+		return amount / scale, true
+	})
+}
+
+// paymentAmounts and itemAmounts are the fields of the order payload holding amounts
+var (
+	paymentAmounts = []string{"amount", "delivery_cost", "goods_total", "custom_fee"}
+	itemAmounts    = []string{"price", "total_price"}
+)
+
+// scaleAmounts converts the integer amounts of the order payload with convert, scale is the number of minor
+// units in a major unit of the payment currency. What isn't an integer is left as is for the schema to reject.
+func scaleAmounts(payload []byte, convert func(amount, scale int64) (int64, bool)) ([]byte, error) {
+	var order map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &order); err != nil {
+		return payload, nil
+	}
+	var payment map[string]json.RawMessage
+	if err := json.Unmarshal(order["payment"], &payment); err != nil || payment == nil {
+		return payload, nil
+	}
+	var currency string
+	_ = json.Unmarshal(payment["currency"], &currency)
+	scale := int64(math.Pow10(MinorUnits(currency)))
+
+	var errs ValidationErrors
+	scaleFields := func(obj map[string]json.RawMessage, path string, fields []string) {
+		for _, field := range fields {
+			amount, err := strconv.ParseInt(string(obj[field]), 10, 64)
+			if err != nil {
+				continue
+			}
+			scaled, ok := convert(amount, scale)
+			if !ok {
+				errs = append(errs, &ValidationError{Field: path + field, Tag: "range", Value: amount,
+					Message: "is out of range in minor units"})
+				continue
+			}
+			obj[field] = json.RawMessage(strconv.FormatInt(scaled, 10))
+		}
+	}
+	scaleFields(payment, "payment.", paymentAmounts)
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(order["items"], &items); err == nil {
+		for _, item := range items {
+			scaleFields(item, "items[].", itemAmounts)
+		}
+		if order["items"], err = json.Marshal(items); err != nil {
+			return nil, err
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	var err error
+	if order["payment"], err = json.Marshal(payment); err != nil {
+		return nil, err
+	}
+	return json.Marshal(order)
+}
+
+// NewEnvelope wraps the order payload into an Envelope of CurrentSchemaVersion
+func NewEnvelope(payload []byte, producedAt time.Time) ([]byte, error) {
+	return json.Marshal(Envelope{SchemaVersion: CurrentSchemaVersion, ProducedAt: producedAt.UTC(), Payload: payload})
+}
+
+// OpenEnvelope returns the envelope of message with its payload as sent, see UpgradePayload. A message
+// without schema_version is a bare order of SchemaVersionBare, one that isn't JSON is returned as is for
+// json.Unmarshal to reject. An unsupported version or an envelope without a payload is reported as
+// ValidationErrors, like ValidateSchema.
+func OpenEnvelope(message []byte) (Envelope, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(message, &probe); err != nil || probe["schema_version"] == nil {
+		return Envelope{SchemaVersion: SchemaVersionBare, Payload: message}, nil
+	}
+	var env Envelope
+	if err := json.Unmarshal(message, &env); err != nil {
+		return Envelope{}, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if _, ok := payloadDecoders[env.SchemaVersion]; !ok || env.SchemaVersion == SchemaVersionBare {
+		return Envelope{}, unsupportedVersion(env.SchemaVersion)
+	}
+	if len(env.Payload) == 0 || string(env.Payload) == "null" {
+		return Envelope{}, ValidationErrors{&ValidationError{Field: "payload", Tag: "required", Message: "is required"}}
+	}
+	return env, nil
+}
+
+// UpgradePayload decodes the payload of an order sent with version to CurrentSchemaVersion, for the
+// consumers and for the payloads stored as sent (the event log, orders_raw); payload itself is left as is
+func UpgradePayload(version int, payload []byte) ([]byte, error) {
+	decode, ok := payloadDecoders[version]
+	if !ok {
+		return nil, unsupportedVersion(version)
+	}
+	upgraded, err := decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("schema version %d: %w", version, err)
+	}
+	return upgraded, nil
+}
+
+func unsupportedVersion(version int) error {
+	return ValidationErrors{&ValidationError{Field: "schema_version", Tag: "supported", Value: version,
+		Message: fmt.Sprintf("must be one of %v", SupportedSchemaVersions())}}
+}
+
+// SupportedSchemaVersions returns the versions of the envelope the consumer decodes, in order
+func SupportedSchemaVersions() []int {
+	versions := make([]int, 0, len(payloadDecoders))
+	for v := range payloadDecoders {
+		if v != SchemaVersionBare {
+			versions = append(versions, v)
+		}
+	}
+	slices.Sort(versions)
+	return versions
+}
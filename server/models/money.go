@@ -0,0 +1,208 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCurrencyMismatch is returned by arithmetic on amounts of different currencies
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// minorUnits are the decimal places of the ISO 4217 currencies not having 2 of them
+var minorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorUnits returns the number of decimal places of the currency (2 for the most of them)
+func MinorUnits(currency string) int {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// Money is an amount in minor units of its currency (cents of USD, kopecks of RUB). Amounts of orders are
+// integers of minor units everywhere: in Kafka messages, in the database and in API responses, so nothing rounds;
+// the order JSON carries only the integers, the currency is the one of the payment.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// NewMoney returns amount minor units of the currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add returns the sum of the amounts of the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Decimal formats the amount in major units with the decimal places of the currency, e.g. 18.17
+func (m Money) Decimal() string {
+	units := MinorUnits(m.Currency)
+	digits := strconv.FormatInt(m.Amount, 10)
+	sign := ""
+	if m.Amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if units == 0 {
+		return sign + digits
+	}
+	if len(digits) <= units {
+		digits = strings.Repeat("0", units-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-units] + "." + digits[len(digits)-units:]
+}
+
+// String formats the amount with its currency code, e.g. 18.17 USD
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// SetCurrency sets the currency of the amounts of o, read as bare minor units, to the currency of its payment
+func (o *Order) SetCurrency() {
+	p := &o.Payment
+	for _, m := range []*Money{&p.Amount, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee} {
+		m.Currency = p.Currency
+	}
+	for i := range o.Items {
+		o.Items[i].Price.Currency = p.Currency
+		o.Items[i].TotalPrice.Currency = p.Currency
+	}
+}
+
+// UnmarshalJSON decodes the order and sets the currency of its amounts
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type order Order
+	if err := json.Unmarshal(data, (*order)(o)); err != nil {
+		return err
+	}
+	o.SetCurrency()
+	return nil
+}
+
+// MarshalJSON writes the amounts of the payment as integers of minor units
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type payment Payment
+	return json.Marshal(struct {
+		payment
+		Amount       int64 `json:"amount"`
+		DeliveryCost int64 `json:"delivery_cost"`
+		GoodsTotal   int64 `json:"goods_total"`
+		CustomFee    int64 `json:"custom_fee"`
+	}{payment(p), p.Amount.Amount, p.DeliveryCost.Amount, p.GoodsTotal.Amount, p.CustomFee.Amount})
+}
+
+// UnmarshalJSON reads the amounts of the payment as integers of minor units of its currency
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	type payment Payment
+	wire := struct {
+		*payment
+		Amount       int64 `json:"amount"`
+		DeliveryCost int64 `json:"delivery_cost"`
+		GoodsTotal   int64 `json:"goods_total"`
+		CustomFee    int64 `json:"custom_fee"`
+	}{payment: (*payment)(p)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	p.Amount, p.DeliveryCost = p.Money(wire.Amount), p.Money(wire.DeliveryCost)
+	p.GoodsTotal, p.CustomFee = p.Money(wire.GoodsTotal), p.Money(wire.CustomFee)
+	return nil
+}
+
+// MarshalJSON writes the prices of the item as integers of minor units
+func (i Item) MarshalJSON() ([]byte, error) {
+	type item Item
+	return json.Marshal(struct {
+		item
+		Price      int64 `json:"price"`
+		TotalPrice int64 `json:"total_price"`
+	}{item(i), i.Price.Amount, i.TotalPrice.Amount})
+}
+
+// UnmarshalJSON reads the prices of the item as integers of minor units, their currency is set by the order
+func (i *Item) UnmarshalJSON(data []byte) error {
+	type item Item
+	wire := struct {
+		*item
+		Price      int64 `json:"price"`
+		TotalPrice int64 `json:"total_price"`
+	}{item: (*item)(i)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	i.Price.Amount, i.TotalPrice.Amount = wire.Price, wire.TotalPrice
+	return nil
+}
+
+// MarshalJSON writes the fields of the hit along with the ones of its item, whose MarshalJSON would hide them
+func (h ItemHit) MarshalJSON() ([]byte, error) {
+	head, err := json.Marshal(struct {
+		OrderUID    string    `json:"order_uid"`
+		DateCreated time.Time `json:"date_created"`
+	}{h.OrderUID, h.DateCreated})
+	if err != nil {
+		return nil, err
+	}
+	item, err := json.Marshal(h.Item)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(head[:len(head)-1], ','), item[1:]...), nil
+}
+
+// UnmarshalJSON reads the fields of the hit along with the ones of its item, whose UnmarshalJSON would hide them
+func (h *ItemHit) UnmarshalJSON(data []byte) error {
+	var head struct {
+		OrderUID    string    `json:"order_uid"`
+		DateCreated time.Time `json:"date_created"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	h.OrderUID, h.DateCreated = head.OrderUID, head.DateCreated
+	return h.Item.UnmarshalJSON(data)
+}
+
+// UnmarshalJSON reads the token of the event along with the order, whose UnmarshalJSON would hide it
+func (e *OrderSavedEvent) UnmarshalJSON(data []byte) error {
+	var token struct {
+		StatusToken string `json:"status_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return err
+	}
+	e.StatusToken = token.StatusToken
+	return e.Order.UnmarshalJSON(data)
+}
+
+// Value stores the amount in minor units, the currency is stored with the payment
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan reads an amount in minor units, its currency is set by Order.SetCurrency
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		m.Amount = v
+		return nil
+	case nil:
+		m.Amount = 0
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Money", src)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoney(t *testing.T) {
+	for _, tc := range []struct {
+		money Money
+		want  string
+	}{
+		{NewMoney(1817, "USD"), "18.17 USD"},
+		{NewMoney(5, "RUB"), "0.05 RUB"},
+		{NewMoney(0, "EUR"), "0.00 EUR"},
+		{NewMoney(-250, "EUR"), "-2.50 EUR"},
+		{NewMoney(1817, "JPY"), "1817 JPY"},
+		{NewMoney(1817, "KWD"), "1.817 KWD"},
+		{NewMoney(7, "KWD"), "0.007 KWD"},
+	} {
+		require.Equal(t, tc.want, tc.money.String())
+	}
+
+	sum, err := NewMoney(317, "USD").Add(NewMoney(1500, "USD"))
+	require.NoError(t, err)
+	require.Equal(t, NewMoney(1817, "USD"), sum)
+	_, err = NewMoney(317, "USD").Add(NewMoney(1500, "RUB"))
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderSchema is the JSON Schema of the order message: the types and the required fields, which
+// json.Unmarshal would otherwise turn into zero values (a null or missing amount becomes 0).
+// The allowed values and formats are left to Order.Validate.
+//
+//go:embed order.schema.json
+var OrderSchema []byte
+
+const orderSchemaURL = "order.schema.json"
+
+var orderSchema = compileOrderSchema()
+
+var schemaPrinter = message.NewPrinter(language.English)
+
+func compileOrderSchema() *jsonschema.Schema {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(OrderSchema))
+	if err != nil {
+		panic(fmt.Sprintf("order schema: %v", err))
+	}
+	c := jsonschema.NewCompiler()
+	c.AssertFormat()
+	if err := c.AddResource(orderSchemaURL, doc); err != nil {
+		panic(fmt.Sprintf("order schema: %v", err))
+	}
+	return c.MustCompile(orderSchemaURL)
+}
+
+// ValidateSchema checks the order message against OrderSchema before it is decoded into Order and returns
+// ValidationErrors listing every violation by its path (e.g. payment.amount or items[0].price). It does
+// nothing while validation.schema is off; a payload that isn't JSON is left to json.Unmarshal.
+func ValidateSchema(payload []byte) error {
+	if !validationRules.Load().Schema {
+		return nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return nil
+	}
+	err = orderSchema.Validate(doc)
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+	var errs ValidationErrors
+	collectSchemaErrors(verr, doc, &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// collectSchemaErrors adds the leaf violations of e, a missing property is reported at its own path
+func collectSchemaErrors(e *jsonschema.ValidationError, doc any, errs *ValidationErrors) {
+	if len(e.Causes) > 0 {
+		for _, cause := range e.Causes {
+			collectSchemaErrors(cause, doc, errs)
+		}
+		return
+	}
+	field := schemaPath(e.InstanceLocation)
+	switch k := e.ErrorKind.(type) {
+	case *kind.Required:
+		for _, name := range k.Missing {
+			*errs = append(*errs, &ValidationError{Field: joinPath(field, name), Tag: "required", Message: "is required"})
+		}
+	case *kind.Type:
+		*errs = append(*errs, &ValidationError{Field: field, Tag: "type", Value: valueAt(doc, e.InstanceLocation),
+			Message: fmt.Sprintf("must be %s, got %s", strings.Join(k.Want, " or "), k.Got)})
+	default:
+		tag := "schema"
+		if path := e.ErrorKind.KeywordPath(); len(path) > 0 {
+			tag = path[len(path)-1]
+		}
+		*errs = append(*errs, &ValidationError{Field: field, Tag: tag, Value: valueAt(doc, e.InstanceLocation),
+			Message: e.ErrorKind.LocalizedString(schemaPrinter)})
+	}
+}
+
+// schemaPath turns the tokens of an instance location into the field path of ValidationError
+func schemaPath(location []string) string {
+	var sb strings.Builder
+	for _, token := range location {
+		if _, err := strconv.Atoi(token); err == nil {
+			sb.WriteString("[" + token + "]")
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// valueAt returns the value of doc at the instance location, numbers as they were written
+func valueAt(doc any, location []string) any {
+	for _, token := range location {
+		switch v := doc.(type) {
+		case map[string]any:
+			doc = v[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i >= len(v) {
+				return nil
+			}
+			doc = v[i]
+		default:
+			return nil
+		}
+	}
+	switch doc.(type) {
+	case map[string]any, []any:
+		// the whole object or array isn't worth repeating in the error
+		return nil
+	}
+	return doc
+}
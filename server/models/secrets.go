@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Secret settings (tagged secret:"true") can be kept out of the config file and the environment:
+//   - <ENV>_FILE names a file holding the value, e.g. DB_PASSWORD_FILE=/run/secrets/db_password (Docker secrets);
+//   - a value vault:<path>#<key> is read from HashiCorp Vault at VAULT_ADDR with VAULT_TOKEN (or VAULT_TOKEN_FILE),
+//     e.g. vault:secret/data/wb#db_password for the KV v2 engine mounted at secret/.
+
+const vaultPrefix = "vault:"
+
+// vaultTimeout bounds one read of Vault
+const vaultTimeout = 10 * time.Second
+
+// readSecretFile reads the value of the secret setting from the file named by <ENV>_FILE;
+// ok is false if the variable isn't set
+func readSecretFile(env string) (value string, ok bool, err error) {
+	path, ok := os.LookupEnv(env + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	if _, set := os.LookupEnv(env); set {
+		return "", true, fmt.Errorf("both %s and %s_FILE are set", env, env)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", true, fmt.Errorf("can't read %s_FILE: %v", env, err)
+	}
+	// files written by editors and `echo` end with a newline
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// resolveVaultSecrets replaces the vault:<path>#<key> references of the secret settings by their values
+func resolveVaultSecrets(cfg *Config) error {
+	var vault *vaultClient
+	var err error
+	walkConfig(reflect.ValueOf(cfg).Elem(), "", func(key string, f reflect.StructField, v reflect.Value) {
+		if err != nil || f.Tag.Get("secret") != "true" {
+			return
+		}
+		resolve := func(s reflect.Value) {
+			ref := s.String()
+			if err != nil || !strings.HasPrefix(ref, vaultPrefix) {
+				return
+			}
+			if vault == nil {
+				if vault, err = newVaultClient(); err != nil {
+					err = fmt.Errorf("can't resolve %s: %v", key, err)
+					return
+				}
+			}
+			var value string
+			if value, err = vault.read(strings.TrimPrefix(ref, vaultPrefix)); err != nil {
+				err = fmt.Errorf("can't resolve %s: %v", key, err)
+				return
+			}
+			s.SetString(value)
+			if cfg.sources != nil {
+				cfg.sources[key] = SourceVault
+			}
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			resolve(v)
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+			for i := 0; i < v.Len(); i++ {
+				resolve(v.Index(i))
+			}
+		}
+	})
+	return err
+}
+
+// vaultClient reads secrets over the HTTP API of Vault, each path once per load
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+	secrets   map[string]map[string]any
+}
+
+func newVaultClient() (*vaultClient, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	token, fromFile, err := readSecretFile("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if !fromFile {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN is not set")
+	}
+	return &vaultClient{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: vaultTimeout},
+		secrets:   make(map[string]map[string]any),
+	}, nil
+}
+
+// read returns the key of the secret in ref (<path>#<key>)
+func (v *vaultClient) read(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference %q is not vault:<path>#<key>", vaultPrefix+ref)
+	}
+	secret, ok := v.secrets[path]
+	if !ok {
+		var err error
+		if secret, err = v.fetch(path); err != nil {
+			return "", err
+		}
+		v.secrets[path] = secret
+	}
+	value, ok := secret[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string key %s", path, key)
+	}
+	return value, nil
+}
+
+func (v *vaultClient) fetch(path string) (map[string]any, error) {
+	req, err := http.NewRequest(http.MethodGet, v.addr+"/v1/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: reading %s: status %d", path, resp.StatusCode)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("vault: reading %s: %v", path, err)
+	}
+	// KV v2 nests the secret with its metadata, KV v1 returns it as is
+	if inner, ok := body.Data["data"].(map[string]any); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return body.Data, nil
+}
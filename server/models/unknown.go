@@ -0,0 +1,112 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	orderType       = reflect.TypeOf(Order{})
+	orderTypes      = map[reflect.Type]bool{orderType: true, reflect.TypeOf(Payment{}): true, reflect.TypeOf(Item{}): true}
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	// jsonFields caches the lowercased JSON names of the fields of the struct types of Order
+	jsonFields sync.Map // reflect.Type -> map[string]reflect.Type
+)
+
+// CheckUnknownFields returns the fields of the order payload that Order has no place for, which json.Unmarshal
+// would drop, as paths like delivery.floor or items[].color. Under validation.unknown_fields reject they are
+// returned as ValidationErrors instead, under ignore they aren't looked for. A payload that isn't JSON is
+// left to json.Unmarshal.
+func CheckUnknownFields(payload []byte) ([]string, error) {
+	mode := validationRules.Load().UnknownFields
+	if mode == UnknownFieldsIgnore {
+		return nil, nil
+	}
+	fields := UnknownFields(payload)
+	if mode != UnknownFieldsReject || len(fields) == 0 {
+		return fields, nil
+	}
+	errs := make(ValidationErrors, 0, len(fields))
+	for _, field := range fields {
+		errs = append(errs, &ValidationError{Field: field, Tag: "unknown", Message: "is not a field of the order"})
+	}
+	return nil, errs
+}
+
+// UnknownFields returns the sorted paths of the fields of payload missing from Order, the items of an array
+// share one path
+func UnknownFields(payload []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+	var fields []string
+	collectUnknown(doc, orderType, "", &fields)
+	slices.Sort(fields)
+	return slices.Compact(fields)
+}
+
+// collectUnknown walks doc along t the way json.Unmarshal would, names are matched case-insensitively
+func collectUnknown(doc any, t reflect.Type, path string, fields *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// the types of the order decode their amounts themselves but keep the fields, they are walked like the others
+	if reflect.PointerTo(t).Implements(unmarshalerType) && !orderTypes[t] {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return
+		}
+		known := structFields(t)
+		for name, value := range obj {
+			ft, ok := known[strings.ToLower(name)]
+			if !ok {
+				*fields = append(*fields, joinPath(path, name))
+				continue
+			}
+			collectUnknown(value, ft, joinPath(path, name), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]any)
+		if !ok {
+			return
+		}
+		for _, value := range arr {
+			collectUnknown(value, t.Elem(), path+"[]", fields)
+		}
+	}
+}
+
+// structFields returns the JSON names of the exported fields of struct t and their types
+func structFields(t reflect.Type) map[string]reflect.Type {
+	if known, ok := jsonFields.Load(t); ok {
+		return known.(map[string]reflect.Type)
+	}
+	known := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[strings.ToLower(name)] = f.Type
+	}
+	jsonFields.Store(t, known)
+	return known
+}
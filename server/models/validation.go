@@ -0,0 +1,202 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	phoneRegex    = regexp.MustCompile(`^\+\d{5,15}$`)
+	trackNumRegex = regexp.MustCompile(`^[A-Z0-9]{8,20}$`)
+)
+
+// validate checks the validate tags of Order, Delivery, Payment and Item.
+// Besides the built-in rules it knows track_number, phone, not_future and allowed=<set of ValidationCfg>.
+var validate = newValidator()
+
+// validationRules is the snapshot of the sets checked by the allowed rule; until SetValidationRules
+// is called these are the defaults of ValidationCfg
+var validationRules atomic.Pointer[ValidationCfg]
+
+func init() {
+	SetValidationRules(ValidationCfg{
+		Currencies: []string{"USD", "EUR", "RUB"},
+		Providers:  []string{"wbpay", "applepay", "googlepay"},
+		Locales:    []string{"en", "ru"},
+
+		MaxMessageBytes: 1 << 20,
+		MaxItems:        1000,
+		Schema:          true,
+		UnknownFields:   UnknownFieldsWarn,
+	})
+}
+
+// SetValidationRules replaces the allowed values checked by Validate, e.g. on a config reload
+func SetValidationRules(cfg ValidationCfg) {
+	validationRules.Store(&cfg)
+}
+
+// TooLargeError rejects a message over validation.max_message_bytes or an order with more items than
+// validation.max_items. Such a message is quarantined without retries.
+type TooLargeError struct {
+	What  string // "message" (its size in bytes) or "items"
+	Size  int
+	Limit int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s is too large: %d exceeds the limit of %d", e.What, e.Size, e.Limit)
+}
+
+// CheckMessageSize returns a TooLargeError if payload is over validation.max_message_bytes; it is checked
+// before the payload is decoded
+func CheckMessageSize(payload []byte) error {
+	if limit := validationRules.Load().MaxMessageBytes; limit > 0 && len(payload) > limit {
+		return &TooLargeError{What: "message", Size: len(payload), Limit: limit}
+	}
+	return nil
+}
+
+// CheckItems returns a TooLargeError if o has more items than validation.max_items; it is checked before Validate
+func (o *Order) CheckItems() error {
+	if limit := validationRules.Load().MaxItems; limit > 0 && len(o.Items) > limit {
+		return &TooLargeError{What: "items", Size: len(o.Items), Limit: limit}
+	}
+	return nil
+}
+
+// allowedSet returns the set of ValidationCfg named by the param of the allowed rule
+func allowedSet(name string) []string {
+	rules := validationRules.Load()
+	switch name {
+	case "currencies":
+		return rules.Currencies
+	case "providers":
+		return rules.Providers
+	case "locales":
+		return rules.Locales
+	case "banks":
+		return rules.Banks
+	}
+	panic(fmt.Sprintf("unknown set %q of the allowed rule", name))
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// errors name the fields as the JSON of the order does
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// the rules of the amounts (gt=0) check their minor units
+	v.RegisterCustomTypeFunc(func(f reflect.Value) any {
+		return f.Interface().(Money).Amount
+	}, Money{})
+	must := func(err error) {
+		if err != nil {
+			panic(err)
+		}
+	}
+	must(v.RegisterValidation("track_number", func(fl validator.FieldLevel) bool {
+		return trackNumRegex.MatchString(fl.Field().String())
+	}))
+	must(v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phoneRegex.MatchString(fl.Field().String())
+	}))
+	// an hour of clock skew between the producer and the service is tolerated
+	must(v.RegisterValidation("not_future", func(fl validator.FieldLevel) bool {
+		t, ok := fl.Field().Interface().(time.Time)
+		return ok && !t.After(time.Now().Add(time.Hour))
+	}))
+	// an empty set allows any value
+	must(v.RegisterValidation("allowed", func(fl validator.FieldLevel) bool {
+		set := allowedSet(fl.Param())
+		return len(set) == 0 || slices.Contains(set, fl.Field().String())
+	}))
+	return v
+}
+
+// ValidationErrors are all invalid fields of an order. errors.As finds the first one as *ValidationError.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, fe := range e {
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// Validate checks the order and returns ValidationErrors listing every invalid field
+func (o *Order) Validate() error {
+	err := validate.Struct(o)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+	errs := make(ValidationErrors, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		// the namespace starts with the struct name: Order.payment.currency
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		errs = append(errs, &ValidationError{
+			Field:   field,
+			Tag:     fe.Tag(),
+			Value:   fe.Value(),
+			Message: validationMessage(fe),
+		})
+	}
+	return errs
+}
+
+// validationMessage describes the failed rule of fe for people
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "track_number", "phone", "email":
+		return "invalid format"
+	case "iso4217":
+		return "must be an ISO 4217 currency code"
+	case "not_future":
+		return "cannot be in the future"
+	case "allowed":
+		return "must be one of " + strings.Join(allowedSet(fe.Param()), ", ")
+	case "min", "max":
+		bound := "at least"
+		if fe.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters", bound, fe.Param())
+		case reflect.Slice:
+			return fmt.Sprintf("length must be %s %s", bound, fe.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	}
+	return "fails the " + fe.Tag() + " rule"
+}
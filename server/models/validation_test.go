@@ -0,0 +1,266 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validOrder() Order {
+	return Order{
+		OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK", Entry: "WBIL",
+		Delivery: Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay",
+			Amount: NewMoney(1817, "USD"), PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: NewMoney(1500, "USD"), GoodsTotal: NewMoney(317, "USD"), CustomFee: NewMoney(0, "USD")},
+		Items: []Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: NewMoney(453, "USD"), Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: NewMoney(317, "USD"), NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+		Locale: "en", CustomerID: "test", DeliveryService: "meest", Shardkey: "9", SmID: 99,
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OofShard: "1",
+	}
+}
+
+func TestOrderValidate(t *testing.T) {
+	order := validOrder()
+	require.NoError(t, order.Validate())
+
+	order.TrackNumber = "bad"
+	order.Delivery.Phone = "123"
+	order.Payment.Currency = "GBP"
+	order.Items[0].Sale = 101
+	order.DateCreated = time.Now().Add(2 * time.Hour)
+	err := order.Validate()
+
+	// every invalid field is reported with its JSON path, rule and value
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, ValidationErrors{
+		{Field: "track_number", Tag: "track_number", Value: "bad", Message: "invalid format"},
+		{Field: "delivery.phone", Tag: "phone", Value: "123", Message: "invalid format"},
+		{Field: "payment.currency", Tag: "allowed", Value: "GBP", Message: "must be one of USD, EUR, RUB"},
+		{Field: "items[0].sale", Tag: "lte", Value: 101, Message: "must be at most 100"},
+		{Field: "date_created", Tag: "not_future", Value: order.DateCreated, Message: "cannot be in the future"},
+	}, errs)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "track_number", verr.Field)
+
+	order = validOrder()
+	order.Payment.Currency = "BTC"
+	require.EqualError(t, order.Validate(), "validation error: payment.currency - must be an ISO 4217 currency code")
+
+	order = validOrder()
+	order.Items = nil
+	require.EqualError(t, order.Validate(), "validation error: items - length must be at least 1")
+}
+
+func TestOrderLimits(t *testing.T) {
+	defer SetValidationRules(*validationRules.Load())
+	SetValidationRules(ValidationCfg{MaxMessageBytes: 16, MaxItems: 2})
+
+	require.NoError(t, CheckMessageSize([]byte(`{"order_uid":1}`)))
+	var tooLarge *TooLargeError
+	require.ErrorAs(t, CheckMessageSize([]byte(`{"order_uid":"12"}`)), &tooLarge)
+	require.Equal(t, TooLargeError{What: "message", Size: 18, Limit: 16}, *tooLarge)
+
+	order := validOrder()
+	order.Items = append(order.Items, order.Items[0])
+	require.NoError(t, order.CheckItems())
+	order.Items = append(order.Items, order.Items[0])
+	require.EqualError(t, order.CheckItems(), "items is too large: 3 exceeds the limit of 2")
+
+	// 0 disables the limits
+	SetValidationRules(ValidationCfg{})
+	require.NoError(t, CheckMessageSize(make([]byte, 1<<21)))
+	require.NoError(t, order.CheckItems())
+}
+
+func TestValidationRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("validation:\n  banks: [alpha]\n"), 0o600))
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	require.Equal(t, []string{"USD", "EUR", "RUB"}, cfg.Validation.Currencies)
+
+	defer SetValidationRules(*validationRules.Load())
+	order := validOrder()
+	order.Payment.Provider = "sbp"
+	order.Payment.Bank = "sber"
+	var verr *ValidationError
+	require.ErrorAs(t, order.Validate(), &verr)
+	require.Equal(t, "payment.provider", verr.Field)
+
+	// a reloaded provider list is accepted without a restart
+	require.NoError(t, os.WriteFile(path, []byte("validation:\n  banks: [alpha]\n  providers: [wbpay, sbp]\n"), 0o600))
+	next, err := cfg.Reload()
+	require.NoError(t, err)
+	live := *cfg
+	applied, _ := live.ApplyReloadable(*next)
+	require.Equal(t, []string{"validation.providers"}, applied)
+	SetValidationRules(live.Validation)
+	require.ErrorAs(t, order.Validate(), &verr)
+	require.Equal(t, "payment.bank", verr.Field)
+	order.Payment.Bank = "alpha"
+	require.NoError(t, order.Validate())
+}
+
+func TestValidateSchema(t *testing.T) {
+	payload, err := json.Marshal(validOrder())
+	require.NoError(t, err)
+	require.NoError(t, ValidateSchema(payload))
+
+	// null, mistyped and missing fields would be decoded as zero values
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(payload, &doc))
+	doc["sm_id"] = 1.5
+	doc["date_created"] = "yesterday"
+	doc["payment"].(map[string]any)["amount"] = nil
+	delete(doc["items"].([]any)[0].(map[string]any), "nm_id")
+	delete(doc, "customer_id")
+	payload, err = json.Marshal(doc)
+	require.NoError(t, err)
+
+	err = ValidateSchema(payload)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 5)
+	require.Equal(t, &ValidationError{Field: "customer_id", Tag: "required", Message: "is required"}, errs[0])
+	require.Equal(t, "date_created", errs[1].Field)
+	require.Equal(t, "format", errs[1].Tag)
+	require.Equal(t, &ValidationError{Field: "items[0].nm_id", Tag: "required", Message: "is required"}, errs[2])
+	require.Equal(t, &ValidationError{Field: "payment.amount", Tag: "type", Message: "must be integer, got null"}, errs[3])
+	require.Equal(t, &ValidationError{Field: "sm_id", Tag: "type", Value: json.Number("1.5"), Message: "must be integer, got number"}, errs[4])
+
+	// off with validation.schema
+	defer SetValidationRules(*validationRules.Load())
+	SetValidationRules(ValidationCfg{})
+	require.NoError(t, ValidateSchema(payload))
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	payload, err := json.Marshal(validOrder())
+	require.NoError(t, err)
+	producedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// the current version round trips
+	message, err := NewEnvelope(payload, producedAt)
+	require.NoError(t, err)
+	env, err := OpenEnvelope(message)
+	require.NoError(t, err)
+	require.Equal(t, CurrentSchemaVersion, env.SchemaVersion)
+	require.True(t, producedAt.Equal(env.ProducedAt))
+	require.JSONEq(t, string(payload), string(env.Payload))
+
+	// a bare order of an older producer carries major units, the payload is returned as sent
+	env, err = OpenEnvelope(payload)
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersionBare, env.SchemaVersion)
+	require.Equal(t, string(payload), string(env.Payload))
+	upgraded, err := UpgradePayload(env.SchemaVersion, env.Payload)
+	require.NoError(t, err)
+	var bare Order
+	require.NoError(t, json.Unmarshal(upgraded, &bare))
+	require.Equal(t, NewMoney(181700, "USD"), bare.Payment.Amount)
+	require.Equal(t, NewMoney(45300, "USD"), bare.Items[0].Price)
+
+	// not JSON is left to json.Unmarshal
+	env, err = OpenEnvelope([]byte("{broken"))
+	require.NoError(t, err)
+	require.Equal(t, "{broken", string(env.Payload))
+
+	var errs ValidationErrors
+	_, err = OpenEnvelope([]byte(`{"schema_version": 99, "payload": {}}`))
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, "schema_version", errs[0].Field)
+	require.Equal(t, 99, errs[0].Value)
+
+	_, err = OpenEnvelope([]byte(`{"schema_version": 0, "payload": {}}`))
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, "schema_version", errs[0].Field)
+
+	_, err = OpenEnvelope([]byte(`{"schema_version": 1, "produced_at": "2024-03-01T12:00:00Z"}`))
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, &ValidationError{Field: "payload", Tag: "required", Message: "is required"}, errs[0])
+
+	_, err = OpenEnvelope([]byte(`{"schema_version": "1", "payload": {}}`))
+	require.ErrorContains(t, err, "invalid envelope")
+	require.Equal(t, []int{1, 2}, SupportedSchemaVersions())
+}
+
+func TestMajorToMinorUnits(t *testing.T) {
+	payload := []byte(`{"order_uid": "test", "payment": {"currency": "USD", "amount": 1817, "delivery_cost": 1500,
+		"goods_total": 317, "custom_fee": 0}, "items": [{"price": 453, "total_price": 317}, {"price": 10, "total_price": 7}]}`)
+	upgraded, err := UpgradePayload(1, payload)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"order_uid": "test", "payment": {"currency": "USD", "amount": 181700, "delivery_cost": 150000,
+		"goods_total": 31700, "custom_fee": 0}, "items": [{"price": 45300, "total_price": 31700},
+		{"price": 1000, "total_price": 700}]}`, string(upgraded))
+	// the payload itself is left as is
+	require.Contains(t, string(payload), `"amount": 1817,`)
+
+	// the scale follows the minor units of the currency
+	upgraded, err = UpgradePayload(SchemaVersionBare, []byte(`{"payment": {"currency": "JPY", "amount": 1817}, "items": [{"price": 453}]}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"payment": {"currency": "JPY", "amount": 1817}, "items": [{"price": 453}]}`, string(upgraded))
+
+	// the current version is returned unchanged
+	upgraded, err = UpgradePayload(CurrentSchemaVersion, payload)
+	require.NoError(t, err)
+	require.Equal(t, string(payload), string(upgraded))
+
+	// an amount that doesn't fit in minor units is rejected
+	var errs ValidationErrors
+	_, err = UpgradePayload(1, []byte(`{"payment": {"currency": "USD", "amount": 9223372036854775807}}`))
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, "payment.amount", errs[0].Field)
+	require.Equal(t, "range", errs[0].Tag)
+	_, err = UpgradePayload(99, payload)
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, "schema_version", errs[0].Field)
+
+	// the legacy payload drops the fractions
+	legacy, err := LegacyPayload([]byte(`{"payment": {"currency": "USD", "amount": 181799}}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"payment": {"currency": "USD", "amount": 1817}}`, string(legacy))
+}
+
+func TestUnknownFields(t *testing.T) {
+	payload, err := json.Marshal(validOrder())
+	require.NoError(t, err)
+	require.Empty(t, UnknownFields(payload))
+
+	// names match case-insensitively like json.Unmarshal, the items share one path
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(payload, &doc))
+	doc["Order_UID"] = doc["order_uid"]
+	doc["loyalty_tier"] = "gold"
+	doc["delivery"].(map[string]any)["floor"] = 3
+	item := doc["items"].([]any)[0].(map[string]any)
+	item["color"] = "red"
+	doc["items"] = append(doc["items"].([]any), map[string]any{"color": "blue", "size": "1"})
+	payload, err = json.Marshal(doc)
+	require.NoError(t, err)
+	require.Equal(t, []string{"delivery.floor", "items[].color", "loyalty_tier"}, UnknownFields(payload))
+
+	fields, err := CheckUnknownFields(payload)
+	require.NoError(t, err)
+	require.Len(t, fields, 3)
+
+	defer SetValidationRules(*validationRules.Load())
+	SetValidationRules(ValidationCfg{UnknownFields: UnknownFieldsReject})
+	_, err = CheckUnknownFields(payload)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 3)
+	require.Equal(t, &ValidationError{Field: "delivery.floor", Tag: "unknown", Message: "is not a field of the order"}, errs[0])
+
+	SetValidationRules(ValidationCfg{UnknownFields: UnknownFieldsIgnore})
+	fields, err = CheckUnknownFields(payload)
+	require.NoError(t, err)
+	require.Empty(t, fields)
+}
@@ -0,0 +1,213 @@
+package rabbitmq
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/health"
+	"WB_LVL0/server/internal/ingest"
+	"WB_LVL0/server/internal/logging"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"WB_LVL0/server/tracing"
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	logger = logging.Component("rabbitmq")
+	tracer = tracing.Tracer("rabbitmq")
+)
+
+// reconnectDelay is the pause before connecting again after the connection is lost
+const reconnectDelay = 5 * time.Second
+
+// Consumer reads orders from the RabbitMQ queue, processes them with the ingest pipeline and acknowledges
+// them manually: a message is acked once its order is stored, a failed one is quarantined and rejected,
+// so the queue dead-letters it through the DLX into the DLQ
+type Consumer struct {
+	cfg       models.RabbitMQCfg
+	pipeline  *ingest.Pipeline
+	errs      health.LastError // last connection or processing error
+	progress  health.Progress
+	connected atomic.Bool
+
+	mu  sync.Mutex
+	pub *amqp.Channel // confirm-mode channel of the redrives, nil while disconnected
+}
+
+// NewConsumer creates consumer of the orders queue saving into db. Saved orders are published to hub.
+func NewConsumer(db storage.Repository, hub *broadcast.Hub, cfg models.RabbitMQCfg) *Consumer {
+	return &Consumer{cfg: cfg, pipeline: ingest.New(db, hub, logger)}
+}
+
+// Run consumes the orders queue until ctx is cancelled, connecting again after a lost connection
+func (c *Consumer) Run(ctx context.Context) {
+	for {
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("rabbitmq connection lost, reconnecting", logging.Duration("in", reconnectDelay), logging.Err(err))
+		c.errs.Set(err)
+		c.progress.Failed(err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// consume connects, declares the topology and processes deliveries until ctx is cancelled (nil)
+// or the connection is lost
+func (c *Consumer) consume(ctx context.Context) error {
+	conn, err := amqp.Dial(c.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	if err := Declare(ch, c.cfg); err != nil {
+		return err
+	}
+	if err := ch.Qos(c.cfg.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	pub, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	if err := pub.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	c.setPublisher(pub)
+	defer c.setPublisher(nil)
+
+	deliveries, err := ch.Consume(c.cfg.Queue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %w", c.cfg.Queue, err)
+	}
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	c.connected.Store(true)
+	defer c.connected.Store(false)
+	c.errs.Set(nil)
+	c.progress.Recovered()
+	logger.Info("consuming orders", "queue", c.cfg.Queue, "exchange", c.cfg.Exchange, "prefetch", c.cfg.Prefetch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case amqpErr := <-closed:
+			if amqpErr == nil {
+				return errors.New("connection closed")
+			}
+			return amqpErr
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("deliveries channel closed")
+			}
+			c.progress.Fetched()
+			msgCtx, span := startProcessSpan(ctx, d)
+			err := c.pipeline.Process(msgCtx, c.message(d), settler{d: d})
+			tracing.End(span, err)
+			// the delivery is settled, acked or rejected, unless the connection is gone
+			c.progress.Committed(nil)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to process message after retries, dead-lettered", logging.Err(err))
+			}
+			c.errs.Set(err)
+		}
+	}
+}
+
+// Declare declares the exchange and the queue of the orders bound with the routing key and the DLX with
+// the DLQ. Redeclaring them is a no-op; a queue declared earlier with other arguments is an error.
+func Declare(ch *amqp.Channel, cfg models.RabbitMQCfg) error {
+	if err := ch.ExchangeDeclare(cfg.Exchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", cfg.Exchange, err)
+	}
+	if err := ch.ExchangeDeclare(cfg.DLX, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", cfg.DLX, err)
+	}
+	if _, err := ch.QueueDeclare(cfg.DLQ, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", cfg.DLQ, err)
+	}
+	if err := ch.QueueBind(cfg.DLQ, "", cfg.DLX, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %w", cfg.DLQ, err)
+	}
+	args := amqp.Table{"x-dead-letter-exchange": cfg.DLX}
+	if _, err := ch.QueueDeclare(cfg.Queue, true, false, false, false, args); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", cfg.Queue, err)
+	}
+	if err := ch.QueueBind(cfg.Queue, cfg.RoutingKey, cfg.Exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %w", cfg.Queue, err)
+	}
+	return nil
+}
+
+func (c *Consumer) setPublisher(ch *amqp.Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pub = ch
+}
+
+// startProcessSpan starts the span of processing d, continuing the trace of its publisher
+func startProcessSpan(ctx context.Context, d amqp.Delivery) (context.Context, trace.Span) {
+	return tracer.Start(Extract(ctx, d.Headers), "process "+d.RoutingKey,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(d.Exchange),
+			semconv.MessagingRabbitMQDestinationRoutingKey(d.RoutingKey),
+		))
+}
+
+// Health is down while disconnected from RabbitMQ or the database and degraded after a message sent to the DLQ
+func (c *Consumer) Health(context.Context) health.Result {
+	res := c.errs.Result()
+	if !c.connected.Load() || c.pipeline.Paused() {
+		res.Status = health.StatusDown
+	}
+	return res
+}
+
+// Progress tracks the deliveries received and settled and the connection failures
+func (c *Consumer) Progress() *health.Progress { return &c.progress }
+
+// message is d for the ingest pipeline, the queue stands for the topic. AMQP messages have no offsets,
+// every failure is a new record: the partition is -1 and the offset unique.
+func (c *Consumer) message(d amqp.Delivery) ingest.Message {
+	retries, _ := d.Headers[models.HeaderAutoRetries].(string)
+	return ingest.Message{
+		Topic:       c.cfg.Queue,
+		Partition:   -1,
+		Offset:      time.Now().UnixNano(),
+		Key:         d.MessageId,
+		Value:       d.Body,
+		AutoRetries: ingest.ParseAutoRetries(retries),
+		LogAttrs:    []any{"delivery_tag", d.DeliveryTag, "redelivered", d.Redelivered},
+	}
+}
+
+// settler settles d for the ingest pipeline: acked once processed, rejected without requeueing after
+// the retries, so the queue dead-letters it through the DLX into the DLQ, and requeued if the consumer stops
+type settler struct {
+	d amqp.Delivery
+}
+
+func (s settler) Ack() error { return s.d.Ack(false) }
+
+func (s settler) DeadLetter(context.Context, error) error { return s.d.Nack(false, false) }
+
+func (s settler) Requeue() error { return s.d.Nack(false, true) }
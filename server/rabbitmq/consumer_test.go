@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"WB_LVL0/server/internal/broadcast"
+	"WB_LVL0/server/internal/storage"
+	"WB_LVL0/server/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// settlement records how a delivery was settled
+type settlement struct {
+	acked, nacked, requeued bool
+}
+
+func (s *settlement) Ack(uint64, bool) error { s.acked = true; return nil }
+
+func (s *settlement) Nack(_ uint64, _ bool, requeue bool) error {
+	s.nacked, s.requeued = true, requeue
+	return nil
+}
+
+func (s *settlement) Reject(_ uint64, requeue bool) error { return s.Nack(0, false, requeue) }
+
+type stubRepo struct {
+	storage.Repository
+	saveErr error
+	saved   []string
+	failed  []models.FailedMessage
+}
+
+func (r *stubRepo) SaveOrderRaw(_ context.Context, order models.Order, _ models.RawPayload) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	r.saved = append(r.saved, order.OrderUID)
+	return nil
+}
+
+func (r *stubRepo) SaveFailedMessage(_ context.Context, m models.FailedMessage) error {
+	r.failed = append(r.failed, m)
+	return nil
+}
+
+func (r *stubRepo) Ping(context.Context) error { return nil }
+
+func delivery(t *testing.T, s *settlement, order models.Order) amqp.Delivery {
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	return amqp.Delivery{Acknowledger: s, MessageId: "m-1", Body: body}
+}
+
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK", Entry: "WBIL",
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay",
+			Amount: models.NewMoney(1817, "USD"), PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: models.NewMoney(1500, "USD"), GoodsTotal: models.NewMoney(317, "USD")},
+		Items: []models.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: models.NewMoney(453, "USD"), Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: models.NewMoney(317, "USD"), NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+		Locale: "en", CustomerID: "test", DeliveryService: "meest", Shardkey: "9", SmID: 99,
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OofShard: "1",
+	}
+}
+
+// process processes d like the consume loop
+func process(c *Consumer, d amqp.Delivery) error {
+	return c.pipeline.Process(context.Background(), c.message(d), settler{d: d})
+}
+
+func TestProcess(t *testing.T) {
+	cfg := models.RabbitMQCfg{Queue: "orders"}
+
+	// a stored order is acked
+	repo := &stubRepo{}
+	c := NewConsumer(repo, broadcast.NewHub(), cfg)
+	var s settlement
+	require.NoError(t, process(c, delivery(t, &s, testOrder())))
+	require.Equal(t, settlement{acked: true}, s)
+	require.Equal(t, []string{"b563feb7b2b84b6test"}, repo.saved)
+
+	// a redelivered order already stored is acked too
+	repo = &stubRepo{saveErr: fmt.Errorf("storage.SaveOrder: %w", storage.ErrOrderExists)}
+	c = NewConsumer(repo, broadcast.NewHub(), cfg)
+	s = settlement{}
+	require.NoError(t, process(c, delivery(t, &s, testOrder())))
+	require.Equal(t, settlement{acked: true}, s)
+
+	// an order in the envelope is stored like a bare one, an unknown schema version is rejected
+	repo = &stubRepo{}
+	c = NewConsumer(repo, broadcast.NewHub(), cfg)
+	d := delivery(t, &s, testOrder())
+	body, err := models.NewEnvelope(d.Body, time.Now())
+	require.NoError(t, err)
+	d.Body = body
+	s = settlement{}
+	require.NoError(t, process(c, d))
+	require.Equal(t, settlement{acked: true}, s)
+	require.Equal(t, []string{"b563feb7b2b84b6test"}, repo.saved)
+	d.Body = []byte(`{"schema_version": 99, "payload": {}}`)
+	s = settlement{}
+	require.Error(t, process(c, d))
+	require.Equal(t, settlement{nacked: true}, s)
+
+	// an invalid order is quarantined at once and rejected into the DLX
+	repo = &stubRepo{}
+	c = NewConsumer(repo, broadcast.NewHub(), cfg)
+	order := testOrder()
+	order.TrackNumber = "bad"
+	s = settlement{}
+	require.Error(t, process(c, delivery(t, &s, order)))
+	require.Equal(t, settlement{nacked: true}, s)
+	require.Empty(t, repo.saved)
+	require.Len(t, repo.failed, 1)
+	require.Equal(t, "orders", repo.failed[0].Topic)
+	require.Equal(t, "m-1", repo.failed[0].Key)
+	require.Equal(t, -1, repo.failed[0].Partition)
+	require.False(t, repo.failed[0].Transient)
+	require.Equal(t, 1, repo.failed[0].Attempts)
+
+	// an oversized message is quarantined without retries as well
+	repo = &stubRepo{}
+	c = NewConsumer(repo, broadcast.NewHub(), cfg)
+	order = testOrder()
+	for len(order.Items) <= 1000 {
+		order.Items = append(order.Items, order.Items[0])
+	}
+	s = settlement{}
+	err = process(c, delivery(t, &s, order))
+	var tooLarge *models.TooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, settlement{nacked: true}, s)
+	require.Empty(t, repo.saved)
+	require.Len(t, repo.failed, 1)
+}
+
+func TestMessage(t *testing.T) {
+	c := NewConsumer(&stubRepo{}, broadcast.NewHub(), models.RabbitMQCfg{Queue: "orders"})
+	m := c.message(amqp.Delivery{MessageId: "m-1", Headers: amqp.Table{models.HeaderAutoRetries: "2"}})
+	require.Equal(t, "orders", m.Topic)
+	require.Equal(t, "m-1", m.Key)
+	require.Equal(t, -1, m.Partition)
+	require.Equal(t, 2, m.AutoRetries)
+	require.Nil(t, m.At)
+}
+
+func TestTableCarrier(t *testing.T) {
+	headers := amqp.Table{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "attempt": 2}
+	c := tableCarrier(headers)
+	require.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", c.Get("traceparent"))
+	require.Empty(t, c.Get("attempt"))
+	c.Set("baggage", "k=v")
+	require.Equal(t, "k=v", headers["baggage"])
+}
@@ -0,0 +1,93 @@
+package rabbitmq
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"strconv"
+)
+
+// errNotConnected is returned by Redrive while the consumer has no connection
+var errNotConnected = errors.New("not connected to rabbitmq")
+
+// Publish publishes a persistent message with the trace context of ctx to the exchange and waits for the broker
+// to confirm it; ch must be in confirm mode
+func Publish(ctx context.Context, ch *amqp.Channel, exchange, key string, msg amqp.Publishing) error {
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	Inject(ctx, msg.Headers)
+	msg.DeliveryMode = amqp.Persistent
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("message to %s was nacked by the broker", exchange)
+	}
+	return nil
+}
+
+// Redrive publishes a quarantined message again to the orders exchange, so the consumer processes it once more.
+// A message failing again is quarantined anew, with the number of its automatic redrives.
+func (c *Consumer) Redrive(ctx context.Context, m models.FailedMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pub == nil {
+		return fmt.Errorf("failed to redrive message %d: %w", m.ID, errNotConnected)
+	}
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		MessageId:   m.Key,
+		Body:        []byte(m.Payload),
+	}
+	if m.AutoRetries > 0 {
+		msg.Headers = amqp.Table{models.HeaderAutoRetries: strconv.Itoa(m.AutoRetries)}
+	}
+	err := Publish(ctx, c.pub, c.cfg.Exchange, c.cfg.RoutingKey, msg)
+	if err != nil {
+		return fmt.Errorf("failed to redrive message %d to %s: %w", m.ID, c.cfg.Exchange, err)
+	}
+	logger.Info("failed message redriven", "id", m.ID, "queue", m.Topic, "exchange", c.cfg.Exchange)
+	return nil
+}
+
+// Inject writes the trace context of ctx into the headers of an AMQP message
+func Inject(ctx context.Context, headers amqp.Table) {
+	otel.GetTextMapPropagator().Inject(ctx, tableCarrier(headers))
+}
+
+// Extract returns ctx continuing the trace whose context is in the headers of an AMQP message
+func Extract(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, tableCarrier(headers))
+}
+
+// tableCarrier adapts AMQP message headers to the propagators
+type tableCarrier amqp.Table
+
+func (c tableCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c tableCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c tableCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
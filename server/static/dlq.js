@@ -0,0 +1,115 @@
+const pageSize = 20;
+const previewLength = 300;
+
+// the key is kept for the browser tab only
+const keyStorage = 'wb-admin-key';
+let offset = 0;
+
+function saveKey() {
+    sessionStorage.setItem(keyStorage, document.getElementById('apiKey').value.trim());
+    offset = 0;
+    loadMessages();
+}
+
+function changePage(delta) {
+    offset = Math.max(0, offset + delta * pageSize);
+    loadMessages();
+}
+
+async function adminFetch(url, options = {}) {
+    const response = await fetch(url, {
+        ...options,
+        headers: {'X-API-Key': sessionStorage.getItem(keyStorage) || ''},
+    });
+    if (!response.ok) {
+        const body = await response.json().catch(() => ({}));
+        throw new Error(body.error || `Ошибка: ${response.status}`);
+    }
+    return response;
+}
+
+async function loadMessages() {
+    showError('');
+    try {
+        const response = await adminFetch(`/admin/failed-messages?limit=${pageSize}&offset=${offset}`);
+        renderMessages(await response.json());
+    } catch (error) {
+        console.error('Ошибка:', error);
+        document.getElementById('result').innerHTML = '';
+        showError(`Не удалось загрузить сообщения: ${error.message}`);
+    }
+}
+
+function renderMessages(messages) {
+    document.getElementById('pageNumber').textContent = `Страница ${offset / pageSize + 1}`;
+    document.getElementById('prevPage').disabled = offset === 0;
+    document.getElementById('nextPage').disabled = messages.length < pageSize;
+
+    const resultDiv = document.getElementById('result');
+    if (messages.length === 0) {
+        resultDiv.innerHTML = '<p>Карантин пуст</p>';
+        return;
+    }
+    resultDiv.innerHTML = messages.map(m => {
+        const preview = m.payload.length > previewLength ? `${m.payload.slice(0, previewLength)}…` : m.payload;
+        return `
+            <div class="message" id="message-${m.id}">
+                <p><strong>#${m.id}</strong> ${escapeHTML(m.topic)} / партиция ${m.partition} / offset ${m.offset}
+                    ${m.key ? `/ ключ ${escapeHTML(m.key)}` : ''}</p>
+                <p class="reason"><strong>Ошибка:</strong> ${escapeHTML(m.error)}</p>
+                <p>Попыток: ${m.attempts}; первая ошибка ${new Date(m.first_failed_at).toLocaleString()},
+                    последняя ${new Date(m.last_failed_at).toLocaleString()}${m.transient
+                        ? `; временная ошибка, автоматических redrive: ${m.auto_retries}` : ''}</p>
+                <pre>${escapeHTML(preview)}</pre>
+                <div class="actions">
+                    <button onclick="redrive(${m.id})">Redrive</button>
+                    <button class="discard" onclick="discard(${m.id})">Удалить</button>
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+async function redrive(id) {
+    if (!confirm(`Отправить сообщение #${id} заново в топик?`)) {
+        return;
+    }
+    await act(id, `/admin/failed-messages/${id}/redrive`, 'POST');
+}
+
+async function discard(id) {
+    if (!confirm(`Удалить сообщение #${id} без обработки?`)) {
+        return;
+    }
+    await act(id, `/admin/failed-messages/${id}`, 'DELETE');
+}
+
+async function act(id, url, method) {
+    const buttons = document.querySelectorAll(`#message-${id} button`);
+    buttons.forEach(b => { b.disabled = true; });
+    try {
+        await adminFetch(url, {method});
+        showError('');
+        loadMessages();
+    } catch (error) {
+        console.error('Ошибка:', error);
+        showError(`Сообщение #${id}: ${error.message}`);
+        buttons.forEach(b => { b.disabled = false; });
+    }
+}
+
+function showError(message) {
+    document.getElementById('error').innerHTML = message ? `<div class="error">${escapeHTML(message)}</div>` : '';
+}
+
+function escapeHTML(value) {
+    return String(value ?? '').replace(/[&<>"']/g, c => ({
+        '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;',
+    })[c]);
+}
+
+const savedKey = sessionStorage.getItem(keyStorage);
+if (savedKey) {
+    document.getElementById('apiKey').value = savedKey;
+    loadMessages();
+}
@@ -0,0 +1,214 @@
+const pageSize = 20;
+
+// state of the shown list: cursors of the visited pages for GET /orders, offset for the search
+const state = {
+    query: '',
+    filter: new URLSearchParams(),
+    cursors: [''],
+    nextCursor: '',
+    offset: 0,
+    hasNext: false,
+    rows: [],
+    count: null,
+};
+
+function applyFilters() {
+    state.query = document.getElementById('query').value.trim();
+    state.filter = new URLSearchParams();
+    const customerId = document.getElementById('customerId').value.trim();
+    if (customerId) {
+        state.filter.set('customer_id', customerId);
+    }
+    // dates are taken as UTC days, "to" includes its day
+    const from = document.getElementById('dateFrom').value;
+    if (from) {
+        state.filter.set('from', `${from}T00:00:00Z`);
+    }
+    const to = document.getElementById('dateTo').value;
+    if (to) {
+        const next = new Date(`${to}T00:00:00Z`);
+        next.setUTCDate(next.getUTCDate() + 1);
+        state.filter.set('to', next.toISOString().replace('.000Z', 'Z'));
+    }
+    state.cursors = [''];
+    state.offset = 0;
+    loadPage();
+    loadCount();
+}
+
+function nextPage() {
+    if (state.query) {
+        state.offset += pageSize;
+    } else {
+        state.cursors.push(state.nextCursor);
+    }
+    loadPage();
+}
+
+function prevPage() {
+    if (state.query) {
+        state.offset = Math.max(0, state.offset - pageSize);
+    } else if (state.cursors.length > 1) {
+        state.cursors.pop();
+    }
+    loadPage();
+}
+
+async function loadPage() {
+    showError('');
+    try {
+        let rows;
+        if (state.query) {
+            const params = new URLSearchParams({q: state.query, limit: pageSize, offset: state.offset});
+            rows = await fetchJSON(`/orders/search?${params}`);
+            state.hasNext = rows.length === pageSize;
+        } else {
+            const params = new URLSearchParams(state.filter);
+            params.set('limit', pageSize);
+            const cursor = state.cursors[state.cursors.length - 1];
+            if (cursor) {
+                params.set('cursor', cursor);
+            }
+            const page = await fetchJSON(`/orders?${params}`);
+            rows = page.orders;
+            state.nextCursor = page.next_cursor || '';
+            state.hasNext = state.nextCursor !== '';
+        }
+        state.rows = rows;
+        renderOrders();
+    } catch (error) {
+        console.error('Ошибка:', error);
+        showError(`Не удалось загрузить заказы: ${error.message}`);
+    }
+}
+
+async function loadCount() {
+    state.count = null;
+    if (!state.query) {
+        try {
+            const result = await fetchJSON(`/orders/count?${state.filter}`);
+            state.count = result.count;
+        } catch (error) {
+            console.error('Ошибка:', error);
+        }
+    }
+    renderSummary();
+}
+
+function renderSummary() {
+    const summary = document.getElementById('summary');
+    summary.textContent = state.count === null ? '' : `Найдено заказов: ${state.count}`;
+}
+
+async function fetchJSON(url) {
+    const response = await fetch(url);
+    if (!response.ok) {
+        const body = await response.json().catch(() => ({}));
+        throw new Error(body.error || `Ошибка: ${response.status}`);
+    }
+    return response.json();
+}
+
+function renderOrders() {
+    const rows = state.rows;
+    const resultDiv = document.getElementById('result');
+    const page = state.query ? state.offset / pageSize + 1 : state.cursors.length;
+    document.getElementById('pageNumber').textContent = `Страница ${page}`;
+    document.getElementById('prevPage').disabled = page === 1;
+    document.getElementById('nextPage').disabled = !state.hasNext;
+
+    if (rows.length === 0) {
+        resultDiv.innerHTML = '<p>Заказов нет</p>';
+        return;
+    }
+    // search hits have the recipient and the city, list rows the track number, customer and delivery service
+    const columns = state.query
+        ? [['name', 'Получатель'], ['city', 'Город']]
+        : [['track_number', 'Трек-номер'], ['customer_id', 'Клиент'], ['delivery_service', 'Доставка']];
+    let html = '<table><tr><th>ID заказа</th>';
+    columns.forEach(([, title]) => {
+        html += `<th>${title}</th>`;
+    });
+    html += '<th>Дата создания</th></tr>';
+    rows.forEach(row => {
+        const uid = escapeHTML(row.order_uid);
+        html += `<tr${row.live ? ' class="live"' : ''}><td><a href="/?order_uid=${encodeURIComponent(row.order_uid)}">${uid}</a></td>`;
+        columns.forEach(([field]) => {
+            html += `<td>${escapeHTML(row[field])}</td>`;
+        });
+        html += `<td>${new Date(row.date_created).toLocaleString()}</td></tr>`;
+    });
+    html += '</table>';
+    resultDiv.innerHTML = html;
+}
+
+// live updates: orders consumed from Kafka are added on top of the first page of the list
+// if they match its filters; the search results are not updated
+function subscribe() {
+    const status = document.getElementById('liveStatus');
+    const source = new EventSource('/orders/stream');
+    source.onopen = () => {
+        status.textContent = '● обновляется в реальном времени';
+        status.className = 'live-on';
+    };
+    source.onerror = () => {
+        // EventSource reconnects by itself
+        status.textContent = '● нет соединения, переподключение…';
+        status.className = 'live-off';
+    };
+    source.addEventListener('order', event => {
+        const order = JSON.parse(event.data);
+        if (!matchesFilter(order)) {
+            return;
+        }
+        if (state.count !== null) {
+            state.count++;
+            renderSummary();
+        }
+        if (state.query || state.cursors.length > 1) {
+            return;
+        }
+        state.rows.unshift({...order, live: true});
+        renderOrders();
+    });
+}
+
+function matchesFilter(order) {
+    if (state.query) {
+        return false;
+    }
+    const customerId = state.filter.get('customer_id');
+    if (customerId && order.customer_id !== customerId) {
+        return false;
+    }
+    const created = new Date(order.date_created);
+    const from = state.filter.get('from');
+    if (from && created < new Date(from)) {
+        return false;
+    }
+    const to = state.filter.get('to');
+    return !(to && created >= new Date(to));
+}
+
+function showError(message) {
+    const resultDiv = document.getElementById('result');
+    resultDiv.innerHTML = message ? `<div class="error">${escapeHTML(message)}</div>` : '';
+}
+
+function escapeHTML(value) {
+    return String(value ?? '').replace(/[&<>"']/g, c => ({
+        '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;',
+    })[c]);
+}
+
+document.querySelectorAll('.filters input').forEach(input => {
+    input.addEventListener('keydown', event => {
+        if (event.key === 'Enter') {
+            applyFilters();
+subscribe();
+        }
+    });
+});
+
+applyFilters();
+subscribe();
@@ -14,22 +14,30 @@ async function getOrder() {
         }
 
         const order = await response.json();
-        renderOrder(order);
+        renderOrder(order, response.headers.get('X-Order-Source'));
     } catch (error) {
         console.error('Ошибка:', error);
         showResult('error', `Не удалось загрузить заказ: ${error.message}`);
     }
 }
 
-function renderOrder(order) {
+// Откуда сервис прочитал заказ (заголовок X-Order-Source)
+const orderSources = {
+    local: ['Кеш сервиса', 'source-cache'],
+    redis: ['Кеш Redis', 'source-cache'],
+    db: ['База данных', 'source-db'],
+};
+
+function renderOrder(order, source) {
     const resultDiv = document.getElementById('result');
 
     // Форматирование даты
     const dateCreated = new Date(order.date_created).toLocaleString();
+    const [sourceTitle, sourceClass] = orderSources[source] || ['Неизвестно', 'source-db'];
 
     let html = `
         <div class="order-section">
-            <h2>Заказ #${order.order_uid}</h2>
+            <h2>Заказ #${order.order_uid} <span class="source ${sourceClass}">${sourceTitle}</span></h2>
             <p><strong>Трек-номер:</strong> ${order.track_number}</p>
             <p><strong>Дата создания:</strong> ${dateCreated}</p>
             <p><strong>Клиент:</strong> ${order.customer_id}</p>
@@ -45,7 +53,8 @@ function renderOrder(order) {
         
         <div class="order-section">
             <h3>Оплата</h3>
-            <p><strong>Сумма:</strong> ${order.payment.amount} ${order.payment.currency}</p>
+            <p><strong>Сумма:</strong> ${order.payment.amount_formatted}</p>
+            <p><strong>Товары:</strong> ${order.payment.goods_total_formatted}, <strong>доставка:</strong> ${order.payment.delivery_cost_formatted}</p>
             <p><strong>Провайдер:</strong> ${order.payment.provider}</p>
             <p><strong>Банк:</strong> ${order.payment.bank}</p>
         </div>
@@ -59,7 +68,7 @@ function renderOrder(order) {
         html += `
             <div class="item-card">
                 <p><strong>${item.name}</strong></p>
-                <p>Цена: $${item.price}</p>
+                <p>Цена: ${item.price_formatted}</p>
                 <p>Бренд: ${item.brand}</p>
                 <p>Артикул: ${item.chrt_id}</p>
             </div>
@@ -83,4 +92,12 @@ function showResult(type, message) {
     else if (type === 'error') {
         resultDiv.innerHTML = `<div class="error">${message}</div>`;
     }
-}
\ No newline at end of file
+}
+// the order list links here with ?order_uid=<uid>
+document.addEventListener('DOMContentLoaded', () => {
+    const orderId = new URLSearchParams(window.location.search).get('order_uid');
+    if (orderId) {
+        document.getElementById('orderId').value = orderId;
+        getOrder();
+    }
+});
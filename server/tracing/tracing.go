@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry for the service and the producer: spans are exported over OTLP/HTTP
+// and the W3C trace context travels in HTTP and Kafka headers, so the trace of an order goes from
+// its generation in the producer through the consumer and storage.
+package tracing
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OrderUIDKey is the attribute of the order a span works on; searching spans by it finds
+// the publishing, processing and reads of one order
+const OrderUIDKey = attribute.Key("order.uid")
+
+// Init installs the global tracer provider of service exporting spans to cfg.Endpoint and
+// the trace context propagator. Without cfg.Enabled no spans are recorded, but the trace context
+// received in headers is still passed on. The returned shutdown flushes the buffered spans.
+func Init(ctx context.Context, service string, cfg models.TracingCfg) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: can't create OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+		// a trace started upstream (e.g. by the producer) is recorded if its parent was
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of a part of the service. It may be created before Init:
+// the global provider passes its spans to the provider installed later.
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer("WB_LVL0/" + component)
+}
+
+// OrderUID is the attribute of the order a span works on
+func OrderUID(uid string) attribute.KeyValue {
+	return OrderUIDKey.String(uid)
+}
+
+// End ends span recording err as its failure. Not found errors are answers, not failures.
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the trace ID of the span in ctx, empty if there is none
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Inject writes the trace context of ctx into the headers of msg
+func Inject(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &msg.Headers})
+}
+
+// Extract returns ctx continuing the trace whose context is in the headers of msg
+func Extract(ctx context.Context, msg kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier{headers: &msg.Headers})
+}
+
+// headerCarrier adapts Kafka message headers to the propagators
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the header, a republished message (DLQ, replay) must not carry two parents
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"WB_LVL0/server/models"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestKafkaPropagation(t *testing.T) {
+	_, err := Init(context.Background(), "test", models.TracingCfg{})
+	require.NoError(t, err)
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	msg := kafka.Message{Headers: []kafka.Header{{Key: "traceparent", Value: []byte("stale")}}}
+	Inject(ctx, &msg)
+	// the header of a republished message is replaced, not duplicated
+	require.Len(t, msg.Headers, 1)
+	require.Equal(t, span.SpanContext().TraceID().String(), TraceID(Extract(context.Background(), msg)))
+
+	require.Empty(t, TraceID(Extract(context.Background(), kafka.Message{})))
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "failed")
+	End(span, errors.New("connection refused"))
+	_, span = tracer.Start(context.Background(), "not found")
+	End(span, fmt.Errorf("order %w", models.ErrNotFound))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"WB_LVL0/producer/generator"
+	"WB_LVL0/producer/stats"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Soak test: drives the producer side (Kafka) at a fixed rate and hammers the HTTP API
+// with randomized reads at the same time, periodically reporting latencies and errors of both.
+func main() {
+	broker := flag.String("broker", "localhost:9092", "Kafka broker address")
+	topic := flag.String("topic", "orders", "Kafka topic of orders")
+	api := flag.String("api", "http://localhost:8081", "base URL of the order API")
+	rate := flag.Float64("rate", 50, "orders produced per second")
+	readers := flag.Int("readers", 8, "concurrent HTTP readers")
+	readRate := flag.Float64("read-rate", 200, "total HTTP reads per second")
+	missRatio := flag.Float64("miss-ratio", 0.1, "share of reads for unknown order UIDs")
+	duration := flag.Duration("duration", time.Hour, "total run time")
+	reportEvery := flag.Duration("report", time.Minute, "interval of intermediate reports")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(*broker),
+		Topic:        *topic,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 5 * time.Millisecond,
+	}
+	defer writer.Close()
+
+	produced := stats.NewRecorder()
+	readsFound := stats.NewRecorder()
+	readsMissing := stats.NewRecorder()
+	uids := &uidPool{}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		produce(ctx, writer, *rate, uids, produced)
+	}()
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticks := ticker(ctx, *readRate)
+	for i := 0; i < *readers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for range ticks {
+				if uid, ok := uids.random(r); ok && r.Float64() >= *missRatio {
+					readsFound.Record(read(ctx, client, *api, uid, http.StatusOK))
+				} else {
+					readsMissing.Record(read(ctx, client, *api, uuid.NewString(), http.StatusBadRequest))
+				}
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	report := time.NewTicker(*reportEvery)
+	defer report.Stop()
+	fmt.Printf("Soak test started: rate=%.1f/s reads=%.1f/s for %v\n", *rate, *readRate, *duration)
+loop:
+	for {
+		select {
+		case <-report.C:
+			printReport("interim", produced, readsFound, readsMissing)
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	wg.Wait()
+	printReport("final", produced, readsFound, readsMissing)
+}
+
+func printReport(kind string, produced, found, missing *stats.Recorder) {
+	fmt.Printf("=== %s report ===\n", kind)
+	fmt.Printf("produce:       %s\n", produced.Summary())
+	fmt.Printf("read existing: %s\n", found.Summary())
+	fmt.Printf("read unknown:  %s\n", missing.Summary())
+}
+
+// ticker emits ticks at the given rate until ctx is done
+func ticker(ctx context.Context, perSecond float64) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(time.Duration(float64(time.Second) / perSecond))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				select {
+				case ch <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func produce(ctx context.Context, writer *kafka.Writer, rate float64, uids *uidPool, rec *stats.Recorder) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for range ticker(ctx, rate) {
+		order := generator.RandomOrder(r)
+		data, err := json.Marshal(order)
+		if err != nil {
+			log.Printf("marshal order: %v", err)
+			continue
+		}
+		start := time.Now()
+		err = writer.WriteMessages(ctx, kafka.Message{Key: []byte(order.OrderUID), Value: data})
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		rec.Record(time.Since(start), err)
+		if err == nil {
+			uids.add(order.OrderUID)
+		}
+	}
+}
+
+// read fetches an order and treats any status other than want as an error
+func read(ctx context.Context, client *http.Client, api, uid string, want int) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/order/"+uid, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != want {
+		return 0, errors.New(resp.Status)
+	}
+	return time.Since(start), nil
+}
+
+// uidPool keeps produced order UIDs for random reads
+type uidPool struct {
+	mu   sync.RWMutex
+	uids []string
+}
+
+func (p *uidPool) add(uid string) {
+	p.mu.Lock()
+	p.uids = append(p.uids, uid)
+	p.mu.Unlock()
+}
+
+func (p *uidPool) random(r *rand.Rand) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.uids) == 0 {
+		return "", false
+	}
+	return p.uids[r.Intn(len(p.uids))], true
+}